@@ -28,4 +28,12 @@ const (
 	AllowAndDenyEffect    = "some(where (p_eft == allow)) && !some(where (p_eft == deny))"
 	PriorityEffect        = "priority(p_eft) || deny"
 	SubjectPriorityEffect = "subjectPriority(p_eft) || deny"
+	// PriorityDenyOverrideEffect decides by the matching rules of the highest priority, where a deny wins
+	// over an allow of the same priority regardless of their order.
+	PriorityDenyOverrideEffect = "priority(p_eft) || deny-override"
+	// AllOfEffect allows a request only if at least one rule matches and all matching rules allow it.
+	AllOfEffect = "all(where (p_eft == allow))"
+	// SpecificityEffect decides by the most specific matching rules, i.e. those with the most fields without
+	// a wildcard, where a deny wins over an allow of the same specificity. It denies if no rule matches.
+	SpecificityEffect = "specificity(p_eft) || deny"
 )
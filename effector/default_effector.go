@@ -101,6 +101,58 @@ func (e *DefaultEffector) MergeEffects(expr string, effects []Effect, matches []
 				break
 			}
 		}
+	case constant.PriorityDenyOverrideEffect:
+		// the enforcer only merges at the last rule of each priority, the rules of higher priorities
+		// did not match with an allow or deny effect, otherwise it would have stopped there.
+		for i := 0; i <= policyIndex; i++ {
+			if matches[i] == 0 {
+				continue
+			}
+			if effects[i] == Deny {
+				result = Deny
+				explainIndex = i
+				break
+			}
+			if effects[i] == Allow && result != Allow {
+				result = Allow
+				explainIndex = i
+			}
+		}
+	case constant.AllOfEffect:
+		// short-circuit if a matched rule does not allow
+		if matches[policyIndex] != 0 && effects[policyIndex] != Allow {
+			result = Deny
+			explainIndex = policyIndex
+			break
+		}
+		if policyIndex < policyLength-1 {
+			return result, explainIndex, nil
+		}
+		// all matched rules allow, allow if there is any
+		for i := range effects {
+			if matches[i] != 0 {
+				result = Allow
+				// set hit rule to first matched allow rule
+				explainIndex = i
+				break
+			}
+		}
+	case constant.SpecificityEffect:
+		// the enforcer sets the match of a matched rule to its specificity plus one, all rules are merged at last
+		if policyIndex < policyLength-1 {
+			return result, explainIndex, nil
+		}
+		var specificity float64
+		for i, eft := range effects {
+			if matches[i] == 0 || eft == Indeterminate {
+				continue
+			}
+			if matches[i] > specificity || (matches[i] == specificity && eft == Deny && result != Deny) {
+				specificity = matches[i]
+				result = eft
+				explainIndex = i
+			}
+		}
 	default:
 		return Deny, -1, errors.New("unsupported effect")
 	}
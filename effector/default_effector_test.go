@@ -0,0 +1,80 @@
+// Copyright 2023 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package effector
+
+import (
+	"testing"
+
+	"github.com/ApicaSystem/casbin/v2/constant"
+)
+
+// merge merges the effects like the enforcer does, rule by rule until the result is determined.
+func merge(t *testing.T, expr string, effects []Effect, matches []float64) (Effect, int) {
+	t.Helper()
+	e := NewDefaultEffector()
+	result, explainIndex := Indeterminate, -1
+	for i := range effects {
+		var err error
+		result, explainIndex, err = e.MergeEffects(expr, effects, matches, i, len(effects))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result != Indeterminate {
+			break
+		}
+	}
+	return result, explainIndex
+}
+
+func TestMergeEffects(t *testing.T) {
+	tests := []struct {
+		name         string
+		expr         string
+		effects      []Effect
+		matches      []float64
+		result       Effect
+		explainIndex int
+	}{
+		{"allow-override", constant.AllowOverrideEffect, []Effect{Allow, Allow}, []float64{0, 1}, Allow, 1},
+		{"allow-override no match", constant.AllowOverrideEffect, []Effect{Allow}, []float64{0}, Indeterminate, -1},
+		{"deny-override deny", constant.DenyOverrideEffect, []Effect{Allow, Deny}, []float64{1, 1}, Deny, 1},
+		// an allow of deny-override is not explained by a rule, even a matched allow rule.
+		{"deny-override allow", constant.DenyOverrideEffect, []Effect{Deny, Allow, Allow}, []float64{0, 0, 1}, Allow, -1},
+		{"deny-override no match", constant.DenyOverrideEffect, []Effect{Allow, Deny}, []float64{0, 0}, Allow, -1},
+		{"allow-and-deny", constant.AllowAndDenyEffect, []Effect{Allow, Deny}, []float64{1, 1}, Deny, 1},
+		{"all-of allow", constant.AllOfEffect, []Effect{Allow, Deny, Allow}, []float64{1, 0, 1}, Allow, 0},
+		{"all-of deny", constant.AllOfEffect, []Effect{Allow, Deny}, []float64{1, 1}, Deny, 1},
+		{"all-of no match", constant.AllOfEffect, []Effect{Allow}, []float64{0}, Indeterminate, -1},
+		// with specificity, matches are the specificity of the matched rules plus one.
+		{"specificity", constant.SpecificityEffect, []Effect{Deny, Allow}, []float64{2, 3}, Allow, 1},
+		{"specificity tie", constant.SpecificityEffect, []Effect{Allow, Deny}, []float64{3, 3}, Deny, 1},
+	}
+	for _, tt := range tests {
+		result, explainIndex := merge(t, tt.expr, tt.effects, tt.matches)
+		if result != tt.result || explainIndex != tt.explainIndex {
+			t.Errorf("%s: %d, %d, supposed to be %d, %d", tt.name, result, explainIndex, tt.result, tt.explainIndex)
+		}
+	}
+
+	// with deny-override priorities, the rules of a priority are merged together at its last rule.
+	result, explainIndex, err := NewDefaultEffector().MergeEffects(constant.PriorityDenyOverrideEffect, []Effect{Allow, Deny}, []float64{1, 1}, 1, 2)
+	if err != nil || result != Deny || explainIndex != 1 {
+		t.Errorf("priority deny-override: %d, %d, %v, supposed to be %d, 1", result, explainIndex, err, Deny)
+	}
+
+	if _, _, err := NewDefaultEffector().MergeEffects("unknown", []Effect{Allow}, []float64{1}, 0, 1); err == nil {
+		t.Error("an unsupported effect should be rejected")
+	}
+}
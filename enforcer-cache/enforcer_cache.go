@@ -0,0 +1,144 @@
+// Copyright 2023 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package enforcercache
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ApicaSystem/casbin/v2"
+)
+
+// CachedEnforcer wraps an Enforcer and caches the decisions of Enforce in a sync.Map keyed on the request,
+// so cached decisions are read without locking. Entries expire after the ttl given to NewEnforcerWithCache.
+type CachedEnforcer struct {
+	*casbin.Enforcer
+	ttl     time.Duration
+	entries sync.Map
+	// generation is incremented by every invalidation, decisions evaluated before one are not stored.
+	generation uint64
+	// nextSweep is the time in unix nanoseconds after which expired entries are swept by the next store.
+	nextSweep int64
+}
+
+type entry struct {
+	allowed   bool
+	subject   string
+	expiresAt time.Time
+}
+
+// NewEnforcerWithCache wraps e with a decision cache whose entries expire after ttl, or never if ttl is 0.
+// Policy changes made through e invalidate the whole cache, changes made elsewhere, e.g. reported by a watcher,
+// can be flushed with InvalidateAll or InvalidateForSubject.
+func NewEnforcerWithCache(e *casbin.Enforcer, ttl time.Duration) *CachedEnforcer {
+	ce := &CachedEnforcer{Enforcer: e, ttl: ttl}
+	e.OnPolicyChange(ce.InvalidateAll)
+	return ce
+}
+
+// Enforce decides whether a "subject" can access a "object" with the operation "action", input parameters are
+// usually: (sub, obj, act). Requests with values other than strings and casbin.CacheableParam are not cached.
+func (e *CachedEnforcer) Enforce(rvals ...interface{}) (bool, error) {
+	key, ok := casbin.GetCacheKey(rvals...)
+	if !ok {
+		return e.Enforcer.Enforce(rvals...)
+	}
+
+	if v, ok := e.entries.Load(key); ok {
+		ent := v.(entry)
+		if ent.expiresAt.IsZero() || time.Now().Before(ent.expiresAt) {
+			return ent.allowed, nil
+		}
+		e.entries.Delete(key)
+	}
+
+	generation := atomic.LoadUint64(&e.generation)
+	allowed, err := e.Enforcer.Enforce(rvals...)
+	if err != nil {
+		return false, err
+	}
+
+	ent := entry{allowed: allowed, subject: e.subjectOf(rvals)}
+	if e.ttl > 0 {
+		ent.expiresAt = time.Now().Add(e.ttl)
+	}
+	if atomic.LoadUint64(&e.generation) == generation {
+		e.entries.Store(key, ent)
+	}
+	e.sweepExpired()
+	return allowed, nil
+}
+
+// sweepExpired deletes the expired entries at most once per ttl, so entries of requests which are not made again
+// do not pile up.
+func (e *CachedEnforcer) sweepExpired() {
+	if e.ttl <= 0 {
+		return
+	}
+	now := time.Now()
+	next := atomic.LoadInt64(&e.nextSweep)
+	if now.UnixNano() < next || !atomic.CompareAndSwapInt64(&e.nextSweep, next, now.Add(e.ttl).UnixNano()) {
+		return
+	}
+	e.entries.Range(func(key, value interface{}) bool {
+		if ent := value.(entry); !ent.expiresAt.IsZero() && !now.Before(ent.expiresAt) {
+			e.entries.Delete(key)
+		}
+		return true
+	})
+}
+
+// InvalidateAll deletes all the cached decisions.
+func (e *CachedEnforcer) InvalidateAll() {
+	atomic.AddUint64(&e.generation, 1)
+	e.entries.Range(func(key, _ interface{}) bool {
+		e.entries.Delete(key)
+		return true
+	})
+}
+
+// InvalidateForSubject deletes the cached decisions of the requests of sub, e.g. from a watcher callback after the
+// roles of sub changed, the decisions of other subjects are kept. The subject of a request is its r.sub value,
+// decisions of requests without one are only deleted by InvalidateAll.
+func (e *CachedEnforcer) InvalidateForSubject(sub string) {
+	atomic.AddUint64(&e.generation, 1)
+	e.entries.Range(func(key, value interface{}) bool {
+		if ent := value.(entry); ent.subject != "" && ent.subject == sub {
+			e.entries.Delete(key)
+		}
+		return true
+	})
+}
+
+// subjectOf returns the r.sub value of the request rvals, "" if the request definition has no sub token.
+func (e *CachedEnforcer) subjectOf(rvals []interface{}) string {
+	ast, ok := e.GetModel()["r"]["r"]
+	if !ok {
+		return ""
+	}
+	for i, token := range ast.Tokens {
+		if token != "r_sub" || i >= len(rvals) {
+			continue
+		}
+		switch sub := rvals[i].(type) {
+		case string:
+			return sub
+		case casbin.CacheableParam:
+			return sub.GetCacheKey()
+		}
+	}
+	return ""
+}
@@ -0,0 +1,116 @@
+// Copyright 2023 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package enforcercache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ApicaSystem/casbin/v2"
+	"github.com/ApicaSystem/casbin/v2/model"
+)
+
+func testEnforce(t *testing.T, e *CachedEnforcer, sub, obj, act string, res bool) {
+	t.Helper()
+	if myRes, err := e.Enforce(sub, obj, act); err != nil {
+		t.Errorf("Enforce Error: %s", err)
+	} else if myRes != res {
+		t.Errorf("%s, %s, %s: %t, supposed to be %t", sub, obj, act, myRes, res)
+	}
+}
+
+func isCached(e *CachedEnforcer, rvals ...interface{}) bool {
+	key, _ := casbin.GetCacheKey(rvals...)
+	_, ok := e.entries.Load(key)
+	return ok
+}
+
+func TestNewEnforcerWithCache(t *testing.T) {
+	base, _ := casbin.NewEnforcer("../examples/rbac_model.conf", "../examples/rbac_policy.csv")
+	base.EnableAutoSave(false)
+	e := NewEnforcerWithCache(base, 0)
+
+	testEnforce(t, e, "alice", "data2", "read", true)
+	testEnforce(t, e, "bob", "data2", "write", true)
+
+	e.InvalidateForSubject("alice")
+	if isCached(e, "alice", "data2", "read") {
+		t.Error("alice's decision should have been invalidated")
+	}
+	if !isCached(e, "bob", "data2", "write") {
+		t.Error("bob's decision should still be cached")
+	}
+
+	// changes made through the wrapped enforcer invalidate the cache too.
+	testEnforce(t, e, "alice", "data2", "read", true)
+	_, _ = base.RemoveGroupingPolicy("alice", "data2_admin")
+	if isCached(e, "bob", "data2", "write") {
+		t.Error("the cache should have been invalidated by the policy change")
+	}
+	testEnforce(t, e, "alice", "data2", "read", false)
+
+	e.InvalidateAll()
+	if isCached(e, "alice", "data2", "read") {
+		t.Error("all decisions should have been invalidated")
+	}
+}
+
+func TestEnforcerWithCacheExpiry(t *testing.T) {
+	base, _ := casbin.NewEnforcer("../examples/rbac_model.conf", "../examples/rbac_policy.csv")
+	e := NewEnforcerWithCache(base, time.Millisecond)
+
+	testEnforce(t, e, "alice", "data1", "read", true)
+	time.Sleep(5 * time.Millisecond)
+	// storing a decision sweeps the expired ones, also of requests which are not made again.
+	testEnforce(t, e, "bob", "data2", "write", true)
+	if isCached(e, "alice", "data1", "read") {
+		t.Error("alice's decision should have expired")
+	}
+	if !isCached(e, "bob", "data2", "write") {
+		t.Error("bob's decision should be cached")
+	}
+}
+
+func TestEnforcerWithCacheSubjectToken(t *testing.T) {
+	m, _ := model.NewModelFromString(`
+[request_definition]
+r = obj, sub, act
+
+[policy_definition]
+p = sub, obj, act
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = r.sub == p.sub && r.obj == p.obj && r.act == p.act
+`)
+	base, _ := casbin.NewEnforcer(m)
+	_, _ = base.AddPolicy("alice", "data1", "read")
+	e := NewEnforcerWithCache(base, 0)
+
+	if ok, _ := e.Enforce("data1", "alice", "read"); !ok {
+		t.Error("alice should be allowed to read data1")
+	}
+	// the subject is the r.sub value, not the first one.
+	e.InvalidateForSubject("data1")
+	if !isCached(e, "data1", "alice", "read") {
+		t.Error("alice's decision should not be invalidated for subject data1")
+	}
+	e.InvalidateForSubject("alice")
+	if isCached(e, "data1", "alice", "read") {
+		t.Error("alice's decision should have been invalidated")
+	}
+}
@@ -15,13 +15,21 @@
 package casbin
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io/ioutil"
+	"reflect"
 	"runtime/debug"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/ApicaSystem/casbin/v2/constant"
 	"github.com/ApicaSystem/casbin/v2/effector"
+	Err "github.com/ApicaSystem/casbin/v2/errors"
 	"github.com/ApicaSystem/casbin/v2/log"
 	"github.com/ApicaSystem/casbin/v2/model"
 	"github.com/ApicaSystem/casbin/v2/persist"
@@ -36,6 +44,10 @@ import (
 // Enforcer is the main interface for authorization enforcement and policy management.
 type Enforcer struct {
 	modelPath string
+	// modelName is the name of the model reported to the observer set with SetObserver, see SetModelName.
+	modelName string
+	// modelText is the text the model was loaded from, see GetModelText.
+	modelText string
 	model     model.Model
 	fm        model.FunctionMap
 	eft       effector.Effector
@@ -46,6 +58,8 @@ type Enforcer struct {
 	rmMap      map[string]rbac.RoleManager
 	condRmMap  map[string]rbac.ConditionalRoleManager
 	matcherMap sync.Map
+	// policyValues caches the results of policyValues by policyValuesKey until the policy changes.
+	policyValues sync.Map
 
 	enabled              bool
 	autoSave             bool
@@ -53,10 +67,97 @@ type Enforcer struct {
 	autoNotifyWatcher    bool
 	autoNotifyDispatcher bool
 	acceptJsonRequest    bool
+	rejectNilRequest     bool
+	syncedRoleManager    bool
+	lenientArity         bool
+	domainGlob           bool
+
+	evalBudget time.Duration
+	// observers are notified at the end of every enforce call, each setter has its own slot so that they are
+	// notified together, see notifyObservers.
+	observers       [observerSlots]EnforceObserver
+	flagProvider    func(name string) bool
+	middlewares     []func(next EnforceFunc) EnforceFunc
+	fallbackMatcher string
+	asyncFunctions  map[string]AsyncExpressionFunction
+	objNormalizer   func(string) string
+	// durationMatchFunc is the durationMatch matcher function, also named scheduleMatch, bound to the clock set
+	// with SetClock.
+	durationMatchFunc govaluate.ExpressionFunction
+	// policyValidators are the validators of the rules added or updated, by ptype, see AddPolicyValidator.
+	policyValidators map[string][]func(rule []string) error
+	// onPolicyChange are called after every change of the in-memory policy, e.g. to drop cached decisions.
+	onPolicyChange []func()
 
 	logger log.Logger
 }
 
+// The slots of Enforcer.observers.
+const (
+	enforceObserverSlot = iota
+	modelObserverSlot
+	decisionSinkSlot
+	observerSlots
+)
+
+// EnforceObserver is notified at the end of every enforce call with the request, the decision and its latency,
+// e.g. to collect metrics. See the observe package for an implementation.
+type EnforceObserver interface {
+	ObserveEnforce(req []interface{}, allowed bool, dur time.Duration)
+}
+
+// EnforceErrorObserver is an EnforceObserver also notified of the enforce calls failing with an error, which are
+// observed as denied decisions otherwise.
+type EnforceErrorObserver interface {
+	EnforceObserver
+	ObserveEnforceError(req []interface{}, err error, dur time.Duration)
+}
+
+// EnforcerObserver is notified at the end of every enforce call with the decision, its latency and the model
+// name, e.g. to export metrics labelled by model. See SetObserver.
+type EnforcerObserver interface {
+	ObserveEnforce(allowed bool, duration time.Duration, model string)
+}
+
+// modelObserver adapts an EnforcerObserver to EnforceObserver.
+type modelObserver struct {
+	e   *Enforcer
+	obs EnforcerObserver
+}
+
+func (o modelObserver) ObserveEnforce(req []interface{}, allowed bool, dur time.Duration) {
+	o.obs.ObserveEnforce(allowed, dur, o.e.GetModelName())
+}
+
+// ruleObserver is an EnforceObserver also given the policy rule that decided the request, nil if none did.
+// Calls failing with an error are not observed.
+type ruleObserver interface {
+	EnforceObserver
+	observeRule(req []interface{}, rule []string, allowed bool, dur time.Duration)
+}
+
+// sinkObserver adapts a log.DecisionSink to EnforceObserver.
+type sinkObserver struct {
+	sink log.DecisionSink
+}
+
+func (o sinkObserver) ObserveEnforce(req []interface{}, allowed bool, dur time.Duration) {
+	o.observeRule(req, nil, allowed, dur)
+}
+
+func (o sinkObserver) observeRule(req []interface{}, rule []string, allowed bool, dur time.Duration) {
+	o.sink.WriteDecision(log.DecisionRecord{
+		Time:        time.Now().Add(-dur),
+		Request:     append([]interface{}(nil), req...),
+		MatchedRule: rule,
+		Allowed:     allowed,
+		Latency:     dur,
+	})
+}
+
+// EnforceFunc decides a request, see Enforce. It is the unit wrapped by enforce middlewares.
+type EnforceFunc func(rvals ...interface{}) (bool, error)
+
 // EnforceContext is used as the first element of the parameter "rvals" in method "enforce".
 type EnforceContext struct {
 	RType string
@@ -80,14 +181,14 @@ func (e EnforceContext) GetCacheKey() string {
 //	a := mysqladapter.NewDBAdapter("mysql", "mysql_username:mysql_password@tcp(127.0.0.1:3306)/")
 //	e := casbin.NewEnforcer("path/to/basic_model.conf", a)
 func NewEnforcer(params ...interface{}) (*Enforcer, error) {
-	e := &Enforcer{logger: &log.DefaultLogger{}}
+	cfg := EnforcerConfig{}
 
 	parsedParamLen := 0
 	paramLen := len(params)
 	if paramLen >= 1 {
 		enableLog, ok := params[paramLen-1].(bool)
 		if ok {
-			e.EnableLog(enableLog)
+			cfg.EnableLog = enableLog
 			parsedParamLen++
 		}
 	}
@@ -95,7 +196,7 @@ func NewEnforcer(params ...interface{}) (*Enforcer, error) {
 	if paramLen-parsedParamLen >= 1 {
 		logger, ok := params[paramLen-parsedParamLen-1].(log.Logger)
 		if ok {
-			e.logger = logger
+			cfg.Logger = logger
 			parsedParamLen++
 		}
 	}
@@ -104,48 +205,105 @@ func NewEnforcer(params ...interface{}) (*Enforcer, error) {
 	case 2:
 		switch p0 := params[0].(type) {
 		case string:
+			cfg.ModelPath = p0
 			switch p1 := params[1].(type) {
 			case string:
-				err := e.InitWithFile(p0, p1)
-				if err != nil {
-					return nil, err
-				}
+				cfg.PolicyPath = p1
 			default:
-				err := e.InitWithAdapter(p0, p1.(persist.Adapter))
-				if err != nil {
-					return nil, err
-				}
+				cfg.Adapter = p1.(persist.Adapter)
 			}
 		default:
 			switch params[1].(type) {
 			case string:
 				return nil, errors.New("invalid parameters for enforcer")
 			default:
-				err := e.InitWithModelAndAdapter(p0.(model.Model), params[1].(persist.Adapter))
-				if err != nil {
-					return nil, err
-				}
+				cfg.Model = p0.(model.Model)
+				cfg.Adapter = params[1].(persist.Adapter)
 			}
 		}
 	case 1:
 		switch p0 := params[0].(type) {
 		case string:
-			err := e.InitWithFile(p0, "")
-			if err != nil {
-				return nil, err
-			}
+			cfg.ModelPath = p0
 		default:
-			err := e.InitWithModelAndAdapter(p0.(model.Model), nil)
-			if err != nil {
-				return nil, err
-			}
+			cfg.Model = p0.(model.Model)
 		}
 	case 0:
-		return e, nil
 	default:
 		return nil, errors.New("invalid parameters for enforcer")
 	}
 
+	return NewEnforcerFromConfig(cfg)
+}
+
+// EnforcerConfig holds the options of NewEnforcerFromConfig.
+type EnforcerConfig struct {
+	// Model is the model of the enforcer. If it is nil, the model is parsed from ModelText, or else read from ModelPath.
+	Model     model.Model
+	ModelText string
+	ModelPath string
+
+	// Adapter is the policy storage. If it is nil and the model is not given as Model, a file adapter reading
+	// PolicyPath is used, the policy is empty if PolicyPath is empty too.
+	Adapter    persist.Adapter
+	PolicyPath string
+
+	// Logger replaces the default logger, EnableLog enables logging.
+	Logger    log.Logger
+	EnableLog bool
+
+	// DisableAutoBuildRoleLinks stops the role links from being built when the policy is loaded or changed,
+	// see EnableAutoBuildRoleLinks. They are built by default, like with NewEnforcer.
+	DisableAutoBuildRoleLinks bool
+}
+
+// NewEnforcerFromConfig creates an enforcer from the given options, loading the policy from the adapter.
+// An enforcer created without a model has to be initialized with one of the Init methods before use.
+//
+//	e, err := casbin.NewEnforcerFromConfig(casbin.EnforcerConfig{
+//		ModelPath: "path/to/basic_model.conf",
+//		Adapter:   a,
+//	})
+func NewEnforcerFromConfig(cfg EnforcerConfig) (*Enforcer, error) {
+	e := &Enforcer{logger: &log.DefaultLogger{}}
+	if cfg.Logger != nil {
+		e.logger = cfg.Logger
+	}
+	if cfg.EnableLog {
+		e.EnableLog(true)
+	}
+
+	m := cfg.Model
+	var err error
+	switch {
+	case m != nil:
+	case cfg.ModelText != "":
+		m, err = model.NewModelFromString(cfg.ModelText)
+	case cfg.ModelPath != "":
+		m, err = model.NewModelFromFile(cfg.ModelPath)
+	default:
+		return e, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	adapter := cfg.Adapter
+	if adapter == nil && (cfg.Model == nil || cfg.PolicyPath != "") {
+		adapter = fileadapter.NewAdapter(cfg.PolicyPath)
+	}
+
+	if err = e.initWithModelAndAdapter(m, adapter, !cfg.DisableAutoBuildRoleLinks); err != nil {
+		return nil, err
+	}
+
+	e.modelPath = cfg.ModelPath
+	if cfg.Model == nil {
+		e.modelText = cfg.ModelText
+		if e.modelText == "" {
+			e.modelText = readModelText(cfg.ModelPath)
+		}
+	}
 	return e, nil
 }
 
@@ -168,19 +326,29 @@ func (e *Enforcer) InitWithAdapter(modelPath string, adapter persist.Adapter) er
 	}
 
 	e.modelPath = modelPath
+	e.modelText = readModelText(modelPath)
 	return nil
 }
 
 // InitWithModelAndAdapter initializes an enforcer with a model and a database adapter.
 func (e *Enforcer) InitWithModelAndAdapter(m model.Model, adapter persist.Adapter) error {
+	return e.initWithModelAndAdapter(m, adapter, true)
+}
+
+func (e *Enforcer) initWithModelAndAdapter(m model.Model, adapter persist.Adapter, autoBuildRoleLinks bool) error {
 	e.adapter = adapter
+	e.modelText = ""
 
 	e.model = m
 	m.SetLogger(e.logger)
+	if e.lenientArity {
+		m.SetStrictArity(false)
+	}
 	e.model.PrintModel()
 	e.fm = model.LoadFunctionMap()
 
 	e.initialize()
+	e.autoBuildRoleLinks = autoBuildRoleLinks
 
 	// Do not initialize the full policy when using a filtered adapter
 	fa, ok := e.adapter.(persist.FilteredAdapter)
@@ -194,7 +362,17 @@ func (e *Enforcer) InitWithModelAndAdapter(m model.Model, adapter persist.Adapte
 	return nil
 }
 
-// SetLogger changes the current enforcer's logger.
+// NormalizePriorityOrder stably sorts the policy rules of every policy type with a priority field by priority.
+// Rules are sorted when the policy is loaded and added, but updating the priority of a rule keeps its position,
+// and rules with equal priority are evaluated in storage order. Call it after such changes so that the
+// in-memory order matches the priority semantics again.
+func (e *Enforcer) NormalizePriorityOrder() error {
+	defer e.policyChanged()
+	return e.model.SortPoliciesByPriority()
+}
+
+// SetLogger changes the current enforcer's logger. If the logger implements log.StructuredLogger, enforce
+// results are logged as key-value fields through LogEnforceResult.
 func (e *Enforcer) SetLogger(logger log.Logger) {
 	e.logger = logger
 	e.model.SetLogger(e.logger)
@@ -219,6 +397,7 @@ func (e *Enforcer) initialize() {
 	e.autoNotifyWatcher = true
 	e.autoNotifyDispatcher = true
 	e.initRmMap()
+	e.policyChanged()
 }
 
 // LoadModel reloads the model from the model CONF file.
@@ -229,7 +408,11 @@ func (e *Enforcer) LoadModel() error {
 	if err != nil {
 		return err
 	}
+	e.modelText = readModelText(e.modelPath)
 	e.model.SetLogger(e.logger)
+	if e.lenientArity {
+		e.model.SetStrictArity(false)
+	}
 
 	e.model.PrintModel()
 	e.fm = model.LoadFunctionMap()
@@ -247,12 +430,99 @@ func (e *Enforcer) GetModel() model.Model {
 // SetModel sets the current model.
 func (e *Enforcer) SetModel(m model.Model) {
 	e.model = m
+	e.modelText = ""
 	e.fm = model.LoadFunctionMap()
 
 	e.model.SetLogger(e.logger)
 	e.initialize()
 }
 
+// GetModelText returns the text of the current model. If the model was loaded from a CONF file or text, that text is
+// returned as is, with its comments and the original spelling of the effect, otherwise it is generated with ToText.
+func (e *Enforcer) GetModelText() string {
+	if e.modelText != "" {
+		return e.modelText
+	}
+	return e.model.ToText()
+}
+
+// SetModelFromText replaces the model by the one defined in text, e.g. to hot-reload a changed model.
+// Unlike SetModel, the enforcer keeps its settings, watcher and functions, and the rules of every policy type
+// defined in both models are kept. The role links are rebuilt if auto-building is enabled.
+func (e *Enforcer) SetModelFromText(text string) error {
+	m, err := model.NewModelFromString(text)
+	if err != nil {
+		return err
+	}
+	m.SetLogger(e.logger)
+	if e.lenientArity {
+		m.SetStrictArity(false)
+	}
+
+	for _, sec := range []string{"p", "g"} {
+		for ptype, ast := range e.model[sec] {
+			newAst, ok := m[sec][ptype]
+			if !ok {
+				continue
+			}
+			if len(newAst.Tokens) != len(ast.Tokens) && len(ast.Policy) != 0 {
+				return fmt.Errorf("the fields of %s changed, its rules cannot be kept", ptype)
+			}
+			if err = m.AddPolicies(sec, ptype, ast.Policy); err != nil {
+				return err
+			}
+		}
+	}
+
+	// role managers are kept for role definitions of the same shape, so their matching functions are kept too.
+	for ptype, ast := range e.model["g"] {
+		newAst, ok := m["g"][ptype]
+		if ok && len(newAst.Tokens) == len(ast.Tokens) && len(newAst.ParamsTokens) == len(ast.ParamsTokens) {
+			continue
+		}
+		delete(e.rmMap, ptype)
+		delete(e.condRmMap, ptype)
+	}
+
+	e.model = m
+	e.modelText = text
+	e.bindRoleManagers(m)
+	// kept conditional role managers already hold the links of the kept rules, they are not rebuilt so the
+	// link condition functions added to them are kept as well.
+	newCondRmMap := map[string]rbac.ConditionalRoleManager{}
+	for ptype, assertion := range m["g"] {
+		_, ok := e.rmMap[ptype]
+		if _, condOk := e.condRmMap[ptype]; ok || condOk {
+			continue
+		}
+		e.newRoleManager(ptype, assertion)
+		if crm, ok := e.condRmMap[ptype]; ok {
+			newCondRmMap[ptype] = crm
+		}
+	}
+	e.invalidateMatcherMap()
+	defer e.policyChanged()
+	if e.autoBuildRoleLinks {
+		if err = e.BuildRoleLinks(); err != nil {
+			return err
+		}
+		return m.BuildConditionalRoleLinks(newCondRmMap)
+	}
+	return nil
+}
+
+// readModelText reads the model CONF file for GetModelText, "" if it cannot be read.
+func readModelText(path string) string {
+	if path == "" {
+		return ""
+	}
+	text, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return string(text)
+}
+
 // GetAdapter gets the current adapter.
 func (e *Enforcer) GetAdapter() persist.Adapter {
 	return e.adapter
@@ -275,6 +545,12 @@ func (e *Enforcer) SetWatcher(watcher persist.Watcher) error {
 	}
 }
 
+// SetWatcherEx sets the current watcher to a WatcherEx, which is told the rules changed by every policy change
+// instead of only being told that the policy changed. It is equivalent to SetWatcher, which also detects WatcherEx.
+func (e *Enforcer) SetWatcherEx(watcher persist.WatcherEx) error {
+	return e.SetWatcher(watcher)
+}
+
 // GetRoleManager gets the current role manager.
 func (e *Enforcer) GetRoleManager() rbac.RoleManager {
 	if e.rmMap != nil && e.rmMap["g"] != nil {
@@ -295,14 +571,22 @@ func (e *Enforcer) GetNamedRoleManager(ptype string) rbac.RoleManager {
 
 // SetRoleManager sets the current role manager.
 func (e *Enforcer) SetRoleManager(rm rbac.RoleManager) {
-	e.invalidateMatcherMap()
-	e.rmMap["g"] = rm
+	e.SetNamedRoleManager("g", rm)
 }
 
 // SetNamedRoleManager sets the role manager for the named policy.
 func (e *Enforcer) SetNamedRoleManager(ptype string, rm rbac.RoleManager) {
 	e.invalidateMatcherMap()
-	e.rmMap[ptype] = rm
+	e.rmMap[ptype] = e.wrapRoleManager(rm)
+	if assertion, ok := e.model["g"][ptype]; ok {
+		assertion.RM = e.rmMap[ptype]
+	}
+}
+
+// OnPolicyChange registers fn to be called after every change of the in-memory policy made through the enforcer,
+// e.g. to drop decisions cached outside of it. fn is called with the locks of the enforcer held.
+func (e *Enforcer) OnPolicyChange(fn func()) {
+	e.onPolicyChange = append(e.onPolicyChange, fn)
 }
 
 // SetEffector sets the current effector.
@@ -319,6 +603,7 @@ func (e *Enforcer) ClearPolicy() {
 		return
 	}
 	e.model.ClearPolicy()
+	e.policyChanged()
 }
 
 // LoadPolicy reloads the policy from file/database.
@@ -334,11 +619,58 @@ func (e *Enforcer) LoadPolicy() error {
 	return nil
 }
 
+// TestLoadPolicy loads the policy from the given adapter into a temporary copy of the model
+// and returns the number of loaded rules, the live policy of the enforcer is left untouched.
+func (e *Enforcer) TestLoadPolicy(a persist.Adapter) (int, error) {
+	if a == nil {
+		return 0, errors.New("adapter cannot be nil")
+	}
+
+	newModel, err := e.loadPolicyFromGivenAdapter(a, e.model)
+	if err != nil {
+		return 0, err
+	}
+
+	ruleCount := 0
+	for _, sec := range []string{"p", "g"} {
+		for _, ast := range newModel[sec] {
+			ruleCount += len(ast.Policy)
+		}
+	}
+	return ruleCount, nil
+}
+
+// SwapAdapterAndReload replaces the adapter with the given one and reloads the policy from it as a single step.
+// If the policy cannot be loaded from the new adapter, the previous adapter and policy are kept and the error is returned.
+func (e *Enforcer) SwapAdapterAndReload(a persist.Adapter) error {
+	if a == nil {
+		return errors.New("adapter cannot be nil")
+	}
+
+	newModel, err := e.loadPolicyFromGivenAdapter(a, e.model)
+	if err != nil {
+		return err
+	}
+
+	oldAdapter, oldModel := e.adapter, e.model
+	e.adapter = a
+	if err = e.applyModifiedModel(newModel); err != nil {
+		e.adapter = oldAdapter
+		_ = e.applyModifiedModel(oldModel)
+		return err
+	}
+	return nil
+}
+
 func (e *Enforcer) loadPolicyFromAdapter(baseModel model.Model) (model.Model, error) {
+	return e.loadPolicyFromGivenAdapter(e.adapter, baseModel)
+}
+
+func (e *Enforcer) loadPolicyFromGivenAdapter(a persist.Adapter, baseModel model.Model) (model.Model, error) {
 	newModel := baseModel.Copy()
 	newModel.ClearPolicy()
 
-	if err := e.adapter.LoadPolicy(newModel); err != nil && err.Error() != "invalid file path, file path cannot be empty" {
+	if err := a.LoadPolicy(newModel); err != nil && err.Error() != "invalid file path, file path cannot be empty" {
 		return nil, err
 	}
 
@@ -364,6 +696,7 @@ func (e *Enforcer) applyModifiedModel(newModel model.Model) error {
 		}
 	}()
 
+	e.bindRoleManagers(newModel)
 	if e.autoBuildRoleLinks {
 		needToRebuild = true
 
@@ -378,19 +711,51 @@ func (e *Enforcer) applyModifiedModel(newModel model.Model) error {
 
 	e.model = newModel
 	e.invalidateMatcherMap()
+	e.policyChanged()
 	return nil
 }
 
+// bindRoleManagers makes the role managers of the enforcer those of the role definitions of newModel, which must
+// not be visible to enforce calls yet.
+func (e *Enforcer) bindRoleManagers(newModel model.Model) {
+	for ptype, ast := range newModel["g"] {
+		if rm, ok := e.rmMap[ptype]; ok {
+			ast.RM = rm
+		}
+		if crm, ok := e.condRmMap[ptype]; ok {
+			ast.CondRM = crm
+		}
+	}
+}
+
+// rebuildRoleLinks rebuilds the role managers from the grouping policy of newModel. Synced role managers are
+// rebuilt aside and swapped in, so concurrent enforce calls never see a partially built role graph.
 func (e *Enforcer) rebuildRoleLinks(newModel model.Model) error {
 	if len(e.rmMap) != 0 {
-		for _, rm := range e.rmMap {
+		rmMap := make(map[string]rbac.RoleManager, len(e.rmMap))
+		for ptype, rm := range e.rmMap {
+			if synced, ok := rm.(*defaultrolemanager.SyncedRoleManager); ok {
+				err := synced.Rebuild(func(fresh rbac.RoleManager) error {
+					if _, ok := newModel["g"][ptype]; !ok {
+						return nil
+					}
+					return newModel.BuildIncrementalRoleLinks(map[string]rbac.RoleManager{ptype: fresh},
+						model.PolicyAdd, "g", ptype, newModel["g"][ptype].Policy)
+				})
+				if err != nil {
+					return err
+				}
+				continue
+			}
+
 			err := rm.Clear()
 			if err != nil {
 				return err
 			}
+			rmMap[ptype] = rm
 		}
 
-		err := newModel.BuildRoleLinks(e.rmMap)
+		err := newModel.BuildRoleLinks(rmMap)
 		if err != nil {
 			return err
 		}
@@ -417,7 +782,14 @@ func (e *Enforcer) rebuildConditionalRoleLinks(newModel model.Model) error {
 }
 
 func (e *Enforcer) loadFilteredPolicy(filter interface{}) error {
+	return e.loadFilteredPolicyWith(func(filteredAdapter persist.FilteredAdapter) error {
+		return filteredAdapter.LoadFilteredPolicy(e.model, filter)
+	})
+}
+
+func (e *Enforcer) loadFilteredPolicyWith(load func(filteredAdapter persist.FilteredAdapter) error) error {
 	e.invalidateMatcherMap()
+	defer e.policyChanged()
 
 	var filteredAdapter persist.FilteredAdapter
 
@@ -428,7 +800,7 @@ func (e *Enforcer) loadFilteredPolicy(filter interface{}) error {
 	default:
 		return errors.New("filtered policies are not supported by this adapter")
 	}
-	if err := filteredAdapter.LoadFilteredPolicy(e.model, filter); err != nil && err.Error() != "invalid file path, file path cannot be empty" {
+	if err := load(filteredAdapter); err != nil && err.Error() != "invalid file path, file path cannot be empty" {
 		return err
 	}
 
@@ -463,6 +835,25 @@ func (e *Enforcer) LoadIncrementalFilteredPolicy(filter interface{}) error {
 	return e.loadFilteredPolicy(filter)
 }
 
+// LoadFilteredPolicies reloads the policy rules matching any of the filters, e.g. one filter per tenant.
+// Adapters implementing persist.BatchFilteredAdapter load all filters in a single round-trip,
+// other filtered adapters are called once per filter.
+func (e *Enforcer) LoadFilteredPolicies(filters []interface{}) error {
+	e.model.ClearPolicy()
+
+	return e.loadFilteredPolicyWith(func(filteredAdapter persist.FilteredAdapter) error {
+		if batchAdapter, ok := filteredAdapter.(persist.BatchFilteredAdapter); ok {
+			return batchAdapter.LoadFilteredPolicies(e.model, filters)
+		}
+		for _, filter := range filters {
+			if err := filteredAdapter.LoadFilteredPolicy(e.model, filter); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
 // IsFiltered returns true if the loaded policy has been filtered.
 func (e *Enforcer) IsFiltered() bool {
 	filteredAdapter, ok := e.adapter.(persist.FilteredAdapter)
@@ -496,28 +887,34 @@ func (e *Enforcer) initRmMap() {
 	for ptype, assertion := range e.model["g"] {
 		if rm, ok := e.rmMap[ptype]; ok {
 			_ = rm.Clear()
+			assertion.RM = rm
 			continue
 		}
-		if len(assertion.Tokens) <= 2 && len(assertion.ParamsTokens) == 0 {
-			assertion.RM = defaultrolemanager.NewRoleManagerImpl(10)
+		e.newRoleManager(ptype, assertion)
+	}
+}
+
+// newRoleManager creates the role manager of the role definition ptype according to its shape.
+func (e *Enforcer) newRoleManager(ptype string, assertion *model.Assertion) {
+	if len(assertion.Tokens) <= 2 && len(assertion.ParamsTokens) == 0 {
+		assertion.RM = e.wrapRoleManager(defaultrolemanager.NewRoleManagerImpl(10))
+		e.rmMap[ptype] = assertion.RM
+	}
+	if len(assertion.Tokens) <= 2 && len(assertion.ParamsTokens) != 0 {
+		assertion.CondRM = defaultrolemanager.NewConditionalRoleManager(10)
+		e.condRmMap[ptype] = assertion.CondRM
+	}
+	if len(assertion.Tokens) > 2 {
+		if len(assertion.ParamsTokens) == 0 {
+			assertion.RM = e.wrapRoleManager(defaultrolemanager.NewRoleManager(10))
 			e.rmMap[ptype] = assertion.RM
-		}
-		if len(assertion.Tokens) <= 2 && len(assertion.ParamsTokens) != 0 {
-			assertion.CondRM = defaultrolemanager.NewConditionalRoleManager(10)
+		} else {
+			assertion.CondRM = defaultrolemanager.NewConditionalDomainManager(10)
 			e.condRmMap[ptype] = assertion.CondRM
 		}
-		if len(assertion.Tokens) > 2 {
-			if len(assertion.ParamsTokens) == 0 {
-				assertion.RM = defaultrolemanager.NewRoleManager(10)
-				e.rmMap[ptype] = assertion.RM
-			} else {
-				assertion.CondRM = defaultrolemanager.NewConditionalDomainManager(10)
-				e.condRmMap[ptype] = assertion.CondRM
-			}
-			matchFun := "keyMatch(r_dom, p_dom)"
-			if strings.Contains(e.model["m"]["m"].Value, matchFun) {
-				e.AddNamedDomainMatchingFunc(ptype, "g", util.KeyMatch)
-			}
+		matchFun := "keyMatch(r_dom, p_dom)"
+		if strings.Contains(e.model["m"]["m"].Value, matchFun) {
+			e.AddNamedDomainMatchingFunc(ptype, "g", util.KeyMatch)
 		}
 	}
 }
@@ -537,6 +934,41 @@ func (e *Enforcer) IsLogEnabled() bool {
 	return e.logger.IsEnabled()
 }
 
+// SetStrictArity controls how policy rules whose field count does not match the policy definition are loaded.
+// Strict, the default, rejects them. Lenient trims trailing empty fields, as emitted by some adapters, and pads
+// missing trailing fields with empty values. It applies to rules loaded by LoadPolicy and the like afterwards.
+func (e *Enforcer) SetStrictArity(strict bool) {
+	e.lenientArity = !strict
+	e.model.SetStrictArity(strict)
+}
+
+// EnableSyncedRoleManager controls whether the role managers of the grouping policies are guarded by a
+// sync.RWMutex, so that links added or removed by AddGroupingPolicy and the like are safe against concurrent
+// Enforce calls. Concurrent policy changes still have to be serialized, e.g. with SyncedEnforcer.
+// Conditional role managers are not wrapped.
+func (e *Enforcer) EnableSyncedRoleManager(enable bool) {
+	e.syncedRoleManager = enable
+	for ptype, rm := range e.rmMap {
+		if enable {
+			rm = e.wrapRoleManager(rm)
+		} else if synced, ok := rm.(*defaultrolemanager.SyncedRoleManager); ok {
+			rm = synced.RoleManager()
+		}
+		e.rmMap[ptype] = rm
+		if assertion, ok := e.model["g"][ptype]; ok {
+			assertion.RM = rm
+		}
+	}
+	e.invalidateMatcherMap()
+}
+
+func (e *Enforcer) wrapRoleManager(rm rbac.RoleManager) rbac.RoleManager {
+	if _, ok := rm.(*defaultrolemanager.SyncedRoleManager); ok || !e.syncedRoleManager {
+		return rm
+	}
+	return defaultrolemanager.NewSyncedRoleManager(rm)
+}
+
 // EnableAutoNotifyWatcher controls whether to save a policy rule automatically notify the Watcher when it is added or removed.
 func (e *Enforcer) EnableAutoNotifyWatcher(enable bool) {
 	e.autoNotifyWatcher = enable
@@ -557,24 +989,216 @@ func (e *Enforcer) EnableAutoBuildRoleLinks(autoBuildRoleLinks bool) {
 	e.autoBuildRoleLinks = autoBuildRoleLinks
 }
 
+// EnableDomainGlob controls whether the domain argument of GetFilteredPolicy, GetFilteredGroupingPolicy and the
+// like, and of GetRolesForUserInDomain and GetUsersForRoleInDomain, is interpreted as a glob pattern such as "prod-*",
+// so that a single query spans all matching domains. Domains without glob metacharacters are still matched literally.
+func (e *Enforcer) EnableDomainGlob(enable bool) {
+	e.domainGlob = enable
+}
+
 // EnableAcceptJsonRequest controls whether to accept json as a request parameter.
 func (e *Enforcer) EnableAcceptJsonRequest(acceptJsonRequest bool) {
 	e.acceptJsonRequest = acceptJsonRequest
 }
 
+// EnableRejectNilRequest controls how nil request values are handled. By default a nil value is evaluated as the
+// empty string "", so it only equals empty policy fields and is passed to matcher functions as "".
+// When enabled, a request with a nil value is rejected with an error instead.
+func (e *Enforcer) EnableRejectNilRequest(reject bool) {
+	e.rejectNilRequest = reject
+}
+
+// SetObjectNormalizer sets a function applied to the r.obj request value, if it is a string, before the matcher
+// runs, e.g. util.NewPathNormalizerFunc to ignore trailing slashes or query strings. The policy is not normalized.
+// nil removes it.
+func (e *Enforcer) SetObjectNormalizer(normalizer func(string) string) {
+	e.objNormalizer = normalizer
+}
+
+// SetClock sets the clock read by the durationMatch matcher function, also named scheduleMatch, instead of the
+// system clock, e.g. to pin the time in tests. nil restores the system clock. A function of either name added with
+// AddFunction is kept. Link condition functions are given their clock when they are added, see
+// util.NewScheduleMatchLinkFunc.
+func (e *Enforcer) SetClock(clock util.Clock) {
+	e.durationMatchFunc = nil
+	if clock != nil {
+		e.durationMatchFunc = util.NewDurationMatchFunc(clock)
+	}
+	e.invalidateMatcherMap()
+}
+
+// SetMatcherEvalBudget sets a time budget for a single matcher evaluation. An evaluation still running when the
+// budget is spent is abandoned, and the enforce call fails with ErrEvalBudgetExceeded without waiting for it.
+// The abandoned evaluation goes on in the background, e.g. a custom function blocking forever is leaked.
+// A budget of 0 disables the check.
+func (e *Enforcer) SetMatcherEvalBudget(budget time.Duration) {
+	e.evalBudget = budget
+}
+
+// SetFallbackMatcher sets a matcher consulted only when the model matcher denies a request, e.g. to grant
+// break-glass access to emergency roles. The fallback is evaluated against the same policy and effect, and its
+// decision is final. It is not consulted for a custom matcher like in EnforceWithMatcher. "" removes it.
+func (e *Enforcer) SetFallbackMatcher(matcher string) {
+	e.fallbackMatcher = matcher
+}
+
+// SetDecisionSink sets the sink receiving a structured record of every enforce decision, with the request, the
+// policy rule that decided it, the decision and its latency. Calls failing with an error are not recorded.
+// See log.NewChannelSink and log.NewWriterSink. The sink is notified along with the observer set by
+// SetEnforceObserver or SetObserver, nil removes it.
+func (e *Enforcer) SetDecisionSink(sink log.DecisionSink) {
+	if sink == nil {
+		e.observers[decisionSinkSlot] = nil
+		return
+	}
+	e.observers[decisionSinkSlot] = sinkObserver{sink: sink}
+}
+
+// SetEnforceObserver sets the observer notified of every enforce decision, nil removes it. An observer implementing
+// EnforceErrorObserver is notified of the calls failing with an error separately.
+func (e *Enforcer) SetEnforceObserver(observer EnforceObserver) {
+	e.observers[enforceObserverSlot] = observer
+}
+
+// SetObserver sets the observer notified of every enforce decision with the model name, see GetModelName. It is
+// notified along with the observer set by SetEnforceObserver and the decision sink, nil removes it.
+func (e *Enforcer) SetObserver(obs EnforcerObserver) {
+	if obs == nil {
+		e.observers[modelObserverSlot] = nil
+		return
+	}
+	e.observers[modelObserverSlot] = modelObserver{e: e, obs: obs}
+}
+
+// SetModelName sets the name of the model reported to the observer set with SetObserver, e.g. to label the
+// metrics of a model created in memory.
+func (e *Enforcer) SetModelName(name string) {
+	e.modelName = name
+}
+
+// GetModelName gets the name of the model set with SetModelName, or else the path of the model file, or else
+// "memory" for a model created in memory.
+func (e *Enforcer) GetModelName() string {
+	if e.modelName != "" {
+		return e.modelName
+	}
+	if e.modelPath != "" {
+		return e.modelPath
+	}
+	return "memory"
+}
+
+// Use adds a middleware around every enforce call, e.g. for audit or rate limiting. The middleware receives the
+// next function of the chain and returns a function deciding the request values, usually by calling next and
+// inspecting or overriding its decision, or by returning without calling next to short-circuit the evaluation.
+// Middlewares are applied in the order they are added, the first one being the outermost. With SyncedEnforcer
+// they run while its read lock is held, so they must not call back into the enforcer. With SyncedCachedEnforcer
+// they run outside the lock, around the cache, so they see the cache hits and the lock is only held to decide.
+func (e *Enforcer) Use(middleware func(next EnforceFunc) EnforceFunc) {
+	e.middlewares = append(e.middlewares, middleware)
+}
+
+// SetFlagProvider sets the function resolving feature flags and registers the matcher function flag(name),
+// so a matcher like flag("beta") && keyMatch(r.obj, p.obj) only grants access while the flag is on.
+// The provider is resolved on every evaluation, so flags may be toggled at runtime. A nil provider turns all flags off.
+func (e *Enforcer) SetFlagProvider(provider func(name string) bool) {
+	e.flagProvider = provider
+	e.fm.AddFunction("flag", e.flagFunc)
+}
+
+func (e *Enforcer) flagFunc(args ...interface{}) (interface{}, error) {
+	if len(args) != 1 {
+		return false, fmt.Errorf("flag: expected 1 argument, got %d", len(args))
+	}
+	name, ok := args[0].(string)
+	if !ok {
+		return false, errors.New("flag: argument must be a string")
+	}
+	provider := e.flagProvider
+	if provider == nil {
+		return false, nil
+	}
+	return provider(name), nil
+}
+
+// policyValuesKey identifies the values of a field of the rules of an assertion.
+type policyValuesKey struct {
+	ast   *model.Assertion
+	index int
+}
+
+// policyValuesFunc is the matcher function policyValues(ptype, field). It returns the distinct values of a field of
+// the rules of ptype in the order they first appear, so a matcher like r.sub in policyValues("p2", "sub") tests
+// membership in a set sourced from the policy. The field is a token name of the policy definition, e.g. "sub",
+// or the index of the field, which is also how the fields of a role definition are selected.
+func (e *Enforcer) policyValuesFunc(args ...interface{}) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("policyValues: expected 2 arguments, got %d", len(args))
+	}
+	ptype, ok := args[0].(string)
+	if !ok || ptype == "" {
+		return nil, errors.New("policyValues: policy type must be a non-empty string")
+	}
+	sec := ptype[:1]
+	ast, ok := e.model[sec][ptype]
+	if !ok || (sec != "p" && sec != "g") {
+		return nil, fmt.Errorf("policyValues: unknown policy type %s", ptype)
+	}
+
+	var index int
+	switch field := args[1].(type) {
+	case string:
+		if sec != "p" {
+			return nil, errors.New("policyValues: the fields of a role definition are selected by index")
+		}
+		var err error
+		if index, err = e.model.GetFieldIndex(ptype, field); err != nil {
+			return nil, fmt.Errorf("policyValues: %v", err)
+		}
+	case float64:
+		index = int(field)
+	default:
+		return nil, errors.New("policyValues: field must be a token name or an index")
+	}
+
+	// the values are computed once per policy, not once per rule evaluated against the request.
+	key := policyValuesKey{ast: ast, index: index}
+	if values, ok := e.policyValues.Load(key); ok {
+		return values, nil
+	}
+	values := make([]interface{}, 0)
+	seen := make(map[string]struct{})
+	for _, rule := range ast.Policy {
+		if index < 0 || index >= len(rule) {
+			continue
+		}
+		if _, ok := seen[rule[index]]; !ok {
+			seen[rule[index]] = struct{}{}
+			values = append(values, rule[index])
+		}
+	}
+	e.policyValues.Store(key, values)
+	return values, nil
+}
+
 // BuildRoleLinks manually rebuild the role inheritance relations.
 func (e *Enforcer) BuildRoleLinks() error {
 	if e.rmMap == nil {
 		return errors.New("rmMap is nil")
 	}
-	for _, rm := range e.rmMap {
-		err := rm.Clear()
-		if err != nil {
-			return err
-		}
-	}
+	e.invalidateMatcherMap()
+	return e.rebuildRoleLinks(e.model)
+}
 
-	return e.model.BuildRoleLinks(e.rmMap)
+// BuildConditionalRoleLinks manually rebuilds only the role inheritance relations with conditions from the policy,
+// e.g. after the condition parameters of grouping rules were changed, the other role managers are left untouched.
+// Like BuildRoleLinks, it resets the link condition functions and their parameters to those of the rules.
+func (e *Enforcer) BuildConditionalRoleLinks() error {
+	if e.condRmMap == nil {
+		return errors.New("condRmMap is nil")
+	}
+	e.invalidateMatcherMap()
+	return e.rebuildConditionalRoleLinks(e.model)
 }
 
 // BuildIncrementalRoleLinks provides incremental build the role inheritance relations.
@@ -600,103 +1224,220 @@ func NewEnforceContext(suffix string) EnforceContext {
 }
 
 func (e *Enforcer) invalidateMatcherMap() {
-	e.matcherMap = sync.Map{}
+	// entries are deleted rather than replacing the map, which would race with concurrent enforce calls.
+	e.matcherMap.Range(func(key, _ interface{}) bool {
+		e.matcherMap.Delete(key)
+		return true
+	})
 }
 
 // enforce use a custom matcher to decides whether a "subject" can access a "object" with the operation "action", input parameters are usually: (matcher, sub, obj, act), use model matcher by default when matcher is "".
-func (e *Enforcer) enforce(matcher string, explains *[]string, rvals ...interface{}) (ok bool, err error) { //nolint:funlen,cyclop,gocyclo // TODO: reduce function complexity
-	defer func() {
-		if r := recover(); r != nil {
-			err = fmt.Errorf("panic: %v\n%s", r, debug.Stack())
-		}
-	}()
+// requestFunctions are added to the matcher functions for this call only.
+// If reasons is not nil, it is filled with a human-readable explanation of the decision.
+// The call goes through the middlewares added with Use.
+func (e *Enforcer) enforce(matcher string, requestFunctions map[string]govaluate.ExpressionFunction, explains *[]string, reasons *[]string, decision *Decision, rvals ...interface{}) (bool, error) {
+	if len(e.middlewares) == 0 {
+		return e.evaluate(matcher, requestFunctions, explains, reasons, decision, rvals...)
+	}
 
-	if !e.enabled {
-		return true, nil
+	return e.chain(func(rvals ...interface{}) (bool, error) {
+		return e.evaluate(matcher, requestFunctions, explains, reasons, decision, rvals...)
+	})(rvals...)
+}
+
+// chain wraps next with the middlewares added with Use.
+func (e *Enforcer) chain(next EnforceFunc) EnforceFunc {
+	for i := len(e.middlewares) - 1; i >= 0; i-- {
+		next = e.middlewares[i](next)
 	}
+	return next
+}
 
-	functions := e.fm.GetFunctions()
-	if _, ok := e.model["g"]; ok {
-		for key, ast := range e.model["g"] {
-			// g must be a normal role definition (ast.RM != nil)
-			//   or a conditional role definition (ast.CondRM != nil)
-			// ast.RM and ast.CondRM shouldn't be nil at the same time
-			if ast.RM != nil {
-				functions[key] = util.GenerateGFunction(ast.RM)
+// observing tells whether an observer is set.
+func (e *Enforcer) observing() bool {
+	for _, observer := range e.observers {
+		if observer != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// notifyObservers notifies every observer set of an enforce call. explains holds the rule that decided the
+// request, if any, for the observers given the rule.
+func (e *Enforcer) notifyObservers(rvals []interface{}, explains *[]string, allowed bool, err error, dur time.Duration) {
+	for _, observer := range e.observers {
+		switch observer := observer.(type) {
+		case nil:
+		case ruleObserver:
+			if err != nil {
+				continue
 			}
-			if ast.CondRM != nil {
-				functions[key] = util.GenerateConditionalGFunction(ast.CondRM)
+			var matchedRule []string
+			if explains != nil && len(*explains) != 0 {
+				matchedRule = append([]string(nil), *explains...)
+			}
+			observer.observeRule(rvals, matchedRule, allowed, dur)
+		case EnforceErrorObserver:
+			if err != nil {
+				observer.ObserveEnforceError(rvals, err, dur)
+				continue
 			}
+			observer.ObserveEnforce(rvals, allowed, dur)
+		default:
+			observer.ObserveEnforce(rvals, allowed, dur)
 		}
 	}
+}
 
-	var (
-		rType = "r"
-		pType = "p"
-		eType = "e"
-		mType = "m"
-	)
+// evaluate decides the request against the policy, see enforce. The fallback matcher is consulted if the model matcher denies.
+func (e *Enforcer) evaluate(matcher string, requestFunctions map[string]govaluate.ExpressionFunction, explains *[]string, reasons *[]string, decision *Decision, rvals ...interface{}) (ok bool, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v\n%s", r, debug.Stack())
+		}
+	}()
+
+	if e.observing() {
+		if explains == nil && e.observers[decisionSinkSlot] != nil {
+			explains = &[]string{}
+		}
+		start := time.Now()
+		defer func() {
+			e.notifyObservers(rvals, explains, ok, err, time.Since(start))
+		}()
+	}
+
+	if !e.enabled {
+		if reasons != nil {
+			*reasons = append(*reasons, "allowed: enforcement is disabled")
+		}
+		if decision != nil {
+			*decision = Allow
+		}
+		return true, nil
+	}
+
+	ok, err = e.evaluateMatcher(matcher, requestFunctions, explains, reasons, decision, rvals...)
+	if err != nil || ok || matcher != "" || e.fallbackMatcher == "" {
+		return ok, err
+	}
+	if explains != nil {
+		*explains = []string{}
+	}
+	if reasons != nil {
+		*reasons = append(*reasons, "consulting the fallback matcher")
+	}
+	// the decision of the model matcher stands unless the fallback matcher allows.
+	ok, err = e.evaluateMatcher(e.fallbackMatcher, requestFunctions, explains, reasons, nil, rvals...)
+	if ok && decision != nil {
+		*decision = Allow
+	}
+	return ok, err
+}
+
+// evaluateMatcher decides the request against the policy with the given matcher, or the model matcher if it is "".
+func (e *Enforcer) evaluateMatcher(matcher string, requestFunctions map[string]govaluate.ExpressionFunction, explains *[]string, reasons *[]string, decision *Decision, rvals ...interface{}) (bool, error) {
+	plan, rvals, err := e.planMatcher(matcher, requestFunctions, rvals)
+	if err != nil {
+		return false, err
+	}
+	defer plan.release()
+	return e.evaluatePlan(plan, explains, reasons, decision, rvals)
+}
+
+// matcherPlan is the part of a matcher evaluation independent of the request values: the sections of the
+// request, policy and effect, the compiled matcher and its parameters. It decides one request at a time.
+type matcherPlan struct {
+	rType, pType, eType string
+	expString           string
+	hasEval             bool
+	expression          *govaluate.EvaluableExpression
+	parameters          *enforceParameters
+	bound               *boundExpression
+	// quiet skips logging the decisions, see quietDecider.
+	quiet bool
+	// abandoned is set once an evaluation exceeded the budget and goes on in the background, see evalMatcher.
+	abandoned bool
+}
+
+// release returns the matcher compiled with request functions to its pool, unless an abandoned evaluation still
+// uses it.
+func (plan *matcherPlan) release() {
+	if plan.bound != nil && !plan.abandoned {
+		plan.bound.release()
+	}
+}
+
+// planMatcher prepares the evaluation of the matcher, or the model matcher if it is "", and returns the request
+// values without their EnforceContext. The plan is to be released once the requests are decided.
+func (e *Enforcer) planMatcher(matcher string, requestFunctions map[string]govaluate.ExpressionFunction, rvals []interface{}) (*matcherPlan, []interface{}, error) {
+	functions := e.matcherFunctions(requestFunctions)
+
+	plan := &matcherPlan{rType: "r", pType: "p", eType: "e"}
+	mType := "m"
 	if len(rvals) != 0 {
-		switch rvals[0].(type) {
-		case EnforceContext:
-			enforceContext := rvals[0].(EnforceContext)
-			rType = enforceContext.RType
-			pType = enforceContext.PType
-			eType = enforceContext.EType
+		if enforceContext, ok := rvals[0].(EnforceContext); ok {
+			plan.rType = enforceContext.RType
+			plan.pType = enforceContext.PType
+			plan.eType = enforceContext.EType
 			mType = enforceContext.MType
 			rvals = rvals[1:]
-		default:
-			break
 		}
 	}
 
-	var expString string
 	if matcher == "" {
-		expString = e.model["m"][mType].Value
+		plan.expString = e.model["m"][mType].Value
 	} else {
-		expString = util.RemoveComments(util.EscapeAssertion(matcher))
+		plan.expString = util.RemoveComments(util.EscapeAssertion(matcher))
 	}
 
-	rTokens := make(map[string]int, len(e.model["r"][rType].Tokens))
-	for i, token := range e.model["r"][rType].Tokens {
+	rTokens := make(map[string]int, len(e.model["r"][plan.rType].Tokens))
+	for i, token := range e.model["r"][plan.rType].Tokens {
 		rTokens[token] = i
 	}
-	pTokens := make(map[string]int, len(e.model["p"][pType].Tokens))
-	for i, token := range e.model["p"][pType].Tokens {
+	pTokens := make(map[string]int, len(e.model["p"][plan.pType].Tokens))
+	for i, token := range e.model["p"][plan.pType].Tokens {
 		pTokens[token] = i
 	}
-
-	if e.acceptJsonRequest {
-		// try to parse all request values from json to map[string]interface{}
-		// skip if there is an error
-		for i, rval := range rvals {
-			switch rval := rval.(type) {
-			case string:
-				var mapValue map[string]interface{}
-				mapValue, err = util.JsonToMap(rval)
-				if err == nil {
-					rvals[i] = mapValue
-				}
-			}
-		}
-	}
-
-	parameters := enforceParameters{
+	plan.parameters = &enforceParameters{
 		rTokens: rTokens,
-		rVals:   rvals,
-
 		pTokens: pTokens,
 	}
 
-	hasEval := util.HasEval(expString)
-	if hasEval {
-		functions["eval"] = generateEvalFunction(functions, &parameters)
+	var err error
+	plan.hasEval = util.HasEval(plan.expString)
+	if plan.hasEval {
+		functions["eval"] = generateEvalFunction(functions, plan.parameters)
+	}
+	switch {
+	case len(requestFunctions) != 0 && plan.hasEval:
+		// The expression is bound to the parameters of this call, so it must not be shared through the cache.
+		plan.expression, err = govaluate.NewEvaluableExpressionWithFunctions(plan.expString, functions)
+	case len(requestFunctions) != 0:
+		if plan.bound, err = e.getBoundMatcherExpression(plan.expString, functions, requestFunctions); err == nil {
+			plan.expression = plan.bound.expression
+		}
+	default:
+		plan.expression, err = e.getAndStoreMatcherExpression(plan.hasEval, plan.expString, functions)
 	}
-	var expression *govaluate.EvaluableExpression
-	expression, err = e.getAndStoreMatcherExpression(hasEval, expString, functions)
+	if err != nil {
+		return nil, nil, err
+	}
+	return plan, rvals, nil
+}
+
+// evaluatePlan decides the request values with the plan.
+func (e *Enforcer) evaluatePlan(plan *matcherPlan, explains *[]string, reasons *[]string, decision *Decision, rvals []interface{}) (bool, error) { //nolint:funlen,cyclop,gocyclo // TODO: reduce function complexity
+	rType, pType, eType := plan.rType, plan.pType, plan.eType
+	expString, hasEval := plan.expString, plan.hasEval
+
+	rvals, err := e.normalizeRequest(rType, rvals)
 	if err != nil {
 		return false, err
 	}
+	parameters := plan.parameters
+	parameters.rVals = rvals
 
 	if len(e.model["r"][rType].Tokens) != len(rvals) {
 		return false, fmt.Errorf(
@@ -711,11 +1452,27 @@ func (e *Enforcer) enforce(matcher string, explains *[]string, rvals ...interfac
 
 	var effect effector.Effect
 	var explainIndex int
+	var evaluated int
 
 	if policyLen := len(e.model["p"][pType].Policy); policyLen != 0 && strings.Contains(expString, pType+"_") { //nolint:nestif // TODO: reduce function complexity
 		policyEffects = make([]effector.Effect, policyLen)
 		matcherResults = make([]float64, policyLen)
 
+		// with specificity, a matched rule weighs its number of fields without a wildcard, see policySpecificity.
+		eftIndex := -1
+		bySpecificity := e.model["e"][eType].Value == constant.SpecificityEffect
+		if j, ok := parameters.pTokens[pType+"_eft"]; ok {
+			eftIndex = j
+		}
+
+		// with deny-override priorities, the effects are merged once all rules of a priority are evaluated.
+		priorityIndex := -1
+		if e.model["e"][eType].Value == constant.PriorityDenyOverrideEffect {
+			if index, err := e.model.GetFieldIndex(pType, constant.PriorityIndex); err == nil {
+				priorityIndex = index
+			}
+		}
+
 		for policyIndex, pvals := range e.model["p"][pType].Policy {
 			// log.LogPrint("Policy Rule: ", pvals)
 			if len(e.model["p"][pType].Tokens) != len(pvals) {
@@ -727,8 +1484,9 @@ func (e *Enforcer) enforce(matcher string, explains *[]string, rvals ...interfac
 			}
 
 			parameters.pVals = pvals
+			evaluated = policyIndex + 1
 
-			result, err := expression.Eval(parameters)
+			result, err := e.evalMatcher(plan)
 			// log.LogPrint("Result: ", result)
 
 			if err != nil {
@@ -749,6 +1507,9 @@ func (e *Enforcer) enforce(matcher string, explains *[]string, rvals ...interfac
 			default:
 				return false, errors.New("matcher result should be bool, int or float")
 			}
+			if bySpecificity && matcherResults[policyIndex] != 0 {
+				matcherResults[policyIndex] += policySpecificity(pvals, eftIndex)
+			}
 
 			if j, ok := parameters.pTokens[pType+"_eft"]; ok {
 				eft := parameters.pVals[j]
@@ -767,6 +1528,11 @@ func (e *Enforcer) enforce(matcher string, explains *[]string, rvals ...interfac
 			//	break
 			// }
 
+			if priorityIndex != -1 && policyIndex+1 < policyLen &&
+				e.model["p"][pType].Policy[policyIndex+1][priorityIndex] == pvals[priorityIndex] {
+				continue
+			}
+
 			effect, explainIndex, err = e.eft.MergeEffects(e.model["e"][eType].Value, policyEffects, matcherResults, policyIndex, policyLen)
 			if err != nil {
 				return false, err
@@ -786,7 +1552,7 @@ func (e *Enforcer) enforce(matcher string, explains *[]string, rvals ...interfac
 
 		parameters.pVals = make([]string, len(parameters.pTokens))
 
-		result, err := expression.Eval(parameters)
+		result, err := e.evalMatcher(plan)
 
 		if err != nil {
 			return false, err
@@ -822,11 +1588,228 @@ func (e *Enforcer) enforce(matcher string, explains *[]string, rvals ...interfac
 	if effect == effector.Allow {
 		result = true
 	}
-	e.logger.LogEnforce(expString, rvals, result, logExplains)
+	if logger, ok := e.logger.(log.StructuredLogger); ok && !plan.quiet {
+		if logger.IsEnabled() {
+			var matchedRule []string
+			if explainIndex != -1 && len(e.model["p"][pType].Policy) > explainIndex {
+				matchedRule = append([]string(nil), e.model["p"][pType].Policy[explainIndex]...)
+			}
+			logger.LogEnforceResult(rvals, result, matchedRule)
+		}
+	} else if !plan.quiet {
+		e.logger.LogEnforce(expString, rvals, result, logExplains)
+	}
+
+	if reasons != nil {
+		var policies [][]string
+		if evaluated > 0 {
+			policies = e.model["p"][pType].Policy[:evaluated]
+		}
+		*reasons = append(*reasons, explainDecision(e.model["r"][rType].Tokens, rvals, policies, policyEffects, matcherResults, explainIndex, result)...)
+	}
+	if decision != nil {
+		*decision = decisionOf(result, policyEffects, matcherResults)
+	}
 
 	return result, nil
 }
 
+// decisionOf tells the decision of an enforce call from its result and the effects of the matched rules: allowed
+// by a matched allow rule, denied by a matched deny rule, or decided by the default of the policy effect.
+func decisionOf(result bool, effects []effector.Effect, matches []float64) Decision {
+	want := effector.Deny
+	if result {
+		want = effector.Allow
+	}
+	for i, eft := range effects {
+		if matches[i] != 0 && eft == want {
+			if result {
+				return Allow
+			}
+			return Deny
+		}
+	}
+	return NotApplicable
+}
+
+// normalizeNilRequest replaces the nil request values by "", or rejects them, see EnableRejectNilRequest.
+// The request values of the caller are not modified.
+func (e *Enforcer) normalizeNilRequest(rType string, rvals []interface{}) ([]interface{}, error) {
+	copied := false
+	for i, rval := range rvals {
+		if rval != nil {
+			continue
+		}
+		if e.rejectNilRequest {
+			tokens := e.model["r"][rType].Tokens
+			if i < len(tokens) {
+				return nil, fmt.Errorf("invalid request: %s is nil", strings.Replace(tokens[i], "_", ".", 1))
+			}
+			return nil, fmt.Errorf("invalid request: value %d is nil", i)
+		}
+		if !copied {
+			rvals = append([]interface{}(nil), rvals...)
+			copied = true
+		}
+		rvals[i] = ""
+	}
+	return rvals, nil
+}
+
+// evalMatcher evaluates the matcher of the plan with its parameters. If a budget is set, the evaluation runs in its
+// own goroutine and is abandoned once the budget is spent. A goroutine cannot be stopped, so the evaluation goes on
+// in the background with a copy of the parameters, and the plan keeps its compiled matcher out of the pool.
+func (e *Enforcer) evalMatcher(plan *matcherPlan) (interface{}, error) {
+	if e.evalBudget <= 0 {
+		return plan.expression.Eval(plan.parameters)
+	}
+
+	type evalResult struct {
+		value interface{}
+		err   error
+	}
+	done := make(chan evalResult, 1)
+	expression, parameters := plan.expression, *plan.parameters
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- evalResult{err: fmt.Errorf("panic: %v\n%s", r, debug.Stack())}
+			}
+		}()
+		value, err := expression.Eval(parameters)
+		done <- evalResult{value, err}
+	}()
+
+	timer := time.NewTimer(e.evalBudget)
+	defer timer.Stop()
+	select {
+	case result := <-done:
+		return result.value, result.err
+	case <-timer.C:
+		plan.abandoned = true
+		return nil, fmt.Errorf("%w: budget is %s", Err.ErrEvalBudgetExceeded, e.evalBudget)
+	}
+}
+
+// normalizeRequest returns the request values the matcher is evaluated with: JSON values parsed if enabled, nil
+// values replaced and the object normalized.
+func (e *Enforcer) normalizeRequest(rType string, rvals []interface{}) ([]interface{}, error) {
+	if e.acceptJsonRequest {
+		// try to parse all request values from json to map[string]interface{}
+		// skip if there is an error
+		for i, rval := range rvals {
+			switch rval := rval.(type) {
+			case string:
+				mapValue, err := util.JsonToMap(rval)
+				if err == nil {
+					rvals[i] = mapValue
+				}
+			}
+		}
+	}
+
+	rvals, err := e.normalizeNilRequest(rType, rvals)
+	if err != nil {
+		return nil, err
+	}
+	if e.objNormalizer != nil {
+		for i, token := range e.model["r"][rType].Tokens {
+			if token != rType+"_obj" || i >= len(rvals) {
+				continue
+			}
+			if obj, ok := rvals[i].(string); ok {
+				rvals = append([]interface{}(nil), rvals...)
+				rvals[i] = e.objNormalizer(obj)
+			}
+		}
+	}
+	return rvals, nil
+}
+
+// matcherFunctions returns the functions a matcher is evaluated with: the registered functions, the role
+// definitions and the functions of the request, which take precedence.
+func (e *Enforcer) matcherFunctions(requestFunctions map[string]govaluate.ExpressionFunction) map[string]govaluate.ExpressionFunction {
+	functions := e.fm.GetFunctions()
+	if _, ok := functions["policyValues"]; !ok {
+		functions["policyValues"] = e.policyValuesFunc
+	}
+	durationMatch := e.durationMatchFunc
+	if durationMatch == nil {
+		durationMatch = util.DurationMatchFunc
+	}
+	for _, name := range []string{"durationMatch", "scheduleMatch"} {
+		if _, ok := functions[name]; !ok {
+			functions[name] = durationMatch
+		}
+	}
+	if _, ok := e.model["g"]; ok {
+		for key, ast := range e.model["g"] {
+			// g must be a normal role definition (ast.RM != nil)
+			//   or a conditional role definition (ast.CondRM != nil)
+			// ast.RM and ast.CondRM shouldn't be nil at the same time
+			if ast.RM != nil {
+				functions[key] = util.GenerateGFunction(ast.RM)
+				functions[key+"Domain"] = util.GenerateGDomainFunction(ast.RM)
+			}
+			if ast.CondRM != nil {
+				functions[key] = util.GenerateConditionalGFunction(ast.CondRM)
+			}
+		}
+	}
+	for name, function := range requestFunctions {
+		functions[name] = function
+	}
+	return functions
+}
+
+// boundExpression is a compiled matcher whose request functions, like those of EnforceWithFunctions, call the
+// functions bound for the current call. It is used by one call at a time.
+type boundExpression struct {
+	expression *govaluate.EvaluableExpression
+	functions  map[string]govaluate.ExpressionFunction
+	pool       *sync.Pool
+}
+
+// release unbinds the functions of the call and returns the expression to its pool.
+func (b *boundExpression) release() {
+	b.functions = nil
+	b.pool.Put(b)
+}
+
+// getBoundMatcherExpression returns the matcher compiled with the request functions bound to requestFunctions.
+// The compiled matchers are pooled in the matcher map per matcher and names of the request functions, so the
+// matcher is only compiled again for concurrent calls or after the map is invalidated.
+func (e *Enforcer) getBoundMatcherExpression(expString string, functions map[string]govaluate.ExpressionFunction, requestFunctions map[string]govaluate.ExpressionFunction) (*boundExpression, error) {
+	names := make([]string, 0, len(requestFunctions))
+	for name := range requestFunctions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pool, _ := e.matcherMap.LoadOrStore(expString+"\x00"+strings.Join(names, ","), &sync.Pool{})
+
+	bound, _ := pool.(*sync.Pool).Get().(*boundExpression)
+	if bound == nil {
+		bound = &boundExpression{pool: pool.(*sync.Pool)}
+		compiled := make(map[string]govaluate.ExpressionFunction, len(functions))
+		for name, function := range functions {
+			compiled[name] = function
+		}
+		for _, name := range names {
+			name := name
+			compiled[name] = func(args ...interface{}) (interface{}, error) {
+				return bound.functions[name](args...)
+			}
+		}
+		expression, err := govaluate.NewEvaluableExpressionWithFunctions(expString, compiled)
+		if err != nil {
+			return nil, err
+		}
+		bound.expression = expression
+	}
+	bound.functions = requestFunctions
+	return bound, nil
+}
+
 func (e *Enforcer) getAndStoreMatcherExpression(hasEval bool, expString string, functions map[string]govaluate.ExpressionFunction) (*govaluate.EvaluableExpression, error) {
 	var expression *govaluate.EvaluableExpression
 	var err error
@@ -846,33 +1829,369 @@ func (e *Enforcer) getAndStoreMatcherExpression(hasEval bool, expString string,
 
 // Enforce decides whether a "subject" can access a "object" with the operation "action", input parameters are usually: (sub, obj, act).
 func (e *Enforcer) Enforce(rvals ...interface{}) (bool, error) {
-	return e.enforce("", nil, rvals...)
+	return e.enforce("", nil, nil, nil, nil, rvals...)
 }
 
 // EnforceWithMatcher use a custom matcher to decides whether a "subject" can access a "object" with the operation "action", input parameters are usually: (matcher, sub, obj, act), use model matcher by default when matcher is "".
 func (e *Enforcer) EnforceWithMatcher(matcher string, rvals ...interface{}) (bool, error) {
-	return e.enforce(matcher, nil, rvals...)
+	return e.enforce(matcher, nil, nil, nil, nil, rvals...)
 }
 
 // EnforceEx explain enforcement by informing matched rules.
 func (e *Enforcer) EnforceEx(rvals ...interface{}) (bool, []string, error) {
 	explain := []string{}
-	result, err := e.enforce("", &explain, rvals...)
+	result, err := e.enforce("", nil, &explain, nil, nil, rvals...)
 	return result, explain, err
 }
 
 // EnforceExWithMatcher use a custom matcher and explain enforcement by informing matched rules.
 func (e *Enforcer) EnforceExWithMatcher(matcher string, rvals ...interface{}) (bool, []string, error) {
 	explain := []string{}
-	result, err := e.enforce(matcher, &explain, rvals...)
+	result, err := e.enforce(matcher, nil, &explain, nil, nil, rvals...)
 	return result, explain, err
 }
 
+// EnforceWithReasons decides like Enforce and also returns human-readable reasons for the decision:
+// every policy rule that was evaluated, whether it matched and which effect it contributed, followed by the decision,
+// e.g. "denied: no policy grants alice write on data1".
+func (e *Enforcer) EnforceWithReasons(rvals ...interface{}) (bool, []string, error) {
+	reasons := []string{}
+	result, err := e.enforce("", nil, nil, &reasons, nil, rvals...)
+	return result, reasons, err
+}
+
+// Decision is the outcome of EnforceDecision.
+type Decision int
+
+const (
+	// NotApplicable means that no policy rule matched the request, Enforce then returns the default of the policy effect.
+	NotApplicable Decision = iota
+	// Allow means that the request is allowed.
+	Allow
+	// Deny means that a policy rule explicitly denied the request.
+	Deny
+)
+
+// String returns the name of the decision.
+func (d Decision) String() string {
+	switch d {
+	case Allow:
+		return "allow"
+	case Deny:
+		return "deny"
+	default:
+		return "not applicable"
+	}
+}
+
+// EnforceDecision decides like Enforce, but tells an explicit deny from a request no policy rule applies to,
+// e.g. to fall back to another enforcer only in the latter case.
+func (e *Enforcer) EnforceDecision(rvals ...interface{}) (Decision, error) {
+	decision := NotApplicable
+	if _, err := e.enforce("", nil, nil, nil, &decision, rvals...); err != nil {
+		return NotApplicable, err
+	}
+	return decision, nil
+}
+
+// DenyReason describes why a request was denied. Field is the first request field, in request definition order,
+// whose condition in the matcher is false for Rule, the policy rule satisfying the most conditions. If a rule
+// matched the request and denied it, Field and RequestValue are empty and Rule is that rule.
+type DenyReason struct {
+	Field        string
+	RequestValue string
+	Rule         []string
+}
+
+// EnforceWithDenyReason decides like Enforce and, if the request is denied, also returns the reason.
+// The matcher is split into the conditions joined by its top-level "&&", and each condition is attributed to
+// the first request field it references, e.g. g(r.sub, p.sub, r.dom) to sub. The conditions are evaluated
+// against every policy rule with the functions of the matcher, so keyMatch, regexMatch and domain roles are
+// taken into account. The reason is nil if the request is allowed or there is no policy rule to compare it with.
+func (e *Enforcer) EnforceWithDenyReason(rvals ...interface{}) (bool, *DenyReason, error) {
+	explain := []string{}
+	result, err := e.enforce("", nil, &explain, nil, nil, rvals...)
+	if err != nil || result {
+		return result, nil, err
+	}
+	if len(explain) > 0 {
+		return false, &DenyReason{Rule: append([]string(nil), explain...)}, nil
+	}
+
+	rType, pType, mType := "r", "p", "m"
+	if len(rvals) != 0 {
+		if enforceContext, ok := rvals[0].(EnforceContext); ok {
+			rType, pType, mType = enforceContext.RType, enforceContext.PType, enforceContext.MType
+			rvals = rvals[1:]
+		}
+	}
+	return false, e.closestRuleMismatch(rType, pType, mType, rvals), nil
+}
+
+// matcherCondition is a condition of a matcher and the index of the first request field it references.
+type matcherCondition struct {
+	expression *govaluate.EvaluableExpression
+	field      int
+}
+
+// closestRuleMismatch finds the policy rule satisfying the most conditions of the matcher and the first request
+// field of its false conditions.
+func (e *Enforcer) closestRuleMismatch(rType string, pType string, mType string, rvals []interface{}) *DenyReason {
+	rvals, err := e.normalizeRequest(rType, rvals)
+	if err != nil {
+		return nil
+	}
+	rTokens := make(map[string]int, len(e.model["r"][rType].Tokens))
+	for i, token := range e.model["r"][rType].Tokens {
+		rTokens[token] = i
+	}
+	pTokens := make(map[string]int, len(e.model["p"][pType].Tokens))
+	for i, token := range e.model["p"][pType].Tokens {
+		pTokens[token] = i
+	}
+	parameters := enforceParameters{
+		rTokens: rTokens,
+		rVals:   rvals,
+
+		pTokens: pTokens,
+	}
+
+	expString := e.model["m"][mType].Value
+	functions := e.matcherFunctions(nil)
+	if util.HasEval(expString) {
+		functions["eval"] = generateEvalFunction(functions, &parameters)
+	}
+	var conditions []matcherCondition
+	for _, conjunct := range splitConjuncts(expString) {
+		field := firstRequestField(conjunct, rTokens)
+		if field == -1 {
+			continue
+		}
+		expression, err := govaluate.NewEvaluableExpressionWithFunctions(conjunct, functions)
+		if err != nil {
+			return nil
+		}
+		conditions = append(conditions, matcherCondition{expression: expression, field: field})
+	}
+
+	var reason *DenyReason
+	best := -1
+	for _, rule := range e.model["p"][pType].Policy {
+		if len(rule) != len(pTokens) {
+			continue
+		}
+		parameters.pVals = rule
+		matched, mismatch := 0, -1
+		for _, condition := range conditions {
+			result, err := condition.expression.Eval(parameters)
+			if err != nil {
+				continue
+			}
+			if ok, _ := result.(bool); ok {
+				matched++
+			} else if mismatch == -1 || condition.field < mismatch {
+				mismatch = condition.field
+			}
+		}
+		if mismatch != -1 && matched > best {
+			best = matched
+			reason = &DenyReason{
+				Field:        strings.TrimPrefix(e.model["r"][rType].Tokens[mismatch], rType+"_"),
+				RequestValue: fmt.Sprint(rvals[mismatch]),
+				Rule:         append([]string(nil), rule...),
+			}
+		}
+	}
+	return reason
+}
+
+// firstRequestField returns the index of the first request field referenced by the conjunct, or -1 if there is
+// none. The conjunct is scanned for identifiers, e.g. "r_sub" in "r_sub.Name == p_sub", looked up in rTokens.
+func firstRequestField(conjunct string, rTokens map[string]int) int {
+	field := -1
+	for start := 0; start < len(conjunct); {
+		if !isIdentByte(conjunct[start]) {
+			start++
+			continue
+		}
+		end := start + 1
+		for end < len(conjunct) && isIdentByte(conjunct[end]) {
+			end++
+		}
+		if i, ok := rTokens[conjunct[start:end]]; ok && (field == -1 || i < field) {
+			field = i
+		}
+		start = end
+	}
+	return field
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// splitConjuncts splits an expression at its top-level "&&", outside of parentheses and string literals.
+func splitConjuncts(expString string) []string {
+	var conjuncts []string
+	depth, start := 0, 0
+	var quote byte
+	for i := 0; i < len(expString); i++ {
+		c := expString[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'' || c == '`':
+			quote = c
+		case c == '(' || c == '[':
+			depth++
+		case c == ')' || c == ']':
+			depth--
+		case depth == 0 && strings.HasPrefix(expString[i:], "&&"):
+			conjuncts = append(conjuncts, strings.TrimSpace(expString[start:i]))
+			start = i + 2
+			i++
+		}
+	}
+	return append(conjuncts, strings.TrimSpace(expString[start:]))
+}
+
+// policySpecificity counts the fields of a policy rule, other than its effect, that are not empty and do not
+// contain a "*" wildcard.
+func policySpecificity(pvals []string, eftIndex int) float64 {
+	var specificity float64
+	for i, v := range pvals {
+		if i != eftIndex && v != "" && !strings.Contains(v, "*") {
+			specificity++
+		}
+	}
+	return specificity
+}
+
+// explainDecision describes the evaluated policies, which of them matched and with which effect, and the decision.
+// policies is nil when the matcher was evaluated without policy rules.
+func explainDecision(rTokens []string, rvals []interface{}, policies [][]string, effects []effector.Effect, matches []float64, explainIndex int, result bool) []string {
+	reasons := make([]string, 0, len(policies)+1)
+	for i, policy := range policies {
+		if matches[i] == 0 {
+			reasons = append(reasons, fmt.Sprintf("policy [%s]: not matched", util.ArrayToString(policy)))
+			continue
+		}
+		effect := "indeterminate"
+		switch effects[i] {
+		case effector.Allow:
+			effect = "allow"
+		case effector.Deny:
+			effect = "deny"
+		}
+		reasons = append(reasons, fmt.Sprintf("policy [%s]: matched, effect %s", util.ArrayToString(policy), effect))
+	}
+
+	decision := "denied"
+	if result {
+		decision = "allowed"
+	}
+	switch {
+	case explainIndex >= 0 && explainIndex < len(policies):
+		return append(reasons, fmt.Sprintf("%s by policy [%s]", decision, util.ArrayToString(policies[explainIndex])))
+	case policies == nil:
+		return append(reasons, decision+": matcher evaluated without policy rules")
+	case result:
+		return append(reasons, decision)
+	}
+
+	request := make(map[string]interface{}, len(rTokens))
+	for i, token := range rTokens {
+		if i < len(rvals) {
+			request[token[strings.Index(token, "_")+1:]] = rvals[i]
+		}
+	}
+	sub, hasSub := request["sub"]
+	obj, hasObj := request["obj"]
+	act, hasAct := request["act"]
+	if hasSub && hasObj && hasAct {
+		return append(reasons, fmt.Sprintf("denied: no policy grants %v %v on %v", sub, act, obj))
+	}
+	return append(reasons, fmt.Sprintf("denied: no policy matched request %v", rvals))
+}
+
+// EnforceWithFunctions decides like Enforce, with funcs available to the matcher in addition to the functions
+// registered by AddFunction. The functions are only used for this call, so they may capture per-request data.
+func (e *Enforcer) EnforceWithFunctions(funcs map[string]govaluate.ExpressionFunction, rvals ...interface{}) (bool, error) {
+	return e.enforce("", funcs, nil, nil, nil, rvals...)
+}
+
+// EnforceWithContext decides like Enforce, passing ctx to the functions added with AddAsyncFunction.
+// It fails with the error of ctx if ctx is done before the decision.
+func (e *Enforcer) EnforceWithContext(ctx context.Context, rvals ...interface{}) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	return e.enforce("", e.contextFunctions(ctx), nil, nil, nil, rvals...)
+}
+
+type contextAttributesKey struct{}
+
+// WithAttributes returns a copy of ctx carrying ambient request attributes, like the client IP or the request time,
+// for EnforceWithContextAttributes.
+func WithAttributes(ctx context.Context, attributes map[string]interface{}) context.Context {
+	return context.WithValue(ctx, contextAttributesKey{}, attributes)
+}
+
+// EnforceWithContextAttributes decides like EnforceWithContext, with the attributes added to ctx by WithAttributes
+// available to the matcher through the function ctx(name), e.g. ctx("ip") == "10.0.0.1". A missing attribute is nil,
+// numbers are converted to float64 so that they can be compared.
+func (e *Enforcer) EnforceWithContextAttributes(ctx context.Context, rvals ...interface{}) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	attributes, _ := ctx.Value(contextAttributesKey{}).(map[string]interface{})
+	funcs := e.contextFunctions(ctx)
+	funcs["ctx"] = func(args ...interface{}) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("ctx: expected 1 argument, got %d", len(args))
+		}
+		name, ok := args[0].(string)
+		if !ok {
+			return nil, errors.New("ctx: argument must be a string")
+		}
+		return numberToFloat64(attributes[name]), nil
+	}
+	return e.enforce("", funcs, nil, nil, nil, rvals...)
+}
+
+// numberToFloat64 converts numbers to float64, the only number type the expression evaluation compares.
+func numberToFloat64(value interface{}) interface{} {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint())
+	case reflect.Float32:
+		return v.Float()
+	default:
+		return value
+	}
+}
+
+// contextFunctions binds the functions added with AddAsyncFunction to ctx.
+func (e *Enforcer) contextFunctions(ctx context.Context) map[string]govaluate.ExpressionFunction {
+	funcs := make(map[string]govaluate.ExpressionFunction, len(e.asyncFunctions)+1)
+	for name, function := range e.asyncFunctions {
+		funcs[name] = bindAsyncFunction(ctx, function)
+	}
+	return funcs
+}
+
 // BatchEnforce enforce in batches.
 func (e *Enforcer) BatchEnforce(requests [][]interface{}) ([]bool, error) {
 	var results []bool
 	for _, request := range requests {
-		result, err := e.enforce("", nil, request...)
+		result, err := e.enforce("", nil, nil, nil, nil, request...)
 		if err != nil {
 			return results, err
 		}
@@ -885,7 +2204,7 @@ func (e *Enforcer) BatchEnforce(requests [][]interface{}) ([]bool, error) {
 func (e *Enforcer) BatchEnforceWithMatcher(matcher string, requests [][]interface{}) ([]bool, error) {
 	var results []bool
 	for _, request := range requests {
-		result, err := e.enforce(matcher, nil, request...)
+		result, err := e.enforce(matcher, nil, nil, nil, nil, request...)
 		if err != nil {
 			return results, err
 		}
@@ -894,10 +2213,148 @@ func (e *Enforcer) BatchEnforceWithMatcher(matcher string, requests [][]interfac
 	return results, nil
 }
 
+// BatchOptions configures BatchEnforceWithOptions.
+type BatchOptions struct {
+	// Concurrency is the number of workers evaluating requests in parallel, values <= 1 evaluate sequentially.
+	Concurrency int
+}
+
+// BatchEnforceWithOptions enforce in batches, evaluating the requests with a pool of opts.Concurrency workers.
+// The results are in the order of the requests. If a request fails, no further requests are started and, once
+// all running evaluations finished, the error of the first failed request is returned with the results of the
+// requests before it, like BatchEnforce.
+func (e *Enforcer) BatchEnforceWithOptions(requests [][]interface{}, opts BatchOptions) ([]bool, error) {
+	if opts.Concurrency <= 1 || len(requests) <= 1 {
+		return e.BatchEnforce(requests)
+	}
+
+	workers := opts.Concurrency
+	if workers > len(requests) {
+		workers = len(requests)
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		failedAt = len(requests)
+		results  = make([]bool, len(requests))
+		indexes  = make(chan int)
+		failed   = make(chan struct{})
+	)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				result, err := e.enforce("", nil, nil, nil, nil, requests[i]...)
+				if err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						close(failed)
+					}
+					// the requests are dispatched in order, so the ones before the first failed request
+					// have all been evaluated.
+					if i < failedAt {
+						firstErr, failedAt = err, i
+					}
+					mu.Unlock()
+					return
+				}
+				results[i] = result
+			}
+		}()
+	}
+
+dispatch:
+	for i := range requests {
+		select {
+		case indexes <- i:
+		case <-failed:
+			break dispatch
+		}
+	}
+	close(indexes)
+	wg.Wait()
+
+	if firstErr != nil {
+		return results[:failedAt], firstErr
+	}
+	return results, nil
+}
+
+// quietDecider returns a function deciding requests like Enforce, with the model matcher and the fallback matcher
+// prepared once, but without the middlewares, the observer and the logger. It is used to probe the policy in the
+// APIs built on enforcement, whose probes are not decisions of their own.
+func (e *Enforcer) quietDecider() (EnforceFunc, error) {
+	if !e.enabled {
+		return func(rvals ...interface{}) (bool, error) {
+			return true, nil
+		}, nil
+	}
+	plan, _, err := e.planMatcher("", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	plan.quiet = true
+	var fallback *matcherPlan
+	if e.fallbackMatcher != "" {
+		if fallback, _, err = e.planMatcher(e.fallbackMatcher, nil, nil); err != nil {
+			return nil, err
+		}
+		fallback.quiet = true
+	}
+	return func(rvals ...interface{}) (bool, error) {
+		ok, err := e.evaluatePlan(plan, nil, nil, nil, rvals)
+		if err != nil || ok || fallback == nil {
+			return ok, err
+		}
+		return e.evaluatePlan(fallback, nil, nil, nil, rvals)
+	}, nil
+}
+
+// FilterAllowedSubjects returns the subjects of subs that are allowed to perform act on obj, in the order of subs.
+// The function map, the compiled model matcher and its parameters are prepared once for all subjects. With
+// middlewares, an observer or a fallback matcher, or enforcement disabled, every subject is decided by Enforce
+// instead, so that they see every decision.
+func (e *Enforcer) FilterAllowedSubjects(subs []interface{}, obj, act interface{}) (allowed []interface{}, err error) {
+	decide := func(sub interface{}) (bool, error) {
+		return e.enforce("", nil, nil, nil, nil, sub, obj, act)
+	}
+	if e.enabled && len(e.middlewares) == 0 && !e.observing() && e.fallbackMatcher == "" {
+		defer func() {
+			if r := recover(); r != nil {
+				allowed, err = nil, fmt.Errorf("panic: %v\n%s", r, debug.Stack())
+			}
+		}()
+		plan, _, err := e.planMatcher("", nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		defer plan.release()
+		decide = func(sub interface{}) (bool, error) {
+			return e.evaluatePlan(plan, nil, nil, nil, []interface{}{sub, obj, act})
+		}
+	}
+
+	for _, sub := range subs {
+		ok, err := decide(sub)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			allowed = append(allowed, sub)
+		}
+	}
+	return allowed, nil
+}
+
 // AddNamedMatchingFunc add MatchingFunc by ptype RoleManager.
 func (e *Enforcer) AddNamedMatchingFunc(ptype, name string, fn rbac.MatchingFunc) bool {
 	if rm, ok := e.rmMap[ptype]; ok {
 		rm.AddMatchingFunc(name, fn)
+		// compiled matchers memorize g() results computed without the matching function.
+		e.invalidateMatcherMap()
 		return true
 	}
 	return false
@@ -907,6 +2364,12 @@ func (e *Enforcer) AddNamedMatchingFunc(ptype, name string, fn rbac.MatchingFunc
 func (e *Enforcer) AddNamedDomainMatchingFunc(ptype, name string, fn rbac.MatchingFunc) bool {
 	if rm, ok := e.rmMap[ptype]; ok {
 		rm.AddDomainMatchingFunc(name, fn)
+		e.invalidateMatcherMap()
+		return true
+	}
+	if rm, ok := e.condRmMap[ptype]; ok {
+		rm.AddDomainMatchingFunc(name, fn)
+		e.invalidateMatcherMap()
 		return true
 	}
 	return false
@@ -961,6 +2424,10 @@ type enforceParameters struct {
 }
 
 // implements govaluate.Parameters.
+//
+// Attribute paths like r_sub.Address.City are resolved by the accessor stage of govaluate, which only asks for the
+// root parameter and then walks struct fields, methods and map keys itself. Paths with an index are escaped by
+// util.EscapeAssertion into a single parameter name like r_obj.Meta.Tags[0], which is resolved here instead.
 func (p enforceParameters) Get(name string) (interface{}, error) {
 	if name == "" {
 		return nil, nil
@@ -974,6 +2441,13 @@ func (p enforceParameters) Get(name string) (interface{}, error) {
 		}
 		return p.pVals[i], nil
 	case 'r':
+		if end := strings.IndexAny(name, ".["); end != -1 {
+			root, err := p.Get(name[:end])
+			if err != nil {
+				return nil, err
+			}
+			return resolveAttributePath(root, name[:end], name[end:])
+		}
 		i, ok := p.rTokens[name]
 		if !ok {
 			return nil, errors.New("No parameter '" + name + "' found.")
@@ -984,6 +2458,62 @@ func (p enforceParameters) Get(name string) (interface{}, error) {
 	}
 }
 
+// resolveAttributePath walks a path of .field, .key and [index] steps, e.g. .Meta.Tags[0], starting at value.
+func resolveAttributePath(value interface{}, name string, path string) (interface{}, error) {
+	for path != "" {
+		v := reflect.ValueOf(value)
+		for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+			v = v.Elem()
+		}
+
+		if path[0] == '[' {
+			end := strings.IndexByte(path, ']')
+			index, err := strconv.Atoi(path[1:end])
+			if err != nil {
+				return nil, err
+			}
+			if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+				return nil, fmt.Errorf("cannot index '%s', it is not a slice", name)
+			}
+			if index >= v.Len() {
+				return nil, fmt.Errorf("index %d out of range of '%s' with length %d", index, name, v.Len())
+			}
+			value = v.Index(index).Interface()
+			name += path[:end+1]
+			path = path[end+1:]
+			continue
+		}
+
+		end := strings.IndexAny(path[1:], ".[") + 1
+		if end == 0 {
+			end = len(path)
+		}
+		key := path[1:end]
+		switch v.Kind() {
+		case reflect.Struct:
+			field := v.FieldByName(key)
+			if !field.IsValid() || !field.CanInterface() {
+				return nil, fmt.Errorf("no exported field '%s' present on '%s'", key, name)
+			}
+			value = field.Interface()
+		case reflect.Map:
+			if v.Type().Key().Kind() != reflect.String {
+				return nil, fmt.Errorf("cannot access key '%s' of '%s', its keys are not strings", key, name)
+			}
+			item := v.MapIndex(reflect.ValueOf(key).Convert(v.Type().Key()))
+			if !item.IsValid() {
+				return nil, fmt.Errorf("no key '%s' present on '%s'", key, name)
+			}
+			value = item.Interface()
+		default:
+			return nil, fmt.Errorf("no field or key '%s' present on '%s'", key, name)
+		}
+		name += path[:end]
+		path = path[end:]
+	}
+	return value, nil
+}
+
 func generateEvalFunction(functions map[string]govaluate.ExpressionFunction, parameters *enforceParameters) govaluate.ExpressionFunction {
 	return func(args ...interface{}) (interface{}, error) {
 		if len(args) != 1 {
@@ -48,6 +48,7 @@ func NewCachedEnforcer(params ...interface{}) (*CachedEnforcer, error) {
 	e.enableCache = 1
 	e.cache, _ = cache.NewDefaultCache()
 	e.locker = new(sync.RWMutex)
+	e.OnPolicyChange(e.invalidateOnPolicyChange)
 	return e, nil
 }
 
@@ -63,13 +64,18 @@ func (e *CachedEnforcer) EnableCache(enableCache bool) {
 // Enforce decides whether a "subject" can access a "object" with the operation "action", input parameters are usually: (sub, obj, act).
 // if rvals is not string , ignore the cache.
 func (e *CachedEnforcer) Enforce(rvals ...interface{}) (bool, error) {
+	// Middlewares run around the cache, so they see cache hits and their decisions are not cached.
+	return e.chain(e.enforceCached)(rvals...)
+}
+
+func (e *CachedEnforcer) enforceCached(rvals ...interface{}) (bool, error) {
 	if atomic.LoadInt32(&e.enableCache) == 0 {
-		return e.Enforcer.Enforce(rvals...)
+		return e.evaluate("", nil, nil, nil, nil, rvals...)
 	}
 
 	key, ok := e.getKey(rvals...)
 	if !ok {
-		return e.Enforcer.Enforce(rvals...)
+		return e.evaluate("", nil, nil, nil, nil, rvals...)
 	}
 
 	if res, err := e.getCachedResult(key); err == nil {
@@ -78,7 +84,7 @@ func (e *CachedEnforcer) Enforce(rvals ...interface{}) (bool, error) {
 		return res, err
 	}
 
-	res, err := e.Enforcer.Enforce(rvals...)
+	res, err := e.evaluate("", nil, nil, nil, nil, rvals...)
 	if err != nil {
 		return false, err
 	}
@@ -87,43 +93,12 @@ func (e *CachedEnforcer) Enforce(rvals ...interface{}) (bool, error) {
 	return res, err
 }
 
-func (e *CachedEnforcer) LoadPolicy() error {
-	if atomic.LoadInt32(&e.enableCache) != 0 {
-		if err := e.cache.Clear(); err != nil {
-			return err
-		}
-	}
-	return e.Enforcer.LoadPolicy()
-}
-
-func (e *CachedEnforcer) RemovePolicy(params ...interface{}) (bool, error) {
-	if atomic.LoadInt32(&e.enableCache) != 0 {
-		key, ok := e.getKey(params...)
-		if ok {
-			if err := e.cache.Delete(key); err != nil && err != cache.ErrNoSuchKey {
-				return false, err
-			}
-		}
+// invalidateOnPolicyChange drops all cached decisions, it is called after every change of the policy. Any change
+// may flip decisions for requests other than the rule itself (roles, deny effects, pattern matching).
+func (e *CachedEnforcer) invalidateOnPolicyChange() {
+	if err := e.InvalidateCache(); err != nil {
+		e.logger.LogError(err, "clear cache failed")
 	}
-	return e.Enforcer.RemovePolicy(params...)
-}
-
-func (e *CachedEnforcer) RemovePolicies(rules [][]string) (bool, error) {
-	if len(rules) != 0 {
-		if atomic.LoadInt32(&e.enableCache) != 0 {
-			irule := make([]interface{}, len(rules[0]))
-			for _, rule := range rules {
-				for i, param := range rule {
-					irule[i] = param
-				}
-				key, _ := e.getKey(irule...)
-				if err := e.cache.Delete(key); err != nil && err != cache.ErrNoSuchKey {
-					return false, err
-				}
-			}
-		}
-	}
-	return e.Enforcer.RemovePolicies(rules)
 }
 
 func (e *CachedEnforcer) getCachedResult(key string) (res bool, err error) {
@@ -136,6 +111,7 @@ func (e *CachedEnforcer) SetExpireTime(expireTime time.Duration) {
 	e.expireTime = expireTime
 }
 
+// SetCache replaces the decision cache, e.g. with a bounded cache.NewLRUCache.
 func (e *CachedEnforcer) SetCache(c cache.Cache) {
 	e.cache = c
 }
@@ -172,14 +148,3 @@ func GetCacheKey(params ...interface{}) (string, bool) {
 	}
 	return key.String(), true
 }
-
-// ClearPolicy clears all policy.
-func (e *CachedEnforcer) ClearPolicy() {
-	if atomic.LoadInt32(&e.enableCache) != 0 {
-		if err := e.cache.Clear(); err != nil {
-			e.logger.LogError(err, "clear cache failed")
-			return
-		}
-	}
-	e.Enforcer.ClearPolicy()
-}
@@ -17,6 +17,9 @@ package casbin
 import (
 	"fmt"
 	"testing"
+	"time"
+
+	"github.com/ApicaSystem/casbin/v2/persist/cache"
 )
 
 func BenchmarkCachedRaw(b *testing.B) {
@@ -43,6 +46,18 @@ func BenchmarkCachedRBACModel(b *testing.B) {
 	}
 }
 
+func BenchmarkCachedRBACModelWithLRU(b *testing.B) {
+	e, _ := NewCachedEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv", false)
+	c, _ := cache.NewLRUCache(1000)
+	e.SetCache(c)
+	e.SetExpireTime(time.Minute)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = e.Enforce("alice", "data2", "read")
+	}
+}
+
 func BenchmarkCachedRBACModelSmall(b *testing.B) {
 	e, _ := NewCachedEnforcer("examples/rbac_model.conf", false)
 	// 100 roles, 10 resources.
@@ -43,6 +43,7 @@ func NewSyncedCachedEnforcer(params ...interface{}) (*SyncedCachedEnforcer, erro
 	e.enableCache = 1
 	e.cache, _ = cache.NewSyncCache()
 	e.locker = new(sync.RWMutex)
+	e.OnPolicyChange(e.invalidateOnPolicyChange)
 	return e, nil
 }
 
@@ -58,13 +59,26 @@ func (e *SyncedCachedEnforcer) EnableCache(enableCache bool) {
 // Enforce decides whether a "subject" can access a "object" with the operation "action", input parameters are usually: (sub, obj, act).
 // if rvals is not string , ignore the cache.
 func (e *SyncedCachedEnforcer) Enforce(rvals ...interface{}) (bool, error) {
+	// Middlewares run around the cache, so they see cache hits and their decisions are not cached.
+	e.m.RLock()
+	enforce := e.chain(e.enforceCached)
+	e.m.RUnlock()
+	return enforce(rvals...)
+}
+
+// enforceCached looks up, decides and caches the request under the read lock, so that a decision computed
+// from a policy being replaced is never cached after the write lock holder invalidated the cache.
+func (e *SyncedCachedEnforcer) enforceCached(rvals ...interface{}) (bool, error) {
+	e.m.RLock()
+	defer e.m.RUnlock()
+
 	if atomic.LoadInt32(&e.enableCache) == 0 {
-		return e.SyncedEnforcer.Enforce(rvals...)
+		return e.evaluate("", nil, nil, nil, nil, rvals...)
 	}
 
 	key, ok := e.getKey(rvals...)
 	if !ok {
-		return e.SyncedEnforcer.Enforce(rvals...)
+		return e.evaluate("", nil, nil, nil, nil, rvals...)
 	}
 
 	if res, err := e.getCachedResult(key); err == nil {
@@ -73,7 +87,7 @@ func (e *SyncedCachedEnforcer) Enforce(rvals ...interface{}) (bool, error) {
 		return res, err
 	}
 
-	res, err := e.SyncedEnforcer.Enforce(rvals...)
+	res, err := e.evaluate("", nil, nil, nil, nil, rvals...)
 	if err != nil {
 		return false, err
 	}
@@ -82,41 +96,26 @@ func (e *SyncedCachedEnforcer) Enforce(rvals ...interface{}) (bool, error) {
 	return res, err
 }
 
-func (e *SyncedCachedEnforcer) LoadPolicy() error {
-	if atomic.LoadInt32(&e.enableCache) != 0 {
-		if err := e.cache.Clear(); err != nil {
-			return err
+// BatchEnforce enforces each request through the cache and returns the results in the same order.
+func (e *SyncedCachedEnforcer) BatchEnforce(requests [][]interface{}) ([]bool, error) {
+	var results []bool
+	for _, request := range requests {
+		result, err := e.Enforce(request...)
+		if err != nil {
+			return results, err
 		}
+		results = append(results, result)
 	}
-	return e.SyncedEnforcer.LoadPolicy()
-}
-
-func (e *SyncedCachedEnforcer) AddPolicy(params ...interface{}) (bool, error) {
-	if ok, err := e.checkOneAndRemoveCache(params...); !ok {
-		return ok, err
-	}
-	return e.SyncedEnforcer.AddPolicy(params...)
-}
-
-func (e *SyncedCachedEnforcer) AddPolicies(rules [][]string) (bool, error) {
-	if ok, err := e.checkManyAndRemoveCache(rules); !ok {
-		return ok, err
-	}
-	return e.SyncedEnforcer.AddPolicies(rules)
-}
-
-func (e *SyncedCachedEnforcer) RemovePolicy(params ...interface{}) (bool, error) {
-	if ok, err := e.checkOneAndRemoveCache(params...); !ok {
-		return ok, err
-	}
-	return e.SyncedEnforcer.RemovePolicy(params...)
+	return results, nil
 }
 
-func (e *SyncedCachedEnforcer) RemovePolicies(rules [][]string) (bool, error) {
-	if ok, err := e.checkManyAndRemoveCache(rules); !ok {
-		return ok, err
+// invalidateOnPolicyChange drops all cached decisions, it is called after every change of the policy. The
+// SyncedEnforcer methods changing the policy hold the write lock, so no concurrent Enforce caches a decision
+// of the previous policy.
+func (e *SyncedCachedEnforcer) invalidateOnPolicyChange() {
+	if err := e.InvalidateCache(); err != nil {
+		e.logger.LogError(err, "clear cache failed")
 	}
-	return e.SyncedEnforcer.RemovePolicies(rules)
 }
 
 func (e *SyncedCachedEnforcer) getCachedResult(key string) (res bool, err error) {
@@ -148,33 +147,3 @@ func (e *SyncedCachedEnforcer) getKey(params ...interface{}) (string, bool) {
 func (e *SyncedCachedEnforcer) InvalidateCache() error {
 	return e.cache.Clear()
 }
-
-func (e *SyncedCachedEnforcer) checkOneAndRemoveCache(params ...interface{}) (bool, error) {
-	if atomic.LoadInt32(&e.enableCache) != 0 {
-		key, ok := e.getKey(params...)
-		if ok {
-			if err := e.cache.Delete(key); err != nil && err != cache.ErrNoSuchKey {
-				return false, err
-			}
-		}
-	}
-	return true, nil
-}
-
-func (e *SyncedCachedEnforcer) checkManyAndRemoveCache(rules [][]string) (bool, error) {
-	if len(rules) != 0 {
-		if atomic.LoadInt32(&e.enableCache) != 0 {
-			irule := make([]interface{}, len(rules[0]))
-			for _, rule := range rules {
-				for i, param := range rule {
-					irule[i] = param
-				}
-				key, _ := e.getKey(irule...)
-				if err := e.cache.Delete(key); err != nil && err != cache.ErrNoSuchKey {
-					return false, err
-				}
-			}
-		}
-	}
-	return true, nil
-}
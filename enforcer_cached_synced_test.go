@@ -15,6 +15,7 @@
 package casbin
 
 import (
+	"reflect"
 	"sync"
 	"testing"
 	"time"
@@ -80,3 +81,83 @@ func TestSyncCache(t *testing.T) {
 	testSyncEnforceCache(t, e, "alice", "data2", "read", true)
 	testSyncEnforceCache(t, e, "alice", "data2", "write", true)
 }
+
+func TestSyncCacheConcurrentWithPolicyChanges(t *testing.T) {
+	e, _ := NewSyncedCachedEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
+	e.EnableAutoSave(false)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				switch (i + j) % 5 {
+				case 0:
+					_, _ = e.AddPolicy("bob", "data1", "read")
+				case 1:
+					_, _ = e.RemovePolicy("bob", "data1", "read")
+				case 2:
+					_, _ = e.AddGroupingPolicy("bob", "data2_admin")
+					_, _ = e.RemoveGroupingPolicy("bob", "data2_admin")
+				case 3:
+					if _, err := e.BatchEnforce([][]interface{}{{"alice", "data1", "read"}, {"bob", "data1", "read"}}); err != nil {
+						t.Error(err)
+					}
+				default:
+					if ok, err := e.Enforce("alice", "data2", "read"); err != nil || !ok {
+						t.Errorf("alice, data2, read: %t, %v, supposed to be true", ok, err)
+					}
+					_, _ = e.Enforce("bob", "data2", "read")
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// Whatever was cached during the concurrent changes, decisions follow the final policy.
+	_, _ = e.RemovePolicy("bob", "data1", "read")
+	testSyncEnforceCache(t, e, "bob", "data1", "read", false)
+	testSyncEnforceCache(t, e, "bob", "data2", "read", false)
+	_, _ = e.AddGroupingPolicy("bob", "data2_admin")
+	testSyncEnforceCache(t, e, "bob", "data2", "read", true)
+
+	res, err := e.BatchEnforce([][]interface{}{{"alice", "data1", "read"}, {"bob", "data1", "read"}, {"bob", "data2", "read"}})
+	if err != nil || !reflect.DeepEqual(res, []bool{true, false, true}) {
+		t.Errorf("BatchEnforce: %v, %v", res, err)
+	}
+	if err = e.LoadPolicy(); err != nil {
+		t.Fatal(err)
+	}
+	testSyncEnforceCache(t, e, "bob", "data2", "read", false)
+}
+
+func TestSyncCacheInvalidationOnHelperAPIs(t *testing.T) {
+	e, _ := NewSyncedCachedEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
+	e.EnableAutoSave(false)
+
+	testSyncEnforceCache(t, e, "alice", "data1", "read", true)
+	_, _ = e.RemoveFilteredPolicy(0, "alice")
+	testSyncEnforceCache(t, e, "alice", "data1", "read", false)
+
+	testSyncEnforceCache(t, e, "bob", "data2", "write", true)
+	_, _ = e.UpdatePolicy([]string{"bob", "data2", "write"}, []string{"bob", "data2", "read"})
+	testSyncEnforceCache(t, e, "bob", "data2", "write", false)
+
+	testSyncEnforceCache(t, e, "alice", "data2", "read", true)
+	_, _ = e.DeleteRoleForUser("alice", "data2_admin")
+	testSyncEnforceCache(t, e, "alice", "data2", "read", false)
+
+	_, _ = e.AddPoliciesWithAffected([][]string{{"alice", "data2", "read"}})
+	testSyncEnforceCache(t, e, "alice", "data2", "read", true)
+
+	_, _ = e.AddRoleForUser("carol", "data2_admin")
+	testSyncEnforceCache(t, e, "carol", "data2", "write", true)
+	if err := e.BulkDeleteRolesForUsers([]string{"carol"}); err != nil {
+		t.Fatal(err)
+	}
+	testSyncEnforceCache(t, e, "carol", "data2", "write", false)
+
+	_, _ = e.AddPoliciesEx([][]string{{"alice", "data2", "read"}, {"carol", "data1", "read"}})
+	testSyncEnforceCache(t, e, "carol", "data1", "read", true)
+}
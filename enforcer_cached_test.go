@@ -14,7 +14,12 @@
 
 package casbin
 
-import "testing"
+import (
+	"testing"
+	"time"
+
+	"github.com/ApicaSystem/casbin/v2/persist/cache"
+)
 
 func testEnforceCache(t *testing.T, e *CachedEnforcer, sub string, obj interface{}, act string, res bool) {
 	t.Helper()
@@ -71,3 +76,107 @@ func TestCache(t *testing.T) {
 	testEnforceCache(t, e, "alice", "data2", "read", false)
 	testEnforceCache(t, e, "alice", "data2", "write", false)
 }
+
+func TestCacheInvalidationOnPolicyChange(t *testing.T) {
+	e, _ := NewCachedEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
+
+	testEnforceCache(t, e, "bob", "data1", "read", false)
+	testEnforceCache(t, e, "alice", "data2", "read", true)
+
+	_, _ = e.AddPolicy("bob", "data1", "read")
+	testEnforceCache(t, e, "bob", "data1", "read", true)
+
+	// Removing the role grant affects alice although no rule mentions her directly.
+	_, _ = e.RemoveGroupingPolicy("alice", "data2_admin")
+	testEnforceCache(t, e, "alice", "data2", "read", false)
+
+	_, _ = e.AddGroupingPolicies([][]string{{"alice", "data2_admin"}})
+	testEnforceCache(t, e, "alice", "data2", "read", true)
+
+	_, _ = e.RemovePolicy("data2_admin", "data2", "read")
+	testEnforceCache(t, e, "alice", "data2", "read", false)
+}
+
+func TestCacheInvalidationOnHelperAPIs(t *testing.T) {
+	e, _ := NewCachedEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
+	e.EnableAutoSave(false)
+
+	testEnforceCache(t, e, "alice", "data1", "read", true)
+	_, _ = e.RemoveFilteredPolicy(0, "alice")
+	testEnforceCache(t, e, "alice", "data1", "read", false)
+
+	testEnforceCache(t, e, "bob", "data2", "write", true)
+	_, _ = e.UpdatePolicy([]string{"bob", "data2", "write"}, []string{"bob", "data2", "read"})
+	testEnforceCache(t, e, "bob", "data2", "write", false)
+
+	testEnforceCache(t, e, "alice", "data2", "read", true)
+	_, _ = e.DeleteRoleForUser("alice", "data2_admin")
+	testEnforceCache(t, e, "alice", "data2", "read", false)
+
+	_, _ = e.AddPoliciesWithAffected([][]string{{"alice", "data2", "read"}})
+	testEnforceCache(t, e, "alice", "data2", "read", true)
+
+	s := e.Snapshot()
+	_, _ = e.RemovePolicy("alice", "data2", "read")
+	testEnforceCache(t, e, "alice", "data2", "read", false)
+	if err := e.Restore(s); err != nil {
+		t.Fatal(err)
+	}
+	testEnforceCache(t, e, "alice", "data2", "read", true)
+
+	diff := PolicyDiff{Removed: []PolicyRule{{Sec: "p", PType: "p", Rule: []string{"alice", "data2", "read"}}}}
+	if err := e.ApplyDiff(diff); err != nil {
+		t.Fatal(err)
+	}
+	testEnforceCache(t, e, "alice", "data2", "read", false)
+
+	e, _ = NewCachedEnforcer("examples/rbac_with_domains_model.conf", "examples/rbac_with_domains_policy.csv")
+	e.EnableAutoSave(false)
+	testEnforceCache4(t, e, "alice", "domain1", "data1", "read", true)
+	if err := e.DeleteDomain("domain1"); err != nil {
+		t.Fatal(err)
+	}
+	testEnforceCache4(t, e, "alice", "domain1", "data1", "read", false)
+}
+
+func testEnforceCache4(t *testing.T, e *CachedEnforcer, sub, dom, obj, act string, res bool) {
+	t.Helper()
+	if myRes, _ := e.Enforce(sub, dom, obj, act); myRes != res {
+		t.Errorf("%s, %s, %s, %s: %t, supposed to be %t", sub, dom, obj, act, myRes, res)
+	}
+}
+
+func TestLRUCache(t *testing.T) {
+	e, _ := NewCachedEnforcer("examples/basic_model.conf", "examples/basic_policy.csv")
+	c, err := cache.NewLRUCache(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.SetCache(c)
+
+	testEnforceCache(t, e, "alice", "data1", "read", true)
+	testEnforceCache(t, e, "bob", "data2", "write", true)
+	if _, err = c.Get("alice$$data1$$read$$"); err != nil {
+		t.Errorf("alice's decision should be cached: %v", err)
+	}
+
+	// alice was used most recently, so bob is evicted.
+	testEnforceCache(t, e, "alice", "data2", "read", false)
+	if _, err = c.Get("bob$$data2$$write$$"); err != cache.ErrNoSuchKey {
+		t.Errorf("bob's decision should have been evicted, got %v", err)
+	}
+	if _, err = c.Get("alice$$data1$$read$$"); err != nil {
+		t.Errorf("alice's decision should still be cached: %v", err)
+	}
+
+	e.SetExpireTime(time.Millisecond)
+	testEnforceCache(t, e, "bob", "data2", "write", true)
+	time.Sleep(5 * time.Millisecond)
+	if _, err = c.Get("bob$$data2$$write$$"); err != cache.ErrNoSuchKey {
+		t.Errorf("bob's decision should have expired, got %v", err)
+	}
+
+	if _, err = cache.NewLRUCache(0); err == nil {
+		t.Error("zero capacity should be rejected")
+	}
+}
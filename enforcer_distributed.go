@@ -53,6 +53,7 @@ func (d *DistributedEnforcer) AddPoliciesSelf(shouldPersist func() bool, sec str
 	if err != nil {
 		return affected, err
 	}
+	defer d.policyChanged()
 
 	if sec == "g" {
 		err := d.BuildIncrementalRoleLinks(model.PolicyAdd, ptype, affected)
@@ -81,6 +82,7 @@ func (d *DistributedEnforcer) RemovePoliciesSelf(shouldPersist func() bool, sec
 	if err != nil {
 		return affected, err
 	}
+	defer d.policyChanged()
 
 	if sec == "g" {
 		err = d.BuildIncrementalRoleLinks(model.PolicyRemove, ptype, affected)
@@ -109,6 +111,7 @@ func (d *DistributedEnforcer) RemoveFilteredPolicySelf(shouldPersist func() bool
 	if err != nil {
 		return affected, err
 	}
+	defer d.policyChanged()
 
 	if sec == "g" {
 		err := d.BuildIncrementalRoleLinks(model.PolicyRemove, ptype, affected)
@@ -132,6 +135,7 @@ func (d *DistributedEnforcer) ClearPolicySelf(shouldPersist func() bool) error {
 	}
 
 	d.model.ClearPolicy()
+	d.policyChanged()
 
 	return nil
 }
@@ -151,6 +155,7 @@ func (d *DistributedEnforcer) UpdatePolicySelf(shouldPersist func() bool, sec st
 	if !ruleUpdated || err != nil {
 		return ruleUpdated, err
 	}
+	defer d.policyChanged()
 
 	if sec == "g" {
 		err := d.BuildIncrementalRoleLinks(model.PolicyRemove, ptype, [][]string{oldRule}) // remove the old rule
@@ -181,6 +186,7 @@ func (d *DistributedEnforcer) UpdatePoliciesSelf(shouldPersist func() bool, sec
 	if !ruleUpdated || err != nil {
 		return ruleUpdated, err
 	}
+	defer d.policyChanged()
 
 	if sec == "g" {
 		err := d.BuildIncrementalRoleLinks(model.PolicyRemove, ptype, oldRules) // remove the old rule
@@ -211,6 +217,7 @@ func (d *DistributedEnforcer) UpdateFilteredPoliciesSelf(shouldPersist func() bo
 		}
 	}
 
+	defer d.policyChanged()
 	ruleChanged, err := d.model.RemovePolicies(sec, ptype, oldRules)
 	if err != nil {
 		return ruleChanged, err
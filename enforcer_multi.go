@@ -0,0 +1,69 @@
+// Copyright 2023 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casbin
+
+import "fmt"
+
+// MultiMode tells how a MultiEnforcer combines the decisions of its enforcers.
+type MultiMode int
+
+const (
+	// AllMustAllow allows a request only if every enforcer allows it.
+	AllMustAllow MultiMode = iota
+	// AnyMayAllow allows a request if any enforcer allows it.
+	AnyMayAllow
+)
+
+// MultiEnforcer composes several independent enforcers, e.g. an organization policy, a team policy and
+// resource-level ACLs, into a single decision.
+type MultiEnforcer struct {
+	mode      MultiMode
+	enforcers []*Enforcer
+}
+
+// NewMultiEnforcer creates a MultiEnforcer combining the decisions of the enforcers according to mode.
+func NewMultiEnforcer(mode MultiMode, enforcers ...*Enforcer) *MultiEnforcer {
+	return &MultiEnforcer{mode: mode, enforcers: enforcers}
+}
+
+// Enforce asks the enforcers in order whether the request is allowed, and stops at the first decisive one: a deny
+// with AllMustAllow, an allow with AnyMayAllow. A request is denied if there is no enforcer, and an error of an
+// enforcer is returned at once.
+func (e *MultiEnforcer) Enforce(rvals ...interface{}) (bool, error) {
+	if e.mode != AllMustAllow && e.mode != AnyMayAllow {
+		return false, fmt.Errorf("unknown multi enforcer mode: %d", e.mode)
+	}
+	if len(e.enforcers) == 0 {
+		return false, nil
+	}
+
+	// the decision an enforcer must make to decide for all of them.
+	decisive := e.mode == AnyMayAllow
+	for _, enforcer := range e.enforcers {
+		ok, err := enforcer.Enforce(rvals...)
+		if err != nil {
+			return false, err
+		}
+		if ok == decisive {
+			return ok, nil
+		}
+	}
+	return !decisive, nil
+}
+
+// GetEnforcers returns the enforcers combined by the MultiEnforcer.
+func (e *MultiEnforcer) GetEnforcers() []*Enforcer {
+	return e.enforcers
+}
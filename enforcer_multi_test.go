@@ -0,0 +1,78 @@
+// Copyright 2023 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casbin
+
+import (
+	"testing"
+	"time"
+)
+
+// countingObserver counts the enforce calls.
+type countingObserver struct {
+	n int
+}
+
+func (o *countingObserver) ObserveEnforce(req []interface{}, allowed bool, dur time.Duration) {
+	o.n++
+}
+
+func testMultiEnforce(t *testing.T, e *MultiEnforcer, sub string, obj string, act string, res bool) {
+	t.Helper()
+	if myRes, err := e.Enforce(sub, obj, act); err != nil {
+		t.Errorf("Enforce Error: %s", err)
+	} else if myRes != res {
+		t.Errorf("%s, %s, %s: %t, supposed to be %t", sub, obj, act, myRes, res)
+	}
+}
+
+func TestMultiEnforcer(t *testing.T) {
+	basic, _ := NewEnforcer("examples/basic_model.conf", "examples/basic_policy.csv")
+	rbac, _ := NewEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
+
+	all := NewMultiEnforcer(AllMustAllow, basic, rbac)
+	testMultiEnforce(t, all, "alice", "data1", "read", true)
+	testMultiEnforce(t, all, "bob", "data2", "write", true)
+	testMultiEnforce(t, all, "alice", "data2", "read", false)
+	testMultiEnforce(t, all, "alice", "data2", "write", false)
+
+	anyOf := NewMultiEnforcer(AnyMayAllow, basic, rbac)
+	testMultiEnforce(t, anyOf, "alice", "data1", "read", true)
+	testMultiEnforce(t, anyOf, "alice", "data2", "read", true)
+	testMultiEnforce(t, anyOf, "bob", "data1", "read", false)
+
+	// the enforcers after the first decisive one are not asked.
+	counted := &countingObserver{}
+	rbac.SetEnforceObserver(counted)
+	testMultiEnforce(t, all, "bob", "data1", "read", false)
+	testMultiEnforce(t, anyOf, "alice", "data1", "read", true)
+	if counted.n != 0 {
+		t.Errorf("the second enforcer was asked %d times, supposed to be never", counted.n)
+	}
+	testMultiEnforce(t, anyOf, "alice", "data2", "read", true)
+	if counted.n != 1 {
+		t.Errorf("the second enforcer was asked %d times, supposed to be once", counted.n)
+	}
+
+	// errors are returned at once.
+	if _, err := all.Enforce("alice", "data1"); err == nil {
+		t.Error("an invalid request should fail")
+	}
+
+	testMultiEnforce(t, NewMultiEnforcer(AllMustAllow), "alice", "data1", "read", false)
+	testMultiEnforce(t, NewMultiEnforcer(AnyMayAllow), "alice", "data1", "read", false)
+	if _, err := NewMultiEnforcer(MultiMode(-1), basic).Enforce("alice", "data1", "read"); err == nil {
+		t.Error("an unknown mode should fail")
+	}
+}
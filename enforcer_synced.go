@@ -15,13 +15,16 @@
 package casbin
 
 import (
+	"context"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/casbin/govaluate"
 
+	"github.com/ApicaSystem/casbin/v2/log"
 	"github.com/ApicaSystem/casbin/v2/persist"
+	"github.com/ApicaSystem/casbin/v2/util"
 )
 
 // SyncedEnforcer wraps Enforcer and provides synchronized access.
@@ -99,6 +102,13 @@ func (e *SyncedEnforcer) SetWatcher(watcher persist.Watcher) error {
 	return e.Enforcer.SetWatcher(watcher)
 }
 
+// SetWatcherEx sets the current watcher to a WatcherEx.
+func (e *SyncedEnforcer) SetWatcherEx(watcher persist.WatcherEx) error {
+	e.m.Lock()
+	defer e.m.Unlock()
+	return e.Enforcer.SetWatcherEx(watcher)
+}
+
 // LoadModel reloads the model from the model CONF file.
 func (e *SyncedEnforcer) LoadModel() error {
 	e.m.Lock()
@@ -130,6 +140,34 @@ func (e *SyncedEnforcer) LoadPolicy() error {
 	return nil
 }
 
+// SwapAdapterAndReload replaces the adapter with the given one and reloads the policy from it as a single step.
+func (e *SyncedEnforcer) SwapAdapterAndReload(a persist.Adapter) error {
+	e.m.Lock()
+	defer e.m.Unlock()
+	return e.Enforcer.SwapAdapterAndReload(a)
+}
+
+// GetModelText returns the text of the current model.
+func (e *SyncedEnforcer) GetModelText() string {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.GetModelText()
+}
+
+// SetModelFromText replaces the model by the one defined in text, keeping the rules of the policy types defined in both.
+func (e *SyncedEnforcer) SetModelFromText(text string) error {
+	e.m.Lock()
+	defer e.m.Unlock()
+	return e.Enforcer.SetModelFromText(text)
+}
+
+// TestLoadPolicy loads the policy from the given adapter without changing the live policy and returns the number of loaded rules.
+func (e *SyncedEnforcer) TestLoadPolicy(a persist.Adapter) (int, error) {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.TestLoadPolicy(a)
+}
+
 // LoadFilteredPolicy reloads a filtered policy from file/database.
 func (e *SyncedEnforcer) LoadFilteredPolicy(filter interface{}) error {
 	e.m.Lock()
@@ -144,6 +182,98 @@ func (e *SyncedEnforcer) LoadIncrementalFilteredPolicy(filter interface{}) error
 	return e.Enforcer.LoadIncrementalFilteredPolicy(filter)
 }
 
+// LoadFilteredPolicies reloads the policy rules matching any of the filters.
+func (e *SyncedEnforcer) LoadFilteredPolicies(filters []interface{}) error {
+	e.m.Lock()
+	defer e.m.Unlock()
+	return e.Enforcer.LoadFilteredPolicies(filters)
+}
+
+// NormalizePriorityOrder stably sorts the policy rules of every policy type with a priority field by priority.
+func (e *SyncedEnforcer) NormalizePriorityOrder() error {
+	e.m.Lock()
+	defer e.m.Unlock()
+	return e.Enforcer.NormalizePriorityOrder()
+}
+
+// Snapshot deep-copies the current "p" and "g" policy so that later edits can be undone with Restore.
+func (e *SyncedEnforcer) Snapshot() *PolicySnapshot {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.Snapshot()
+}
+
+// BeginSnapshot takes a snapshot and suspends auto-save and notifications until Restore or CommitSnapshot.
+func (e *SyncedEnforcer) BeginSnapshot() *PolicySnapshot {
+	e.m.Lock()
+	defer e.m.Unlock()
+	return e.Enforcer.BeginSnapshot()
+}
+
+// Restore discards the edits made since the snapshot was taken and rebuilds the role links.
+func (e *SyncedEnforcer) Restore(s *PolicySnapshot) error {
+	e.m.Lock()
+	defer e.m.Unlock()
+	return e.Enforcer.Restore(s)
+}
+
+// CommitSnapshot keeps the edits made since BeginSnapshot, resumes auto-save and notifies the watcher.
+func (e *SyncedEnforcer) CommitSnapshot(s *PolicySnapshot) error {
+	e.m.Lock()
+	defer e.m.Unlock()
+	return e.Enforcer.CommitSnapshot(s)
+}
+
+// ExportPolicy returns a copy of all policy rules of the enforcer.
+func (e *SyncedEnforcer) ExportPolicy() Policy {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.ExportPolicy()
+}
+
+// PoliciesAddedSince returns the rules missing from a policy returned by ExportPolicy, prefixed with their policy type.
+func (e *SyncedEnforcer) PoliciesAddedSince(since Policy) [][]string {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.PoliciesAddedSince(since)
+}
+
+// PoliciesRemovedSince returns the rules of a policy returned by ExportPolicy that are missing from the policy.
+func (e *SyncedEnforcer) PoliciesRemovedSince(since Policy) [][]string {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.PoliciesRemovedSince(since)
+}
+
+// ApplyDiff applies the changes of diff to the policy, removals first, then updates and additions.
+func (e *SyncedEnforcer) ApplyDiff(diff PolicyDiff) error {
+	e.m.Lock()
+	defer e.m.Unlock()
+	return e.Enforcer.ApplyDiff(diff)
+}
+
+// BatchUpdatePolicies replaces the old rule of every update by its new rule as a single change,
+// under one write lock.
+func (e *SyncedEnforcer) BatchUpdatePolicies(updates []PolicyUpdate) error {
+	e.m.Lock()
+	defer e.m.Unlock()
+	return e.Enforcer.BatchUpdatePolicies(updates)
+}
+
+// SetStrictArity controls how policy rules whose field count does not match the policy definition are loaded.
+func (e *SyncedEnforcer) SetStrictArity(strict bool) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	e.Enforcer.SetStrictArity(strict)
+}
+
+// EnableDomainGlob controls whether the domain argument of the filtered policy and domain role queries is a glob pattern.
+func (e *SyncedEnforcer) EnableDomainGlob(enable bool) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	e.Enforcer.EnableDomainGlob(enable)
+}
+
 // SavePolicy saves the current policy (usually after changed with Casbin API) back to file/database.
 func (e *SyncedEnforcer) SavePolicy() error {
 	e.m.Lock()
@@ -158,6 +288,111 @@ func (e *SyncedEnforcer) BuildRoleLinks() error {
 	return e.Enforcer.BuildRoleLinks()
 }
 
+// BuildConditionalRoleLinks manually rebuilds only the role inheritance relations with conditions.
+func (e *SyncedEnforcer) BuildConditionalRoleLinks() error {
+	e.m.Lock()
+	defer e.m.Unlock()
+	return e.Enforcer.BuildConditionalRoleLinks()
+}
+
+// Use adds a middleware around every enforce call, see Enforcer.Use.
+func (e *SyncedEnforcer) Use(middleware func(next EnforceFunc) EnforceFunc) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	e.Enforcer.Use(middleware)
+}
+
+// SetDecisionSink sets the sink receiving a structured record of every enforce decision.
+func (e *SyncedEnforcer) SetDecisionSink(sink log.DecisionSink) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	e.Enforcer.SetDecisionSink(sink)
+}
+
+// SetModelName sets the name of the model reported to the observer set with SetObserver.
+func (e *SyncedEnforcer) SetModelName(name string) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	e.Enforcer.SetModelName(name)
+}
+
+// GetModelName gets the name of the model reported to the observer set with SetObserver.
+func (e *SyncedEnforcer) GetModelName() string {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.GetModelName()
+}
+
+// SetEnforceObserver sets the observer notified of every enforce decision, nil removes it.
+func (e *SyncedEnforcer) SetEnforceObserver(observer EnforceObserver) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	e.Enforcer.SetEnforceObserver(observer)
+}
+
+// SetObserver sets the observer notified of every enforce decision with the model name, nil removes it.
+func (e *SyncedEnforcer) SetObserver(obs EnforcerObserver) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	e.Enforcer.SetObserver(obs)
+}
+
+// SetMatcherEvalBudget sets a time budget for a single matcher evaluation, 0 disables the check.
+func (e *SyncedEnforcer) SetMatcherEvalBudget(budget time.Duration) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	e.Enforcer.SetMatcherEvalBudget(budget)
+}
+
+// SetLogger changes the current enforcer's logger.
+func (e *SyncedEnforcer) SetLogger(logger log.Logger) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	e.Enforcer.SetLogger(logger)
+}
+
+// EnableSyncedRoleManager controls whether the role managers of the grouping policies are guarded by a sync.RWMutex.
+func (e *SyncedEnforcer) EnableSyncedRoleManager(enable bool) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	e.Enforcer.EnableSyncedRoleManager(enable)
+}
+
+// EnableRejectNilRequest controls whether a request with a nil value is rejected with an error.
+func (e *SyncedEnforcer) EnableRejectNilRequest(reject bool) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	e.Enforcer.EnableRejectNilRequest(reject)
+}
+
+// OnPolicyChange registers fn to be called after every change of the in-memory policy made through the enforcer.
+func (e *SyncedEnforcer) OnPolicyChange(fn func()) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	e.Enforcer.OnPolicyChange(fn)
+}
+
+// SetClock sets the clock read by the durationMatch matcher function, also named scheduleMatch, instead of the system clock.
+func (e *SyncedEnforcer) SetClock(clock util.Clock) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	e.Enforcer.SetClock(clock)
+}
+
+// SetObjectNormalizer sets a function applied to the r.obj request value before the matcher runs.
+func (e *SyncedEnforcer) SetObjectNormalizer(normalizer func(string) string) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	e.Enforcer.SetObjectNormalizer(normalizer)
+}
+
+// SetFallbackMatcher sets a matcher consulted only when the model matcher denies a request.
+func (e *SyncedEnforcer) SetFallbackMatcher(matcher string) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	e.Enforcer.SetFallbackMatcher(matcher)
+}
+
 // Enforce decides whether a "subject" can access a "object" with the operation "action", input parameters are usually: (sub, obj, act).
 func (e *SyncedEnforcer) Enforce(rvals ...interface{}) (bool, error) {
 	e.m.RLock()
@@ -186,6 +421,55 @@ func (e *SyncedEnforcer) EnforceExWithMatcher(matcher string, rvals ...interface
 	return e.Enforcer.EnforceExWithMatcher(matcher, rvals...)
 }
 
+// EnforceWithReasons decides like Enforce and also returns human-readable reasons for the decision.
+func (e *SyncedEnforcer) EnforceWithReasons(rvals ...interface{}) (bool, []string, error) {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.EnforceWithReasons(rvals...)
+}
+
+// EnforceDecision decides like Enforce, but tells an explicit deny from a request no policy rule applies to.
+func (e *SyncedEnforcer) EnforceDecision(rvals ...interface{}) (Decision, error) {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.EnforceDecision(rvals...)
+}
+
+// EnforceWithDenyReason decides like Enforce and, if the request is denied, also returns the reason.
+func (e *SyncedEnforcer) EnforceWithDenyReason(rvals ...interface{}) (bool, *DenyReason, error) {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.EnforceWithDenyReason(rvals...)
+}
+
+// EnforceWithFunctions decides like Enforce, with funcs available to the matcher for this call only.
+func (e *SyncedEnforcer) EnforceWithFunctions(funcs map[string]govaluate.ExpressionFunction, rvals ...interface{}) (bool, error) {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.EnforceWithFunctions(funcs, rvals...)
+}
+
+// EnforceWithContext decides like Enforce, passing ctx to the functions added with AddAsyncFunction.
+func (e *SyncedEnforcer) EnforceWithContext(ctx context.Context, rvals ...interface{}) (bool, error) {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.EnforceWithContext(ctx, rvals...)
+}
+
+// EnforceExplain decides like Enforce and explains the decision.
+func (e *SyncedEnforcer) EnforceExplain(rvals ...interface{}) (bool, *Explanation, error) {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.EnforceExplain(rvals...)
+}
+
+// EnforceWithContextAttributes decides like EnforceWithContext, with the attributes of ctx available through ctx(name).
+func (e *SyncedEnforcer) EnforceWithContextAttributes(ctx context.Context, rvals ...interface{}) (bool, error) {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.EnforceWithContextAttributes(ctx, rvals...)
+}
+
 // BatchEnforce enforce in batches.
 func (e *SyncedEnforcer) BatchEnforce(requests [][]interface{}) ([]bool, error) {
 	e.m.RLock()
@@ -200,6 +484,20 @@ func (e *SyncedEnforcer) BatchEnforceWithMatcher(matcher string, requests [][]in
 	return e.Enforcer.BatchEnforceWithMatcher(matcher, requests)
 }
 
+// BatchEnforceWithOptions enforce in batches, evaluating the requests with a pool of opts.Concurrency workers.
+func (e *SyncedEnforcer) BatchEnforceWithOptions(requests [][]interface{}, opts BatchOptions) ([]bool, error) {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.BatchEnforceWithOptions(requests, opts)
+}
+
+// FilterAllowedSubjects returns the subjects of subs that are allowed to perform act on obj, in the order of subs.
+func (e *SyncedEnforcer) FilterAllowedSubjects(subs []interface{}, obj, act interface{}) ([]interface{}, error) {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.FilterAllowedSubjects(subs, obj, act)
+}
+
 // GetAllSubjects gets the list of subjects that show up in the current policy.
 func (e *SyncedEnforcer) GetAllSubjects() ([]string, error) {
 	e.m.RLock()
@@ -277,6 +575,13 @@ func (e *SyncedEnforcer) GetNamedPolicy(ptype string) ([][]string, error) {
 	return e.Enforcer.GetNamedPolicy(ptype)
 }
 
+// GetPolicyCount returns the number of authorization rules in the named policy, 0 if the policy type does not exist.
+func (e *SyncedEnforcer) GetPolicyCount(ptype string) int {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.GetPolicyCount(ptype)
+}
+
 // GetFilteredNamedPolicy gets all the authorization rules in the named policy, field filters can be specified.
 func (e *SyncedEnforcer) GetFilteredNamedPolicy(ptype string, fieldIndex int, fieldValues ...string) ([][]string, error) {
 	e.m.RLock()
@@ -353,6 +658,22 @@ func (e *SyncedEnforcer) AddPoliciesEx(rules [][]string) (bool, error) {
 	return e.Enforcer.AddPoliciesEx(rules)
 }
 
+// AddPoliciesWithAffected adds the authorization rules that are not in the current policy yet
+// and returns exactly the rules added.
+func (e *SyncedEnforcer) AddPoliciesWithAffected(rules [][]string) ([][]string, error) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	return e.Enforcer.AddPoliciesWithAffected(rules)
+}
+
+// AddNamedPoliciesWithAffected adds the authorization rules that are not in the current named policy yet
+// and returns exactly the rules added.
+func (e *SyncedEnforcer) AddNamedPoliciesWithAffected(ptype string, rules [][]string) ([][]string, error) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	return e.Enforcer.AddNamedPoliciesWithAffected(ptype, rules)
+}
+
 // AddNamedPolicy adds an authorization rule to the current named policy.
 // If the rule already exists, the function returns false and the rule will not be added.
 // Otherwise the function returns true by adding the new rule.
@@ -460,6 +781,20 @@ func (e *SyncedEnforcer) RemoveFilteredNamedPolicy(ptype string, fieldIndex int,
 	return e.Enforcer.RemoveFilteredNamedPolicy(ptype, fieldIndex, fieldValues...)
 }
 
+// ReplaceAllPolicies replaces all authorization rules in the current policy with rules.
+func (e *SyncedEnforcer) ReplaceAllPolicies(rules [][]string) (bool, error) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	return e.Enforcer.ReplaceAllPolicies(rules)
+}
+
+// ReplaceAllNamedPolicies replaces all authorization rules in the current named policy with rules.
+func (e *SyncedEnforcer) ReplaceAllNamedPolicies(ptype string, rules [][]string) (bool, error) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	return e.Enforcer.ReplaceAllNamedPolicies(ptype, rules)
+}
+
 // HasGroupingPolicy determines whether a role inheritance rule exists.
 func (e *SyncedEnforcer) HasGroupingPolicy(params ...interface{}) (bool, error) {
 	e.m.RLock()
@@ -501,6 +836,13 @@ func (e *SyncedEnforcer) AddGroupingPoliciesEx(rules [][]string) (bool, error) {
 	return e.Enforcer.AddGroupingPoliciesEx(rules)
 }
 
+// AddGroupingPoliciesFromMap adds the role inheritance rules of a user -> roles map in a single batch.
+func (e *SyncedEnforcer) AddGroupingPoliciesFromMap(m map[string][]string, domain ...string) (bool, error) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	return e.Enforcer.AddGroupingPoliciesFromMap(m, domain...)
+}
+
 // AddNamedGroupingPolicy adds a named role inheritance rule to the current policy.
 // If the rule already exists, the function returns false and the rule will not be added.
 // Otherwise the function returns true by adding the new rule.
@@ -594,6 +936,13 @@ func (e *SyncedEnforcer) RemoveFilteredNamedGroupingPolicy(ptype string, fieldIn
 	return e.Enforcer.RemoveFilteredNamedGroupingPolicy(ptype, fieldIndex, fieldValues...)
 }
 
+// SetFlagProvider sets the function resolving feature flags used by the matcher function flag(name).
+func (e *SyncedEnforcer) SetFlagProvider(provider func(name string) bool) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	e.Enforcer.SetFlagProvider(provider)
+}
+
 // AddFunction adds a customized function.
 func (e *SyncedEnforcer) AddFunction(name string, function govaluate.ExpressionFunction) {
 	e.m.Lock()
@@ -601,6 +950,27 @@ func (e *SyncedEnforcer) AddFunction(name string, function govaluate.ExpressionF
 	e.Enforcer.AddFunction(name, function)
 }
 
+// SetObjectMatcher registers the trieKeyMatch(key, pattern) matcher function backed by tm.
+func (e *SyncedEnforcer) SetObjectMatcher(tm *util.TrieMatcher) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	e.Enforcer.SetObjectMatcher(tm)
+}
+
+// AddAsyncFunction adds a customized function whose result is awaited by the matcher.
+func (e *SyncedEnforcer) AddAsyncFunction(name string, function AsyncExpressionFunction) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	e.Enforcer.AddAsyncFunction(name, function)
+}
+
+// AddPolicyValidator adds a validator for the rules of a ptype added or updated through the enforcer.
+func (e *SyncedEnforcer) AddPolicyValidator(ptype string, fn func(rule []string) error) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	e.Enforcer.AddPolicyValidator(ptype, fn)
+}
+
 func (e *SyncedEnforcer) SelfAddPolicy(sec string, ptype string, rule []string) (bool, error) {
 	e.m.Lock()
 	defer e.m.Unlock()
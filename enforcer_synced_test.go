@@ -16,10 +16,13 @@ package casbin
 
 import (
 	"sort"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/ApicaSystem/casbin/v2/errors"
+	"github.com/ApicaSystem/casbin/v2/log"
+	"github.com/ApicaSystem/casbin/v2/observe"
 	"github.com/ApicaSystem/casbin/v2/util"
 )
 
@@ -297,6 +300,8 @@ func TestSyncedEnforcerSelfRemoveFilteredPolicy(t *testing.T) {
 func TestSyncedEnforcerSelfUpdatePolicy(t *testing.T) {
 	for i := 0; i < 10; i++ {
 		e, _ := NewSyncedEnforcer("examples/basic_model.conf", "examples/basic_policy.csv")
+		// Rules are only modified in memory, keep the policy file untouched.
+		e.EnableAutoSave(false)
 		go func() { _, _ = e.SelfAddPolicy("p", "p", []string{"user1", "data1", "read"}) }()
 		go func() { _, _ = e.SelfAddPolicy("p", "p", []string{"user2", "data2", "read"}) }()
 		go func() { _, _ = e.SelfAddPolicy("p", "p", []string{"user3", "data3", "read"}) }()
@@ -352,6 +357,8 @@ func TestSyncedEnforcerSelfUpdatePolicy(t *testing.T) {
 func TestSyncedEnforcerSelfUpdatePolicies(t *testing.T) {
 	for i := 0; i < 10; i++ {
 		e, _ := NewSyncedEnforcer("examples/basic_model.conf", "examples/basic_policy.csv")
+		// Rules are only modified in memory, keep the policy file untouched.
+		e.EnableAutoSave(false)
 		go func() { _, _ = e.SelfAddPolicy("p", "p", []string{"user1", "data1", "read"}) }()
 		go func() { _, _ = e.SelfAddPolicy("p", "p", []string{"user2", "data2", "read"}) }()
 		go func() { _, _ = e.SelfAddPolicy("p", "p", []string{"user3", "data3", "read"}) }()
@@ -531,3 +538,36 @@ func TestSyncedEnforcerAddNamedGroupingPoliciesEx(t *testing.T) {
 		testSyncedEnforcerGetUsers(t, e, []string{"user1", "user2", "user3", "user4", "user5", "user6"}, "member")
 	}
 }
+
+func TestSyncedEnforcerSetters(t *testing.T) {
+	e, _ := NewSyncedEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
+
+	// the setters are safe against concurrent Enforce calls, run with -race.
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_, _ = e.Enforce("alice", "data1", "read")
+			}
+		}()
+	}
+	metrics := observe.NewMetrics()
+	e.SetEnforceObserver(metrics)
+	e.SetObserver(nil)
+	e.SetMatcherEvalBudget(time.Second)
+	e.SetLogger(&log.DefaultLogger{})
+	e.EnableSyncedRoleManager(true)
+	e.EnableRejectNilRequest(true)
+	e.OnPolicyChange(func() {})
+	wg.Wait()
+
+	testEnforceSync(t, e, "alice", "data2", "read", true)
+	if s := metrics.Snapshot(); s.Allowed == 0 {
+		t.Error("the observer set by SetEnforceObserver should be notified")
+	}
+	if _, err := e.Enforce("alice", nil, "read"); err == nil {
+		t.Error("a nil request value should be rejected")
+	}
+}
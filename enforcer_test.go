@@ -15,12 +15,24 @@
 package casbin
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 
+	Err "github.com/ApicaSystem/casbin/v2/errors"
+	"github.com/ApicaSystem/casbin/v2/log"
 	"github.com/ApicaSystem/casbin/v2/model"
+	"github.com/ApicaSystem/casbin/v2/observe"
 	fileadapter "github.com/ApicaSystem/casbin/v2/persist/file-adapter"
 	"github.com/ApicaSystem/casbin/v2/util"
+
+	"github.com/casbin/govaluate"
 )
 
 func TestKeyMatchModelInMemory(t *testing.T) {
@@ -231,6 +243,68 @@ func TestMatcherUsingInOperatorBracket(t *testing.T) {
 	testEnforce(t, e, "anyone", "data3", "read", true)
 }
 
+func TestMatcherUsingInOperatorWithPolicyValues(t *testing.T) {
+	m, _ := model.NewModelFromString(`
+[request_definition]
+r = sub, obj, act
+
+[policy_definition]
+p = sub, obj, act
+p2 = sub
+
+[role_definition]
+g = _, _
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = r.sub in policyValues('p2', 'sub') || r.obj in policyValues('g', 1) || r.sub == p.sub && r.obj == p.obj && r.act == p.act
+`)
+	e, _ := NewEnforcer(m)
+	_, _ = e.AddPolicy("alice", "data1", "read")
+	_, _ = e.AddNamedPolicies("p2", [][]string{{"root"}, {"admin"}, {"root"}})
+	_, _ = e.AddGroupingPolicy("bob", "public")
+
+	testEnforce(t, e, "alice", "data1", "read", true)
+	testEnforce(t, e, "alice", "data2", "read", false)
+	testEnforce(t, e, "root", "data2", "write", true)
+	testEnforce(t, e, "admin", "data3", "read", true)
+	testEnforce(t, e, "anyone", "public", "read", true)
+
+	// the set follows the policy.
+	_, _ = e.RemoveNamedPolicy("p2", "admin")
+	testEnforce(t, e, "admin", "data3", "read", false)
+	_, _ = e.AddGroupingPolicy("carol", "shared")
+	testEnforce(t, e, "anyone", "shared", "read", true)
+
+	values, err := e.policyValuesFunc("p2", "sub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(values, []interface{}{"root"}) {
+		t.Errorf("policyValues: %v, supposed to be [root]", values)
+	}
+	if _, err := e.policyValuesFunc("p3", "sub"); err == nil {
+		t.Error("policyValues of an unknown policy type should fail")
+	}
+	if _, err := e.policyValuesFunc("g", "sub"); err == nil {
+		t.Error("policyValues of a role definition field by name should fail")
+	}
+}
+
+func TestMatcherUsingTernaryOperator(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_model_matcher_using_ternary.conf", "examples/rbac_policy.csv")
+
+	testEnforce(t, e, "admin", "data1", "write", true)
+	testEnforce(t, e, "admin", "data3", "read", true)
+	testEnforce(t, e, "alice", "data1", "read", true)
+	testEnforce(t, e, "alice", "data1", "write", false)
+	testEnforce(t, e, "alice", "data2", "write", true)
+	testEnforce(t, e, "bob", "data1", "read", false)
+	testEnforce(t, e, "bob", "data2", "write", true)
+}
+
 func TestReloadPolicy(t *testing.T) {
 	e, _ := NewEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
 
@@ -382,6 +456,55 @@ func TestEnforceConcurrency(t *testing.T) {
 	wg.Wait()
 }
 
+func TestEnforceConcurrentWithGroupingPolicyChanges(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_model.conf")
+	e.EnableSyncedRoleManager(true)
+	_, _ = e.AddPolicy("data2_admin", "data2", "read")
+
+	const users = 1000
+	for i := 0; i < users; i++ {
+		_, _ = e.AddGroupingPolicy(fmt.Sprintf("user%d", i), "data2_admin")
+	}
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(done)
+		for i := users; i < users+20; i++ {
+			_, _ = e.AddGroupingPolicy(fmt.Sprintf("user%d", i), "data2_admin")
+			// a full rebuild must not expose a partially built role graph to enforce calls.
+			if err := e.BuildRoleLinks(); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+	for n := 0; n < 4; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; ; i = (i + 1) % users {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				user := fmt.Sprintf("user%d", i)
+				if ok, err := e.Enforce(user, "data2", "read"); err != nil || !ok {
+					t.Errorf("%s, data2, read: %t, %v, supposed to be true", user, ok, err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i := 0; i < users+20; i++ {
+		testEnforce(t, e, fmt.Sprintf("user%d", i), "data2", "read", true)
+	}
+}
+
 func TestGetAndSetModel(t *testing.T) {
 	e, _ := NewEnforcer("examples/basic_model.conf", "examples/basic_policy.csv")
 	e2, _ := NewEnforcer("examples/basic_with_root_model.conf", "examples/basic_policy.csv")
@@ -446,176 +569,900 @@ func testEnforceEx(t *testing.T, e *Enforcer, sub, obj, act interface{}, res []s
 	}
 }
 
-func TestEnforceEx(t *testing.T) {
-	e, _ := NewEnforcer("examples/basic_model.conf", "examples/basic_policy.csv")
+func testEnforceWithReasons(t *testing.T, e *Enforcer, sub, obj, act interface{}, res bool, reasons []string) {
+	t.Helper()
+	myRes, myReasons, err := e.EnforceWithReasons(sub, obj, act)
+	if err != nil {
+		t.Fatal(err)
+	}
 
-	testEnforceEx(t, e, "alice", "data1", "read", []string{"alice", "data1", "read"})
-	testEnforceEx(t, e, "alice", "data1", "write", []string{})
-	testEnforceEx(t, e, "alice", "data2", "read", []string{})
-	testEnforceEx(t, e, "alice", "data2", "write", []string{})
-	testEnforceEx(t, e, "bob", "data1", "read", []string{})
-	testEnforceEx(t, e, "bob", "data1", "write", []string{})
-	testEnforceEx(t, e, "bob", "data2", "read", []string{})
-	testEnforceEx(t, e, "bob", "data2", "write", []string{"bob", "data2", "write"})
+	if myRes != res {
+		t.Errorf("%s, %v, %s: %t, supposed to be %t", sub, obj, act, myRes, res)
+	}
+	if !util.ArrayEquals(reasons, myReasons) {
+		t.Errorf("Reasons: %q, supposed to be %q", myReasons, reasons)
+	}
+}
 
-	e, _ = NewEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
+func TestEnforceWithReasons(t *testing.T) {
+	e, _ := NewEnforcer("examples/basic_model.conf", "examples/basic_policy.csv")
 
-	testEnforceEx(t, e, "alice", "data1", "read", []string{"alice", "data1", "read"})
-	testEnforceEx(t, e, "alice", "data1", "write", []string{})
-	testEnforceEx(t, e, "alice", "data2", "read", []string{"data2_admin", "data2", "read"})
-	testEnforceEx(t, e, "alice", "data2", "write", []string{"data2_admin", "data2", "write"})
-	testEnforceEx(t, e, "bob", "data1", "read", []string{})
-	testEnforceEx(t, e, "bob", "data1", "write", []string{})
-	testEnforceEx(t, e, "bob", "data2", "read", []string{})
-	testEnforceEx(t, e, "bob", "data2", "write", []string{"bob", "data2", "write"})
+	testEnforceWithReasons(t, e, "alice", "data1", "read", true, []string{
+		"policy [alice, data1, read]: matched, effect allow",
+		"allowed by policy [alice, data1, read]"})
+	testEnforceWithReasons(t, e, "alice", "data1", "write", false, []string{
+		"policy [alice, data1, read]: not matched",
+		"policy [bob, data2, write]: not matched",
+		"denied: no policy grants alice write on data1"})
+
+	e, _ = NewEnforcer("examples/rbac_with_deny_model.conf", "examples/rbac_with_deny_policy.csv")
+
+	testEnforceWithReasons(t, e, "alice", "data2", "write", false, []string{
+		"policy [alice, data1, read, allow]: not matched",
+		"policy [bob, data2, write, allow]: not matched",
+		"policy [data2_admin, data2, read, allow]: not matched",
+		"policy [data2_admin, data2, write, allow]: matched, effect allow",
+		"policy [alice, data2, write, deny]: matched, effect deny",
+		"denied by policy [alice, data2, write, deny]"})
+
+	e, _ = NewEnforcer("examples/basic_with_root_model.conf", "examples/basic_policy.csv")
+	e.EnableEnforce(false)
+	testEnforceWithReasons(t, e, "alice", "data1", "write", true, []string{"allowed: enforcement is disabled"})
+}
 
-	e, _ = NewEnforcer("examples/priority_model.conf", "examples/priority_policy.csv")
+func TestEnforceWithDenyReason(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
 
-	testEnforceEx(t, e, "alice", "data1", "read", []string{"alice", "data1", "read", "allow"})
-	testEnforceEx(t, e, "alice", "data1", "write", []string{"data1_deny_group", "data1", "write", "deny"})
-	testEnforceEx(t, e, "alice", "data2", "read", []string{})
-	testEnforceEx(t, e, "alice", "data2", "write", []string{})
-	testEnforceEx(t, e, "bob", "data1", "write", []string{})
-	testEnforceEx(t, e, "bob", "data2", "read", []string{"data2_allow_group", "data2", "read", "allow"})
-	testEnforceEx(t, e, "bob", "data2", "write", []string{"bob", "data2", "write", "deny"})
+	testDenyReason := func(sub string, obj string, act string, res *DenyReason) {
+		t.Helper()
+		ok, reason, err := e.EnforceWithDenyReason(sub, obj, act)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != (res == nil) {
+			t.Errorf("%s, %s, %s: %t, supposed to be %t", sub, obj, act, ok, res == nil)
+		}
+		if !reflect.DeepEqual(reason, res) {
+			t.Errorf("%s, %s, %s: deny reason %+v, supposed to be %+v", sub, obj, act, reason, res)
+		}
+	}
 
-	e, _ = NewEnforcer("examples/abac_model.conf")
-	obj := struct{ Owner string }{Owner: "alice"}
-	testEnforceEx(t, e, "alice", obj, "write", []string{})
+	testDenyReason("alice", "data1", "read", nil)
+	testDenyReason("alice", "data1", "write", &DenyReason{Field: "act", RequestValue: "write", Rule: []string{"alice", "data1", "read"}})
+	testDenyReason("bob", "data2", "read", &DenyReason{Field: "act", RequestValue: "read", Rule: []string{"bob", "data2", "write"}})
+	// alice has the data2_admin role, so the closest rule is the one granting data2_admin.
+	testDenyReason("alice", "data2", "delete", &DenyReason{Field: "act", RequestValue: "delete", Rule: []string{"data2_admin", "data2", "read"}})
+	testDenyReason("alice", "data3", "read", &DenyReason{Field: "obj", RequestValue: "data3", Rule: []string{"alice", "data1", "read"}})
+
+	e, _ = NewEnforcer("examples/rbac_with_deny_model.conf", "examples/rbac_with_deny_policy.csv")
+	testDenyReason("alice", "data2", "write", &DenyReason{Rule: []string{"alice", "data2", "write", "deny"}})
+
+	// the conditions are evaluated with the functions of the matcher.
+	e, _ = NewEnforcer("examples/keymatch_model.conf", "examples/keymatch_policy.csv")
+	testDenyReason("alice", "/alice_data/resource2", "DELETE", &DenyReason{Field: "act", RequestValue: "DELETE", Rule: []string{"alice", "/alice_data/*", "GET"}})
+	testDenyReason("cathy", "/cathy_data/1", "GET", &DenyReason{Field: "obj", RequestValue: "/cathy_data/1", Rule: []string{"cathy", "/cathy_data", "(GET)|(POST)"}})
+
+	// the role is checked in the domain of the request.
+	e, _ = NewEnforcer("examples/rbac_with_domains_model.conf", "examples/rbac_with_domains_policy.csv")
+	ok, reason, err := e.EnforceWithDenyReason("alice", "domain2", "data2", "read")
+	if err != nil || ok {
+		t.Fatalf("EnforceWithDenyReason: %t, %v", ok, err)
+	}
+	if res := (&DenyReason{Field: "sub", RequestValue: "alice", Rule: []string{"admin", "domain2", "data2", "read"}}); !reflect.DeepEqual(reason, res) {
+		t.Errorf("deny reason %+v, supposed to be %+v", reason, res)
+	}
+	reason.Rule[0] = "changed"
+	if rule, _ := e.GetPolicy(); rule[2][0] != "admin" {
+		t.Error("the rule of the deny reason should be a copy")
+	}
+
+	// the request fields are found as whole identifiers.
+	rTokens := map[string]int{"r_sub": 0, "r_obj": 1, "r_act": 2}
+	for conjunct, field := range map[string]int{
+		"r_sub.Name == p_sub":                 0,
+		"keyMatch(r_obj, p_obj)":              1,
+		"r_act == p_act || r_sub == \"root\"": 0,
+		"r_subject == p_sub":                  -1,
+		"p_act == \"read\"":                   -1,
+	} {
+		if res := firstRequestField(conjunct, rTokens); res != field {
+			t.Errorf("firstRequestField(%q): %d, supposed to be %d", conjunct, res, field)
+		}
+	}
 }
 
-func TestEnforceExLog(t *testing.T) {
-	e, _ := NewEnforcer("examples/basic_model.conf", "examples/basic_policy.csv", true)
+func TestEnforceDecision(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_with_not_deny_model.conf", "examples/rbac_with_deny_policy.csv")
 
-	testEnforceEx(t, e, "alice", "data1", "read", []string{"alice", "data1", "read"})
-	testEnforceEx(t, e, "alice", "data1", "write", []string{})
-	testEnforceEx(t, e, "alice", "data2", "read", []string{})
-	testEnforceEx(t, e, "alice", "data2", "write", []string{})
-	testEnforceEx(t, e, "bob", "data1", "read", []string{})
-	testEnforceEx(t, e, "bob", "data1", "write", []string{})
-	testEnforceEx(t, e, "bob", "data2", "read", []string{})
-	testEnforceEx(t, e, "bob", "data2", "write", []string{"bob", "data2", "write"})
-}
+	testDecision := func(sub string, obj string, act string, res Decision) {
+		t.Helper()
+		decision, err := e.EnforceDecision(sub, obj, act)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decision != res {
+			t.Errorf("%s, %s, %s: %s, supposed to be %s", sub, obj, act, decision, res)
+		}
+	}
 
-func testBatchEnforce(t *testing.T, e *Enforcer, requests [][]interface{}, results []bool) {
-	t.Helper()
-	myRes, _ := e.BatchEnforce(requests)
-	if len(myRes) != len(results) {
-		t.Errorf("%v supposed to be %v", myRes, results)
+	testDecision("alice", "data1", "read", Allow)
+	testDecision("alice", "data2", "read", Allow)
+	testDecision("alice", "data2", "write", Deny)
+	// the decision does not change the explanation of deny-override, which has no rule for an allow.
+	testEnforceEx(t, e, "alice", "data1", "read", []string{})
+	// deny-override allows anything that is not denied, but no rule applies to these requests.
+	testDecision("bob", "data1", "read", NotApplicable)
+	testDecision("alice", "data3", "read", NotApplicable)
+	if ok, _ := e.Enforce("bob", "data1", "read"); !ok {
+		t.Error("bob, data1, read: false, supposed to be true")
 	}
-	for i, v := range myRes {
-		if v != results[i] {
-			t.Errorf("%v supposed to be %v", myRes, results)
+
+	e, _ = NewEnforcer("examples/rbac_with_deny_model.conf", "examples/rbac_with_deny_policy.csv")
+	testDecision("alice", "data2", "read", Allow)
+	testDecision("alice", "data2", "write", Deny)
+	testDecision("bob", "data1", "read", NotApplicable)
+
+	// an explicit deny stands if the fallback matcher denies too.
+	e.SetFallbackMatcher("r.sub == \"bob\"")
+	testDecision("alice", "data2", "write", Deny)
+	testDecision("bob", "data1", "read", Allow)
+
+	e.EnableEnforce(false)
+	testDecision("alice", "data2", "write", Allow)
+
+	// without policy, the matcher alone decides.
+	m, _ := model.NewModelFromString(`
+[request_definition]
+r = sub, obj, act
+
+[policy_definition]
+p = sub, obj, act
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = r.sub == "root"
+`)
+	e, _ = NewEnforcer(m)
+	testDecision("root", "data1", "read", Allow)
+	testDecision("alice", "data1", "read", NotApplicable)
+}
+
+func TestEnforceExplain(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
+
+	testExplanation := func(rvals []interface{}, res bool, explanation *Explanation) {
+		t.Helper()
+		ok, myExplanation, err := e.EnforceExplain(rvals...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != res {
+			t.Errorf("%v: %t, supposed to be %t", rvals, ok, res)
+		}
+		if !reflect.DeepEqual(myExplanation, explanation) {
+			t.Errorf("%v: explanation %+v, supposed to be %+v", rvals, myExplanation, explanation)
 		}
 	}
-}
 
-func TestBatchEnforce(t *testing.T) {
-	e, _ := NewEnforcer("examples/basic_model.conf", "examples/basic_policy.csv")
-	results := []bool{true, true, false}
-	testBatchEnforce(t, e, [][]interface{}{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"jack", "data3", "read"}}, results)
-}
+	testExplanation([]interface{}{"alice", "data2", "read"}, true, &Explanation{
+		Rule:    []string{"data2_admin", "data2", "read"},
+		Effect:  "allow",
+		Matcher: `g("alice", "data2_admin") && "data2" == "data2" && "read" == "read"`,
+		Links:   [][]string{{"g", "alice", "data2_admin"}},
+	})
+	testExplanation([]interface{}{"alice", "data1", "read"}, true, &Explanation{
+		Rule:    []string{"alice", "data1", "read"},
+		Effect:  "allow",
+		Matcher: `g("alice", "alice") && "data1" == "data1" && "read" == "read"`,
+	})
+	testExplanation([]interface{}{"alice", "data1", "write"}, false, &Explanation{
+		Matcher: `g("alice", p_sub) && "data1" == p_obj && "write" == p_act`,
+	})
 
-func TestSubjectPriority(t *testing.T) {
-	e, _ := NewEnforcer("examples/subject_priority_model.conf", "examples/subject_priority_policy.csv")
-	testBatchEnforce(t, e, [][]interface{}{
-		{"jane", "data1", "read"},
-		{"alice", "data1", "read"},
-	}, []bool{
-		true, true,
+	e, _ = NewEnforcer("examples/rbac_with_domains_model.conf", "examples/rbac_with_domains_policy.csv")
+	testExplanation([]interface{}{"alice", "domain1", "data1", "read"}, true, &Explanation{
+		Rule:    []string{"admin", "domain1", "data1", "read"},
+		Effect:  "allow",
+		Matcher: `g("alice", "admin", "domain1") && "domain1" == "domain1" && "data1" == "data1" && "read" == "read"`,
+		Links:   [][]string{{"g", "alice", "admin", "domain1"}},
 	})
-}
 
-func TestSubjectPriorityWithDomain(t *testing.T) {
-	e, _ := NewEnforcer("examples/subject_priority_model_with_domain.conf", "examples/subject_priority_policy_with_domain.csv")
-	testBatchEnforce(t, e, [][]interface{}{
-		{"alice", "data1", "domain1", "write"},
-		{"bob", "data2", "domain2", "write"},
-	}, []bool{
-		true, true,
+	e, _ = NewEnforcer("examples/rbac_with_deny_model.conf", "examples/rbac_with_deny_policy.csv")
+	testExplanation([]interface{}{"alice", "data2", "write"}, false, &Explanation{
+		Rule:    []string{"alice", "data2", "write", "deny"},
+		Effect:  "deny",
+		Matcher: `g("alice", "alice") && "data2" == "data2" && "write" == "write"`,
 	})
 }
 
-func TestSubjectPriorityInFilter(t *testing.T) {
-	e, _ := NewEnforcer()
+func TestMatcherEvalBudget(t *testing.T) {
+	m := model.NewModel()
+	m.AddDef("r", "r", "sub, obj, act")
+	m.AddDef("p", "p", "sub, obj, act")
+	m.AddDef("e", "e", "some(where (p.eft == allow))")
+	m.AddDef("m", "m", "slow(r.sub) && r.sub == p.sub && r.obj == p.obj && r.act == p.act")
 
-	adapter := fileadapter.NewFilteredAdapter("examples/subject_priority_policy_with_domain.csv")
-	_ = e.InitWithAdapter("examples/subject_priority_model_with_domain.conf", adapter)
-	if err := e.loadFilteredPolicy(&fileadapter.Filter{
-		P: []string{"", "", "domain1"},
-	}); err != nil {
-		t.Errorf("unexpected error in LoadFilteredPolicy: %v", err)
+	e, _ := NewEnforcer(m, fileadapter.NewAdapter("examples/basic_policy.csv"))
+	var block chan struct{}
+	e.AddFunction("slow", func(args ...interface{}) (interface{}, error) {
+		if block != nil {
+			<-block
+		}
+		return true, nil
+	})
+
+	testEnforce(t, e, "alice", "data1", "read", true)
+
+	// the evaluation blocks until the end of the test, so the call only returns if the budget aborts it.
+	block = make(chan struct{})
+	e.SetMatcherEvalBudget(10 * time.Millisecond)
+	done := make(chan error, 1)
+	go func() {
+		_, err := e.Enforce("alice", "data1", "read")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, Err.ErrEvalBudgetExceeded) {
+			t.Errorf("Enforce should exceed the evaluation budget, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Enforce should return once the evaluation budget is spent")
 	}
+	close(block)
 
-	testBatchEnforce(t, e, [][]interface{}{
-		{"alice", "data1", "domain1", "write"},
-		{"admin", "data1", "domain1", "write"},
-	}, []bool{
-		true, false,
-	})
+	e.SetMatcherEvalBudget(time.Second)
+	testEnforce(t, e, "alice", "data1", "read", true)
 }
 
-func TestMultiplePolicyDefinitions(t *testing.T) {
-	e, _ := NewEnforcer("examples/multiple_policy_definitions_model.conf", "examples/multiple_policy_definitions_policy.csv")
-	enforceContext := NewEnforceContext("2")
-	enforceContext.EType = "e"
-	testBatchEnforce(t, e, [][]interface{}{
-		{"alice", "data2", "read"},
-		{enforceContext, struct{ Age int }{Age: 70}, "/data1", "read"},
-		{enforceContext, struct{ Age int }{Age: 30}, "/data1", "read"},
-	}, []bool{
-		true, false, true,
-	})
-}
+func TestFlagProvider(t *testing.T) {
+	m := model.NewModel()
+	m.AddDef("r", "r", "sub, obj, act")
+	m.AddDef("p", "p", "sub, obj, act")
+	m.AddDef("e", "e", "some(where (p.eft == allow))")
+	m.AddDef("m", "m", `flag("beta") && r.sub == p.sub && keyMatch(r.obj, p.obj) && regexMatch(r.act, p.act)`)
 
-func TestPriorityExplicit(t *testing.T) {
-	e, _ := NewEnforcer("examples/priority_model_explicit.conf", "examples/priority_policy_explicit.csv")
-	testBatchEnforce(t, e, [][]interface{}{
-		{"alice", "data1", "write"},
-		{"alice", "data1", "read"},
-		{"bob", "data2", "read"},
-		{"bob", "data2", "write"},
-		{"data1_deny_group", "data1", "read"},
-		{"data1_deny_group", "data1", "write"},
-		{"data2_allow_group", "data2", "read"},
-		{"data2_allow_group", "data2", "write"},
-	}, []bool{
-		true, true, false, true, false, false, true, true,
-	})
+	e, _ := NewEnforcer(m, fileadapter.NewAdapter("examples/keymatch_policy.csv"))
 
-	_, err := e.AddPolicy("1", "bob", "data2", "write", "deny")
-	if err != nil {
-		t.Fatalf("Add Policy: %v", err)
+	if _, err := e.Enforce("alice", "/alice_data/resource1", "GET"); err == nil {
+		t.Error("Enforce should fail while flag() is not registered")
 	}
 
-	testBatchEnforce(t, e, [][]interface{}{
-		{"alice", "data1", "write"},
-		{"alice", "data1", "read"},
-		{"bob", "data2", "read"},
-		{"bob", "data2", "write"},
-		{"data1_deny_group", "data1", "read"},
-		{"data1_deny_group", "data1", "write"},
-		{"data2_allow_group", "data2", "read"},
-		{"data2_allow_group", "data2", "write"},
-	}, []bool{
-		true, true, false, false, false, false, true, true,
+	flags := map[string]bool{}
+	e.SetFlagProvider(func(name string) bool {
+		return flags[name]
 	})
-}
+	testEnforce(t, e, "alice", "/alice_data/resource1", "GET", false)
 
-func TestFailedToLoadPolicy(t *testing.T) {
-	e, _ := NewEnforcer("examples/rbac_with_pattern_model.conf", "examples/rbac_with_pattern_policy.csv")
-	e.AddNamedMatchingFunc("g2", "matchingFunc", util.KeyMatch2)
-	testEnforce(t, e, "alice", "/book/1", "GET", true)
-	testEnforce(t, e, "bob", "/pen/3", "GET", true)
-	e.SetAdapter(fileadapter.NewAdapter("not found"))
-	_ = e.LoadPolicy()
-	testEnforce(t, e, "alice", "/book/1", "GET", true)
-	testEnforce(t, e, "bob", "/pen/3", "GET", true)
+	flags["beta"] = true
+	testEnforce(t, e, "alice", "/alice_data/resource1", "GET", true)
+	testEnforce(t, e, "bob", "/alice_data/resource1", "GET", false)
+
+	flags["beta"] = false
+	testEnforce(t, e, "alice", "/alice_data/resource1", "GET", false)
+
+	e.SetFlagProvider(nil)
+	testEnforce(t, e, "alice", "/alice_data/resource1", "GET", false)
 }
 
-func TestReloadPolicyWithFunc(t *testing.T) {
-	e, _ := NewEnforcer("examples/rbac_with_pattern_model.conf", "examples/rbac_with_pattern_policy.csv")
-	e.AddNamedMatchingFunc("g2", "matchingFunc", util.KeyMatch2)
+func TestEnforceWithFunctions(t *testing.T) {
+	m := model.NewModel()
+	m.AddDef("r", "r", "sub, obj, act")
+	m.AddDef("p", "p", "sub, obj, act")
+	m.AddDef("e", "e", "some(where (p.eft == allow))")
+	m.AddDef("m", "m", "r.sub == p.sub && r.obj == p.obj && r.act == p.act || isOwner(r.sub, r.obj)")
+
+	e, _ := NewEnforcer(m, fileadapter.NewAdapter("examples/basic_policy.csv"))
+	e.AddFunction("isOwner", func(args ...interface{}) (interface{}, error) {
+		return false, nil
+	})
+
+	// ownedBy returns a function whose closure captures the owner of the requested object.
+	ownedBy := func(owner string) map[string]govaluate.ExpressionFunction {
+		return map[string]govaluate.ExpressionFunction{
+			"isOwner": func(args ...interface{}) (interface{}, error) {
+				return args[0].(string) == owner, nil
+			},
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if res, err := e.EnforceWithFunctions(ownedBy("bob"), "bob", "data1", "write"); !res || err != nil {
+				t.Errorf("bob should own data1: %t, %v", res, err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if res, err := e.EnforceWithFunctions(ownedBy("alice"), "bob", "data1", "write"); res || err != nil {
+				t.Errorf("bob should not own data1: %t, %v", res, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// The functions of a single call do not leak into later calls.
+	testEnforce(t, e, "bob", "data1", "write", false)
+	testEnforce(t, e, "alice", "data1", "read", true)
+}
+
+type testStructuredLogger struct {
+	log.DefaultLogger
+	entries [][]log.Field
+}
+
+type testCtxKey struct{}
+
+func TestSetObjectMatcher(t *testing.T) {
+	m, _ := model.NewModelFromString(`
+[request_definition]
+r = sub, obj, act
+
+[policy_definition]
+p = sub, obj, act
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = r.sub == p.sub && trieKeyMatch(r.obj, p.obj) && regexMatch(r.act, p.act)
+`)
+	e, _ := NewEnforcer(m, fileadapter.NewAdapter("examples/keymatch2_policy.csv"))
+	e.EnableAutoSave(false)
+
+	objects, _ := e.GetAllObjects()
+	e.SetObjectMatcher(util.NewTrieMatcher(objects...))
+
+	testEnforce(t, e, "alice", "/alice_data", "GET", false)
+	testEnforce(t, e, "alice", "/alice_data/resource1", "GET", true)
+	testEnforce(t, e, "alice", "/alice_data2/myid", "GET", false)
+	testEnforce(t, e, "alice", "/alice_data2/myid/using/res_id", "GET", true)
+
+	// a pattern added after the matcher was built falls back to keyMatch2.
+	_, _ = e.AddPolicy("alice", "/bob_data/*", "GET")
+	testEnforce(t, e, "alice", "/bob_data/report", "GET", true)
+}
+
+func TestAddAsyncFunction(t *testing.T) {
+	m := model.NewModel()
+	m.AddDef("r", "r", "sub, obj, act")
+	m.AddDef("p", "p", "sub, obj, act")
+	m.AddDef("e", "e", "some(where (p.eft == allow))")
+	m.AddDef("m", "m", "r.sub == p.sub && r.obj == p.obj && r.act == p.act || department(r.sub) == r.obj")
+
+	e, _ := NewEnforcer(m, fileadapter.NewAdapter("examples/basic_policy.csv"))
+	departments := map[string]string{"carol": "data2"}
+	var requestID interface{}
+	e.AddAsyncFunction("department", func(ctx context.Context, args ...interface{}) <-chan AsyncResult {
+		res := make(chan AsyncResult, 1)
+		go func() {
+			requestID = ctx.Value(testCtxKey{})
+			if args[0] == "dave" {
+				// a lookup hanging until the request is cancelled.
+				<-ctx.Done()
+				return
+			}
+			res <- AsyncResult{Value: departments[args[0].(string)]}
+		}()
+		return res
+	})
+
+	testEnforce(t, e, "alice", "data1", "read", true)
+	testEnforce(t, e, "carol", "data2", "write", true)
+	testEnforce(t, e, "carol", "data1", "read", false)
+
+	ctx := context.WithValue(context.Background(), testCtxKey{}, "42")
+	if res, err := e.EnforceWithContext(ctx, "carol", "data2", "read"); !res || err != nil {
+		t.Errorf("carol should read data2: %t, %v", res, err)
+	}
+	if requestID != "42" {
+		t.Errorf("the async function got request %v, supposed to be 42", requestID)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if res, err := e.EnforceWithContext(ctx, "dave", "data2", "read"); res || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("the lookup should have been given up: %t, %v", res, err)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if _, err := e.EnforceWithContext(ctx, "carol", "data2", "read"); !errors.Is(err, context.Canceled) {
+		t.Errorf("a cancelled request should not be decided: %v", err)
+	}
+}
+
+func TestEnforceWithContextAttributes(t *testing.T) {
+	m := model.NewModel()
+	m.AddDef("r", "r", "sub, obj, act")
+	m.AddDef("p", "p", "sub, obj, act")
+	m.AddDef("e", "e", "some(where (p.eft == allow))")
+	m.AddDef("m", "m", `r.sub == p.sub && r.obj == p.obj && r.act == p.act && ipMatch(ctx("ip"), "10.0.0.0/8") && ctx("hour") < 18`)
+
+	e, _ := NewEnforcer(m, fileadapter.NewAdapter("examples/basic_policy.csv"))
+
+	testCtxEnforce := func(attributes map[string]interface{}, res bool) {
+		t.Helper()
+		ctx := WithAttributes(context.Background(), attributes)
+		ok, err := e.EnforceWithContextAttributes(ctx, "alice", "data1", "read")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != res {
+			t.Errorf("%v: %t, supposed to be %t", attributes, ok, res)
+		}
+	}
+
+	testCtxEnforce(map[string]interface{}{"ip": "10.1.2.3", "hour": 9}, true)
+	testCtxEnforce(map[string]interface{}{"ip": "192.168.1.1", "hour": 9}, false)
+	testCtxEnforce(map[string]interface{}{"ip": "10.1.2.3", "hour": 20}, false)
+
+	// the attributes are only available to this call.
+	if _, err := e.Enforce("alice", "data1", "read"); err == nil {
+		t.Error("ctx() should not be available to Enforce")
+	}
+
+	// the compiled matcher is shared, but every call sees its own attributes.
+	var wg sync.WaitGroup
+	errs := make(chan error, 100)
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ip, res := "10.1.2.3", true
+			if i%2 == 1 {
+				ip, res = "192.168.1.1", false
+			}
+			ctx := WithAttributes(context.Background(), map[string]interface{}{"ip": ip, "hour": 9})
+			if ok, err := e.EnforceWithContextAttributes(ctx, "alice", "data1", "read"); err != nil || ok != res {
+				errs <- fmt.Errorf("%s: %t, %v, supposed to be %t", ip, ok, err, res)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func (l *testStructuredLogger) LogEnforceResult(request []interface{}, result bool, matchedRule []string) {
+	l.entries = append(l.entries, log.EnforceFields(request, result, matchedRule))
+}
+
+func TestStructuredLogger(t *testing.T) {
+	e, _ := NewEnforcer("examples/basic_model.conf", "examples/basic_policy.csv")
+	logger := &testStructuredLogger{}
+	e.SetLogger(logger)
+
+	// nothing is logged while the logger is disabled.
+	testEnforce(t, e, "alice", "data1", "read", true)
+	if len(logger.entries) != 0 {
+		t.Errorf("a disabled logger got %d entries, supposed to be none", len(logger.entries))
+	}
+
+	logger.EnableLog(true)
+	testEnforce(t, e, "alice", "data1", "read", true)
+	testEnforce(t, e, "alice", "data2", "read", false)
+
+	expected := [][]log.Field{
+		{
+			{Key: "request", Value: []interface{}{"alice", "data1", "read"}},
+			{Key: "result", Value: true},
+			{Key: "matched_rule", Value: []string{"alice", "data1", "read"}},
+		},
+		{
+			{Key: "request", Value: []interface{}{"alice", "data2", "read"}},
+			{Key: "result", Value: false},
+			{Key: "matched_rule", Value: []string(nil)},
+		},
+	}
+	if !reflect.DeepEqual(logger.entries, expected) {
+		t.Errorf("structured log entries = %v, supposed to be %v", logger.entries, expected)
+	}
+}
+
+func TestEnforceObserver(t *testing.T) {
+	e, _ := NewEnforcer("examples/basic_model.conf", "examples/basic_policy.csv")
+	metrics := observe.NewMetrics()
+	e.SetEnforceObserver(metrics)
+
+	testEnforce(t, e, "alice", "data1", "read", true)
+	testEnforce(t, e, "alice", "data1", "write", false)
+	testEnforce(t, e, "bob", "data2", "write", true)
+	_, _, _ = e.EnforceEx("bob", "data2", "read")
+	if _, err := e.Enforce("bob", "data2"); err == nil {
+		t.Error("Enforce should fail for a request of the wrong size")
+	}
+
+	s := metrics.Snapshot()
+	if s.Allowed != 2 || s.Denied != 2 || s.Errors != 1 {
+		t.Errorf("allowed %d, denied %d, errors %d, supposed to be 2, 2, 1", s.Allowed, s.Denied, s.Errors)
+	}
+
+	e.SetEnforceObserver(nil)
+	testEnforce(t, e, "alice", "data1", "read", true)
+	if s = metrics.Snapshot(); s.Allowed != 2 {
+		t.Errorf("allowed %d after removing the observer, supposed to be 2", s.Allowed)
+	}
+}
+
+type modelObservation struct {
+	allowed bool
+	model   string
+}
+
+type recordingObserver struct {
+	observations []modelObservation
+}
+
+func (o *recordingObserver) ObserveEnforce(allowed bool, duration time.Duration, model string) {
+	o.observations = append(o.observations, modelObservation{allowed, model})
+}
+
+func TestObserver(t *testing.T) {
+	e, _ := NewEnforcer("examples/basic_model.conf", "examples/basic_policy.csv")
+	obs := &recordingObserver{}
+	e.SetObserver(obs)
+
+	testEnforce(t, e, "alice", "data1", "read", true)
+	testEnforce(t, e, "alice", "data1", "write", false)
+
+	expected := []modelObservation{{true, "examples/basic_model.conf"}, {false, "examples/basic_model.conf"}}
+	if !reflect.DeepEqual(obs.observations, expected) {
+		t.Errorf("observations = %v, supposed to be %v", obs.observations, expected)
+	}
+
+	e.SetObserver(nil)
+	testEnforce(t, e, "alice", "data1", "read", true)
+	if len(obs.observations) != 2 {
+		t.Errorf("%d observations after removing the observer, supposed to be 2", len(obs.observations))
+	}
+
+	// a model created in memory is reported by the name it is given, and the observer is notified along with
+	// the enforce observer.
+	m, _ := model.NewModelFromFile("examples/basic_model.conf")
+	e, _ = NewEnforcer(m, fileadapter.NewAdapter("examples/basic_policy.csv"))
+	obs = &recordingObserver{}
+	e.SetObserver(obs)
+	metrics := observe.NewMetrics()
+	e.SetEnforceObserver(metrics)
+	testEnforce(t, e, "alice", "data1", "read", true)
+	e.SetModelName("basic")
+	testEnforce(t, e, "alice", "data1", "write", false)
+
+	expected = []modelObservation{{true, "memory"}, {false, "basic"}}
+	if !reflect.DeepEqual(obs.observations, expected) {
+		t.Errorf("observations = %v, supposed to be %v", obs.observations, expected)
+	}
+	if s := metrics.Snapshot(); s.Allowed != 1 || s.Denied != 1 {
+		t.Errorf("allowed %d, denied %d, supposed to be 1, 1", s.Allowed, s.Denied)
+	}
+}
+
+func TestDecisionSink(t *testing.T) {
+	e, _ := NewEnforcer("examples/basic_model.conf", "examples/basic_policy.csv")
+	ch := make(chan log.DecisionRecord, 3)
+	sink := log.NewChannelSink(ch)
+	e.SetDecisionSink(sink)
+
+	testEnforce(t, e, "alice", "data1", "read", true)
+	testEnforce(t, e, "alice", "data1", "write", false)
+	testEnforceEx(t, e, "bob", "data2", "write", []string{"bob", "data2", "write"})
+	// calls failing with an error are not recorded.
+	if _, err := e.Enforce("alice", "data1"); err == nil {
+		t.Error("an invalid request should fail")
+	}
+	// records are dropped once the channel is full.
+	testEnforce(t, e, "bob", "data2", "write", true)
+	if sink.Dropped() != 1 {
+		t.Errorf("dropped %d records, supposed to be 1", sink.Dropped())
+	}
+	close(ch)
+
+	expected := []log.DecisionRecord{
+		{Request: []interface{}{"alice", "data1", "read"}, MatchedRule: []string{"alice", "data1", "read"}, Allowed: true},
+		{Request: []interface{}{"alice", "data1", "write"}},
+		{Request: []interface{}{"bob", "data2", "write"}, MatchedRule: []string{"bob", "data2", "write"}, Allowed: true},
+	}
+	var records []log.DecisionRecord
+	for record := range ch {
+		if record.Time.IsZero() || record.Latency < 0 {
+			t.Errorf("record without time or latency: %+v", record)
+		}
+		record.Time, record.Latency = time.Time{}, 0
+		records = append(records, record)
+	}
+	if !reflect.DeepEqual(records, expected) {
+		t.Errorf("records = %+v, supposed to be %+v", records, expected)
+	}
+	// the matched rule is a copy.
+	records[2].MatchedRule[0] = "changed"
+	if ok, _ := e.HasPolicy("bob", "data2", "write"); !ok {
+		t.Error("changing a recorded rule should not change the policy")
+	}
+
+	var buf strings.Builder
+	e.SetDecisionSink(log.NewWriterSink(&buf))
+	testEnforce(t, e, "alice", "data1", "read", true)
+	if line := buf.String(); !strings.Contains(line, `"request":["alice","data1","read"],"matched_rule":["alice","data1","read"],"allowed":true`) {
+		t.Errorf("written record: %s", line)
+	}
+
+	e.SetDecisionSink(nil)
+	testEnforce(t, e, "alice", "data1", "read", true)
+	if n := strings.Count(buf.String(), "\n"); n != 1 {
+		t.Errorf("%d records written after removing the sink, supposed to be 1", n)
+	}
+
+	// the sink and an observer are both notified.
+	buf.Reset()
+	e.SetDecisionSink(log.NewWriterSink(&buf))
+	metrics := observe.NewMetrics()
+	e.SetEnforceObserver(metrics)
+	testEnforce(t, e, "alice", "data1", "read", true)
+	testEnforce(t, e, "alice", "data1", "write", false)
+	if _, err := e.Enforce("alice", "data1"); err == nil {
+		t.Error("an invalid request should fail")
+	}
+	s := metrics.Snapshot()
+	if n := strings.Count(buf.String(), "\n"); n != 2 || s.Allowed != 1 || s.Denied != 1 || s.Errors != 1 {
+		t.Errorf("%d records written and %d allowed, %d denied, %d errors observed, supposed to be 2 and 1, 1, 1",
+			n, s.Allowed, s.Denied, s.Errors)
+	}
+}
+
+func TestEnforceEx(t *testing.T) {
+	e, _ := NewEnforcer("examples/basic_model.conf", "examples/basic_policy.csv")
+
+	testEnforceEx(t, e, "alice", "data1", "read", []string{"alice", "data1", "read"})
+	testEnforceEx(t, e, "alice", "data1", "write", []string{})
+	testEnforceEx(t, e, "alice", "data2", "read", []string{})
+	testEnforceEx(t, e, "alice", "data2", "write", []string{})
+	testEnforceEx(t, e, "bob", "data1", "read", []string{})
+	testEnforceEx(t, e, "bob", "data1", "write", []string{})
+	testEnforceEx(t, e, "bob", "data2", "read", []string{})
+	testEnforceEx(t, e, "bob", "data2", "write", []string{"bob", "data2", "write"})
+
+	e, _ = NewEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
+
+	testEnforceEx(t, e, "alice", "data1", "read", []string{"alice", "data1", "read"})
+	testEnforceEx(t, e, "alice", "data1", "write", []string{})
+	testEnforceEx(t, e, "alice", "data2", "read", []string{"data2_admin", "data2", "read"})
+	testEnforceEx(t, e, "alice", "data2", "write", []string{"data2_admin", "data2", "write"})
+	testEnforceEx(t, e, "bob", "data1", "read", []string{})
+	testEnforceEx(t, e, "bob", "data1", "write", []string{})
+	testEnforceEx(t, e, "bob", "data2", "read", []string{})
+	testEnforceEx(t, e, "bob", "data2", "write", []string{"bob", "data2", "write"})
+
+	e, _ = NewEnforcer("examples/priority_model.conf", "examples/priority_policy.csv")
+
+	testEnforceEx(t, e, "alice", "data1", "read", []string{"alice", "data1", "read", "allow"})
+	testEnforceEx(t, e, "alice", "data1", "write", []string{"data1_deny_group", "data1", "write", "deny"})
+	testEnforceEx(t, e, "alice", "data2", "read", []string{})
+	testEnforceEx(t, e, "alice", "data2", "write", []string{})
+	testEnforceEx(t, e, "bob", "data1", "write", []string{})
+	testEnforceEx(t, e, "bob", "data2", "read", []string{"data2_allow_group", "data2", "read", "allow"})
+	testEnforceEx(t, e, "bob", "data2", "write", []string{"bob", "data2", "write", "deny"})
+
+	e, _ = NewEnforcer("examples/abac_model.conf")
+	obj := struct{ Owner string }{Owner: "alice"}
+	testEnforceEx(t, e, "alice", obj, "write", []string{})
+}
+
+func TestEnforceExLog(t *testing.T) {
+	e, _ := NewEnforcer("examples/basic_model.conf", "examples/basic_policy.csv", true)
+
+	testEnforceEx(t, e, "alice", "data1", "read", []string{"alice", "data1", "read"})
+	testEnforceEx(t, e, "alice", "data1", "write", []string{})
+	testEnforceEx(t, e, "alice", "data2", "read", []string{})
+	testEnforceEx(t, e, "alice", "data2", "write", []string{})
+	testEnforceEx(t, e, "bob", "data1", "read", []string{})
+	testEnforceEx(t, e, "bob", "data1", "write", []string{})
+	testEnforceEx(t, e, "bob", "data2", "read", []string{})
+	testEnforceEx(t, e, "bob", "data2", "write", []string{"bob", "data2", "write"})
+}
+
+func testBatchEnforce(t *testing.T, e *Enforcer, requests [][]interface{}, results []bool) {
+	t.Helper()
+	myRes, _ := e.BatchEnforce(requests)
+	if len(myRes) != len(results) {
+		t.Errorf("%v supposed to be %v", myRes, results)
+	}
+	for i, v := range myRes {
+		if v != results[i] {
+			t.Errorf("%v supposed to be %v", myRes, results)
+		}
+	}
+}
+
+func TestBatchEnforce(t *testing.T) {
+	e, _ := NewEnforcer("examples/basic_model.conf", "examples/basic_policy.csv")
+	results := []bool{true, true, false}
+	testBatchEnforce(t, e, [][]interface{}{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"jack", "data3", "read"}}, results)
+}
+
+func TestFilterAllowedSubjects(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
+
+	subs := []interface{}{"alice", "bob", "data2_admin", "eve"}
+	allowed, err := e.FilterAllowedSubjects(subs, "data2", "write")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(allowed, []interface{}{"alice", "bob", "data2_admin"}) {
+		t.Errorf("FilterAllowedSubjects: %v, supposed to be [alice bob data2_admin]", allowed)
+	}
+
+	allowed, err = e.FilterAllowedSubjects(subs, "data1", "write")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(allowed) != 0 {
+		t.Errorf("FilterAllowedSubjects: %v, supposed to be empty", allowed)
+	}
+
+	// an observer sees the decision of every subject.
+	obs := &recordingObserver{}
+	e.SetObserver(obs)
+	allowed, err = e.FilterAllowedSubjects(subs, "data2", "write")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(allowed, []interface{}{"alice", "bob", "data2_admin"}) || len(obs.observations) != len(subs) {
+		t.Errorf("FilterAllowedSubjects: %v with %d observations, supposed to be [alice bob data2_admin] with %d", allowed, len(obs.observations), len(subs))
+	}
+}
+
+func TestSubjectPriority(t *testing.T) {
+	e, _ := NewEnforcer("examples/subject_priority_model.conf", "examples/subject_priority_policy.csv")
+	testBatchEnforce(t, e, [][]interface{}{
+		{"jane", "data1", "read"},
+		{"alice", "data1", "read"},
+	}, []bool{
+		true, true,
+	})
+}
+
+func TestSubjectPriorityWithDomain(t *testing.T) {
+	e, _ := NewEnforcer("examples/subject_priority_model_with_domain.conf", "examples/subject_priority_policy_with_domain.csv")
+	testBatchEnforce(t, e, [][]interface{}{
+		{"alice", "data1", "domain1", "write"},
+		{"bob", "data2", "domain2", "write"},
+	}, []bool{
+		true, true,
+	})
+}
+
+func TestSubjectPriorityInFilter(t *testing.T) {
+	e, _ := NewEnforcer()
+
+	adapter := fileadapter.NewFilteredAdapter("examples/subject_priority_policy_with_domain.csv")
+	_ = e.InitWithAdapter("examples/subject_priority_model_with_domain.conf", adapter)
+	if err := e.loadFilteredPolicy(&fileadapter.Filter{
+		P: []string{"", "", "domain1"},
+	}); err != nil {
+		t.Errorf("unexpected error in LoadFilteredPolicy: %v", err)
+	}
+
+	testBatchEnforce(t, e, [][]interface{}{
+		{"alice", "data1", "domain1", "write"},
+		{"admin", "data1", "domain1", "write"},
+	}, []bool{
+		true, false,
+	})
+}
+
+func TestMultiplePolicyDefinitions(t *testing.T) {
+	e, _ := NewEnforcer("examples/multiple_policy_definitions_model.conf", "examples/multiple_policy_definitions_policy.csv")
+	enforceContext := NewEnforceContext("2")
+	enforceContext.EType = "e"
+	testBatchEnforce(t, e, [][]interface{}{
+		{"alice", "data2", "read"},
+		{enforceContext, struct{ Age int }{Age: 70}, "/data1", "read"},
+		{enforceContext, struct{ Age int }{Age: 30}, "/data1", "read"},
+	}, []bool{
+		true, false, true,
+	})
+}
+
+func TestPriorityExplicit(t *testing.T) {
+	e, _ := NewEnforcer("examples/priority_model_explicit.conf", "examples/priority_policy_explicit.csv")
+	testBatchEnforce(t, e, [][]interface{}{
+		{"alice", "data1", "write"},
+		{"alice", "data1", "read"},
+		{"bob", "data2", "read"},
+		{"bob", "data2", "write"},
+		{"data1_deny_group", "data1", "read"},
+		{"data1_deny_group", "data1", "write"},
+		{"data2_allow_group", "data2", "read"},
+		{"data2_allow_group", "data2", "write"},
+	}, []bool{
+		true, true, false, true, false, false, true, true,
+	})
+
+	_, err := e.AddPolicy("1", "bob", "data2", "write", "deny")
+	if err != nil {
+		t.Fatalf("Add Policy: %v", err)
+	}
+
+	testBatchEnforce(t, e, [][]interface{}{
+		{"alice", "data1", "write"},
+		{"alice", "data1", "read"},
+		{"bob", "data2", "read"},
+		{"bob", "data2", "write"},
+		{"data1_deny_group", "data1", "read"},
+		{"data1_deny_group", "data1", "write"},
+		{"data2_allow_group", "data2", "read"},
+		{"data2_allow_group", "data2", "write"},
+	}, []bool{
+		true, true, false, false, false, false, true, true,
+	})
+}
+
+func TestBatchEnforceWithOptions(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
+
+	var requests [][]interface{}
+	for i := 0; i < 100; i++ {
+		for _, sub := range []string{"alice", "bob", "data2_admin", "eve"} {
+			for _, obj := range []string{"data1", "data2"} {
+				requests = append(requests, []interface{}{sub, obj, "read"}, []interface{}{sub, obj, "write"})
+			}
+		}
+	}
+	expected, err := e.BatchEnforce(requests)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, concurrency := range []int{0, 1, 4, 2000} {
+		results, err := e.BatchEnforceWithOptions(requests, BatchOptions{Concurrency: concurrency})
+		if err != nil {
+			t.Fatalf("concurrency %d: %v", concurrency, err)
+		}
+		if !reflect.DeepEqual(expected, results) {
+			t.Errorf("concurrency %d: results differ from BatchEnforce", concurrency)
+		}
+	}
+
+	// the results of the requests before the failed one are returned, like BatchEnforce.
+	requests[len(requests)/2] = []interface{}{"alice", "data1"}
+	requests[len(requests)/2+10] = []interface{}{"bob", "data2"}
+	expected, err = e.BatchEnforce(requests)
+	if err == nil || len(expected) != len(requests)/2 {
+		t.Fatalf("BatchEnforce: %d results, %v", len(expected), err)
+	}
+	for _, concurrency := range []int{1, 4, 2000} {
+		results, err := e.BatchEnforceWithOptions(requests, BatchOptions{Concurrency: concurrency})
+		if err == nil {
+			t.Errorf("concurrency %d: an invalid request should fail the batch", concurrency)
+		}
+		if !reflect.DeepEqual(expected, results) {
+			t.Errorf("concurrency %d: %d results, supposed to be %d", concurrency, len(results), len(expected))
+		}
+	}
+}
+
+func TestFailedToLoadPolicy(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_with_pattern_model.conf", "examples/rbac_with_pattern_policy.csv")
+	e.AddNamedMatchingFunc("g2", "matchingFunc", util.KeyMatch2)
+	testEnforce(t, e, "alice", "/book/1", "GET", true)
+	testEnforce(t, e, "bob", "/pen/3", "GET", true)
+	e.SetAdapter(fileadapter.NewAdapter("not found"))
+	_ = e.LoadPolicy()
+	testEnforce(t, e, "alice", "/book/1", "GET", true)
+	testEnforce(t, e, "bob", "/pen/3", "GET", true)
+}
+
+func TestReloadPolicyWithFunc(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_with_pattern_model.conf", "examples/rbac_with_pattern_policy.csv")
+	e.AddNamedMatchingFunc("g2", "matchingFunc", util.KeyMatch2)
 	testEnforce(t, e, "alice", "/book/1", "GET", true)
 	testEnforce(t, e, "bob", "/pen/3", "GET", true)
 	_ = e.LoadPolicy()
@@ -630,6 +1477,52 @@ func TestEvalPriority(t *testing.T) {
 	testEnforce(t, e, "user", "users", "write", false)
 }
 
+func TestBuildConditionalRoleLinks(t *testing.T) {
+	m, _ := model.NewModelFromString(`
+[request_definition]
+r = sub, obj, act
+
+[policy_definition]
+p = sub, obj, act
+
+[role_definition]
+g = _, _
+g2 = _, _, (_, _)
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = (g(r.sub, p.sub) || g2(r.sub, p.sub)) && r.obj == p.obj && r.act == p.act
+`)
+	e, _ := NewEnforcer(m)
+	_, _ = e.AddPolicies([][]string{{"data1_admin", "data1", "read"}, {"data2_admin", "data2", "read"}})
+	_, _ = e.AddNamedGroupingPolicies("g2", [][]string{{"alice", "data2_admin", "_", "_"}})
+	testEnforce(t, e, "alice", "data2", "read", true)
+
+	// a link added to the role manager without a rule is only dropped by a full rebuild.
+	if err := e.GetRoleManager().AddLink("bob", "data1_admin"); err != nil {
+		t.Fatal(err)
+	}
+	testEnforce(t, e, "bob", "data1", "read", true)
+
+	// change the conditional rules behind the back of the role managers.
+	_, _ = e.GetModel().RemovePolicy("g", "g2", []string{"alice", "data2_admin", "_", "_"})
+	_ = e.GetModel().AddPolicy("g", "g2", []string{"carol", "data2_admin", "_", "_"})
+	testEnforce(t, e, "alice", "data2", "read", true)
+	testEnforce(t, e, "carol", "data2", "read", false)
+
+	if err := e.BuildConditionalRoleLinks(); err != nil {
+		t.Fatal(err)
+	}
+	testEnforce(t, e, "alice", "data2", "read", false)
+	testEnforce(t, e, "carol", "data2", "read", true)
+	if ok, _ := e.GetRoleManager().HasLink("bob", "data1_admin"); !ok {
+		t.Error("the role links without conditions should not be rebuilt")
+	}
+	testEnforce(t, e, "bob", "data1", "read", true)
+}
+
 func TestLinkConditionFunc(t *testing.T) {
 	TrueFunc := func(args ...string) (bool, error) {
 		if len(args) != 0 {
@@ -733,3 +1626,487 @@ func TestLinkConditionFunc(t *testing.T) {
 	testDomainEnforce(t, e, "alice", "domain5", "data5", "read", false)
 	testDomainEnforce(t, e, "alice", "domain5", "data5", "write", false)
 }
+
+func TestTestLoadPolicy(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
+
+	ruleCount, err := e.TestLoadPolicy(fileadapter.NewAdapter("examples/basic_policy.csv"))
+	if err != nil {
+		t.Fatalf("TestLoadPolicy: %v", err)
+	}
+	if ruleCount != 2 {
+		t.Errorf("TestLoadPolicy: rule count = %d, supposed to be 2", ruleCount)
+	}
+
+	_, err = e.TestLoadPolicy(fileadapter.NewAdapter("examples/error/error_policy.csv"))
+	if err == nil {
+		t.Error("TestLoadPolicy: an invalid policy should return an error")
+	}
+
+	_, err = e.TestLoadPolicy(fileadapter.NewAdapter("not found"))
+	if err == nil {
+		t.Error("TestLoadPolicy: a missing policy file should return an error")
+	}
+
+	// The live policy must not be affected by the test loads.
+	testGetPolicy(t, e, [][]string{
+		{"alice", "data1", "read"},
+		{"bob", "data2", "write"},
+		{"data2_admin", "data2", "read"},
+		{"data2_admin", "data2", "write"},
+	})
+	testEnforce(t, e, "alice", "data2", "read", true)
+}
+
+func TestNilRequestValues(t *testing.T) {
+	e, _ := NewEnforcer("examples/basic_model.conf", "examples/basic_policy.csv")
+	e.EnableAutoSave(false)
+	_, _ = e.AddPolicy("carol", "", "read")
+
+	// nil is evaluated as "".
+	testEnforce(t, e, "carol", nil, "read", true)
+	testEnforce(t, e, "carol", "", "read", true)
+	testEnforce(t, e, "alice", nil, "read", false)
+	testEnforce(t, e, "alice", "", "read", false)
+
+	k, _ := NewEnforcer("examples/keymatch_model.conf", "examples/keymatch_policy.csv")
+	testEnforce(t, k, "alice", nil, "GET", false)
+	testEnforce(t, k, "alice", "", "GET", false)
+
+	request := []interface{}{"carol", nil, "read"}
+	e.EnableRejectNilRequest(true)
+	if _, err := e.Enforce(request...); err == nil || err.Error() != "invalid request: r.obj is nil" {
+		t.Errorf("a nil request value should be rejected, got %v", err)
+	}
+	if request[1] != nil {
+		t.Error("the request values should not be modified")
+	}
+	if _, err := k.Enforce("alice", nil, "GET"); err != nil {
+		t.Errorf("the option of an enforcer should not affect others: %v", err)
+	}
+	testEnforce(t, e, "carol", "", "read", true)
+	testEnforce(t, e, "alice", "", "read", false)
+}
+
+// clockAt is a clock pinned to a time.
+type clockAt time.Time
+
+func (c clockAt) Now() time.Time {
+	return time.Time(c)
+}
+
+func TestScheduleMatch(t *testing.T) {
+	m, _ := model.NewModelFromString(`
+[request_definition]
+r = sub, obj, act
+
+[policy_definition]
+p = sub, obj, act, schedule
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = r.sub == p.sub && r.obj == p.obj && r.act == p.act && scheduleMatch(p.schedule)
+`)
+	e, _ := NewEnforcer(m)
+	_, _ = e.AddPolicies([][]string{
+		{"alice", "data", "read", "Mon-Fri 09:00-17:00"},
+		{"bob", "data", "read", "Sat,Sun 10:00-12:00 Europe/Paris"},
+	})
+
+	// 2023-06-17 is a Saturday, 2023-06-14 a Wednesday.
+	weekend, _ := time.Parse(time.RFC3339, "2023-06-17T09:30:00Z")
+	weekday, _ := time.Parse(time.RFC3339, "2023-06-14T10:00:00Z")
+
+	e.SetClock(clockAt(weekend))
+	testEnforce(t, e, "alice", "data", "read", false)
+	testEnforce(t, e, "bob", "data", "read", true)
+
+	e.SetClock(clockAt(weekday))
+	testEnforce(t, e, "alice", "data", "read", true)
+	testEnforce(t, e, "bob", "data", "read", false)
+
+	// durationMatch is the same function, bound to the same clock.
+	testDurationMatch := func(res bool) {
+		t.Helper()
+		matcher := "r.sub == p.sub && r.obj == p.obj && r.act == p.act && durationMatch(p.schedule)"
+		if ok, err := e.EnforceWithMatcher(matcher, "alice", "data", "read"); err != nil || ok != res {
+			t.Errorf("durationMatch: %t, %v, supposed to be %t", ok, err, res)
+		}
+	}
+	testDurationMatch(true)
+	e.SetClock(clockAt(weekend))
+	testDurationMatch(false)
+
+	// a function added with AddFunction is kept.
+	e.AddFunction("durationMatch", func(args ...interface{}) (interface{}, error) {
+		return true, nil
+	})
+	testDurationMatch(true)
+
+	// as a link condition function.
+	m, _ = model.NewModelFromFile("examples/rbac_with_temporal_roles_model.conf")
+	e, _ = NewEnforcer(m)
+	_, _ = e.AddPolicy("data_admin", "data", "read")
+	_, _ = e.AddGroupingPolicies([][]string{{"alice", "data_admin", "Mon-Fri 09:00-17:00", "_"}})
+	e.AddNamedLinkConditionFunc("g", "alice", "data_admin", func(args ...string) (bool, error) {
+		return util.NewScheduleMatchLinkFunc(clockAt(weekend))(args[0])
+	})
+	testEnforce(t, e, "alice", "data", "read", false)
+	e.AddNamedLinkConditionFunc("g", "alice", "data_admin", func(args ...string) (bool, error) {
+		return util.NewScheduleMatchLinkFunc(clockAt(weekday))(args[0])
+	})
+	testEnforce(t, e, "alice", "data", "read", true)
+}
+
+func TestObjectNormalizer(t *testing.T) {
+	e, _ := NewEnforcer("examples/keymatch_model.conf", "examples/keymatch_policy.csv")
+	testEnforce(t, e, "cathy", "/cathy_data/", "GET", false)
+	testEnforce(t, e, "cathy", "/cathy_data?page=2", "GET", false)
+
+	e.SetObjectNormalizer(util.NewPathNormalizerFunc(util.PathNormOptions{StripTrailingSlash: true, StripQueryString: true}))
+	testEnforce(t, e, "cathy", "/cathy_data/", "GET", true)
+	testEnforce(t, e, "cathy", "/cathy_data?page=2", "GET", true)
+	testEnforce(t, e, "cathy", "/cathy_data", "GET", true)
+	testEnforce(t, e, "cathy", "/Cathy_data/", "GET", false)
+	testEnforce(t, e, "alice", "/alice_data/resource1/", "POST", true)
+
+	request := []interface{}{"cathy", "/cathy_data/", "GET"}
+	if ok, _ := e.Enforce(request...); !ok || request[1] != "/cathy_data/" {
+		t.Errorf("the request values should not be modified, got %v", request)
+	}
+
+	e.SetObjectNormalizer(nil)
+	testEnforce(t, e, "cathy", "/cathy_data/", "GET", false)
+}
+
+func TestModelText(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
+	text, _ := ioutil.ReadFile("examples/rbac_model.conf")
+	if e.GetModelText() != string(text) {
+		t.Errorf("GetModelText: %q, supposed to be the model file %q", e.GetModelText(), text)
+	}
+
+	requests := [][]interface{}{
+		{"alice", "data1", "read"}, {"alice", "data2", "write"}, {"bob", "data1", "read"}, {"bob", "data2", "write"},
+	}
+	expected, _ := e.BatchEnforce(requests)
+
+	// reloading the exported text keeps the policy and the decisions.
+	if err := e.SetModelFromText(e.GetModelText()); err != nil {
+		t.Fatal(err)
+	}
+	if e.GetModelText() != string(text) {
+		t.Errorf("GetModelText after reload: %q, supposed to be %q", e.GetModelText(), text)
+	}
+	testBatchEnforce(t, e, requests, expected)
+
+	// a changed matcher applies to the kept policy, with the text kept as written.
+	changed := `[request_definition]
+r = sub, obj, act
+
+[policy_definition]
+p = sub, obj, act
+
+[role_definition]
+g = _, _
+
+[policy_effect]
+# any allowing rule grants access
+e = some(where (p.eft == allow))
+
+[matchers]
+m = g(r.sub, p.sub) && r.obj == p.obj
+`
+	if err := e.SetModelFromText(changed); err != nil {
+		t.Fatal(err)
+	}
+	if e.GetModelText() != changed {
+		t.Errorf("GetModelText: %q, supposed to be %q", e.GetModelText(), changed)
+	}
+	testBatchEnforce(t, e, requests, []bool{true, true, false, true})
+
+	if err := e.SetModelFromText(strings.Replace(changed, "p = sub, obj, act", "p = sub, obj", 1)); err == nil {
+		t.Error("a model changing the fields of a policy type with rules should not be set")
+	}
+
+	e.SetModel(e.GetModel())
+	if e.GetModelText() != e.GetModel().ToText() {
+		t.Error("GetModelText of a model set in memory should be generated")
+	}
+}
+
+func TestModelTextWithConditionalRoles(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_with_temporal_roles_model.conf", "examples/rbac_with_temporal_roles_policy.csv")
+	_ = e.AddNamedLinkConditionFunc("g", "alice", "data2_admin", util.TimeMatchFunc)
+	_ = e.AddNamedLinkConditionFunc("g", "alice", "data3_admin", util.TimeMatchFunc)
+
+	testEnforce(t, e, "alice", "data2", "read", false)
+	testEnforce(t, e, "alice", "data3", "read", true)
+
+	// the conditional links and their condition functions are kept.
+	if err := e.SetModelFromText(e.GetModelText()); err != nil {
+		t.Fatal(err)
+	}
+	testEnforce(t, e, "alice", "data2", "read", false)
+	testEnforce(t, e, "alice", "data3", "read", true)
+
+	changed := strings.Replace(e.GetModelText(), "g = _, _, (_, _)", "g = _, _, _, (_, _)", 1)
+	if err := e.SetModelFromText(changed); err == nil {
+		t.Error("a model changing the fields of a role definition with rules should not be set")
+	}
+}
+
+func TestSwapAdapterAndReload(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
+	oldAdapter := e.GetAdapter()
+
+	for _, bad := range []string{"examples/error/error_policy.csv", "not found"} {
+		if err := e.SwapAdapterAndReload(fileadapter.NewAdapter(bad)); err == nil {
+			t.Errorf("SwapAdapterAndReload(%s): an error is supposed to be returned", bad)
+		}
+		if e.GetAdapter() != oldAdapter {
+			t.Errorf("SwapAdapterAndReload(%s): the previous adapter is supposed to be kept", bad)
+		}
+		testGetPolicy(t, e, [][]string{
+			{"alice", "data1", "read"},
+			{"bob", "data2", "write"},
+			{"data2_admin", "data2", "read"},
+			{"data2_admin", "data2", "write"},
+		})
+		testEnforce(t, e, "alice", "data2", "read", true)
+	}
+
+	if err := e.SwapAdapterAndReload(nil); err == nil {
+		t.Error("SwapAdapterAndReload(nil): an error is supposed to be returned")
+	}
+
+	newAdapter := fileadapter.NewAdapter("examples/basic_policy.csv")
+	if err := e.SwapAdapterAndReload(newAdapter); err != nil {
+		t.Fatalf("SwapAdapterAndReload: %v", err)
+	}
+	if e.GetAdapter() != newAdapter {
+		t.Error("SwapAdapterAndReload: the new adapter is supposed to be set")
+	}
+	testGetPolicy(t, e, [][]string{
+		{"alice", "data1", "read"},
+		{"bob", "data2", "write"},
+	})
+	testEnforce(t, e, "alice", "data2", "read", false)
+}
+
+func TestSetStrictArity(t *testing.T) {
+	policy := "p, alice, data1, read, \np, bob, data2, write\ng, bob, data2_admin, \n"
+	newModel := func() model.Model {
+		m, _ := model.NewModelFromFile("examples/rbac_model.conf")
+		return m
+	}
+
+	// Strict arity is the default and rejects the extra empty field.
+	_, err := NewEnforcer(newModel(), fileadapter.NewAdapterFromReader(strings.NewReader(policy)))
+	if err == nil {
+		t.Error("a rule with an extra empty field should be rejected with strict arity")
+	}
+
+	e, err := NewEnforcer(newModel())
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.SetStrictArity(false)
+	e.SetAdapter(fileadapter.NewAdapterFromReader(strings.NewReader(policy)))
+	if err = e.LoadPolicy(); err != nil {
+		t.Fatal(err)
+	}
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}})
+	testGetGroupingPolicy(t, e, [][]string{{"bob", "data2_admin"}})
+	testEnforce(t, e, "alice", "data1", "read", true)
+	testEnforce(t, e, "bob", "data2", "write", true)
+
+	// Missing trailing fields are padded with empty values.
+	e.SetAdapter(fileadapter.NewAdapterFromReader(strings.NewReader("p, alice, data1\n")))
+	if err = e.LoadPolicy(); err != nil {
+		t.Fatal(err)
+	}
+	testGetPolicy(t, e, [][]string{{"alice", "data1", ""}})
+
+	// Switching back to strict arity rejects the rule again.
+	e.SetStrictArity(true)
+	e.SetAdapter(fileadapter.NewAdapterFromReader(strings.NewReader(policy)))
+	if err = e.LoadPolicy(); err == nil {
+		t.Error("a rule with an extra empty field should be rejected with strict arity")
+	}
+}
+
+func TestSha256EqModel(t *testing.T) {
+	m, _ := model.NewModelFromString(`
+[request_definition]
+r = token, obj, act
+
+[policy_definition]
+p = tokenHash, obj, act
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = sha256Eq(r.token, p.tokenHash) && r.obj == p.obj && r.act == p.act
+`)
+	e, _ := NewEnforcer(m)
+	if _, err := e.AddPolicy(util.Sha256Hex("secret-token"), "data1", "read"); err != nil {
+		t.Fatal(err)
+	}
+
+	testEnforce(t, e, "secret-token", "data1", "read", true)
+	testEnforce(t, e, "secret-token", "data1", "write", false)
+	testEnforce(t, e, "other-token", "data1", "read", false)
+	testEnforce(t, e, util.Sha256Hex("secret-token"), "data1", "read", false)
+}
+
+func TestFallbackMatcher(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_with_deny_model.conf", "examples/rbac_with_deny_policy.csv")
+	e.EnableAutoSave(false)
+	_, _ = e.AddRoleForUser("carol", "emergency")
+	_, _ = e.AddRoleForUser("alice", "emergency")
+
+	testEnforce(t, e, "alice", "data2", "write", false)
+	testEnforce(t, e, "carol", "data1", "read", false)
+
+	e.SetFallbackMatcher(`g(r.sub, "emergency")`)
+	// the break-glass role is allowed despite the explicit deny of the model matcher.
+	testEnforce(t, e, "alice", "data2", "write", true)
+	testEnforce(t, e, "carol", "data1", "read", true)
+	testEnforce(t, e, "carol", "data2", "write", true)
+	testEnforce(t, e, "bob", "data1", "read", false)
+	testEnforce(t, e, "bob", "data2", "write", true)
+
+	// a custom matcher is not backed by the fallback.
+	ok, err := e.EnforceWithMatcher("r.sub == p.sub && r.obj == p.obj && r.act == p.act", "carol", "data1", "read")
+	if err != nil || ok {
+		t.Errorf("EnforceWithMatcher: %t, %v, supposed to be false", ok, err)
+	}
+
+	_, reasons, _ := e.EnforceWithReasons("carol", "data1", "read")
+	if !util.ArrayEquals(reasons[len(reasons)-2:], []string{"consulting the fallback matcher", "allowed: matcher evaluated without policy rules"}) {
+		t.Errorf("reasons: %v", reasons)
+	}
+
+	e.SetFallbackMatcher("")
+	testEnforce(t, e, "alice", "data2", "write", false)
+	testEnforce(t, e, "carol", "data1", "read", false)
+}
+
+func TestEnforceMiddleware(t *testing.T) {
+	e, _ := NewEnforcer("examples/basic_model.conf", "examples/basic_policy.csv")
+
+	var order []string
+	calls := 0
+	e.Use(func(next EnforceFunc) EnforceFunc {
+		return func(rvals ...interface{}) (bool, error) {
+			calls++
+			order = append(order, "count")
+			return next(rvals...)
+		}
+	})
+	blocked := map[interface{}]bool{}
+	e.Use(func(next EnforceFunc) EnforceFunc {
+		return func(rvals ...interface{}) (bool, error) {
+			order = append(order, "block")
+			if blocked[rvals[0]] {
+				return false, nil
+			}
+			return next(rvals...)
+		}
+	})
+
+	testEnforce(t, e, "alice", "data1", "read", true)
+	testEnforce(t, e, "bob", "data2", "write", true)
+	if calls != 2 {
+		t.Errorf("middleware called %d times, supposed to be 2", calls)
+	}
+	if !reflect.DeepEqual(order, []string{"count", "block", "count", "block"}) {
+		t.Errorf("middleware order %v, supposed to be the order of Use", order)
+	}
+
+	blocked["alice"] = true
+	testEnforce(t, e, "alice", "data1", "read", false)
+	testEnforce(t, e, "bob", "data2", "write", true)
+	if ok, _, _ := e.EnforceEx("alice", "data1", "read"); ok {
+		t.Error("EnforceEx should go through the middlewares")
+	}
+
+	// Decisions of middlewares are not cached.
+	ce, _ := NewCachedEnforcer("examples/basic_model.conf", "examples/basic_policy.csv")
+	ce.Use(func(next EnforceFunc) EnforceFunc {
+		return func(rvals ...interface{}) (bool, error) {
+			if blocked[rvals[0]] {
+				return false, nil
+			}
+			return next(rvals...)
+		}
+	})
+	testEnforceCache(t, ce, "alice", "data1", "read", false)
+	blocked["alice"] = false
+	testEnforceCache(t, ce, "alice", "data1", "read", true)
+}
+
+func TestNewEnforcerFromConfig(t *testing.T) {
+	e, err := NewEnforcerFromConfig(EnforcerConfig{
+		ModelPath:  "examples/rbac_model.conf",
+		PolicyPath: "examples/rbac_policy.csv",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testEnforce(t, e, "alice", "data1", "read", true)
+	testEnforce(t, e, "alice", "data2", "read", true)
+
+	// Without auto-building, the role links have to be built explicitly.
+	e, err = NewEnforcerFromConfig(EnforcerConfig{
+		ModelPath:                 "examples/rbac_model.conf",
+		Adapter:                   fileadapter.NewAdapter("examples/rbac_policy.csv"),
+		EnableLog:                 true,
+		PolicyPath:                "ignored.csv",
+		DisableAutoBuildRoleLinks: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !e.IsLogEnabled() {
+		t.Error("logging should be enabled")
+	}
+	e.EnableLog(false)
+	if e.autoBuildRoleLinks {
+		t.Error("auto-building the role links should be disabled")
+	}
+	if err = e.BuildRoleLinks(); err != nil {
+		t.Fatal(err)
+	}
+	testEnforce(t, e, "alice", "data1", "read", true)
+	testEnforce(t, e, "alice", "data2", "read", true)
+
+	text, _ := ioutil.ReadFile("examples/basic_model.conf")
+	logger := &testStructuredLogger{}
+	logger.EnableLog(true)
+	e, err = NewEnforcerFromConfig(EnforcerConfig{ModelText: string(text), Logger: logger})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.GetPolicyCount("p") != 0 {
+		t.Error("the policy should be empty without an adapter")
+	}
+	if _, err = e.AddPolicy("alice", "data1", "read"); err != nil {
+		t.Fatal(err)
+	}
+	testEnforce(t, e, "alice", "data1", "read", true)
+	if len(logger.entries) != 1 {
+		t.Errorf("the custom logger should be used, got %d entries", len(logger.entries))
+	}
+
+	if _, err = NewEnforcerFromConfig(EnforcerConfig{ModelText: "[matchers]"}); err == nil {
+		t.Error("an invalid model should be rejected")
+	}
+	if e, err = NewEnforcerFromConfig(EnforcerConfig{}); err != nil || e.GetModel() != nil {
+		t.Errorf("an empty config should create an uninitialized enforcer, got %v", err)
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright 2023 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casbin
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Explanation describes how a decision was made, see EnforceExplain.
+type Explanation struct {
+	// Rule is the policy rule that decided the request, nil if no rule did.
+	Rule []string
+	// Effect is the effect of Rule, "allow" or "deny", or "" if no rule decided the request.
+	Effect string
+	// Matcher is the matcher with the request values, and the values of Rule if any, substituted.
+	Matcher string
+	// Links are the grouping policy rules through which the role functions of the matcher matched for Rule,
+	// each starting with its policy type like in a policy file, e.g. ["g", "alice", "data2_admin"].
+	Links [][]string
+}
+
+var (
+	matcherTokenRegex = regexp.MustCompile(`\b[rp][0-9]*_\w+(\.\w+)*`)
+	roleCallRegex     = regexp.MustCompile(`\b(g[0-9]*)\(\s*([^,()]+?)\s*,\s*([^,()]+?)\s*(?:,\s*([^,()]+?)\s*)?\)`)
+)
+
+// EnforceExplain decides like Enforce and explains the decision, e.g. for support requests. The explanation is
+// only built by this method, so the other enforce methods are not slowed down.
+func (e *Enforcer) EnforceExplain(rvals ...interface{}) (bool, *Explanation, error) {
+	explain := []string{}
+	result, err := e.enforce("", nil, &explain, nil, nil, rvals...)
+	if err != nil {
+		return false, nil, err
+	}
+
+	rType, pType, mType := "r", "p", "m"
+	if len(rvals) != 0 {
+		if enforceContext, ok := rvals[0].(EnforceContext); ok {
+			rType, pType, mType = enforceContext.RType, enforceContext.PType, enforceContext.MType
+			rvals = rvals[1:]
+		}
+	}
+
+	values := make(map[string]interface{})
+	for i, token := range e.model["r"][rType].Tokens {
+		if i < len(rvals) {
+			values[token] = rvals[i]
+		}
+	}
+	res := &Explanation{}
+	if len(explain) > 0 {
+		res.Rule = explain
+		res.Effect = "allow"
+		for i, token := range e.model["p"][pType].Tokens {
+			if i < len(explain) {
+				values[token] = explain[i]
+			}
+			if token == pType+"_eft" && i < len(explain) {
+				res.Effect = explain[i]
+			}
+		}
+	}
+
+	resolve := func(expr string) (interface{}, bool) {
+		if unquoted, err := strconv.Unquote(expr); err == nil {
+			return unquoted, true
+		}
+		if !matcherTokenRegex.MatchString(expr) {
+			return nil, false
+		}
+		token, path := expr, ""
+		if i := strings.IndexByte(expr, '.'); i != -1 {
+			token, path = expr[:i], expr[i:]
+		}
+		value, ok := values[token]
+		if !ok {
+			return nil, false
+		}
+		value, err := resolveAttributePath(value, token, path)
+		return value, err == nil
+	}
+
+	matcher := e.model["m"][mType].Value
+	res.Matcher = matcherTokenRegex.ReplaceAllStringFunc(matcher, func(expr string) string {
+		value, ok := resolve(expr)
+		if !ok {
+			return expr
+		}
+		if s, isString := value.(string); isString {
+			return strconv.Quote(s)
+		}
+		return fmt.Sprint(value)
+	})
+
+	for _, call := range roleCallRegex.FindAllStringSubmatch(matcher, -1) {
+		ast, ok := e.model["g"][call[1]]
+		if !ok || ast.RM == nil {
+			continue
+		}
+		var args []string
+		for _, arg := range call[2:] {
+			if arg == "" {
+				continue
+			}
+			value, ok := resolve(arg)
+			s, isString := value.(string)
+			if !ok || !isString {
+				args = nil
+				break
+			}
+			args = append(args, s)
+		}
+		if len(args) < 2 {
+			continue
+		}
+		chains, err := roleChains(ast.RM, args[0], args[1], args[2:]...)
+		if err != nil {
+			return false, nil, err
+		}
+		if len(chains) == 0 {
+			continue
+		}
+		chain := chains[0]
+		for i := 0; i+1 < len(chain); i++ {
+			link := append([]string{call[1], chain[i], chain[i+1]}, args[2:]...)
+			res.Links = append(res.Links, link)
+		}
+	}
+
+	return result, res, nil
+}
@@ -17,7 +17,9 @@ package casbin
 import (
 	"testing"
 
+	"github.com/ApicaSystem/casbin/v2/persist"
 	fileadapter "github.com/ApicaSystem/casbin/v2/persist/file-adapter"
+	stringadapter "github.com/ApicaSystem/casbin/v2/persist/string-adapter"
 	"github.com/ApicaSystem/casbin/v2/util"
 )
 
@@ -146,6 +148,50 @@ func TestAppendFilteredPolicy(t *testing.T) {
 	testHasPolicy(t, e, []string{"admin", "domain2", "data2", "read"}, true)
 }
 
+func TestLoadFilteredPolicies(t *testing.T) {
+	filters := []interface{}{
+		&fileadapter.Filter{
+			P: []string{"", "domain1"},
+			G: []string{"", "", "domain1"},
+		},
+		&fileadapter.Filter{
+			P: []string{"", "domain2"},
+			G: []string{"", "", "domain2"},
+		},
+	}
+
+	// the file adapter loads every filter in a single pass, the wrapped one falls back to one call per filter
+	adapters := []persist.FilteredAdapter{
+		fileadapter.NewFilteredAdapter("examples/rbac_with_domains_policy.csv"),
+		struct{ persist.FilteredAdapter }{fileadapter.NewFilteredAdapter("examples/rbac_with_domains_policy.csv")},
+	}
+	for _, adapter := range adapters {
+		e, _ := NewEnforcer()
+		_ = e.InitWithAdapter("examples/rbac_with_domains_model.conf", adapter)
+
+		if err := e.LoadFilteredPolicies(filters[:1]); err != nil {
+			t.Errorf("unexpected error in LoadFilteredPolicies: %v", err)
+		}
+		testHasPolicy(t, e, []string{"admin", "domain1", "data1", "read"}, true)
+		testHasPolicy(t, e, []string{"admin", "domain2", "data2", "read"}, false)
+
+		if err := e.LoadFilteredPolicies(filters); err != nil {
+			t.Errorf("unexpected error in LoadFilteredPolicies: %v", err)
+		}
+		if !e.IsFiltered() {
+			t.Errorf("adapter did not set the filtered flag correctly")
+		}
+		testHasPolicy(t, e, []string{"admin", "domain1", "data1", "read"}, true)
+		testHasPolicy(t, e, []string{"admin", "domain2", "data2", "read"}, true)
+		testDomainEnforce(t, e, "alice", "domain1", "data1", "read", true)
+		testDomainEnforce(t, e, "bob", "domain2", "data2", "read", true)
+
+		if err := e.LoadFilteredPolicies([]interface{}{[]string{"", "domain1"}}); err == nil {
+			t.Errorf("expected error in LoadFilteredPolicies, but got nil")
+		}
+	}
+}
+
 func TestFilteredPolicyInvalidFilter(t *testing.T) {
 	e, _ := NewEnforcer()
 
@@ -175,7 +221,7 @@ func TestFilteredPolicyEmptyFilter(t *testing.T) {
 }
 
 func TestUnsupportedFilteredPolicy(t *testing.T) {
-	e, _ := NewEnforcer("examples/rbac_with_domains_model.conf", "examples/rbac_with_domains_policy.csv")
+	e, _ := NewEnforcer("examples/rbac_with_domains_model.conf", stringadapter.NewAdapter("p, admin, domain1, data1, read"))
 
 	err := e.LoadFilteredPolicy(&fileadapter.Filter{
 		P: []string{"", "domain1"},
@@ -186,6 +232,49 @@ func TestUnsupportedFilteredPolicy(t *testing.T) {
 	}
 }
 
+func TestLoadFilteredPolicyWithAdapter(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_with_domains_model.conf", "examples/rbac_with_domains_policy.csv")
+
+	// the whole policy is loaded when the enforcer is created
+	if e.IsFiltered() {
+		t.Errorf("adapter did not set the filtered flag correctly")
+	}
+	testHasPolicy(t, e, []string{"admin", "domain2", "data2", "read"}, true)
+
+	if err := e.LoadFilteredPolicy(&fileadapter.Filter{
+		P: []string{"", "domain1"},
+		G: []string{"", "", "domain1"},
+	}); err != nil {
+		t.Errorf("unexpected error in LoadFilteredPolicy: %v", err)
+	}
+	if !e.IsFiltered() {
+		t.Errorf("adapter did not set the filtered flag correctly")
+	}
+
+	// only policies for domain1 should be loaded
+	testHasPolicy(t, e, []string{"admin", "domain1", "data1", "read"}, true)
+	testHasPolicy(t, e, []string{"admin", "domain1", "data1", "write"}, true)
+	testHasPolicy(t, e, []string{"admin", "domain2", "data2", "read"}, false)
+	testDomainEnforce(t, e, "alice", "domain1", "data1", "read", true)
+	testDomainEnforce(t, e, "bob", "domain2", "data2", "read", false)
+
+	if err := e.SavePolicy(); err == nil {
+		t.Errorf("enforcer did not prevent saving filtered policy")
+	}
+	if err := e.GetAdapter().SavePolicy(e.GetModel()); err == nil {
+		t.Errorf("adapter did not prevent saving filtered policy")
+	}
+
+	// a nil filter loads the whole policy again
+	if err := e.LoadFilteredPolicy(nil); err != nil {
+		t.Errorf("unexpected error in LoadFilteredPolicy: %v", err)
+	}
+	if e.IsFiltered() {
+		t.Errorf("adapter did not set the filtered flag correctly")
+	}
+	testHasPolicy(t, e, []string{"admin", "domain2", "data2", "read"}, true)
+}
+
 func TestFilteredAdapterEmptyFilepath(t *testing.T) {
 	e, _ := NewEnforcer()
 
@@ -15,7 +15,9 @@
 package casbin
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 
 	Err "github.com/ApicaSystem/casbin/v2/errors"
 	"github.com/ApicaSystem/casbin/v2/model"
@@ -34,8 +36,36 @@ func (e *Enforcer) shouldNotify() bool {
 	return e.watcher != nil && e.autoNotifyWatcher
 }
 
+// policyChanged is called after the in-memory policy changed, it drops the values cached for policyValues and runs
+// the onPolicyChange hooks.
+func (e *Enforcer) policyChanged() {
+	e.policyValues.Range(func(key, _ interface{}) bool {
+		e.policyValues.Delete(key)
+		return true
+	})
+	for _, fn := range e.onPolicyChange {
+		fn()
+	}
+}
+
+// validatePolicies calls the validators of ptype with the rules, see AddPolicyValidator.
+func (e *Enforcer) validatePolicies(ptype string, rules [][]string) error {
+	for _, fn := range e.policyValidators[ptype] {
+		for _, rule := range rules {
+			if err := fn(rule); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 // addPolicy adds a rule to the current policy.
 func (e *Enforcer) addPolicyWithoutNotify(sec string, ptype string, rule []string) (bool, error) {
+	if err := e.validatePolicies(ptype, [][]string{rule}); err != nil {
+		return false, err
+	}
+
 	if e.dispatcher != nil && e.autoNotifyDispatcher {
 		return true, e.dispatcher.AddPolicies(sec, ptype, [][]string{rule})
 	}
@@ -57,6 +87,7 @@ func (e *Enforcer) addPolicyWithoutNotify(sec string, ptype string, rule []strin
 	if err != nil {
 		return false, err
 	}
+	defer e.policyChanged()
 
 	if sec == "g" {
 		err := e.BuildIncrementalRoleLinks(model.PolicyAdd, ptype, [][]string{rule})
@@ -72,11 +103,21 @@ func (e *Enforcer) addPolicyWithoutNotify(sec string, ptype string, rule []strin
 // If autoRemoveRepeat == true, existing rules are automatically filtered
 // Otherwise, false is returned directly.
 func (e *Enforcer) addPoliciesWithoutNotify(sec string, ptype string, rules [][]string, autoRemoveRepeat bool) (bool, error) {
+	if err := e.validatePolicies(ptype, rules); err != nil {
+		return false, err
+	}
+
 	if e.dispatcher != nil && e.autoNotifyDispatcher {
 		return true, e.dispatcher.AddPolicies(sec, ptype, rules)
 	}
 
-	if !autoRemoveRepeat {
+	if autoRemoveRepeat {
+		// only the new rules reach the adapter, which may reject existing ones.
+		var err error
+		if rules, err = e.newPolicies(sec, ptype, rules); len(rules) == 0 || err != nil {
+			return false, err
+		}
+	} else {
 		hasPolicies, err := e.model.HasPolicies(sec, ptype, rules)
 		if hasPolicies || err != nil {
 			return false, err
@@ -95,6 +136,7 @@ func (e *Enforcer) addPoliciesWithoutNotify(sec string, ptype string, rules [][]
 	if err != nil {
 		return false, err
 	}
+	defer e.policyChanged()
 
 	if sec == "g" {
 		err := e.BuildIncrementalRoleLinks(model.PolicyAdd, ptype, rules)
@@ -129,6 +171,7 @@ func (e *Enforcer) removePolicyWithoutNotify(sec string, ptype string, rule []st
 	if !ruleRemoved || err != nil {
 		return ruleRemoved, err
 	}
+	defer e.policyChanged()
 
 	if sec == "g" {
 		err := e.BuildIncrementalRoleLinks(model.PolicyRemove, ptype, [][]string{rule})
@@ -141,6 +184,10 @@ func (e *Enforcer) removePolicyWithoutNotify(sec string, ptype string, rule []st
 }
 
 func (e *Enforcer) updatePolicyWithoutNotify(sec string, ptype string, oldRule []string, newRule []string) (bool, error) {
+	if err := e.validatePolicies(ptype, [][]string{newRule}); err != nil {
+		return false, err
+	}
+
 	if e.dispatcher != nil && e.autoNotifyDispatcher {
 		return true, e.dispatcher.UpdatePolicy(sec, ptype, oldRule, newRule)
 	}
@@ -156,6 +203,7 @@ func (e *Enforcer) updatePolicyWithoutNotify(sec string, ptype string, oldRule [
 	if !ruleUpdated || err != nil {
 		return ruleUpdated, err
 	}
+	defer e.policyChanged()
 
 	if sec == "g" {
 		err := e.BuildIncrementalRoleLinks(model.PolicyRemove, ptype, [][]string{oldRule}) // remove the old rule
@@ -175,6 +223,9 @@ func (e *Enforcer) updatePoliciesWithoutNotify(sec string, ptype string, oldRule
 	if len(newRules) != len(oldRules) {
 		return false, fmt.Errorf("the length of oldRules should be equal to the length of newRules, but got the length of oldRules is %d, the length of newRules is %d", len(oldRules), len(newRules))
 	}
+	if err := e.validatePolicies(ptype, newRules); err != nil {
+		return false, err
+	}
 
 	if e.dispatcher != nil && e.autoNotifyDispatcher {
 		return true, e.dispatcher.UpdatePolicies(sec, ptype, oldRules, newRules)
@@ -192,6 +243,7 @@ func (e *Enforcer) updatePoliciesWithoutNotify(sec string, ptype string, oldRule
 	if !ruleUpdated || err != nil {
 		return ruleUpdated, err
 	}
+	defer e.policyChanged()
 
 	if sec == "g" {
 		err := e.BuildIncrementalRoleLinks(model.PolicyRemove, ptype, oldRules) // remove the old rules
@@ -229,6 +281,7 @@ func (e *Enforcer) removePoliciesWithoutNotify(sec string, ptype string, rules [
 	if !rulesRemoved || err != nil {
 		return rulesRemoved, err
 	}
+	defer e.policyChanged()
 
 	if sec == "g" {
 		err := e.BuildIncrementalRoleLinks(model.PolicyRemove, ptype, rules)
@@ -261,6 +314,7 @@ func (e *Enforcer) removeFilteredPolicyWithoutNotify(sec string, ptype string, f
 	if !ruleRemoved || err != nil {
 		return ruleRemoved, err
 	}
+	defer e.policyChanged()
 
 	if sec == "g" {
 		err := e.BuildIncrementalRoleLinks(model.PolicyRemove, ptype, effects)
@@ -281,6 +335,9 @@ func (e *Enforcer) updateFilteredPoliciesWithoutNotify(sec string, ptype string,
 	if _, err = e.model.GetAssertion(sec, ptype); err != nil {
 		return oldRules, err
 	}
+	if err = e.validatePolicies(ptype, newRules); err != nil {
+		return oldRules, err
+	}
 
 	if e.shouldPersist() {
 		if oldRules, err = e.adapter.(persist.UpdatableAdapter).UpdateFilteredPolicies(sec, ptype, newRules, fieldIndex, fieldValues...); err != nil {
@@ -300,6 +357,7 @@ func (e *Enforcer) updateFilteredPoliciesWithoutNotify(sec string, ptype string,
 		return oldRules, e.dispatcher.UpdateFilteredPolicies(sec, ptype, oldRules, newRules)
 	}
 
+	defer e.policyChanged()
 	ruleChanged, err := e.model.RemovePolicies(sec, ptype, oldRules)
 	if err != nil {
 		return oldRules, err
@@ -351,22 +409,60 @@ func (e *Enforcer) addPolicy(sec string, ptype string, rule []string) (bool, err
 // If autoRemoveRepeat == true, existing rules are automatically filtered
 // Otherwise, false is returned directly.
 func (e *Enforcer) addPolicies(sec string, ptype string, rules [][]string, autoRemoveRepeat bool) (bool, error) {
-	ok, err := e.addPoliciesWithoutNotify(sec, ptype, rules, autoRemoveRepeat)
-	if !ok || err != nil {
-		return ok, err
-	}
+	_, ok, err := e.addPoliciesWithAffected(sec, ptype, rules, autoRemoveRepeat)
+	return ok, err
+}
 
-	if e.shouldNotify() {
+// addPoliciesWithAffected adds rules to the current policy like addPolicies and returns the rules added.
+// If autoRemoveRepeat == true, only the rules not in the policy yet are added, saved and notified.
+func (e *Enforcer) addPoliciesWithAffected(sec string, ptype string, rules [][]string, autoRemoveRepeat bool) ([][]string, bool, error) {
+	if autoRemoveRepeat && (e.dispatcher == nil || !e.autoNotifyDispatcher) {
 		var err error
-		if watcher, ok := e.watcher.(persist.WatcherEx); ok {
-			err = watcher.UpdateForAddPolicies(sec, ptype, rules...)
-		} else {
-			err = e.watcher.Update()
+		if rules, err = e.newPolicies(sec, ptype, rules); len(rules) == 0 || err != nil {
+			return nil, false, err
 		}
-		return true, err
+		autoRemoveRepeat = false
 	}
 
-	return true, nil
+	ok, err := e.addPoliciesWithoutNotify(sec, ptype, rules, autoRemoveRepeat)
+	if !ok {
+		return nil, ok, err
+	}
+	if err != nil {
+		return rules, ok, err
+	}
+
+	return rules, true, e.notifyAddPolicies(sec, ptype, rules)
+}
+
+// notifyAddPolicies notifies the watcher of added rules.
+func (e *Enforcer) notifyAddPolicies(sec string, ptype string, rules [][]string) error {
+	if !e.shouldNotify() {
+		return nil
+	}
+	if watcher, ok := e.watcher.(persist.WatcherEx); ok {
+		return watcher.UpdateForAddPolicies(sec, ptype, rules...)
+	}
+	return e.watcher.Update()
+}
+
+// newPolicies returns the rules that are not in the policy yet, without duplicates.
+func (e *Enforcer) newPolicies(sec string, ptype string, rules [][]string) ([][]string, error) {
+	var res [][]string
+	seen := make(map[string]struct{}, len(rules))
+	for _, rule := range rules {
+		ok, err := e.model.HasPolicy(sec, ptype, rule)
+		if err != nil {
+			return nil, err
+		}
+		key := strings.Join(rule, model.DefaultSep)
+		if _, dup := seen[key]; ok || dup {
+			continue
+		}
+		seen[key] = struct{}{}
+		res = append(res, rule)
+	}
+	return res, nil
 }
 
 // removePolicy removes a rule from the current policy.
@@ -414,17 +510,18 @@ func (e *Enforcer) updatePolicies(sec string, ptype string, oldRules [][]string,
 		return ok, err
 	}
 
-	if e.shouldNotify() {
-		var err error
-		if watcher, ok := e.watcher.(persist.UpdatableWatcher); ok {
-			err = watcher.UpdateForUpdatePolicies(sec, ptype, oldRules, newRules)
-		} else {
-			err = e.watcher.Update()
-		}
-		return true, err
-	}
+	return true, e.notifyUpdatePolicies(sec, ptype, oldRules, newRules)
+}
 
-	return true, nil
+// notifyUpdatePolicies notifies the watcher of updated rules.
+func (e *Enforcer) notifyUpdatePolicies(sec string, ptype string, oldRules [][]string, newRules [][]string) error {
+	if !e.shouldNotify() {
+		return nil
+	}
+	if watcher, ok := e.watcher.(persist.UpdatableWatcher); ok {
+		return watcher.UpdateForUpdatePolicies(sec, ptype, oldRules, newRules)
+	}
+	return e.watcher.Update()
 }
 
 // removePolicies removes rules from the current policy.
@@ -434,17 +531,18 @@ func (e *Enforcer) removePolicies(sec string, ptype string, rules [][]string) (b
 		return ok, err
 	}
 
-	if e.shouldNotify() {
-		var err error
-		if watcher, ok := e.watcher.(persist.WatcherEx); ok {
-			err = watcher.UpdateForRemovePolicies(sec, ptype, rules...)
-		} else {
-			err = e.watcher.Update()
-		}
-		return true, err
-	}
+	return true, e.notifyRemovePolicies(sec, ptype, rules)
+}
 
-	return true, nil
+// notifyRemovePolicies notifies the watcher of removed rules.
+func (e *Enforcer) notifyRemovePolicies(sec string, ptype string, rules [][]string) error {
+	if !e.shouldNotify() {
+		return nil
+	}
+	if watcher, ok := e.watcher.(persist.WatcherEx); ok {
+		return watcher.UpdateForRemovePolicies(sec, ptype, rules...)
+	}
+	return e.watcher.Update()
 }
 
 // removeFilteredPolicy removes rules based on field filters from the current policy.
@@ -487,6 +585,76 @@ func (e *Enforcer) updateFilteredPolicies(sec string, ptype string, newRules [][
 	return true, nil
 }
 
+// replaceAllPolicies replaces all rules of the ptype in the current policy with rules.
+// Adapters implementing persist.ReplaceAdapter persist the change in a single call, others save the whole policy.
+// If the adapter fails, the previous rules are restored in the model.
+func (e *Enforcer) replaceAllPolicies(sec string, ptype string, rules [][]string) (bool, error) {
+	if err := e.validatePolicies(ptype, rules); err != nil {
+		return false, err
+	}
+
+	assertion, err := e.model.GetAssertion(sec, ptype)
+	if err != nil {
+		return false, err
+	}
+
+	if e.dispatcher != nil && e.autoNotifyDispatcher {
+		return true, e.dispatcher.UpdateFilteredPolicies(sec, ptype, append([][]string(nil), assertion.Policy...), rules)
+	}
+
+	if e.shouldPersist() && e.IsFiltered() {
+		if _, ok := e.adapter.(persist.ReplaceAdapter); !ok {
+			return false, errors.New("cannot save a filtered policy")
+		}
+	}
+
+	oldPolicy, oldPolicyMap := assertion.Policy, assertion.PolicyMap
+	restore := func() {
+		assertion.Policy, assertion.PolicyMap = oldPolicy, oldPolicyMap
+	}
+	if err = e.model.ReplacePolicies(sec, ptype, rules); err != nil {
+		restore()
+		return false, err
+	}
+
+	if e.shouldPersist() {
+		if err = e.saveReplacedPolicies(sec, ptype, rules); err != nil {
+			restore()
+			return false, err
+		}
+	}
+	e.policyChanged()
+
+	if e.shouldNotify() {
+		if watcher, ok := e.watcher.(persist.WatcherEx); ok {
+			err = watcher.UpdateForSavePolicy(e.model)
+		} else {
+			err = e.watcher.Update()
+		}
+		return true, err
+	}
+
+	return true, nil
+}
+
+// saveReplacedPolicies persists the rules replacing those of the ptype, with a single ReplaceAllPolicies call if
+// the adapter supports it, or else by saving the whole policy.
+func (e *Enforcer) saveReplacedPolicies(sec string, ptype string, rules [][]string) error {
+	if replaceAdapter, ok := e.adapter.(persist.ReplaceAdapter); ok {
+		err := replaceAdapter.ReplaceAllPolicies(sec, ptype, rules)
+		if err == nil || err.Error() != notImplemented {
+			return err
+		}
+		if e.IsFiltered() {
+			return errors.New("cannot save a filtered policy")
+		}
+	}
+	if err := e.adapter.SavePolicy(e.model); err != nil && err.Error() != notImplemented {
+		return err
+	}
+	return nil
+}
+
 func (e *Enforcer) GetFieldIndex(ptype string, field string) (int, error) {
 	return e.model.GetFieldIndex(ptype, field)
 }
@@ -0,0 +1,94 @@
+// Copyright 2023 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DecisionRecord is the structured record of an enforce decision, see DecisionSink.
+type DecisionRecord struct {
+	// Time is when the enforce call started.
+	Time    time.Time     `json:"time"`
+	Request []interface{} `json:"request"`
+	// MatchedRule is the policy rule that decided the request, nil if none did.
+	MatchedRule []string      `json:"matched_rule"`
+	Allowed     bool          `json:"allowed"`
+	Latency     time.Duration `json:"latency_ns"`
+}
+
+// DecisionSink receives a record of every enforce decision, e.g. to ship them to a log pipeline.
+// WriteDecision is called synchronously by the enforce call, so it should not block.
+type DecisionSink interface {
+	WriteDecision(record DecisionRecord)
+}
+
+// ChannelSink is a DecisionSink sending the records to a channel. A record is dropped rather than blocking the
+// enforce call when the channel is full.
+type ChannelSink struct {
+	ch      chan<- DecisionRecord
+	dropped uint64
+}
+
+// NewChannelSink creates a ChannelSink sending the records to ch.
+func NewChannelSink(ch chan<- DecisionRecord) *ChannelSink {
+	return &ChannelSink{ch: ch}
+}
+
+// WriteDecision sends the record to the channel, or drops it if the channel is full.
+func (s *ChannelSink) WriteDecision(record DecisionRecord) {
+	select {
+	case s.ch <- record:
+	default:
+		atomic.AddUint64(&s.dropped, 1)
+	}
+}
+
+// Dropped returns the number of records dropped because the channel was full.
+func (s *ChannelSink) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// WriterSink is a DecisionSink writing the records to a writer as JSON lines. It is safe for concurrent use.
+type WriterSink struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	err error
+}
+
+// NewWriterSink creates a WriterSink writing the records to w.
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{enc: json.NewEncoder(w)}
+}
+
+// WriteDecision writes the record as a line of JSON.
+func (s *WriterSink) WriteDecision(record DecisionRecord) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.enc.Encode(record); err != nil && s.err == nil {
+		s.err = err
+	}
+}
+
+// Err returns the first error that occurred while writing a record.
+func (s *WriterSink) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
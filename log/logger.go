@@ -39,3 +39,28 @@ type Logger interface {
 	// LogError log info relate to error
 	LogError(err error, msg ...string)
 }
+
+// StructuredLogger is a Logger that logs enforce results as key-value fields, so log aggregators
+// can index them without parsing the message. When the enforcer's logger implements it,
+// LogEnforceResult is called instead of LogEnforce.
+type StructuredLogger interface {
+	Logger
+
+	// LogEnforceResult log an enforce result, matchedRule is nil if no policy rule matched.
+	LogEnforceResult(request []interface{}, result bool, matchedRule []string)
+}
+
+// Field is a key-value pair of a structured log entry.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// EnforceFields returns the fields describing an enforce result, for use by StructuredLogger implementations.
+func EnforceFields(request []interface{}, result bool, matchedRule []string) []Field {
+	return []Field{
+		{Key: "request", Value: request},
+		{Key: "result", Value: result},
+		{Key: "matched_rule", Value: matchedRule},
+	}
+}
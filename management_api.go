@@ -15,11 +15,15 @@
 package casbin
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/ApicaSystem/casbin/v2/constant"
+	"github.com/ApicaSystem/casbin/v2/model"
+	"github.com/ApicaSystem/casbin/v2/persist"
 	"github.com/ApicaSystem/casbin/v2/util"
 	"github.com/casbin/govaluate"
 )
@@ -91,9 +95,18 @@ func (e *Enforcer) GetNamedPolicy(ptype string) ([][]string, error) {
 	return e.model.GetPolicy("p", ptype)
 }
 
+// GetPolicyCount returns the number of authorization rules in the named policy, 0 if the policy type does not exist.
+func (e *Enforcer) GetPolicyCount(ptype string) int {
+	ast, ok := e.model["p"][ptype]
+	if !ok {
+		return 0
+	}
+	return ast.PolicyCount()
+}
+
 // GetFilteredNamedPolicy gets all the authorization rules in the named policy, field filters can be specified.
 func (e *Enforcer) GetFilteredNamedPolicy(ptype string, fieldIndex int, fieldValues ...string) ([][]string, error) {
-	return e.model.GetFilteredPolicy("p", ptype, fieldIndex, fieldValues...)
+	return e.getFilteredPolicy("p", ptype, fieldIndex, fieldValues...)
 }
 
 // GetGroupingPolicy gets all the role inheritance rules in the policy.
@@ -113,7 +126,58 @@ func (e *Enforcer) GetNamedGroupingPolicy(ptype string) ([][]string, error) {
 
 // GetFilteredNamedGroupingPolicy gets all the role inheritance rules in the policy, field filters can be specified.
 func (e *Enforcer) GetFilteredNamedGroupingPolicy(ptype string, fieldIndex int, fieldValues ...string) ([][]string, error) {
-	return e.model.GetFilteredPolicy("g", ptype, fieldIndex, fieldValues...)
+	return e.getFilteredPolicy("g", ptype, fieldIndex, fieldValues...)
+}
+
+// getFilteredPolicy gets the rules matching the field filters. With EnableDomainGlob, a domain filter containing
+// glob metacharacters is matched as a pattern against the domain of the rules.
+func (e *Enforcer) getFilteredPolicy(sec string, ptype string, fieldIndex int, fieldValues ...string) ([][]string, error) {
+	i := e.domainFieldIndex(sec, ptype) - fieldIndex
+	if !e.domainGlob || i < 0 || i >= len(fieldValues) || !isDomainGlob(fieldValues[i]) {
+		return e.model.GetFilteredPolicy(sec, ptype, fieldIndex, fieldValues...)
+	}
+
+	pattern := fieldValues[i]
+	values := append([]string(nil), fieldValues...)
+	values[i] = ""
+	rules, err := e.model.GetFilteredPolicy(sec, ptype, fieldIndex, values...)
+	if err != nil {
+		return nil, err
+	}
+
+	res := [][]string{}
+	for _, rule := range rules {
+		if ok, err := util.GlobMatch(rule[fieldIndex+i], pattern); err != nil {
+			return nil, err
+		} else if ok {
+			res = append(res, rule)
+		}
+	}
+	return res, nil
+}
+
+// domainFieldIndex returns the index of the domain field of a policy type, or -1 if it has none.
+// The domain of a grouping rule is its third field.
+func (e *Enforcer) domainFieldIndex(sec string, ptype string) int {
+	if sec == "g" {
+		if ast, ok := e.model["g"][ptype]; ok && len(ast.Tokens) > 2 {
+			return 2
+		}
+		return -1
+	}
+	if _, ok := e.model["p"][ptype]; !ok {
+		return -1
+	}
+	index, err := e.GetFieldIndex(ptype, constant.DomainIndex)
+	if err != nil {
+		return -1
+	}
+	return index
+}
+
+// isDomainGlob reports whether a domain contains glob metacharacters.
+func isDomainGlob(domain string) bool {
+	return strings.ContainsAny(domain, "*?[{")
 }
 
 // GetFilteredNamedPolicyWithMatcher gets rules based on matcher from the policy.
@@ -121,20 +185,7 @@ func (e *Enforcer) GetFilteredNamedPolicyWithMatcher(ptype string, matcher strin
 	var res [][]string
 	var err error
 
-	functions := e.fm.GetFunctions()
-	if _, ok := e.model["g"]; ok {
-		for key, ast := range e.model["g"] {
-			// g must be a normal role definition (ast.RM != nil)
-			//   or a conditional role definition (ast.CondRM != nil)
-			// ast.RM and ast.CondRM shouldn't be nil at the same time
-			if ast.RM != nil {
-				functions[key] = util.GenerateGFunction(ast.RM)
-			}
-			if ast.CondRM != nil {
-				functions[key] = util.GenerateConditionalGFunction(ast.CondRM)
-			}
-		}
-	}
+	functions := e.matcherFunctions(nil)
 
 	var expString string
 	if matcher == "" {
@@ -234,6 +285,12 @@ func (e *Enforcer) AddPoliciesEx(rules [][]string) (bool, error) {
 	return e.AddNamedPoliciesEx("p", rules)
 }
 
+// AddPoliciesWithAffected adds the authorization rules that are not in the current policy yet, like AddPoliciesEx,
+// and returns exactly the rules added. Only these rules are saved by auto-save and sent to the watcher.
+func (e *Enforcer) AddPoliciesWithAffected(rules [][]string) ([][]string, error) {
+	return e.AddNamedPoliciesWithAffected("p", rules)
+}
+
 // AddNamedPolicy adds an authorization rule to the current named policy.
 // If the rule already exists, the function returns false and the rule will not be added.
 // Otherwise the function returns true by adding the new rule.
@@ -264,6 +321,13 @@ func (e *Enforcer) AddNamedPoliciesEx(ptype string, rules [][]string) (bool, err
 	return e.addPolicies("p", ptype, rules, true)
 }
 
+// AddNamedPoliciesWithAffected adds the authorization rules that are not in the current named policy yet
+// and returns exactly the rules added, see AddPoliciesWithAffected.
+func (e *Enforcer) AddNamedPoliciesWithAffected(ptype string, rules [][]string) ([][]string, error) {
+	added, _, err := e.addPoliciesWithAffected("p", ptype, rules, true)
+	return added, err
+}
+
 // RemovePolicy removes an authorization rule from the current policy.
 func (e *Enforcer) RemovePolicy(params ...interface{}) (bool, error) {
 	return e.RemoveNamedPolicy("p", params...)
@@ -328,6 +392,16 @@ func (e *Enforcer) RemoveFilteredNamedPolicy(ptype string, fieldIndex int, field
 	return e.removeFilteredPolicy("p", ptype, fieldIndex, fieldValues)
 }
 
+// ReplaceAllPolicies replaces all authorization rules in the current policy with rules.
+func (e *Enforcer) ReplaceAllPolicies(rules [][]string) (bool, error) {
+	return e.ReplaceAllNamedPolicies("p", rules)
+}
+
+// ReplaceAllNamedPolicies replaces all authorization rules in the current named policy with rules.
+func (e *Enforcer) ReplaceAllNamedPolicies(ptype string, rules [][]string) (bool, error) {
+	return e.replaceAllPolicies("p", ptype, rules)
+}
+
 // HasGroupingPolicy determines whether a role inheritance rule exists.
 func (e *Enforcer) HasGroupingPolicy(params ...interface{}) (bool, error) {
 	return e.HasNamedGroupingPolicy("g", params...)
@@ -368,6 +442,29 @@ func (e *Enforcer) AddGroupingPoliciesEx(rules [][]string) (bool, error) {
 	return e.AddNamedGroupingPoliciesEx("g", rules)
 }
 
+// AddGroupingPoliciesFromMap adds the role inheritance rules of a user -> roles map in a single batch,
+// the domain is appended to every rule if given. Rules that already exist are skipped.
+func (e *Enforcer) AddGroupingPoliciesFromMap(m map[string][]string, domain ...string) (bool, error) {
+	users := make([]string, 0, len(m))
+	for user := range m {
+		users = append(users, user)
+	}
+	sort.Strings(users)
+
+	var rules [][]string
+	for _, user := range users {
+		for _, role := range m[user] {
+			rule := []string{user, role}
+			rule = append(rule, domain...)
+			rules = append(rules, rule)
+		}
+	}
+	if len(rules) == 0 {
+		return false, nil
+	}
+	return e.AddGroupingPoliciesEx(rules)
+}
+
 // AddNamedGroupingPolicy adds a named role inheritance rule to the current policy.
 // If the rule already exists, the function returns false and the rule will not be added.
 // Otherwise the function returns true by adding the new rule.
@@ -465,6 +562,66 @@ func (e *Enforcer) RemoveFilteredNamedGroupingPolicy(ptype string, fieldIndex in
 // AddFunction adds a customized function.
 func (e *Enforcer) AddFunction(name string, function govaluate.ExpressionFunction) {
 	e.fm.AddFunction(name, function)
+	e.invalidateMatcherMap()
+}
+
+// SetObjectMatcher registers the trieKeyMatch(key, pattern) matcher function backed by tm, a drop-in replacement
+// for keyMatch2 for models with many path patterns, e.g.
+//
+//	m = g(r.sub, p.sub) && trieKeyMatch(r.obj, p.obj) && r.act == p.act
+//
+// tm is typically built from the objects of the policy, see util.NewTrieMatcher. The key is matched against all
+// patterns in one walk of the trie, and every rule is then decided by a lookup. Patterns missing from tm fall back
+// to KeyMatch2, so tm does not have to be rebuilt for every policy change to stay correct.
+func (e *Enforcer) SetObjectMatcher(tm *util.TrieMatcher) {
+	e.fm.AddFunction("trieKeyMatch", tm.TrieKeyMatchFunc())
+	e.invalidateMatcherMap()
+}
+
+// AsyncResult is the value, or the error, delivered by an AsyncExpressionFunction.
+type AsyncResult struct {
+	Value interface{}
+	Err   error
+}
+
+// AsyncExpressionFunction is a matcher function retrieving attributes from a slow source like a database or an
+// HTTP service. It starts the retrieval and returns a channel delivering the result, and should stop as soon as
+// ctx is done.
+type AsyncExpressionFunction func(ctx context.Context, args ...interface{}) <-chan AsyncResult
+
+// AddAsyncFunction adds a customized function whose result is awaited by the matcher. With EnforceWithContext it
+// receives the context of the request, the wait is then given up as soon as the context is done. Other enforce
+// calls pass context.Background().
+func (e *Enforcer) AddAsyncFunction(name string, function AsyncExpressionFunction) {
+	if e.asyncFunctions == nil {
+		e.asyncFunctions = make(map[string]AsyncExpressionFunction)
+	}
+	e.asyncFunctions[name] = function
+	e.fm.AddFunction(name, bindAsyncFunction(context.Background(), function))
+}
+
+// bindAsyncFunction turns function into a matcher function awaiting its result or the end of ctx.
+func bindAsyncFunction(ctx context.Context, function AsyncExpressionFunction) govaluate.ExpressionFunction {
+	return func(args ...interface{}) (interface{}, error) {
+		select {
+		case res := <-function(ctx, args...):
+			return res.Value, res.Err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// AddPolicyValidator adds a validator for the rules of a ptype, e.g. "p" or "g". The validators are called with
+// every rule added or updated through the enforcer, in the order they were added, and the first error returned
+// rejects the rules, which are then neither saved nor added to the model. Loaded policies are not validated.
+// Rules applied through the Self methods, e.g. replicated by a dispatcher, are validated too, so every instance
+// should register the same validators.
+func (e *Enforcer) AddPolicyValidator(ptype string, fn func(rule []string) error) {
+	if e.policyValidators == nil {
+		e.policyValidators = make(map[string][]func(rule []string) error)
+	}
+	e.policyValidators[ptype] = append(e.policyValidators[ptype], fn)
 }
 
 func (e *Enforcer) SelfAddPolicy(sec string, ptype string, rule []string) (bool, error) {
@@ -498,3 +655,123 @@ func (e *Enforcer) SelfUpdatePolicy(sec string, ptype string, oldRule, newRule [
 func (e *Enforcer) SelfUpdatePolicies(sec string, ptype string, oldRules, newRules [][]string) (bool, error) {
 	return e.updatePoliciesWithoutNotify(sec, ptype, oldRules, newRules)
 }
+
+// PolicySnapshot is a copy of the "p" and "g" sections of the policy taken by Snapshot or BeginSnapshot.
+type PolicySnapshot struct {
+	model model.Model
+	// begun is set while the snapshot taken by BeginSnapshot is neither restored nor committed, the settings it
+	// suspended are resumed then.
+	begun                bool
+	autoSave             bool
+	autoNotifyWatcher    bool
+	autoNotifyDispatcher bool
+}
+
+// Snapshot deep-copies the current "p" and "g" policy so that later edits can be undone with Restore.
+// It has no side effect, the edits made afterwards are saved and notified as usual.
+func (e *Enforcer) Snapshot() *PolicySnapshot {
+	return &PolicySnapshot{model: e.model.Copy()}
+}
+
+// BeginSnapshot takes a snapshot like Snapshot and starts a transaction: auto-save, watcher notifications and the
+// dispatcher are suspended until the snapshot is restored or committed with CommitSnapshot, so the edits made in
+// between are applied to this instance and stay in memory only.
+func (e *Enforcer) BeginSnapshot() *PolicySnapshot {
+	s := &PolicySnapshot{
+		model:                e.model.Copy(),
+		begun:                true,
+		autoSave:             e.autoSave,
+		autoNotifyWatcher:    e.autoNotifyWatcher,
+		autoNotifyDispatcher: e.autoNotifyDispatcher,
+	}
+	e.autoSave = false
+	e.autoNotifyWatcher = false
+	e.autoNotifyDispatcher = false
+	return s
+}
+
+// resume resumes the settings suspended by BeginSnapshot.
+func (e *Enforcer) resume(s *PolicySnapshot) {
+	if !s.begun {
+		return
+	}
+	e.autoSave = s.autoSave
+	e.autoNotifyWatcher = s.autoNotifyWatcher
+	e.autoNotifyDispatcher = s.autoNotifyDispatcher
+	s.begun = false
+}
+
+// Restore discards the edits made since the snapshot was taken and rebuilds the role links. Only the in-memory
+// policy is restored, the adapter and the watcher are not told. A snapshot taken by BeginSnapshot resumes
+// auto-save, watcher notifications and the dispatcher. The snapshot can be restored more than once.
+func (e *Enforcer) Restore(s *PolicySnapshot) error {
+	if s == nil {
+		return errors.New("snapshot is nil")
+	}
+
+	// Copy again so that the snapshot stays intact for a later Restore.
+	saved := s.model.Copy()
+	for _, sec := range []string{"p", "g"} {
+		for ptype, ast := range e.model[sec] {
+			if savedAst, ok := saved[sec][ptype]; ok {
+				ast.Policy = savedAst.Policy
+				ast.PolicyMap = savedAst.PolicyMap
+			} else {
+				ast.Policy = nil
+				ast.PolicyMap = make(map[string]int)
+			}
+		}
+	}
+	e.invalidateMatcherMap()
+	defer e.policyChanged()
+
+	e.resume(s)
+
+	if err := e.rebuildRoleLinks(e.model); err != nil {
+		return err
+	}
+	return e.rebuildConditionalRoleLinks(e.model)
+}
+
+// CommitSnapshot keeps the edits made since the snapshot was taken by BeginSnapshot and resumes auto-save,
+// watcher notifications and the dispatcher. If auto-save was enabled, the whole policy is saved to the adapter
+// once. Then a WatcherEx is notified of the rules removed and added since the snapshot, per policy type, and
+// another watcher is updated once. The edits are not dispatched to the other instances.
+func (e *Enforcer) CommitSnapshot(s *PolicySnapshot) error {
+	if s == nil {
+		return errors.New("snapshot is nil")
+	}
+	if !s.begun {
+		return errors.New("snapshot was not taken by BeginSnapshot or is already committed or restored")
+	}
+
+	e.resume(s)
+
+	if e.autoSave && e.adapter != nil {
+		if err := e.adapter.SavePolicy(e.model); err != nil {
+			return err
+		}
+	}
+	if !e.shouldNotify() {
+		return nil
+	}
+	if _, ok := e.watcher.(persist.WatcherEx); !ok {
+		return e.watcher.Update()
+	}
+	before, after := exportPolicy(s.model), e.ExportPolicy()
+	for _, sec := range sortedKeys(before, after) {
+		for _, ptype := range sortedPTypes(before[sec], after[sec]) {
+			if removed := missingRules(before[sec][ptype], after[sec][ptype]); len(removed) != 0 {
+				if err := e.notifyRemovePolicies(sec, ptype, removed); err != nil {
+					return err
+				}
+			}
+			if added := missingRules(after[sec][ptype], before[sec][ptype]); len(added) != 0 {
+				if err := e.notifyAddPolicies(sec, ptype, added); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
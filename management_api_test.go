@@ -15,8 +15,14 @@
 package casbin
 
 import (
+	"errors"
+	"reflect"
+	"strings"
 	"testing"
 
+	"github.com/ApicaSystem/casbin/v2/model"
+	"github.com/ApicaSystem/casbin/v2/persist"
+	fileadapter "github.com/ApicaSystem/casbin/v2/persist/file-adapter"
 	"github.com/ApicaSystem/casbin/v2/util"
 )
 
@@ -197,8 +203,38 @@ func TestGetPolicyAPI(t *testing.T) {
 	testHasGroupingPolicy(t, e, []string{"bob", "data2_admin"}, false)
 }
 
+func TestGetPolicyCount(t *testing.T) {
+	e, _ := NewEnforcer("examples/multiple_policy_definitions_model.conf", "examples/multiple_policy_definitions_policy.csv")
+
+	if count := e.GetPolicyCount("p"); count != 1 {
+		t.Errorf("GetPolicyCount(p) = %d, supposed to be 1", count)
+	}
+	if count := e.GetPolicyCount("p2"); count != 2 {
+		t.Errorf("GetPolicyCount(p2) = %d, supposed to be 2", count)
+	}
+	if count := e.GetPolicyCount("p3"); count != 0 {
+		t.Errorf("GetPolicyCount(p3) = %d, supposed to be 0", count)
+	}
+	if count := e.GetModel().TotalPolicyCount(); count != 3 {
+		t.Errorf("TotalPolicyCount() = %d, supposed to be 3", count)
+	}
+
+	e.EnableAutoSave(false)
+	if _, err := e.AddPolicy("alice", "data1", "read"); err != nil {
+		t.Fatal(err)
+	}
+	if count := e.GetPolicyCount("p"); count != 2 {
+		t.Errorf("GetPolicyCount(p) = %d, supposed to be 2", count)
+	}
+	if count := e.GetModel().TotalPolicyCount(); count != 4 {
+		t.Errorf("TotalPolicyCount() = %d, supposed to be 4", count)
+	}
+}
+
 func TestModifyPolicyAPI(t *testing.T) {
 	e, _ := NewEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
+	// Rules are only modified in memory, keep the policy file untouched.
+	e.EnableAutoSave(false)
 
 	testGetPolicy(t, e, [][]string{
 		{"alice", "data1", "read"},
@@ -280,6 +316,8 @@ func TestModifyPolicyAPI(t *testing.T) {
 
 func TestModifyGroupingPolicyAPI(t *testing.T) {
 	e, _ := NewEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
+	// Rules are only modified in memory, keep the policy file untouched.
+	e.EnableAutoSave(false)
 
 	testGetRoles(t, e, []string{"data2_admin"}, "alice")
 	testGetRoles(t, e, []string{}, "bob")
@@ -360,3 +398,579 @@ func TestModifyGroupingPolicyAPI(t *testing.T) {
 	_, _ = e.AddNamedGroupingPoliciesEx("g", [][]string{{"user1", "member"}, {"user2", "member"}, {"user3", "member"}})
 	testGetUsers(t, e, []string{"user1", "user2", "user3"}, "member")
 }
+
+func TestAddGroupingPoliciesFromMap(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
+
+	ok, err := e.AddGroupingPoliciesFromMap(map[string][]string{
+		"bob":   {"data2_admin", "data3_admin"},
+		"eve":   {"data3_admin"},
+		"alice": {"data2_admin"},
+	})
+	if !ok || err != nil {
+		t.Fatalf("AddGroupingPoliciesFromMap: %t, %v", ok, err)
+	}
+
+	testGetRoles(t, e, []string{"data2_admin"}, "alice")
+	testGetRoles(t, e, []string{"data2_admin", "data3_admin"}, "bob")
+	testGetRoles(t, e, []string{"data3_admin"}, "eve")
+	testGetUsers(t, e, []string{"alice", "bob"}, "data2_admin")
+	testEnforce(t, e, "bob", "data2", "read", true)
+
+	ok, _ = e.AddGroupingPoliciesFromMap(map[string][]string{})
+	if ok {
+		t.Error("an empty map should not change the policy")
+	}
+
+	e, _ = NewEnforcer("examples/rbac_with_domains_model.conf", "examples/rbac_with_domains_policy.csv")
+	_, _ = e.AddGroupingPoliciesFromMap(map[string][]string{"carol": {"admin"}, "dave": {"admin"}}, "domain2")
+	testGetUsersInDomain(t, e, "admin", "domain2", []string{"bob", "carol", "dave"})
+	testGetUsersInDomain(t, e, "admin", "domain1", []string{"alice"})
+}
+
+// mockSaveAdapter records SavePolicy calls instead of writing the policy file.
+type mockSaveAdapter struct {
+	*fileadapter.Adapter
+	saved bool
+}
+
+func (a *mockSaveAdapter) SavePolicy(model model.Model) error {
+	a.saved = true
+	return nil
+}
+
+// mockReplaceAdapter additionally supports replacing all rules in a single call.
+type mockReplaceAdapter struct {
+	mockSaveAdapter
+	replaced [][]string
+}
+
+func (a *mockReplaceAdapter) ReplaceAllPolicies(sec string, ptype string, rules [][]string) error {
+	a.replaced = rules
+	return nil
+}
+
+// mockAddAdapter records the rules of AddPolicies calls.
+type mockAddAdapter struct {
+	mockSaveAdapter
+	added [][][]string
+}
+
+func (a *mockAddAdapter) AddPolicies(sec string, ptype string, rules [][]string) error {
+	a.added = append(a.added, rules)
+	return nil
+}
+
+func TestAddPoliciesWithAffected(t *testing.T) {
+	a := &mockAddAdapter{mockSaveAdapter: mockSaveAdapter{Adapter: fileadapter.NewAdapter("examples/rbac_policy.csv")}}
+	e, _ := NewEnforcer("examples/rbac_model.conf", a)
+	w := &recordingWatcherEx{}
+	_ = e.SetWatcher(w)
+
+	rules := [][]string{
+		{"alice", "data1", "read"},
+		{"carol", "data1", "read"},
+		{"bob", "data2", "write"},
+		{"carol", "data2", "write"},
+		{"carol", "data1", "read"},
+	}
+	added, err := e.AddPoliciesWithAffected(rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := [][]string{{"carol", "data1", "read"}, {"carol", "data2", "write"}}
+	if !reflect.DeepEqual(added, expected) {
+		t.Errorf("added %v, supposed to be %v", added, expected)
+	}
+	if len(a.added) != 1 || !reflect.DeepEqual(a.added[0], expected) {
+		t.Errorf("adapter added %v, supposed to be %v", a.added, expected)
+	}
+	if !reflect.DeepEqual(w.calls, []string{"AddPolicies p p [[carol data1 read] [carol data2 write]]"}) {
+		t.Errorf("watcher calls: %v", w.calls)
+	}
+	testEnforce(t, e, "carol", "data2", "write", true)
+
+	// nothing new, nothing saved.
+	added, err = e.AddPoliciesWithAffected(rules)
+	if err != nil || len(added) != 0 {
+		t.Errorf("added %v, %v, supposed to be nothing", added, err)
+	}
+	if len(a.added) != 1 {
+		t.Errorf("AddPolicies called %d times, supposed to be once", len(a.added))
+	}
+
+	// AddPoliciesEx saves only the new rules too.
+	if ok, err := e.AddPoliciesEx([][]string{{"alice", "data1", "read"}, {"dave", "data1", "read"}}); !ok || err != nil {
+		t.Fatalf("AddPoliciesEx: %t, %v", ok, err)
+	}
+	if len(a.added) != 2 || !reflect.DeepEqual(a.added[1], [][]string{{"dave", "data1", "read"}}) {
+		t.Errorf("adapter added %v, supposed to be [[dave data1 read]]", a.added[len(a.added)-1])
+	}
+}
+
+func TestReplaceAllPolicies(t *testing.T) {
+	rules := [][]string{{"alice", "data2", "write"}, {"bob", "data1", "read"}}
+
+	a := &mockReplaceAdapter{mockSaveAdapter: mockSaveAdapter{Adapter: fileadapter.NewAdapter("examples/rbac_policy.csv")}}
+	e, _ := NewEnforcer("examples/rbac_model.conf", a)
+
+	ok, err := e.ReplaceAllPolicies(rules)
+	if !ok || err != nil {
+		t.Fatalf("ReplaceAllPolicies: %t, %v", ok, err)
+	}
+	testGetPolicy(t, e, rules)
+	if !util.Array2DEquals(rules, a.replaced) {
+		t.Errorf("adapter replaced %v, supposed to be %v", a.replaced, rules)
+	}
+	if a.saved {
+		t.Error("SavePolicy should not be called when the adapter supports ReplaceAllPolicies")
+	}
+
+	testEnforce(t, e, "alice", "data1", "read", false)
+	testEnforce(t, e, "alice", "data2", "write", true)
+	testEnforce(t, e, "bob", "data1", "read", true)
+	testEnforce(t, e, "bob", "data2", "write", false)
+	// Grouping policy is left untouched.
+	testGetRoles(t, e, []string{"data2_admin"}, "alice")
+
+	s := &mockSaveAdapter{Adapter: fileadapter.NewAdapter("examples/rbac_policy.csv")}
+	e, _ = NewEnforcer("examples/rbac_model.conf", s)
+
+	ok, err = e.ReplaceAllPolicies(rules)
+	if !ok || err != nil {
+		t.Fatalf("ReplaceAllPolicies: %t, %v", ok, err)
+	}
+	testGetPolicy(t, e, rules)
+	if !s.saved {
+		t.Error("SavePolicy should be called when the adapter does not support ReplaceAllPolicies")
+	}
+}
+
+func TestReplaceAllPoliciesValidated(t *testing.T) {
+	a := &mockReplaceAdapter{mockSaveAdapter: mockSaveAdapter{Adapter: fileadapter.NewAdapter("examples/rbac_policy.csv")}}
+	e, _ := NewEnforcer("examples/rbac_model.conf", a)
+	e.AddPolicyValidator("p", func(rule []string) error {
+		if rule[0] == "eve" {
+			return errors.New("eve is not allowed")
+		}
+		return nil
+	})
+
+	if ok, err := e.ReplaceAllPolicies([][]string{{"bob", "data1", "read"}, {"eve", "data1", "read"}}); ok || err == nil {
+		t.Errorf("ReplaceAllPolicies: %t, %v, supposed to be rejected", ok, err)
+	}
+	if a.replaced != nil {
+		t.Errorf("adapter replaced %v, supposed to be untouched", a.replaced)
+	}
+	testEnforce(t, e, "alice", "data1", "read", true)
+	testEnforce(t, e, "bob", "data1", "read", false)
+}
+
+// failingSaveAdapter fails to save the policy.
+type failingSaveAdapter struct {
+	*fileadapter.Adapter
+}
+
+func (a *failingSaveAdapter) SavePolicy(model model.Model) error {
+	return errors.New("save failed")
+}
+
+// recordingDispatcher records the calls of AddPolicies and UpdateFilteredPolicies.
+type recordingDispatcher struct {
+	persist.Dispatcher
+	added              [][]string
+	oldRules, newRules [][]string
+}
+
+func (d *recordingDispatcher) AddPolicies(sec string, ptype string, rules [][]string) error {
+	d.added = append(d.added, rules...)
+	return nil
+}
+
+func (d *recordingDispatcher) UpdateFilteredPolicies(sec string, ptype string, oldRules [][]string, newRules [][]string) error {
+	d.oldRules, d.newRules = oldRules, newRules
+	return nil
+}
+
+func TestReplaceAllPoliciesRollback(t *testing.T) {
+	rules := [][]string{{"alice", "data2", "write"}, {"bob", "data1", "read"}}
+
+	e, _ := NewEnforcer("examples/rbac_model.conf", &failingSaveAdapter{Adapter: fileadapter.NewAdapter("examples/rbac_policy.csv")})
+	before, _ := e.GetPolicy()
+	if ok, err := e.ReplaceAllPolicies(rules); ok || err == nil {
+		t.Errorf("ReplaceAllPolicies: %t, %v, supposed to fail", ok, err)
+	}
+	testGetPolicy(t, e, before)
+	testEnforce(t, e, "alice", "data1", "read", true)
+	testEnforce(t, e, "bob", "data1", "read", false)
+
+	// with a dispatcher, the replacement is dispatched instead of applied locally.
+	d, _ := NewDistributedEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
+	dispatcher := &recordingDispatcher{}
+	d.SetDispatcher(dispatcher)
+	if ok, err := d.ReplaceAllPolicies(rules); !ok || err != nil {
+		t.Fatalf("ReplaceAllPolicies: %t, %v", ok, err)
+	}
+	if !util.Array2DEquals(dispatcher.oldRules, before) || !util.Array2DEquals(dispatcher.newRules, rules) {
+		t.Errorf("dispatched %v -> %v, supposed to be %v -> %v", dispatcher.oldRules, dispatcher.newRules, before, rules)
+	}
+	testGetPolicy(t, d.Enforcer, before)
+}
+
+func TestPolicyDiff(t *testing.T) {
+	current, _ := NewEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
+	current.EnableAutoSave(false)
+	proposed, _ := NewEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
+	proposed.EnableAutoSave(false)
+
+	_, _ = proposed.RemovePolicy("alice", "data1", "read")
+	_, _ = proposed.UpdatePolicy([]string{"bob", "data2", "write"}, []string{"bob", "data2", "read"})
+	_, _ = proposed.AddPolicy("carol", "data3", "read")
+	_, _ = proposed.AddRoleForUser("carol", "data2_admin")
+
+	diff := current.ExportPolicy().Diff(proposed.ExportPolicy())
+	expected := PolicyDiff{
+		Added: []PolicyRule{
+			{Sec: "g", PType: "g", Rule: []string{"carol", "data2_admin"}},
+			{Sec: "p", PType: "p", Rule: []string{"carol", "data3", "read"}},
+		},
+		Removed: []PolicyRule{{Sec: "p", PType: "p", Rule: []string{"alice", "data1", "read"}}},
+		Updated: []PolicyUpdate{{Sec: "p", PType: "p", OldRule: []string{"bob", "data2", "write"}, NewRule: []string{"bob", "data2", "read"}}},
+	}
+	if !reflect.DeepEqual(diff, expected) {
+		t.Fatalf("diff: %+v, supposed to be %+v", diff, expected)
+	}
+
+	if err := current.ApplyDiff(diff); err != nil {
+		t.Fatal(err)
+	}
+	if d := Diff(current.ExportPolicy(), proposed.ExportPolicy()); !d.IsEmpty() {
+		t.Errorf("policies still differ after applying the diff: %+v", d)
+	}
+	testEnforce(t, current, "alice", "data1", "read", false)
+	testEnforce(t, current, "bob", "data2", "read", true)
+	testEnforce(t, current, "carol", "data2", "write", true)
+
+	// the diff no longer applies, and nothing is changed.
+	if err := current.ApplyDiff(diff); err == nil {
+		t.Error("a diff whose removed rules are missing should not apply")
+	}
+	if d := Diff(current.ExportPolicy(), proposed.ExportPolicy()); !d.IsEmpty() {
+		t.Errorf("a failed diff changed the policy: %+v", d)
+	}
+
+	// a rule changed twice in one diff is rejected.
+	twice := PolicyDiff{Added: []PolicyRule{
+		{Sec: "p", PType: "p", Rule: []string{"dave", "data1", "read"}},
+		{Sec: "p", PType: "p", Rule: []string{"dave", "data1", "read"}},
+	}}
+	if err := current.ApplyDiff(twice); err == nil {
+		t.Error("a diff adding a rule twice should not apply")
+	}
+	testEnforce(t, current, "dave", "data1", "read", false)
+}
+
+// failingAddAdapter removes and updates rules, but fails to add them.
+type failingAddAdapter struct {
+	*fileadapter.Adapter
+}
+
+func (a *failingAddAdapter) RemovePolicies(sec string, ptype string, rules [][]string) error {
+	return nil
+}
+
+func (a *failingAddAdapter) UpdatePolicies(sec string, ptype string, oldRules, newRules [][]string) error {
+	return nil
+}
+
+func (a *failingAddAdapter) AddPolicies(sec string, ptype string, rules [][]string) error {
+	return errors.New("add failed")
+}
+
+func TestApplyDiffRollback(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_model.conf", &failingAddAdapter{Adapter: fileadapter.NewAdapter("examples/rbac_policy.csv")})
+	before := e.ExportPolicy()
+
+	diff := PolicyDiff{
+		Added:   []PolicyRule{{Sec: "g", PType: "g", Rule: []string{"carol", "data2_admin"}}},
+		Removed: []PolicyRule{{Sec: "p", PType: "p", Rule: []string{"alice", "data1", "read"}}},
+		Updated: []PolicyUpdate{{Sec: "p", PType: "p", OldRule: []string{"bob", "data2", "write"}, NewRule: []string{"bob", "data2", "read"}}},
+	}
+	if err := e.ApplyDiff(diff); err == nil {
+		t.Fatal("ApplyDiff is supposed to fail when the adapter fails to add rules")
+	}
+	if d := Diff(before, e.ExportPolicy()); !d.IsEmpty() {
+		t.Errorf("a failed diff changed the policy: %+v", d)
+	}
+	testEnforce(t, e, "alice", "data1", "read", true)
+	testEnforce(t, e, "bob", "data2", "write", true)
+	testEnforce(t, e, "carol", "data2", "write", false)
+}
+
+func TestPoliciesSince(t *testing.T) {
+	a := &mockSaveAdapter{Adapter: fileadapter.NewAdapter("examples/rbac_policy.csv")}
+	e, _ := NewEnforcer("examples/rbac_model.conf", a)
+
+	s := e.Snapshot()
+	since := e.ExportPolicy()
+	if added := e.PoliciesAddedSince(since); len(added) != 0 {
+		t.Errorf("PoliciesAddedSince: %v, supposed to be empty", added)
+	}
+
+	_, _ = e.AddPolicy("bob", "data1", "read")
+	_, _ = e.RemovePolicy("alice", "data1", "read")
+	_, _ = e.AddGroupingPolicy("bob", "data2_admin")
+	_, _ = e.RemoveGroupingPolicy("alice", "data2_admin")
+	_, _ = e.AddPolicy("carol", "data1", "read")
+	_, _ = e.RemovePolicy("carol", "data1", "read")
+
+	added := [][]string{{"g", "bob", "data2_admin"}, {"p", "bob", "data1", "read"}}
+	if res := e.PoliciesAddedSince(since); !reflect.DeepEqual(res, added) {
+		t.Errorf("PoliciesAddedSince: %v, supposed to be %v", res, added)
+	}
+	removed := [][]string{{"g", "alice", "data2_admin"}, {"p", "alice", "data1", "read"}}
+	if res := e.PoliciesRemovedSince(since); !reflect.DeepEqual(res, removed) {
+		t.Errorf("PoliciesRemovedSince: %v, supposed to be %v", res, removed)
+	}
+
+	if err := e.Restore(s); err != nil {
+		t.Fatal(err)
+	}
+	if res := e.PoliciesAddedSince(since); len(res) != 0 {
+		t.Errorf("PoliciesAddedSince after restore: %v, supposed to be empty", res)
+	}
+	if res := e.PoliciesRemovedSince(since); len(res) != 0 {
+		t.Errorf("PoliciesRemovedSince after restore: %v, supposed to be empty", res)
+	}
+}
+
+// mockUpdateAdapter records UpdatePolicies calls and fails them for failPType.
+type mockUpdateAdapter struct {
+	mockSaveAdapter
+	updated   []string
+	failPType string
+}
+
+func (a *mockUpdateAdapter) UpdatePolicy(sec string, ptype string, oldRule, newRule []string) error {
+	return a.UpdatePolicies(sec, ptype, [][]string{oldRule}, [][]string{newRule})
+}
+
+func (a *mockUpdateAdapter) UpdatePolicies(sec string, ptype string, oldRules, newRules [][]string) error {
+	if ptype == a.failPType {
+		return errors.New("update failed")
+	}
+	a.updated = append(a.updated, ptype)
+	return nil
+}
+
+func (a *mockUpdateAdapter) UpdateFilteredPolicies(sec string, ptype string, newRules [][]string, fieldIndex int, fieldValues ...string) ([][]string, error) {
+	return nil, errors.New("not implemented")
+}
+
+func TestBatchUpdatePolicies(t *testing.T) {
+	a := &mockUpdateAdapter{mockSaveAdapter: mockSaveAdapter{Adapter: fileadapter.NewAdapter("examples/rbac_policy.csv")}}
+	e, _ := NewEnforcer("examples/rbac_model.conf", a)
+
+	updates := []PolicyUpdate{
+		{PType: "p", OldRule: []string{"alice", "data1", "read"}, NewRule: []string{"alice", "data1", "write"}},
+		{PType: "g", OldRule: []string{"alice", "data2_admin"}, NewRule: []string{"bob", "data2_admin"}},
+		{PType: "p", OldRule: []string{"bob", "data2", "write"}, NewRule: []string{"bob", "data3", "write"}},
+	}
+
+	// a missing old rule rejects the whole batch.
+	missing := append(updates, PolicyUpdate{PType: "p", OldRule: []string{"carol", "data1", "read"}, NewRule: []string{"carol", "data1", "write"}})
+	if err := e.BatchUpdatePolicies(missing); err == nil {
+		t.Error("a batch with a missing rule should not apply")
+	}
+	if len(a.updated) != 0 {
+		t.Errorf("adapter updated %v, supposed to be nothing", a.updated)
+	}
+
+	// the adapter failing on g undoes the updates of p.
+	a.failPType = "g"
+	if err := e.BatchUpdatePolicies(updates); err == nil {
+		t.Error("a batch failing in the adapter should return the error")
+	}
+	testGetPolicy(t, e, [][]string{
+		{"alice", "data1", "read"},
+		{"bob", "data2", "write"},
+		{"data2_admin", "data2", "read"},
+		{"data2_admin", "data2", "write"}})
+	testGetRoles(t, e, []string{"data2_admin"}, "alice")
+
+	a.failPType = ""
+	a.updated = nil
+	if err := e.BatchUpdatePolicies(updates); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(a.updated, []string{"p", "g"}) {
+		t.Errorf("adapter updated %v, supposed to be [p g]", a.updated)
+	}
+	testGetPolicy(t, e, [][]string{
+		{"alice", "data1", "write"},
+		{"bob", "data3", "write"},
+		{"data2_admin", "data2", "read"},
+		{"data2_admin", "data2", "write"}})
+	testGetRoles(t, e, []string{}, "alice")
+	testGetRoles(t, e, []string{"data2_admin"}, "bob")
+	testEnforce(t, e, "bob", "data2", "read", true)
+	testEnforce(t, e, "alice", "data2", "read", false)
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	a := &mockSaveAdapter{Adapter: fileadapter.NewAdapter("examples/rbac_policy.csv")}
+	e, _ := NewEnforcer("examples/rbac_model.conf", a)
+
+	s := e.BeginSnapshot()
+	if _, err := e.AddPolicy("bob", "data1", "read"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.RemovePolicy("alice", "data1", "read"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.AddGroupingPolicy("bob", "data2_admin"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.RemoveGroupingPolicy("alice", "data2_admin"); err != nil {
+		t.Fatal(err)
+	}
+	testEnforce(t, e, "bob", "data1", "read", true)
+	testEnforce(t, e, "bob", "data2", "write", true)
+	testEnforce(t, e, "alice", "data1", "read", false)
+	testEnforce(t, e, "alice", "data2", "write", false)
+
+	if err := e.Restore(s); err != nil {
+		t.Fatal(err)
+	}
+	testGetPolicy(t, e, [][]string{
+		{"alice", "data1", "read"},
+		{"bob", "data2", "write"},
+		{"data2_admin", "data2", "read"},
+		{"data2_admin", "data2", "write"}})
+	testGetGroupingPolicy(t, e, [][]string{{"alice", "data2_admin"}})
+	testEnforce(t, e, "bob", "data1", "read", false)
+	testEnforce(t, e, "bob", "data2", "read", false)
+	testEnforce(t, e, "alice", "data1", "read", true)
+	testEnforce(t, e, "alice", "data2", "write", true)
+	testGetRoles(t, e, []string{}, "bob")
+	testGetRoles(t, e, []string{"data2_admin"}, "alice")
+	if a.saved {
+		t.Error("SavePolicy should not be called when the snapshot is restored")
+	}
+
+	// the watcher is not notified and the dispatcher not called while a snapshot is begun.
+	d, _ := NewDistributedEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
+	d.EnableAutoSave(false)
+	w := &recordingWatcherEx{}
+	_ = d.SetWatcher(w)
+	dispatcher := &recordingDispatcher{}
+	d.SetDispatcher(dispatcher)
+	s = d.BeginSnapshot()
+	if _, err := d.AddPolicy("bob", "data1", "read"); err != nil {
+		t.Fatal(err)
+	}
+	testEnforce(t, d.Enforcer, "bob", "data1", "read", true)
+	if err := d.Restore(s); err != nil {
+		t.Fatal(err)
+	}
+	testEnforce(t, d.Enforcer, "bob", "data1", "read", false)
+	if len(w.calls) != 0 || len(dispatcher.added) != 0 {
+		t.Errorf("watcher calls %v, dispatched %v, supposed to be none", w.calls, dispatcher.added)
+	}
+	if _, err := d.AddPolicy("bob", "data1", "read"); err != nil || len(dispatcher.added) != 1 {
+		t.Errorf("the dispatcher should be resumed: %v, dispatched %v", err, dispatcher.added)
+	}
+
+	// a plain snapshot has no side effect.
+	w.calls = nil
+	s = d.Snapshot()
+	if _, err := d.AddPolicy("alice", "data2", "read"); err != nil {
+		t.Fatal(err)
+	}
+	if len(w.calls) != 1 || len(dispatcher.added) != 2 {
+		t.Errorf("watcher calls %v, dispatched %v, supposed to be notified as usual", w.calls, dispatcher.added)
+	}
+	if err := d.CommitSnapshot(s); err == nil {
+		t.Error("CommitSnapshot should fail for a snapshot not taken by BeginSnapshot")
+	}
+
+	// the commit notifies the watcher of the edits made since the snapshot.
+	w.calls = nil
+	s = d.BeginSnapshot()
+	if _, err := d.AddPolicy("carol", "data1", "read"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.RemovePolicy("alice", "data1", "read"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.AddGroupingPolicy("carol", "data2_admin"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.CommitSnapshot(s); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"AddPolicies g g [[carol data2_admin]]",
+		"RemovePolicies p p [[alice data1 read]]",
+		"AddPolicies p p [[carol data1 read]]",
+	}
+	if !reflect.DeepEqual(w.calls, expected) {
+		t.Errorf("watcher calls %v, supposed to be %v", w.calls, expected)
+	}
+	if err := d.CommitSnapshot(s); err == nil {
+		t.Error("CommitSnapshot should fail for a snapshot already committed")
+	}
+
+	s = e.BeginSnapshot()
+	if _, err := e.AddPolicy("bob", "data1", "read"); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.CommitSnapshot(s); err != nil {
+		t.Fatal(err)
+	}
+	if !a.saved {
+		t.Error("SavePolicy should be called when the snapshot is committed")
+	}
+	testEnforce(t, e, "bob", "data1", "read", true)
+
+	e.Snapshot()
+	if !e.autoSave {
+		t.Error("auto-save should not be suspended by a plain snapshot")
+	}
+}
+
+func TestAddPolicyValidator(t *testing.T) {
+	e, _ := NewEnforcer("examples/keymatch_model.conf", "examples/keymatch_policy.csv")
+	e.EnableAutoSave(false)
+
+	errNoSlash := errors.New("obj must start with /")
+	e.AddPolicyValidator("p", func(rule []string) error {
+		if !strings.HasPrefix(rule[1], "/") {
+			return errNoSlash
+		}
+		return nil
+	})
+
+	if _, err := e.AddPolicy("alice", "alice_data", "GET"); err != errNoSlash {
+		t.Errorf("AddPolicy should be rejected by the validator, got %v", err)
+	}
+	if _, err := e.AddPolicies([][]string{{"dave", "/dave_data", "GET"}, {"dave", "dave_data", "POST"}}); err != errNoSlash {
+		t.Errorf("AddPolicies should be rejected by the validator, got %v", err)
+	}
+	if _, err := e.UpdatePolicy([]string{"cathy", "/cathy_data", "(GET)|(POST)"}, []string{"cathy", "cathy_data", "GET"}); err != errNoSlash {
+		t.Errorf("UpdatePolicy should be rejected by the validator, got %v", err)
+	}
+	testHasPolicy(t, e, []string{"dave", "/dave_data", "GET"}, false)
+	testHasPolicy(t, e, []string{"cathy", "/cathy_data", "(GET)|(POST)"}, true)
+
+	if ok, err := e.AddPolicy("dave", "/dave_data", "GET"); !ok || err != nil {
+		t.Errorf("AddPolicy of a valid rule: %v, %v", ok, err)
+	}
+	testEnforce(t, e, "dave", "/dave_data", "GET", true)
+
+	// validators of other ptypes are not called.
+	e.AddPolicyValidator("p2", func(rule []string) error { return errNoSlash })
+	if ok, err := e.AddPolicy("dave", "/dave_data", "POST"); !ok || err != nil {
+		t.Errorf("AddPolicy of a valid rule: %v, %v", ok, err)
+	}
+}
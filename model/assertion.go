@@ -36,10 +36,13 @@ type Assertion struct {
 	FieldIndexMap map[string]int
 
 	logger log.Logger
+	// lenientArity makes AdjustRuleArity trim trailing empty fields and pad missing ones.
+	lenientArity bool
 }
 
+// buildIncrementalRoleLinks adds or deletes the links of rules in rm. Unlike buildRoleLinks, it does not make rm
+// the role manager of the assertion, which enforce calls may be reading concurrently.
 func (ast *Assertion) buildIncrementalRoleLinks(rm rbac.RoleManager, op PolicyOp, rules [][]string) error {
-	ast.RM = rm
 	count := strings.Count(ast.Value, "_")
 	if count < 2 {
 		return errors.New("the number of \"_\" in role definition should be at least 2")
@@ -90,8 +93,8 @@ func (ast *Assertion) buildRoleLinks(rm rbac.RoleManager) error {
 	return nil
 }
 
+// buildIncrementalConditionalRoleLinks adds or deletes the links of rules in condRM, see buildIncrementalRoleLinks.
 func (ast *Assertion) buildIncrementalConditionalRoleLinks(condRM rbac.ConditionalRoleManager, op PolicyOp, rules [][]string) error {
-	ast.CondRM = condRM
 	count := strings.Count(ast.Value, "_")
 	if count < 2 {
 		return errors.New("the number of \"_\" in role definition should be at least 2")
@@ -110,9 +113,9 @@ func (ast *Assertion) buildIncrementalConditionalRoleLinks(condRM rbac.Condition
 
 		switch op {
 		case PolicyAdd:
-			err = ast.addConditionalRoleLink(rule, domainRule)
+			err = ast.addConditionalRoleLink(condRM, rule, domainRule)
 		case PolicyRemove:
-			err = ast.CondRM.DeleteLink(rule[0], rule[1], rule[2:]...)
+			err = condRM.DeleteLink(rule[0], rule[1], rule[2:]...)
 		}
 		if err != nil {
 			return err
@@ -138,7 +141,7 @@ func (ast *Assertion) buildConditionalRoleLinks(condRM rbac.ConditionalRoleManag
 
 		domainRule := rule[2:len(ast.Tokens)]
 
-		err := ast.addConditionalRoleLink(rule, domainRule)
+		err := ast.addConditionalRoleLink(condRM, rule, domainRule)
 		if err != nil {
 			return err
 		}
@@ -148,18 +151,18 @@ func (ast *Assertion) buildConditionalRoleLinks(condRM rbac.ConditionalRoleManag
 }
 
 // addConditionalRoleLink adds Link to rbac.ConditionalRoleManager and sets the parameters for LinkConditionFunc.
-func (ast *Assertion) addConditionalRoleLink(rule []string, domainRule []string) error {
+func (ast *Assertion) addConditionalRoleLink(condRM rbac.ConditionalRoleManager, rule []string, domainRule []string) error {
 	var err error
 	if len(domainRule) == 0 {
-		err = ast.CondRM.AddLink(rule[0], rule[1])
+		err = condRM.AddLink(rule[0], rule[1])
 		if err == nil {
-			ast.CondRM.SetLinkConditionFuncParams(rule[0], rule[1], rule[len(ast.Tokens):]...)
+			condRM.SetLinkConditionFuncParams(rule[0], rule[1], rule[len(ast.Tokens):]...)
 		}
 	} else {
 		domain := domainRule[0]
-		err = ast.CondRM.AddLink(rule[0], rule[1], domain)
+		err = condRM.AddLink(rule[0], rule[1], domain)
 		if err == nil {
-			ast.CondRM.SetDomainLinkConditionFuncParams(rule[0], rule[1], domain, rule[len(ast.Tokens):]...)
+			condRM.SetDomainLinkConditionFuncParams(rule[0], rule[1], domain, rule[len(ast.Tokens):]...)
 		}
 	}
 	return err
@@ -169,8 +172,14 @@ func (ast *Assertion) setLogger(logger log.Logger) {
 	ast.logger = logger
 }
 
+// PolicyCount returns the number of rules of the assertion.
+func (ast *Assertion) PolicyCount() int {
+	return len(ast.Policy)
+}
+
 func (ast *Assertion) copy() *Assertion {
 	tokens := append([]string(nil), ast.Tokens...)
+	paramsTokens := append([]string(nil), ast.ParamsTokens...)
 	policy := make([][]string, len(ast.Policy))
 
 	for i, p := range ast.Policy {
@@ -186,8 +195,10 @@ func (ast *Assertion) copy() *Assertion {
 		Value:         ast.Value,
 		PolicyMap:     policyMap,
 		Tokens:        tokens,
+		ParamsTokens:  paramsTokens,
 		Policy:        policy,
 		FieldIndexMap: ast.FieldIndexMap,
+		lenientArity:  ast.lenientArity,
 	}
 
 	return newAst
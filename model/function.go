@@ -33,7 +33,8 @@ func (fm *FunctionMap) AddFunction(name string, function govaluate.ExpressionFun
 	fm.fns.LoadOrStore(name, function)
 }
 
-// LoadFunctionMap loads an initial function map.
+// LoadFunctionMap loads an initial function map. The durationMatch function, also named scheduleMatch, is not
+// part of it, the enforcer adds it bound to its clock unless a function of the same name was added.
 func LoadFunctionMap() FunctionMap {
 	fm := &FunctionMap{}
 	fm.fns = &sync.Map{}
@@ -42,13 +43,23 @@ func LoadFunctionMap() FunctionMap {
 	fm.AddFunction("keyGet", util.KeyGetFunc)
 	fm.AddFunction("keyMatch2", util.KeyMatch2Func)
 	fm.AddFunction("keyGet2", util.KeyGet2Func)
+	fm.AddFunction("keyMatchI", util.KeyMatchIFunc)
 	fm.AddFunction("keyMatch3", util.KeyMatch3Func)
 	fm.AddFunction("keyGet3", util.KeyGet3Func)
 	fm.AddFunction("keyMatch4", util.KeyMatch4Func)
 	fm.AddFunction("keyMatch5", util.KeyMatch5Func)
+	fm.AddFunction("keyMatchN", util.KeyMatchNFunc)
+	fm.AddFunction("keyGetN", util.KeyGetNFunc)
 	fm.AddFunction("regexMatch", util.RegexMatchFunc)
 	fm.AddFunction("ipMatch", util.IPMatchFunc)
+	fm.AddFunction("ipRangeMatch", util.IPRangeMatchFunc)
+	fm.AddFunction("ipWildcardMatch", util.IPWildcardMatchFunc)
+	fm.AddFunction("ipMatchAny", util.IPMatchAnyFunc)
+	fm.AddFunction("ipMatchExcept", util.IPMatchExceptFunc)
 	fm.AddFunction("globMatch", util.GlobMatchFunc)
+	fm.AddFunction("domainMatch", util.DomainMatchFunc)
+	fm.AddFunction("originMatch", util.OriginMatchFunc)
+	fm.AddFunction("sha256Eq", util.Sha256EqFunc)
 
 	return *fm
 }
@@ -15,7 +15,9 @@
 package model
 
 import (
+	"bytes"
 	"container/list"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"regexp"
@@ -195,6 +197,10 @@ func (model Model) loadModelFromConfig(cfg config.ConfigInterface) error {
 	for s := range sectionNameMap {
 		loadSection(model, cfg, s)
 	}
+	return model.checkRequiredSections()
+}
+
+func (model Model) checkRequiredSections() error {
 	ms := make([]string, 0)
 	for _, rs := range requiredSections {
 		if !model.hasSection(rs) {
@@ -341,14 +347,12 @@ func (model Model) SortPoliciesByPriority() error {
 			continue
 		}
 		policies := assertion.Policy
+		// rules with an invalid priority keep their relative order after all the valid ones.
 		sort.SliceStable(policies, func(i, j int) bool {
-			p1, err := strconv.Atoi(policies[i][priorityIndex])
-			if err != nil {
-				return true
-			}
-			p2, err := strconv.Atoi(policies[j][priorityIndex])
-			if err != nil {
-				return true
+			p1, err1 := strconv.Atoi(policies[i][priorityIndex])
+			p2, err2 := strconv.Atoi(policies[j][priorityIndex])
+			if err1 != nil || err2 != nil {
+				return err1 == nil && err2 != nil
 			}
 			return p1 < p2
 		})
@@ -365,16 +369,7 @@ var (
 )
 
 func (model Model) ToText() string {
-	tokenPatterns := make(map[string]string)
-
-	for _, ptype := range []string{"r", "p"} {
-		for _, token := range model[ptype][ptype].Tokens {
-			tokenPatterns[token] = rPattern.ReplaceAllString(pPattern.ReplaceAllString(token, "p."), "r.")
-		}
-	}
-	if strings.Contains(model["e"]["e"].Value, "p_eft") {
-		tokenPatterns["p_eft"] = "p.eft"
-	}
+	tokenPatterns := model.tokenPatterns()
 	s := strings.Builder{}
 	writeString := func(sec string) {
 		for ptype := range model[sec] {
@@ -402,6 +397,89 @@ func (model Model) ToText() string {
 	return s.String()
 }
 
+// tokenPatterns maps the escaped request and policy tokens back to their dotted form, e.g. "r_sub" to "r.sub".
+func (model Model) tokenPatterns() map[string]string {
+	tokenPatterns := make(map[string]string)
+
+	for _, ptype := range []string{"r", "p"} {
+		for _, token := range model[ptype][ptype].Tokens {
+			tokenPatterns[token] = rPattern.ReplaceAllString(pPattern.ReplaceAllString(token, "p."), "r.")
+		}
+	}
+	if strings.Contains(model["e"]["e"].Value, "p_eft") {
+		tokenPatterns["p_eft"] = "p.eft"
+	}
+	return tokenPatterns
+}
+
+// ToJSON serialises the model definition into JSON. The sections are keyed by their CONF names and hold
+// the definition of every assertion, e.g. {"request_definition":{"r":"sub, obj, act"}, ...}.
+func (model Model) ToJSON() ([]byte, error) {
+	tokenPatterns := model.tokenPatterns()
+	sections := make(map[string]map[string]string)
+	for sec, name := range sectionNameMap {
+		if !model.hasSection(sec) {
+			continue
+		}
+		assertions := make(map[string]string)
+		for key, ast := range model[sec] {
+			value := ast.Value
+			if sec == "e" || sec == "m" {
+				for tokenPattern, newToken := range tokenPatterns {
+					value = strings.Replace(value, tokenPattern, newToken, -1)
+				}
+			}
+			assertions[key] = value
+		}
+		sections[name] = assertions
+	}
+
+	// Matchers are full of "&&", keep them readable instead of escaping them for HTML.
+	buf := bytes.Buffer{}
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(sections); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// NewModelFromJSON creates a model from the JSON produced by ToJSON.
+func NewModelFromJSON(data []byte) (Model, error) {
+	var sections map[string]map[string]string
+	if err := json.Unmarshal(data, &sections); err != nil {
+		return nil, err
+	}
+	return newModelFromSections(sections)
+}
+
+// newModelFromSections creates a model from the definitions of the assertions keyed by their CONF section names.
+func newModelFromSections(sections map[string]map[string]string) (Model, error) {
+	secOfName := make(map[string]string, len(sectionNameMap))
+	for sec, name := range sectionNameMap {
+		secOfName[name] = sec
+	}
+
+	m := NewModel()
+	for name, assertions := range sections {
+		sec, ok := secOfName[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown section: %s", name)
+		}
+		for key, value := range assertions {
+			if !strings.HasPrefix(key, sec) {
+				return nil, fmt.Errorf("invalid assertion key %s in section %s", key, name)
+			}
+			m.AddDef(sec, key, value)
+		}
+	}
+
+	if err := m.checkRequiredSections(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 func (model Model) Copy() Model {
 	newModel := NewModel()
 
@@ -17,6 +17,7 @@ package model
 import (
 	"io/ioutil"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -159,3 +160,227 @@ func testModelToText(t *testing.T, mData, mExpected string) {
 		}
 	}
 }
+
+func TestModelToJSON(t *testing.T) {
+	m, _ := NewModelFromFile(filepath.Join("..", "examples", "rbac_model.conf"))
+	data, err := m.ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"matchers":{"m":"g(r.sub, p.sub) && r.obj == p.obj && r.act == p.act"},` +
+		`"policy_definition":{"p":"sub, obj, act"},` +
+		`"policy_effect":{"e":"some(where (p.eft == allow))"},` +
+		`"request_definition":{"r":"sub, obj, act"},` +
+		`"role_definition":{"g":"_, _"}}`
+	if string(data) != expected {
+		t.Errorf("JSON: %s, supposed to be %s", data, expected)
+	}
+}
+
+func TestModelJSONRoundTrip(t *testing.T) {
+	for _, name := range []string{
+		"basic_model.conf",
+		"rbac_model.conf",
+		"rbac_with_domains_model.conf",
+		"rbac_with_deny_model.conf",
+		"abac_rule_model.conf",
+		"keymatch_model.conf",
+	} {
+		m, err := NewModelFromFile(filepath.Join("..", "examples", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := m.ToJSON()
+		if err != nil {
+			t.Fatal(err)
+		}
+		newM, err := NewModelFromJSON(data)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if m.ToText() != newM.ToText() {
+			t.Errorf("%s: model changed after JSON round trip:\n%s\nsupposed to be:\n%s", name, newM.ToText(), m.ToText())
+		}
+	}
+}
+
+func TestNewModelFromJSONErrors(t *testing.T) {
+	for _, data := range []string{
+		`not json`,
+		`{"request_definition":{"r":"sub, obj, act"}}`,
+		`{"unknown":{"u":"sub"}}`,
+		`{"request_definition":{"x":"sub, obj, act"}}`,
+	} {
+		if _, err := NewModelFromJSON([]byte(data)); err == nil {
+			t.Errorf("%s should fail to load", data)
+		}
+	}
+}
+
+func TestNewModelFromTOML(t *testing.T) {
+	text := `# RBAC model
+[request_definition]
+r = "sub, obj, act"
+
+[policy_definition]
+p = 'sub, obj, act' # a literal string
+
+[role_definition]
+g = "_, _"
+
+[policy_effect]
+e = "some(where (p.eft == allow))"
+
+[matchers]
+m = """
+g(r.sub, p.sub) && \
+    r.obj == p.obj && r.act == p.act"""
+`
+	m, err := NewModelFromTOML(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, _ := NewModelFromFile(filepath.Join("..", "examples", "rbac_model.conf"))
+	if m.ToText() != expected.ToText() {
+		t.Errorf("TOML model:\n%s\nsupposed to be:\n%s", m.ToText(), expected.ToText())
+	}
+
+	m, err = NewModelFromTOML(`
+[request_definition]
+r = "sub, obj, act"
+[policy_definition]
+p = "sub, obj, act"
+[policy_effect]
+e = "some(where (p.eft == allow))"
+[matchers]
+m = "r.sub == p.sub && r.obj == \"data\u0031\" && r.act == p.act"
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value := m["m"]["m"].Value; value != `r_sub == p_sub && r_obj == "data1" && r_act == p_act` {
+		t.Errorf("matcher: %s", value)
+	}
+}
+
+func TestNewModelFromTOMLErrors(t *testing.T) {
+	for _, text := range []string{
+		`r = "sub, obj, act"`,
+		"[request_definition]\nr = sub, obj, act",
+		"[request_definition]\nr = 1",
+		"[request_definition]\nr = \"sub, obj, act",
+		"[request_definition]\nr = \"sub\" obj",
+		"[request_definition]\nr = \"\\x\"",
+		"[[request_definition]]\nr = \"sub, obj, act\"",
+		"[request_definition]\nr = \"sub, obj, act\"",
+		"[unknown]\nu = \"sub\"",
+	} {
+		if _, err := NewModelFromTOML(text); err == nil {
+			t.Errorf("%q should fail to load", text)
+		}
+	}
+}
+
+func TestAdjustRuleArity(t *testing.T) {
+	m := NewModel()
+	m.AddDef("p", "p", "sub, obj, act")
+	m.AddDef("g", "g", "_, _")
+
+	rule := []string{"alice", "data1", "read", ""}
+	if res := m.AdjustRuleArity("p", "p", rule); strings.Join(res, ",") != "alice,data1,read," {
+		t.Errorf("strict arity should keep the rule, got %v", res)
+	}
+
+	m.SetStrictArity(false)
+	tests := []struct {
+		sec  string
+		rule []string
+		res  string
+	}{
+		{"p", []string{"alice", "data1", "read", "", ""}, "alice,data1,read"},
+		{"p", []string{"alice", "data1"}, "alice,data1,"},
+		{"p", []string{"alice", "data1", "read", "x"}, "alice,data1,read,x"},
+		{"g", []string{"alice", "admin", ""}, "alice,admin"},
+		{"g", []string{"alice", "admin", "param", ""}, "alice,admin,param"},
+	}
+	for _, test := range tests {
+		if res := m.AdjustRuleArity(test.sec, test.sec, test.rule); strings.Join(res, ",") != test.res {
+			t.Errorf("AdjustRuleArity(%v) = %v, supposed to be %s", test.rule, res, test.res)
+		}
+	}
+
+	if !m.Copy()["p"]["p"].lenientArity {
+		t.Error("Copy should keep the lenient arity")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, name := range []string{"basic_model.conf", "rbac_with_domains_model.conf", "abac_rule_model.conf", "priority_model.conf"} {
+		m, err := NewModelFromFile(filepath.Join("..", "examples", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if errs := m.Validate(); len(errs) != 0 {
+			t.Errorf("%s: unexpected errors %v", name, errs)
+		}
+	}
+
+	m := NewModel()
+	m.AddDef("r", "r", "sub, obj, act")
+	m.AddDef("p", "p", "sub, obj, act")
+	m.AddDef("g", "g", "_")
+	m.AddDef("e", "e", "some(where (p.eft == permit))")
+	m.AddDef("m", "m", `g(r.sub, p.sub) && g2(r.obj, p.obj) && r.dom == p.dom && r.act == "p.x"`)
+
+	expected := []ValidationError{
+		{Section: "e", Key: "e", Message: `unknown effect "some(where (p_eft == permit))"`},
+		{Section: "g", Key: "g", Message: `role definition needs at least two "_" placeholders`},
+		{Section: "m", Key: "m", Message: "r.dom is not declared"},
+		{Section: "m", Key: "m", Message: "p.dom is not declared"},
+		{Section: "m", Key: "m", Message: "g2() references an undeclared role definition"},
+	}
+	if errs := m.Validate(); !reflect.DeepEqual(errs, expected) {
+		t.Errorf("Validate() = %v, supposed to be %v", errs, expected)
+	}
+
+	if errs := NewModel().Validate(); len(errs) != len(requiredSections) {
+		t.Errorf("an empty model should miss %d sections, got %v", len(requiredSections), errs)
+	}
+}
+
+func TestGetAllPolicies(t *testing.T) {
+	m, err := NewModelFromFile(filepath.Join("..", "examples", "rbac_with_multiple_policy_model.conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = m.AddPolicies("p", "p", [][]string{{"admin", "data1", "read"}, {"admin", "data1", "write"}})
+	_ = m.AddPolicy("p", "p2", []string{"user", "read"})
+	_ = m.AddPolicy("g", "g", []string{"alice", "admin"})
+
+	policies := m.GetAllPolicies()
+	expected := map[string][][]string{
+		"p":  {{"admin", "data1", "read"}, {"admin", "data1", "write"}},
+		"p2": {{"user", "read"}},
+	}
+	if !reflect.DeepEqual(policies, expected) {
+		t.Errorf("GetAllPolicies() = %v, supposed to be %v", policies, expected)
+	}
+	groupingPolicies := m.GetAllGroupingPolicies()
+	expected = map[string][][]string{
+		"g":  {{"alice", "admin"}},
+		"g2": {},
+	}
+	if !reflect.DeepEqual(groupingPolicies, expected) {
+		t.Errorf("GetAllGroupingPolicies() = %v, supposed to be %v", groupingPolicies, expected)
+	}
+
+	// the rules returned are copies.
+	policies["p"][0][0] = "root"
+	policies["p2"] = append(policies["p2"], []string{"user", "write"})
+	if rules, _ := m.GetPolicy("p", "p"); rules[0][0] != "admin" {
+		t.Errorf("modifying the result changed the model: %v", rules)
+	}
+	if rules, _ := m.GetPolicy("p", "p2"); len(rules) != 1 {
+		t.Errorf("modifying the result changed the model: %v", rules)
+	}
+}
@@ -120,6 +120,30 @@ func (model Model) PrintPolicy() {
 	model.GetLogger().LogPolicy(policy)
 }
 
+// GetAllPolicies returns the rules of all the policy types of section "p", by ptype. The rules are copies,
+// modifying them does not change the model.
+func (model Model) GetAllPolicies() map[string][][]string {
+	return model.copySectionPolicies("p")
+}
+
+// GetAllGroupingPolicies returns the rules of all the role definitions of section "g", by ptype. The rules are
+// copies, modifying them does not change the model.
+func (model Model) GetAllGroupingPolicies() map[string][][]string {
+	return model.copySectionPolicies("g")
+}
+
+func (model Model) copySectionPolicies(sec string) map[string][][]string {
+	res := make(map[string][][]string, len(model[sec]))
+	for ptype, ast := range model[sec] {
+		rules := make([][]string, len(ast.Policy))
+		for i, rule := range ast.Policy {
+			rules[i] = append([]string(nil), rule...)
+		}
+		res[ptype] = rules
+	}
+	return res
+}
+
 // ClearPolicy clears all current policy.
 func (model Model) ClearPolicy() {
 	for _, ast := range model["p"] {
@@ -142,6 +166,15 @@ func (model Model) GetPolicy(sec string, ptype string) ([][]string, error) {
 	return model[sec][ptype].Policy, nil
 }
 
+// TotalPolicyCount returns the number of rules of all the policy types in section "p".
+func (model Model) TotalPolicyCount() int {
+	count := 0
+	for _, ast := range model["p"] {
+		count += ast.PolicyCount()
+	}
+	return count
+}
+
 // GetFilteredPolicy gets rules based on field filters from a policy.
 func (model Model) GetFilteredPolicy(sec string, ptype string, fieldIndex int, fieldValues ...string) ([][]string, error) {
 	_, err := model.GetAssertion(sec, ptype)
@@ -167,6 +200,44 @@ func (model Model) GetFilteredPolicy(sec string, ptype string, fieldIndex int, f
 	return res, nil
 }
 
+// SetStrictArity controls how rules whose field count does not match the policy definition are loaded.
+// Strict, the default, rejects them. Lenient trims trailing empty fields and pads missing trailing fields
+// with empty values, see AdjustRuleArity.
+func (model Model) SetStrictArity(strict bool) {
+	for _, sec := range []string{"p", "g"} {
+		for _, ast := range model[sec] {
+			ast.lenientArity = !strict
+		}
+	}
+}
+
+// AdjustRuleArity fits a rule to the field count of its policy definition when the arity is lenient,
+// by trimming trailing empty fields and padding missing trailing fields with empty values.
+// Grouping rules keep extra non-empty fields, which are used as condition parameters.
+// The rule is returned unchanged when the arity is strict or the policy type does not exist.
+func (model Model) AdjustRuleArity(sec string, ptype string, rule []string) []string {
+	assertion, err := model.GetAssertion(sec, ptype)
+	if err != nil || !assertion.lenientArity {
+		return rule
+	}
+
+	size := len(assertion.Tokens)
+	end := len(rule)
+	for end > size && rule[end-1] == "" {
+		end--
+	}
+	if end == len(rule) && end >= size {
+		return rule
+	}
+
+	if end < size {
+		end = size
+	}
+	res := make([]string, end)
+	copy(res, rule)
+	return res
+}
+
 // HasPolicyEx determines whether a model has the specified policy rule with error.
 func (model Model) HasPolicyEx(sec string, ptype string, rule []string) (bool, error) {
 	assertion, err := model.GetAssertion(sec, ptype)
@@ -278,6 +349,17 @@ func (model Model) AddPoliciesWithAffected(sec string, ptype string, rules [][]s
 	return affected, err
 }
 
+// ReplacePolicies replaces all policy rules of the given ptype with rules.
+func (model Model) ReplacePolicies(sec string, ptype string, rules [][]string) error {
+	assertion, err := model.GetAssertion(sec, ptype)
+	if err != nil {
+		return err
+	}
+	assertion.Policy = nil
+	assertion.PolicyMap = map[string]int{}
+	return model.AddPolicies(sec, ptype, rules)
+}
+
 // RemovePolicy removes a policy rule from the model.
 // Deprecated: Using AddPoliciesWithAffected instead.
 func (model Model) RemovePolicy(sec string, ptype string, rule []string) (bool, error) {
@@ -0,0 +1,212 @@
+// Copyright 2023 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// NewModelFromTOML creates a model from TOML text, with a table per section and a string per assertion:
+//
+//	[request_definition]
+//	r = "sub, obj, act"
+//
+//	[matchers]
+//	m = """
+//	g(r.sub, p.sub) && \
+//	r.obj == p.obj && r.act == p.act"""
+//
+// Basic, literal and multi-line strings are supported. Since every assertion is a string, other TOML values,
+// arrays and nested tables are rejected.
+func NewModelFromTOML(text string) (Model, error) {
+	sections, err := parseTOML(text)
+	if err != nil {
+		return nil, err
+	}
+	return newModelFromSections(sections)
+}
+
+// parseTOML parses the string-valued tables of TOML text.
+func parseTOML(text string) (map[string]map[string]string, error) {
+	sections := make(map[string]map[string]string)
+	var section map[string]string
+
+	lines := strings.Split(strings.Replace(text, "\r\n", "\n", -1), "\n")
+	for i := 0; i < len(lines); i++ {
+		lineNum := i + 1
+		line := strings.TrimSpace(lines[i])
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			end := strings.Index(line, "]")
+			if strings.HasPrefix(line, "[[") || end == -1 || !isTOMLComment(line[end+1:]) {
+				return nil, fmt.Errorf("line %d: invalid table header %s", lineNum, line)
+			}
+			name := strings.TrimSpace(line[1:end])
+			if _, ok := sections[name]; ok {
+				return nil, fmt.Errorf("line %d: duplicate table %s", lineNum, name)
+			}
+			section = make(map[string]string)
+			sections[name] = section
+			continue
+		}
+
+		eq := strings.Index(line, "=")
+		if eq == -1 {
+			return nil, fmt.Errorf("line %d: expected key = value, got %s", lineNum, line)
+		}
+		key := strings.TrimSpace(line[:eq])
+		if section == nil {
+			return nil, fmt.Errorf("line %d: key %s outside of a table", lineNum, key)
+		}
+		if _, ok := section[key]; ok {
+			return nil, fmt.Errorf("line %d: duplicate key %s", lineNum, key)
+		}
+
+		rest := strings.TrimSpace(line[eq+1:])
+		for _, delim := range []string{`"""`, `'''`} {
+			if !strings.HasPrefix(rest, delim) {
+				continue
+			}
+			// a multi-line string runs until the closing delimiter, possibly on a later line.
+			for !strings.Contains(rest[3:], delim) && i+1 < len(lines) {
+				i++
+				rest += "\n" + lines[i]
+			}
+			break
+		}
+
+		value, err := parseTOMLString(rest)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: value of %s: %v", lineNum, key, err)
+		}
+		section[key] = value
+	}
+
+	return sections, nil
+}
+
+// parseTOMLString parses a TOML string value followed by an optional comment.
+func parseTOMLString(s string) (string, error) {
+	var delim string
+	for _, d := range []string{`"""`, `'''`, `"`, `'`} {
+		if strings.HasPrefix(s, d) {
+			delim = d
+			break
+		}
+	}
+	if delim == "" {
+		return "", fmt.Errorf("expected a string, got %s", s)
+	}
+
+	body := s[len(delim):]
+	end := -1
+	for i := 0; i+len(delim) <= len(body); i++ {
+		if delim[0] == '"' && body[i] == '\\' {
+			i++
+			continue
+		}
+		if strings.HasPrefix(body[i:], delim) {
+			end = i
+			break
+		}
+	}
+	if end == -1 {
+		return "", fmt.Errorf("unterminated string %s", s)
+	}
+	if !isTOMLComment(body[end+len(delim):]) {
+		return "", fmt.Errorf("unexpected %s after the string", strings.TrimSpace(body[end+len(delim):]))
+	}
+
+	value := body[:end]
+	multiLine := len(delim) == 3
+	if multiLine {
+		// a newline right after the opening delimiter is trimmed.
+		value = strings.TrimPrefix(strings.TrimPrefix(value, "\r"), "\n")
+	} else if strings.Contains(value, "\n") {
+		return "", fmt.Errorf("newline in a single-line string")
+	}
+
+	if delim[0] == '\'' {
+		return value, nil
+	}
+	return unescapeTOML(value, multiLine)
+}
+
+// unescapeTOML resolves the escape sequences of a TOML basic string. In multi-line strings, a backslash at the
+// end of a line trims the line break and the whitespace up to the next non-whitespace character.
+func unescapeTOML(s string, multiLine bool) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '\\' {
+			b.WriteByte(c)
+			continue
+		}
+		if i+1 == len(s) {
+			return "", fmt.Errorf("invalid escape at the end of %q", s)
+		}
+		i++
+		switch s[i] {
+		case 'b':
+			b.WriteByte('\b')
+		case 't':
+			b.WriteByte('\t')
+		case 'n':
+			b.WriteByte('\n')
+		case 'f':
+			b.WriteByte('\f')
+		case 'r':
+			b.WriteByte('\r')
+		case '"':
+			b.WriteByte('"')
+		case '\\':
+			b.WriteByte('\\')
+		case 'u', 'U':
+			n := 4
+			if s[i] == 'U' {
+				n = 8
+			}
+			if i+n >= len(s) {
+				return "", fmt.Errorf("invalid unicode escape in %q", s)
+			}
+			code, err := strconv.ParseUint(s[i+1:i+1+n], 16, 32)
+			if err != nil || !utf8.ValidRune(rune(code)) {
+				return "", fmt.Errorf("invalid unicode escape in %q", s)
+			}
+			b.WriteRune(rune(code))
+			i += n
+		default:
+			rest := strings.TrimLeft(s[i:], " \t\r")
+			if !multiLine || !strings.HasPrefix(rest, "\n") {
+				return "", fmt.Errorf("invalid escape \\%c in %q", s[i], s)
+			}
+			rest = strings.TrimLeft(rest, " \t\r\n")
+			i = len(s) - len(rest) - 1
+		}
+	}
+	return b.String(), nil
+}
+
+// isTOMLComment reports whether s is blank or a comment.
+func isTOMLComment(s string) bool {
+	s = strings.TrimSpace(s)
+	return s == "" || strings.HasPrefix(s, "#")
+}
@@ -0,0 +1,138 @@
+// Copyright 2023 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ApicaSystem/casbin/v2/constant"
+)
+
+// ValidationError is a structural error of a model, found by Validate.
+type ValidationError struct {
+	// Section is the section of the model in which the error is, e.g. "m".
+	Section string
+	// Key is the assertion of the section in which the error is, e.g. "m" or "g2".
+	Key     string
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	if e.Key == "" {
+		return fmt.Sprintf("%s: %s", sectionNameMap[e.Section], e.Message)
+	}
+	return fmt.Sprintf("%s.%s: %s", sectionNameMap[e.Section], e.Key, e.Message)
+}
+
+var knownEffects = []string{
+	constant.AllowOverrideEffect,
+	constant.DenyOverrideEffect,
+	constant.AllowAndDenyEffect,
+	constant.PriorityEffect,
+	constant.SubjectPriorityEffect,
+	constant.PriorityDenyOverrideEffect,
+	constant.AllOfEffect,
+	constant.SpecificityEffect,
+}
+
+var (
+	stringLiteralRegex = regexp.MustCompile(`"(\\.|[^"\\])*"|'(\\.|[^'\\])*'`)
+	requestTokenRegex  = regexp.MustCompile(`\b[rp][0-9]*_\w+`)
+	roleFunctionRegex  = regexp.MustCompile(`\b(g[0-9]*)\s*\(`)
+)
+
+// Validate checks the structure of the model and returns the errors found, which is empty for a valid model:
+// the required sections must be present, the matchers may only reference declared request and policy tokens
+// and role definitions, the effect must be one of the known expressions and every role definition must have
+// at least two "_" placeholders.
+func (model Model) Validate() []ValidationError {
+	var errs []ValidationError
+	for _, sec := range requiredSections {
+		if !model.hasSection(sec) {
+			errs = append(errs, ValidationError{Section: sec, Message: "section is missing"})
+		}
+	}
+
+	for _, key := range model.sortedKeys("e") {
+		value := model["e"][key].Value
+		if !isKnownEffect(value) {
+			errs = append(errs, ValidationError{Section: "e", Key: key, Message: fmt.Sprintf("unknown effect %q", value)})
+		}
+	}
+
+	for _, key := range model.sortedKeys("g") {
+		placeholders := 0
+		for _, token := range model["g"][key].Tokens {
+			if strings.TrimSpace(token) == "_" {
+				placeholders++
+			}
+		}
+		if placeholders < 2 {
+			errs = append(errs, ValidationError{Section: "g", Key: key, Message: "role definition needs at least two \"_\" placeholders"})
+		}
+	}
+
+	declared := make(map[string]bool)
+	for _, sec := range []string{"r", "p"} {
+		for _, ast := range model[sec] {
+			for _, token := range ast.Tokens {
+				declared[token] = true
+			}
+		}
+	}
+	for _, key := range model.sortedKeys("m") {
+		matcher := stringLiteralRegex.ReplaceAllString(model["m"][key].Value, "")
+		reported := make(map[string]bool)
+		for _, token := range requestTokenRegex.FindAllString(matcher, -1) {
+			if !declared[token] && !reported[token] {
+				reported[token] = true
+				errs = append(errs, ValidationError{Section: "m", Key: key,
+					Message: fmt.Sprintf("%s is not declared", strings.Replace(token, "_", ".", 1))})
+			}
+		}
+		for _, match := range roleFunctionRegex.FindAllStringSubmatch(matcher, -1) {
+			ptype := match[1]
+			if _, ok := model["g"][ptype]; !ok && !reported[ptype] {
+				reported[ptype] = true
+				errs = append(errs, ValidationError{Section: "m", Key: key,
+					Message: fmt.Sprintf("%s() references an undeclared role definition", ptype)})
+			}
+		}
+	}
+
+	return errs
+}
+
+func isKnownEffect(value string) bool {
+	for _, effect := range knownEffects {
+		if value == effect {
+			return true
+		}
+	}
+	return false
+}
+
+// sortedKeys returns the keys of the assertions of a section in sorted order.
+func (model Model) sortedKeys(sec string) []string {
+	keys := make([]string, 0, len(model[sec]))
+	for key := range model[sec] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"testing"
 
+	"github.com/ApicaSystem/casbin/v2/observe"
 	"github.com/ApicaSystem/casbin/v2/util"
 )
 
@@ -55,6 +56,16 @@ func BenchmarkRBACModel(b *testing.B) {
 	}
 }
 
+func BenchmarkRBACModelWithObserver(b *testing.B) {
+	e, _ := NewEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv", false)
+	e.SetEnforceObserver(observe.NewMetrics())
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = e.Enforce("alice", "data2", "read")
+	}
+}
+
 func BenchmarkRBACModelSizes(b *testing.B) {
 	cases := []struct {
 		name      string
@@ -124,6 +135,52 @@ func BenchmarkRBACModelSizes(b *testing.B) {
 	}
 }
 
+func newFilterSubjectsBenchmark(b *testing.B) (*Enforcer, []interface{}) {
+	e, _ := NewEnforcer("examples/rbac_model.conf", false)
+
+	// 100 roles, 10 resources.
+	for i := 0; i < 100; i++ {
+		_, err := e.AddPolicy(fmt.Sprintf("group%d", i), fmt.Sprintf("data%d", i/10), "read")
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	// 1000 users.
+	subs := make([]interface{}, 0, 1000)
+	for i := 0; i < 1000; i++ {
+		_, err := e.AddGroupingPolicy(fmt.Sprintf("user%d", i), fmt.Sprintf("group%d", i/10))
+		if err != nil {
+			b.Fatal(err)
+		}
+		subs = append(subs, fmt.Sprintf("user%d", i))
+	}
+	return e, subs
+}
+
+func BenchmarkFilterAllowedSubjects(b *testing.B) {
+	e, subs := newFilterSubjectsBenchmark(b)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = e.FilterAllowedSubjects(subs, "data9", "read")
+	}
+}
+
+func BenchmarkFilterSubjectsWithEnforce(b *testing.B) {
+	e, subs := newFilterSubjectsBenchmark(b)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var allowed []interface{}
+		for _, sub := range subs {
+			if ok, _ := e.Enforce(sub, "data9", "read"); ok {
+				allowed = append(allowed, sub)
+			}
+		}
+	}
+}
+
 func BenchmarkRBACModelSmall(b *testing.B) {
 	e, _ := NewEnforcer("examples/rbac_model.conf", false)
 
@@ -262,6 +319,17 @@ func BenchmarkKeyMatchModel(b *testing.B) {
 	}
 }
 
+func BenchmarkKeyMatchModelWithRegexMatch(b *testing.B) {
+	e, _ := NewEnforcer("examples/keymatch_model.conf", "examples/keymatch_policy.csv", false)
+
+	// the last rule matches, so regexMatch runs against the action of every rule.
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = e.Enforce("cathy", "/cathy_data", "POST")
+	}
+}
+
 func BenchmarkRBACModelWithDeny(b *testing.B) {
 	e, _ := NewEnforcer("examples/rbac_with_deny_model.conf", "examples/rbac_with_deny_policy.csv")
 
@@ -17,6 +17,7 @@ package casbin
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/ApicaSystem/casbin/v2/log"
@@ -262,6 +263,51 @@ func TestRBACModelWithOnlyDeny(t *testing.T) {
 	testEnforce(t, e, "alice", "data2", "write", false)
 }
 
+func TestRBACModelWithDomainWildcardDeny(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_with_domain_deny_model.conf", "examples/rbac_with_domain_deny_policy.csv")
+
+	// p, *, domain1, *, *, deny locks down domain1 for everyone.
+	testDomainEnforce(t, e, "alice", "domain1", "data1", "read", false)
+	testDomainEnforce(t, e, "alice", "domain1", "data1", "write", false)
+	testDomainEnforce(t, e, "bob", "domain1", "data1", "read", false)
+	testDomainEnforce(t, e, "admin", "domain1", "data1", "read", false)
+
+	// domain2 is unaffected.
+	testDomainEnforce(t, e, "alice", "domain2", "data2", "read", true)
+	testDomainEnforce(t, e, "alice", "domain2", "data2", "write", true)
+	testDomainEnforce(t, e, "bob", "domain2", "data2", "read", true)
+	testDomainEnforce(t, e, "bob", "domain2", "data1", "read", false)
+
+	_, _ = e.RemovePolicy("*", "domain1", "*", "*", "deny")
+	testDomainEnforce(t, e, "alice", "domain1", "data1", "read", true)
+	testDomainEnforce(t, e, "bob", "domain1", "data1", "read", false)
+
+	_, _ = e.AddPolicy("*", "domain2", "*", "*", "deny")
+	testDomainEnforce(t, e, "alice", "domain2", "data2", "read", false)
+	testDomainEnforce(t, e, "bob", "domain2", "data2", "write", false)
+	testDomainEnforce(t, e, "alice", "domain1", "data1", "write", true)
+}
+
+func TestRBACModelWithHierarchicalDomains(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_with_hierarchical_domains_model.conf", "examples/rbac_with_hierarchical_domains_policy.csv")
+
+	// without the domain matching function, roles are only effective in the domain they are granted in.
+	testDomainEnforce(t, e, "alice", "org", "data1", "read", true)
+	testDomainEnforce(t, e, "alice", "org/team", "data1", "read", false)
+
+	e.AddNamedDomainMatchingFunc("g", "", util.DomainMatch)
+
+	testDomainEnforce(t, e, "alice", "org", "data1", "read", true)
+	testDomainEnforce(t, e, "alice", "org/team", "data1", "read", true)
+	testDomainEnforce(t, e, "alice", "org/team/sub", "data1", "write", true)
+	testDomainEnforce(t, e, "alice", "other", "data1", "read", false)
+
+	testDomainEnforce(t, e, "bob", "org/team", "data2", "read", true)
+	testDomainEnforce(t, e, "bob", "org/team/sub", "data2", "read", true)
+	testDomainEnforce(t, e, "bob", "org", "data2", "read", false)
+	testDomainEnforce(t, e, "bob", "org/team", "data1", "read", false)
+}
+
 func TestRBACModelWithCustomData(t *testing.T) {
 	e, _ := NewEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
 
@@ -510,6 +556,58 @@ func TestABACTypes(t *testing.T) {
 	testEnforce(t, e, string(jsonRequest), "", "", true)
 }
 
+type testAddress struct {
+	City    string
+	Country struct{ Code string }
+}
+
+type testNestedSub struct {
+	Name    string
+	Address testAddress
+}
+
+type testMeta struct {
+	Tags   []string
+	Labels map[string]string
+}
+
+type testNestedObj struct {
+	Meta *testMeta
+}
+
+func TestABACNestedAttributes(t *testing.T) {
+	e, _ := NewEnforcer("examples/abac_model.conf")
+	matcher := `r.sub.Address.City == "Paris" && r.sub.Address.Country.Code == "FR" && ` +
+		`r.obj.Meta.Labels.team == "eng" && r.obj.Meta.Tags[0] == "public"`
+	e.GetModel()["m"]["m"].Value = util.RemoveComments(util.EscapeAssertion(matcher))
+
+	sub := testNestedSub{Name: "alice", Address: testAddress{City: "Paris"}}
+	sub.Address.Country.Code = "FR"
+	obj := testNestedObj{Meta: &testMeta{Tags: []string{"public", "docs"}, Labels: map[string]string{"team": "eng"}}}
+	testEnforce(t, e, sub, obj, "read", true)
+	testEnforce(t, e, &sub, &obj, "read", true)
+
+	sub.Address.Country.Code = "IT"
+	testEnforce(t, e, sub, obj, "read", false)
+	sub.Address.Country.Code = "FR"
+
+	obj.Meta.Tags = []string{"private", "public"}
+	testEnforce(t, e, sub, obj, "read", false)
+
+	mapObj := map[string]interface{}{
+		"Meta": map[string]interface{}{
+			"Tags":   []interface{}{"public"},
+			"Labels": map[string]interface{}{"team": "eng"},
+		},
+	}
+	testEnforce(t, e, sub, mapObj, "read", true)
+
+	obj.Meta.Tags = nil
+	if _, err := e.Enforce(sub, obj, "read"); err == nil {
+		t.Error("an index out of range should return an error")
+	}
+}
+
 func TestABACJsonRequest(t *testing.T) {
 	e, _ := NewEnforcer("examples/abac_model.conf")
 	e.EnableAcceptJsonRequest(true)
@@ -637,6 +735,13 @@ func TestIPMatchModel(t *testing.T) {
 	testEnforce(t, e, "192.168.0.1", "data1", "write", false)
 	testEnforce(t, e, "192.168.0.1", "data2", "read", false)
 	testEnforce(t, e, "192.168.0.1", "data2", "write", false)
+
+	// a malformed pattern makes Enforce fail instead of panicking.
+	_, _ = e.AddPolicy("192.168.*", "data3", "read")
+	_, err := e.Enforce("192.168.2.123", "data3", "read")
+	if err == nil || !strings.HasPrefix(err.Error(), "ipMatch: invalid argument") {
+		t.Errorf("Enforce should fail with the ipMatch error, got %v", err)
+	}
 }
 
 func TestGlobMatchModel(t *testing.T) {
@@ -677,6 +782,78 @@ func TestPriorityModelIndeterminate(t *testing.T) {
 	testEnforce(t, e, "alice", "data1", "read", false)
 }
 
+func TestPriorityDenyOverrideModel(t *testing.T) {
+	e, _ := NewEnforcer("examples/priority_deny_override_model.conf", "examples/priority_deny_override_policy.csv")
+	// the deny of priority 1 wins although the allow comes first.
+	testEnforce(t, e, "alice", "data1", "read", false)
+	// a deny of a lower priority does not override an allow of a higher one.
+	testEnforce(t, e, "bob", "data2", "read", true)
+	// priorities without a matching rule are skipped.
+	testEnforce(t, e, "bob", "data2", "write", true)
+	testEnforce(t, e, "alice", "data2", "read", false)
+
+	// with priority(p.eft) || deny, the first matching rule wins.
+	e, _ = NewEnforcer("examples/priority_model_explicit.conf", "examples/priority_deny_override_policy.csv")
+	testEnforce(t, e, "alice", "data1", "read", true)
+	testEnforce(t, e, "bob", "data2", "read", true)
+	testEnforce(t, e, "bob", "data2", "write", true)
+	testEnforce(t, e, "alice", "data2", "read", false)
+
+	// on the policy of priority_model_explicit.conf, both effects agree.
+	e, _ = NewEnforcer("examples/priority_deny_override_model.conf", "examples/priority_policy_explicit.csv")
+	testEnforce(t, e, "alice", "data1", "write", true)
+	testEnforce(t, e, "alice", "data1", "read", true)
+	testEnforce(t, e, "bob", "data2", "read", false)
+	testEnforce(t, e, "bob", "data2", "write", true)
+
+	// the explanation is the deciding deny rule.
+	e, _ = NewEnforcer("examples/priority_deny_override_model.conf", "examples/priority_deny_override_policy.csv")
+	_, explain, _ := e.EnforceEx("alice", "data1", "read")
+	if !util.ArrayEquals(explain, []string{"1", "data1_readers", "data1", "read", "deny"}) {
+		t.Errorf("explain: %v", explain)
+	}
+}
+
+func TestAllOfModel(t *testing.T) {
+	e, _ := NewEnforcer("examples/all_of_model.conf", "examples/all_of_policy.csv")
+	// every matching rule allows.
+	testEnforce(t, e, "alice", "report", "approve", true)
+	testEnforce(t, e, "carol", "report", "approve", true)
+	testEnforce(t, e, "bob", "budget", "approve", true)
+	// one matching rule denies.
+	testEnforce(t, e, "bob", "report", "approve", false)
+	// no rule matches.
+	testEnforce(t, e, "carol", "budget", "approve", false)
+
+	testEnforceEx(t, e, "bob", "report", "approve", []string{"intern", "report", "approve", "deny"})
+	testEnforceEx(t, e, "alice", "report", "approve", []string{"finance", "report", "approve", "allow"})
+}
+
+func TestSpecificityModel(t *testing.T) {
+	e, _ := NewEnforcer("examples/specificity_model.conf", "examples/specificity_policy.csv")
+	// a rule naming the subject beats a rule for everyone.
+	testEnforce(t, e, "alice", "data1", "read", false)
+	testEnforce(t, e, "bob", "data1", "read", true)
+	// a deny wins over an allow of the same specificity.
+	testEnforce(t, e, "carol", "data2", "write", false)
+	testEnforce(t, e, "carol", "data2", "read", true)
+	// an object pattern is less specific than an object.
+	testEnforce(t, e, "bob", "data3/public", "read", true)
+	testEnforce(t, e, "bob", "data3/secret", "read", false)
+	// no rule matches.
+	testEnforce(t, e, "dave", "data4", "read", false)
+
+	testEnforceEx(t, e, "alice", "data1", "read", []string{"alice", "data1", "read", "deny"})
+	testEnforceEx(t, e, "bob", "data1", "read", []string{"*", "data1", "read", "allow"})
+	testEnforceEx(t, e, "carol", "data2", "write", []string{"data2_admin", "data2", "write", "deny"})
+
+	// the order of the rules does not matter.
+	e.ClearPolicy()
+	_, _ = e.AddPolicies([][]string{{"alice", "data1", "read", "deny"}, {"*", "data1", "read", "allow"}})
+	testEnforce(t, e, "alice", "data1", "read", false)
+	testEnforce(t, e, "bob", "data1", "read", true)
+}
+
 func TestRBACModelInMultiLines(t *testing.T) {
 	e, _ := NewEnforcer("examples/rbac_model_in_multi_line.conf", "examples/rbac_policy.csv")
 
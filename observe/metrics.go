@@ -0,0 +1,124 @@
+// Copyright 2023 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package observe provides enforce observers collecting authorization metrics.
+//
+// The package has no dependencies, so it does not register metrics with a monitoring system itself. The
+// prometheus-observer module ships a casbin.EnforcerObserver exporting the decisions to Prometheus, to be set
+// with SetObserver. For other systems, implement casbin.EnforcerObserver on top of their client SDK, or collect
+// with Metrics and publish its Snapshot, whose cumulative bucket counts map directly to a Prometheus histogram.
+package observe
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultBuckets are the upper bounds of the latency histogram used when no buckets are given.
+var DefaultBuckets = []time.Duration{
+	10 * time.Microsecond,
+	50 * time.Microsecond,
+	100 * time.Microsecond,
+	500 * time.Microsecond,
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+}
+
+// Metrics counts allowed and denied decisions and failed calls, and records the enforce latency in a histogram.
+// It implements casbin.EnforceErrorObserver and is safe for concurrent use.
+type Metrics struct {
+	allowed uint64
+	denied  uint64
+	errors  uint64
+	sum     int64
+	buckets []time.Duration
+	// counts has one counter per bucket plus a last one for latencies above all buckets.
+	counts []uint64
+}
+
+// Snapshot is a point-in-time copy of the metrics, laid out like a Prometheus histogram.
+type Snapshot struct {
+	Allowed uint64
+	Denied  uint64
+	// Errors is the number of enforce calls that failed with an error, they are neither allowed nor denied.
+	Errors uint64
+	// Buckets are the upper bounds of the histogram buckets.
+	Buckets []time.Duration
+	// Counts are cumulative: Counts[i] is the number of enforce calls that took at most Buckets[i].
+	// The extra last element is the total number of calls, failed ones included.
+	Counts []uint64
+	// Sum is the total latency of all calls.
+	Sum time.Duration
+}
+
+// NewMetrics creates Metrics with the given histogram buckets, DefaultBuckets are used if none are given.
+func NewMetrics(buckets ...time.Duration) *Metrics {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	sorted := make([]time.Duration, len(buckets))
+	copy(sorted, buckets)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	return &Metrics{
+		buckets: sorted,
+		counts:  make([]uint64, len(sorted)+1),
+	}
+}
+
+// ObserveEnforce records a single enforce decision.
+func (m *Metrics) ObserveEnforce(req []interface{}, allowed bool, dur time.Duration) {
+	if allowed {
+		atomic.AddUint64(&m.allowed, 1)
+	} else {
+		atomic.AddUint64(&m.denied, 1)
+	}
+	m.observeLatency(dur)
+}
+
+// ObserveEnforceError records an enforce call that failed with an error.
+func (m *Metrics) ObserveEnforceError(req []interface{}, err error, dur time.Duration) {
+	atomic.AddUint64(&m.errors, 1)
+	m.observeLatency(dur)
+}
+
+func (m *Metrics) observeLatency(dur time.Duration) {
+	atomic.AddInt64(&m.sum, int64(dur))
+
+	i := sort.Search(len(m.buckets), func(i int) bool { return dur <= m.buckets[i] })
+	atomic.AddUint64(&m.counts[i], 1)
+}
+
+// Snapshot returns the current metrics.
+func (m *Metrics) Snapshot() Snapshot {
+	s := Snapshot{
+		Allowed: atomic.LoadUint64(&m.allowed),
+		Denied:  atomic.LoadUint64(&m.denied),
+		Errors:  atomic.LoadUint64(&m.errors),
+		Buckets: m.buckets,
+		Counts:  make([]uint64, len(m.counts)),
+		Sum:     time.Duration(atomic.LoadInt64(&m.sum)),
+	}
+
+	var total uint64
+	for i := range m.counts {
+		total += atomic.LoadUint64(&m.counts[i])
+		s.Counts[i] = total
+	}
+	return s
+}
@@ -0,0 +1,69 @@
+// Copyright 2023 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package observe
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	m := NewMetrics(time.Second, time.Millisecond)
+
+	m.ObserveEnforce([]interface{}{"alice", "data1", "read"}, true, 500*time.Microsecond)
+	m.ObserveEnforce([]interface{}{"alice", "data1", "write"}, false, time.Millisecond)
+	m.ObserveEnforce([]interface{}{"bob", "data2", "write"}, true, 20*time.Millisecond)
+	m.ObserveEnforce([]interface{}{"bob", "data1", "read"}, false, 2*time.Second)
+	m.ObserveEnforceError([]interface{}{"bob"}, errors.New("invalid request size"), 3*time.Second)
+
+	s := m.Snapshot()
+	if s.Allowed != 2 || s.Denied != 2 || s.Errors != 1 {
+		t.Errorf("allowed %d, denied %d, errors %d, supposed to be 2, 2, 1", s.Allowed, s.Denied, s.Errors)
+	}
+	if !reflect.DeepEqual(s.Buckets, []time.Duration{time.Millisecond, time.Second}) {
+		t.Errorf("buckets: %v", s.Buckets)
+	}
+	if !reflect.DeepEqual(s.Counts, []uint64{2, 3, 5}) {
+		t.Errorf("counts: %v, supposed to be [2 3 5]", s.Counts)
+	}
+	if expected := 5*time.Second + 21*time.Millisecond + 500*time.Microsecond; s.Sum != expected {
+		t.Errorf("sum: %s, supposed to be %s", s.Sum, expected)
+	}
+}
+
+func TestMetricsConcurrent(t *testing.T) {
+	m := NewMetrics()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			m.ObserveEnforce(nil, i%2 == 0, time.Duration(i)*time.Microsecond)
+		}(i)
+	}
+	wg.Wait()
+
+	s := m.Snapshot()
+	if s.Allowed != 50 || s.Denied != 50 {
+		t.Errorf("allowed %d, denied %d, supposed to be 50, 50", s.Allowed, s.Denied)
+	}
+	if s.Counts[len(s.Counts)-1] != 100 {
+		t.Errorf("total count: %d, supposed to be 100", s.Counts[len(s.Counts)-1])
+	}
+}
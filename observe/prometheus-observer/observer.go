@@ -0,0 +1,75 @@
+// Copyright 2023 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package prometheusobserver provides a casbin.EnforcerObserver exporting the enforce decisions to Prometheus.
+//
+// It is a module of its own, so that the casbin module does not depend on the Prometheus client.
+package prometheusobserver
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// PrometheusObserver counts the allowed and the denied enforce decisions and records their latency in a
+// histogram, all labelled by model. Set it on an enforcer with SetObserver.
+type PrometheusObserver struct {
+	// Allowed is the casbin_enforce_allowed_total counter.
+	Allowed *prometheus.CounterVec
+	// Denied is the casbin_enforce_denied_total counter.
+	Denied *prometheus.CounterVec
+	// Latency is the casbin_enforce_duration_seconds histogram.
+	Latency *prometheus.HistogramVec
+}
+
+// NewPrometheusObserver creates a PrometheusObserver and registers its metrics with reg, or with
+// prometheus.DefaultRegisterer if reg is nil.
+func NewPrometheusObserver(reg prometheus.Registerer) (*PrometheusObserver, error) {
+	if reg == nil {
+		reg = prometheus.DefaultRegisterer
+	}
+
+	o := &PrometheusObserver{
+		Allowed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "casbin_enforce_allowed_total",
+			Help: "Number of enforce decisions allowing the request.",
+		}, []string{"model"}),
+		Denied: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "casbin_enforce_denied_total",
+			Help: "Number of enforce decisions denying the request.",
+		}, []string{"model"}),
+		Latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "casbin_enforce_duration_seconds",
+			Help:    "Latency of the enforce decisions.",
+			Buckets: prometheus.ExponentialBuckets(0.00001, 5, 8),
+		}, []string{"model"}),
+	}
+	for _, c := range []prometheus.Collector{o.Allowed, o.Denied, o.Latency} {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	return o, nil
+}
+
+// ObserveEnforce records a single enforce decision.
+func (o *PrometheusObserver) ObserveEnforce(allowed bool, duration time.Duration, model string) {
+	if allowed {
+		o.Allowed.WithLabelValues(model).Inc()
+	} else {
+		o.Denied.WithLabelValues(model).Inc()
+	}
+	o.Latency.WithLabelValues(model).Observe(duration.Seconds())
+}
@@ -0,0 +1,58 @@
+// Copyright 2023 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheusobserver
+
+import (
+	"testing"
+
+	"github.com/ApicaSystem/casbin/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestPrometheusObserver(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	obs, err := NewPrometheusObserver(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := casbin.NewEnforcer("../../examples/basic_model.conf", "../../examples/basic_policy.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.SetModelName("basic")
+	e.SetObserver(obs)
+
+	for _, req := range [][]interface{}{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"alice", "data1", "write"}} {
+		if _, err = e.Enforce(req...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n := testutil.ToFloat64(obs.Allowed.WithLabelValues("basic")); n != 2 {
+		t.Errorf("allowed %v, supposed to be 2", n)
+	}
+	if n := testutil.ToFloat64(obs.Denied.WithLabelValues("basic")); n != 1 {
+		t.Errorf("denied %v, supposed to be 1", n)
+	}
+	if n := testutil.CollectAndCount(obs.Latency); n != 1 {
+		t.Errorf("%d latency series, supposed to be 1", n)
+	}
+
+	// the metrics are registered once.
+	if _, err = NewPrometheusObserver(reg); err == nil {
+		t.Error("registering the metrics twice should fail")
+	}
+}
@@ -23,12 +23,17 @@ import (
 
 // LoadPolicyLine loads a text line as a policy rule to model.
 func LoadPolicyLine(line string, m model.Model) error {
+	return LoadPolicyLineWithSep(line, m, ',')
+}
+
+// LoadPolicyLineWithSep loads a text line whose fields are separated by sep as a policy rule to model.
+func LoadPolicyLineWithSep(line string, m model.Model, sep rune) error {
 	if line == "" || strings.HasPrefix(line, "#") {
 		return nil
 	}
 
 	r := csv.NewReader(strings.NewReader(line))
-	r.Comma = ','
+	r.Comma = sep
 	r.Comment = '#'
 	r.TrimLeadingSpace = true
 
@@ -44,7 +49,8 @@ func LoadPolicyLine(line string, m model.Model) error {
 func LoadPolicyArray(rule []string, m model.Model) error {
 	key := rule[0]
 	sec := key[:1]
-	ok, err := m.HasPolicyEx(sec, key, rule[1:])
+	fields := m.AdjustRuleArity(sec, key, rule[1:])
+	ok, err := m.HasPolicyEx(sec, key, fields)
 	if err != nil {
 		return err
 	}
@@ -52,7 +58,7 @@ func LoadPolicyArray(rule []string, m model.Model) error {
 		return nil // skip duplicated policy
 	}
 
-	err = m.AddPolicy(sec, key, rule[1:])
+	err = m.AddPolicy(sec, key, fields)
 	if err != nil {
 		return err
 	}
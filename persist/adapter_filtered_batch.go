@@ -0,0 +1,29 @@
+// Copyright 2023 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package persist
+
+import (
+	"github.com/ApicaSystem/casbin/v2/model"
+)
+
+// BatchFilteredAdapter is the interface for Casbin adapters able to load the policy rules
+// matching several filters in a single round-trip, e.g. one query per tenant set.
+type BatchFilteredAdapter interface {
+	FilteredAdapter
+
+	// LoadFilteredPolicies loads the policy rules matching any of the filters.
+	// Rules matched by more than one filter are only loaded once.
+	LoadFilteredPolicies(model model.Model, filters []interface{}) error
+}
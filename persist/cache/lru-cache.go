@@ -0,0 +1,103 @@
+// Copyright 2023 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"container/list"
+	"errors"
+	"time"
+)
+
+type lruEntry struct {
+	key  string
+	item cacheItem
+}
+
+// LRUCache is a capacity-bounded cache that evicts the least recently used
+// key once it is full. Items may additionally expire after a TTL.
+type LRUCache struct {
+	capacity int
+	items    map[string]*list.Element
+	order    *list.List
+}
+
+func (c *LRUCache) Set(key string, value bool, extra ...interface{}) error {
+	ttl := time.Duration(-1)
+	if len(extra) > 0 {
+		ttl = extra[0].(time.Duration)
+	}
+	item := cacheItem{
+		value:     value,
+		expiresAt: time.Now().Add(ttl),
+		ttl:       ttl,
+	}
+
+	if elem, ok := c.items[key]; ok {
+		elem.Value.(*lruEntry).item = item
+		c.order.MoveToFront(elem)
+		return nil
+	}
+
+	if c.order.Len() >= c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*lruEntry).key)
+	}
+	c.items[key] = c.order.PushFront(&lruEntry{key: key, item: item})
+	return nil
+}
+
+func (c *LRUCache) Get(key string) (bool, error) {
+	elem, ok := c.items[key]
+	if !ok {
+		return false, ErrNoSuchKey
+	}
+	entry := elem.Value.(*lruEntry)
+	if entry.item.ttl > 0 && time.Now().After(entry.item.expiresAt) {
+		c.order.Remove(elem)
+		delete(c.items, key)
+		return false, ErrNoSuchKey
+	}
+	c.order.MoveToFront(elem)
+	return entry.item.value, nil
+}
+
+func (c *LRUCache) Delete(key string) error {
+	elem, ok := c.items[key]
+	if !ok {
+		return ErrNoSuchKey
+	}
+	c.order.Remove(elem)
+	delete(c.items, key)
+	return nil
+}
+
+func (c *LRUCache) Clear() error {
+	c.items = make(map[string]*list.Element)
+	c.order.Init()
+	return nil
+}
+
+// NewLRUCache creates an LRU cache holding at most capacity keys.
+func NewLRUCache(capacity int) (Cache, error) {
+	if capacity <= 0 {
+		return nil, errors.New("capacity of LRU cache must be positive")
+	}
+	return &LRUCache{
+		capacity: capacity,
+		items:    make(map[string]*list.Element),
+		order:    list.New(),
+	}, nil
+}
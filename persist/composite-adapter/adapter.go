@@ -0,0 +1,239 @@
+// Copyright 2023 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compositeadapter
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/ApicaSystem/casbin/v2/model"
+	"github.com/ApicaSystem/casbin/v2/persist"
+)
+
+// Adapter is the composite adapter for Casbin. It maps each policy type to the adapter storing it,
+// e.g. "p" rules in a database and "g" rules in a directory service, and dispatches the calls per
+// policy type. An adapter may back several policy types. Rules of policy types without an adapter
+// are neither loaded nor saved, and changing them returns an error.
+type Adapter struct {
+	adapters map[string]persist.Adapter
+}
+
+// NewAdapter is the constructor for Adapter, adapters maps each policy type like "p" or "g2" to its adapter.
+func NewAdapter(adapters map[string]persist.Adapter) *Adapter {
+	m := make(map[string]persist.Adapter, len(adapters))
+	for ptype, a := range adapters {
+		m[ptype] = a
+	}
+	return &Adapter{adapters: m}
+}
+
+// group is an adapter with the policy types it backs.
+type group struct {
+	adapter persist.Adapter
+	ptypes  map[string]bool
+}
+
+// groups returns the distinct adapters with their policy types, in the order of their first policy type.
+// Adapters are compared by identity, so an adapter backing several policy types is loaded and saved once.
+func (a *Adapter) groups() []*group {
+	ptypes := make([]string, 0, len(a.adapters))
+	for ptype := range a.adapters {
+		ptypes = append(ptypes, ptype)
+	}
+	sort.Strings(ptypes)
+
+	var groups []*group
+	for _, ptype := range ptypes {
+		adapter := a.adapters[ptype]
+		var g *group
+		for _, other := range groups {
+			if other.adapter == adapter {
+				g = other
+				break
+			}
+		}
+		if g == nil {
+			g = &group{adapter: adapter, ptypes: map[string]bool{}}
+			groups = append(groups, g)
+		}
+		g.ptypes[ptype] = true
+	}
+	return groups
+}
+
+func (a *Adapter) adapter(ptype string) (persist.Adapter, error) {
+	adapter, ok := a.adapters[ptype]
+	if !ok {
+		return nil, fmt.Errorf("no adapter for policy type %s", ptype)
+	}
+	return adapter, nil
+}
+
+// LoadPolicy loads the rules of each policy type from its adapter.
+func (a *Adapter) LoadPolicy(m model.Model) error {
+	for _, g := range a.groups() {
+		loaded := m.Copy()
+		loaded.ClearPolicy()
+		if err := g.adapter.LoadPolicy(loaded); err != nil {
+			return err
+		}
+
+		for _, sec := range []string{"p", "g"} {
+			for ptype, ast := range loaded[sec] {
+				if !g.ptypes[ptype] {
+					continue
+				}
+				for _, rule := range ast.Policy {
+					if err := persist.LoadPolicyArray(append([]string{ptype}, rule...), m); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// SavePolicy saves the rules of each policy type to its adapter. The rules an adapter holds of the other policy
+// types of the model are loaded from it first and saved back unchanged, so a store shared with another
+// application keeps them. Rules of policy types the model does not define cannot be loaded and are not kept.
+func (a *Adapter) SavePolicy(m model.Model) error {
+	for _, g := range a.groups() {
+		saved := m.Copy()
+		var stored model.Model
+		for _, sec := range []string{"p", "g"} {
+			for ptype, ast := range saved[sec] {
+				if g.ptypes[ptype] {
+					continue
+				}
+				if stored == nil {
+					stored = m.Copy()
+					stored.ClearPolicy()
+					if err := g.adapter.LoadPolicy(stored); err != nil {
+						return err
+					}
+				}
+				ast.Policy = stored[sec][ptype].Policy
+				ast.PolicyMap = stored[sec][ptype].PolicyMap
+			}
+		}
+		if err := g.adapter.SavePolicy(saved); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddPolicy adds a policy rule to the adapter of its policy type.
+func (a *Adapter) AddPolicy(sec string, ptype string, rule []string) error {
+	adapter, err := a.adapter(ptype)
+	if err != nil {
+		return err
+	}
+	return adapter.AddPolicy(sec, ptype, rule)
+}
+
+// AddPolicies adds policy rules to the adapter of their policy type, one by one if it is not a batch adapter.
+func (a *Adapter) AddPolicies(sec string, ptype string, rules [][]string) error {
+	adapter, err := a.adapter(ptype)
+	if err != nil {
+		return err
+	}
+	if batch, ok := adapter.(persist.BatchAdapter); ok {
+		return batch.AddPolicies(sec, ptype, rules)
+	}
+	for _, rule := range rules {
+		if err = adapter.AddPolicy(sec, ptype, rule); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemovePolicy removes a policy rule from the adapter of its policy type.
+func (a *Adapter) RemovePolicy(sec string, ptype string, rule []string) error {
+	adapter, err := a.adapter(ptype)
+	if err != nil {
+		return err
+	}
+	return adapter.RemovePolicy(sec, ptype, rule)
+}
+
+// RemovePolicies removes policy rules from the adapter of their policy type, one by one if it is not a batch adapter.
+func (a *Adapter) RemovePolicies(sec string, ptype string, rules [][]string) error {
+	adapter, err := a.adapter(ptype)
+	if err != nil {
+		return err
+	}
+	if batch, ok := adapter.(persist.BatchAdapter); ok {
+		return batch.RemovePolicies(sec, ptype, rules)
+	}
+	for _, rule := range rules {
+		if err = adapter.RemovePolicy(sec, ptype, rule); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemoveFilteredPolicy removes policy rules that match the filter from the adapter of their policy type.
+func (a *Adapter) RemoveFilteredPolicy(sec string, ptype string, fieldIndex int, fieldValues ...string) error {
+	adapter, err := a.adapter(ptype)
+	if err != nil {
+		return err
+	}
+	return adapter.RemoveFilteredPolicy(sec, ptype, fieldIndex, fieldValues...)
+}
+
+// UpdatePolicy updates a policy rule in the adapter of its policy type.
+func (a *Adapter) UpdatePolicy(sec string, ptype string, oldRule, newRule []string) error {
+	adapter, err := a.updatableAdapter(ptype)
+	if err != nil {
+		return err
+	}
+	return adapter.UpdatePolicy(sec, ptype, oldRule, newRule)
+}
+
+// UpdatePolicies updates policy rules in the adapter of their policy type.
+func (a *Adapter) UpdatePolicies(sec string, ptype string, oldRules, newRules [][]string) error {
+	adapter, err := a.updatableAdapter(ptype)
+	if err != nil {
+		return err
+	}
+	return adapter.UpdatePolicies(sec, ptype, oldRules, newRules)
+}
+
+// UpdateFilteredPolicies deletes the policy rules that match the filter and adds newRules in the adapter of their
+// policy type.
+func (a *Adapter) UpdateFilteredPolicies(sec string, ptype string, newRules [][]string, fieldIndex int, fieldValues ...string) ([][]string, error) {
+	adapter, err := a.updatableAdapter(ptype)
+	if err != nil {
+		return nil, err
+	}
+	return adapter.UpdateFilteredPolicies(sec, ptype, newRules, fieldIndex, fieldValues...)
+}
+
+func (a *Adapter) updatableAdapter(ptype string) (persist.UpdatableAdapter, error) {
+	adapter, err := a.adapter(ptype)
+	if err != nil {
+		return nil, err
+	}
+	updatable, ok := adapter.(persist.UpdatableAdapter)
+	if !ok {
+		return nil, errors.New("not implemented")
+	}
+	return updatable, nil
+}
@@ -0,0 +1,118 @@
+// Copyright 2023 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compositeadapter
+
+import (
+	"testing"
+
+	"github.com/ApicaSystem/casbin/v2"
+	"github.com/ApicaSystem/casbin/v2/model"
+	"github.com/ApicaSystem/casbin/v2/persist"
+	stringadapter "github.com/ApicaSystem/casbin/v2/persist/string-adapter"
+	"github.com/ApicaSystem/casbin/v2/util"
+)
+
+// mockAdapter loads its policy from a string and records the auto-save calls.
+type mockAdapter struct {
+	*stringadapter.Adapter
+	added   [][]string
+	removed [][]string
+}
+
+func (a *mockAdapter) AddPolicy(sec string, ptype string, rule []string) error {
+	a.added = append(a.added, append([]string{ptype}, rule...))
+	return nil
+}
+
+func (a *mockAdapter) RemovePolicy(sec string, ptype string, rule []string) error {
+	a.removed = append(a.removed, append([]string{ptype}, rule...))
+	return nil
+}
+
+func testEnforce(t *testing.T, e *casbin.Enforcer, sub string, obj string, act string, res bool) {
+	t.Helper()
+	if myRes, err := e.Enforce(sub, obj, act); err != nil {
+		t.Errorf("Enforce Error: %s", err)
+	} else if myRes != res {
+		t.Errorf("%s, %s, %s: %t, supposed to be %t", sub, obj, act, myRes, res)
+	}
+}
+
+func TestCompositeAdapter(t *testing.T) {
+	// each store may hold rules of other policy types, only the mapped ones are loaded.
+	p := &mockAdapter{Adapter: stringadapter.NewAdapter(`
+p, alice, data1, read
+p, data2_admin, data2, read
+p, data2_admin, data2, write
+g, mallory, data2_admin
+`)}
+	g := &mockAdapter{Adapter: stringadapter.NewAdapter(`
+p, mallory, data1, read
+g, alice, data2_admin
+`)}
+
+	e, err := casbin.NewEnforcer("../../examples/rbac_model.conf", NewAdapter(map[string]persist.Adapter{"p": p, "g": g}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testEnforce(t, e, "alice", "data1", "read", true)
+	testEnforce(t, e, "alice", "data2", "write", true)
+	testEnforce(t, e, "mallory", "data1", "read", false)
+	testEnforce(t, e, "mallory", "data2", "read", false)
+
+	// the auto-save calls are dispatched by policy type.
+	_, _ = e.AddPolicy("bob", "data1", "read")
+	_, _ = e.AddGroupingPolicy("bob", "data2_admin")
+	_, _ = e.RemovePolicies([][]string{{"alice", "data1", "read"}})
+	if !util.Array2DEquals([][]string{{"p", "bob", "data1", "read"}}, p.added) ||
+		!util.Array2DEquals([][]string{{"p", "alice", "data1", "read"}}, p.removed) {
+		t.Errorf("p adapter: added %v, removed %v", p.added, p.removed)
+	}
+	if !util.Array2DEquals([][]string{{"g", "bob", "data2_admin"}}, g.added) || len(g.removed) != 0 {
+		t.Errorf("g adapter: added %v, removed %v", g.added, g.removed)
+	}
+
+	// every adapter only saves the rules of its policy types, and keeps the rules it holds of the others.
+	if err = e.SavePolicy(); err != nil {
+		t.Fatal(err)
+	}
+	if p.Line != "p, data2_admin, data2, read\np, data2_admin, data2, write\np, bob, data1, read\ng, mallory, data2_admin" {
+		t.Errorf("p adapter saved %q", p.Line)
+	}
+	if g.Line != "p, mallory, data1, read\ng, alice, data2_admin\ng, bob, data2_admin" {
+		t.Errorf("g adapter saved %q", g.Line)
+	}
+}
+
+func TestCompositeAdapterUnmappedType(t *testing.T) {
+	p := &mockAdapter{Adapter: stringadapter.NewAdapter("p, alice, data1, read\ng, bob, admin")}
+	a := NewAdapter(map[string]persist.Adapter{"p": p})
+
+	m, _ := model.NewModelFromFile("../../examples/rbac_model.conf")
+	if err := a.LoadPolicy(m); err != nil {
+		t.Fatal(err)
+	}
+	if policy, _ := m.GetPolicy("g", "g"); len(policy) != 0 {
+		t.Errorf("rules of an unmapped policy type should not be loaded, got %v", policy)
+	}
+
+	if err := a.AddPolicy("g", "g", []string{"bob", "admin"}); err == nil {
+		t.Error("adding a rule of an unmapped policy type should return an error")
+	}
+	if err := a.UpdatePolicy("p", "p", []string{"alice", "data1", "read"}, []string{"alice", "data1", "write"}); err == nil || err.Error() != "not implemented" {
+		t.Errorf("updating with a non updatable adapter should not be implemented, got %v", err)
+	}
+}
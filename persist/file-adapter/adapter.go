@@ -17,8 +17,14 @@ package fileadapter
 import (
 	"bufio"
 	"bytes"
+	"compress/gzip"
+	"encoding/csv"
 	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/ApicaSystem/casbin/v2/model"
@@ -30,18 +36,110 @@ import (
 // It can load policy from file or save policy to file.
 type Adapter struct {
 	filePath string
+	// reader is the policy source of an adapter created by NewAdapterFromReader,
+	// its content is kept in data after the first read so the policy can be reloaded.
+	reader     io.Reader
+	data       []byte
+	fromReader bool
+	// filtered is set once a filtered policy was loaded, the policy must not be saved then.
+	filtered bool
+	// sep is the field separator of the policy lines, a comma if unset.
+	sep rune
+	// compress makes the policy file be saved gzip-compressed, see NewAdapterGzip.
+	compress bool
+	// rename replaces the policy file with the written temporary file, os.Rename if unset.
+	rename func(oldPath, newPath string) error
 }
 
+// Option configures an Adapter created by NewAdapterWithOptions.
+type Option func(*Adapter)
+
+// WithSeparator sets the field separator of the policy lines, e.g. ';' for legacy exports. It is used both to
+// load and to save the policy. The default is a comma.
+func WithSeparator(sep rune) Option {
+	return func(a *Adapter) {
+		a.sep = sep
+	}
+}
+
+var errReaderNotSupported = errors.New("not supported: the adapter was created from a reader")
+
+// UpdatePolicy updates a policy rule in the storage.
 func (a *Adapter) UpdatePolicy(sec string, ptype string, oldRule, newRule []string) error {
-	return errors.New("not implemented")
+	return a.UpdatePolicies(sec, ptype, [][]string{oldRule}, [][]string{newRule})
 }
 
+// UpdatePolicies updates policy rules in the storage, each old rule is replaced in place by its new rule.
 func (a *Adapter) UpdatePolicies(sec string, ptype string, oldRules, newRules [][]string) error {
-	return errors.New("not implemented")
+	if a.fromReader {
+		return errors.New("not implemented")
+	}
+	if len(oldRules) != len(newRules) {
+		return fmt.Errorf("the length of oldRules should be equal to the length of newRules, but got the length of oldRules is %d, the length of newRules is %d", len(oldRules), len(newRules))
+	}
+
+	file, err := a.readPolicyLines()
+	if err != nil {
+		return err
+	}
+
+	lines := file.lines
+	replaced := make([]bool, len(lines))
+	for i, oldRule := range oldRules {
+		found := false
+		for j, rule := range file.rules {
+			if replaced[j] || !isRuleOf(rule, sec, ptype) || !util.ArrayEquals(rule[1:], oldRule) {
+				continue
+			}
+			lines[j] = a.policyLine(ptype, newRules[i])
+			replaced[j] = true
+			found = true
+			break
+		}
+		if !found {
+			return fmt.Errorf("policy rule not found: %s, %s", ptype, util.ArrayToString(oldRule))
+		}
+	}
+
+	return a.savePolicyFile(file.text(lines))
 }
 
+// UpdateFilteredPolicies deletes the policy rules that match the filter and adds newRules in place of the first one.
+// It returns the deleted rules.
 func (a *Adapter) UpdateFilteredPolicies(sec string, ptype string, newRules [][]string, fieldIndex int, fieldValues ...string) ([][]string, error) {
-	return nil, errors.New("not implemented")
+	if a.fromReader {
+		return nil, errors.New("not implemented")
+	}
+	file, err := a.readPolicyLines()
+	if err != nil {
+		return nil, err
+	}
+
+	var oldRules [][]string
+	res := make([]string, 0, len(file.lines)+len(newRules))
+	for i, rule := range file.rules {
+		if !isRuleOf(rule, sec, ptype) || !matchFilter(rule[1:], fieldIndex, fieldValues) {
+			res = append(res, file.lines[i])
+			continue
+		}
+		if oldRules == nil {
+			for _, newRule := range newRules {
+				res = append(res, a.policyLine(ptype, newRule))
+			}
+		}
+		oldRules = append(oldRules, rule[1:])
+	}
+
+	if len(oldRules) == 0 {
+		return oldRules, nil
+	}
+	return oldRules, a.savePolicyFile(file.text(res))
+}
+
+// isRuleOf tells whether the tokens of a policy line are a rule of ptype in the section sec. The section of a line
+// is the first letter of its policy type, like when the policy is loaded.
+func isRuleOf(rule []string, sec string, ptype string) bool {
+	return len(rule) != 0 && rule[0] == ptype && ptype != "" && ptype[:1] == sec
 }
 
 // NewAdapter is the constructor for Adapter.
@@ -49,17 +147,62 @@ func NewAdapter(filePath string) *Adapter {
 	return &Adapter{filePath: filePath}
 }
 
+// NewAdapterGzip creates an Adapter whose policy file is gzip-compressed, whatever its extension.
+// The policy is decompressed when it is loaded and compressed when it is saved or updated.
+//
+// Adapters created with NewAdapter handle compressed files as well: they are detected by their first bytes when
+// loaded, and a policy file with the ".gz" extension or already compressed stays compressed when it is saved.
+func NewAdapterGzip(filePath string) *Adapter {
+	return &Adapter{filePath: filePath, compress: true}
+}
+
+// NewAdapterWithOptions is the constructor for Adapter taking options, see WithSeparator.
+func NewAdapterWithOptions(filePath string, opts ...Option) *Adapter {
+	a := NewAdapter(filePath)
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// NewAdapterFromReader creates an Adapter that loads policy from r, e.g. an embedded file or an HTTP response body.
+// The adapter is read-only, SavePolicy returns an error.
+func NewAdapterFromReader(r io.Reader) *Adapter {
+	return &Adapter{reader: r, fromReader: true}
+}
+
 // LoadPolicy loads all policy rules from the storage.
 func (a *Adapter) LoadPolicy(model model.Model) error {
+	a.filtered = false
+	if a.fromReader {
+		return a.loadPolicyReader(model, a.loadPolicyLine)
+	}
 	if a.filePath == "" {
 		return errors.New("invalid file path, file path cannot be empty")
 	}
 
-	return a.loadPolicyFile(model, persist.LoadPolicyLine)
+	return a.loadPolicyFile(model, a.loadPolicyLine)
+}
+
+func (a *Adapter) separator() rune {
+	if a.sep == 0 {
+		return ','
+	}
+	return a.sep
+}
+
+func (a *Adapter) loadPolicyLine(line string, m model.Model) error {
+	return persist.LoadPolicyLineWithSep(line, m, a.separator())
 }
 
 // SavePolicy saves all policy rules to the storage.
 func (a *Adapter) SavePolicy(model model.Model) error {
+	if a.fromReader {
+		return errReaderNotSupported
+	}
+	if a.filtered {
+		return errors.New("cannot save a filtered policy")
+	}
 	if a.filePath == "" {
 		return errors.New("invalid file path, file path cannot be empty")
 	}
@@ -68,16 +211,14 @@ func (a *Adapter) SavePolicy(model model.Model) error {
 
 	for ptype, ast := range model["p"] {
 		for _, rule := range ast.Policy {
-			tmp.WriteString(ptype + ", ")
-			tmp.WriteString(util.ArrayToString(rule))
+			tmp.WriteString(a.policyLine(ptype, rule))
 			tmp.WriteString("\n")
 		}
 	}
 
 	for ptype, ast := range model["g"] {
 		for _, rule := range ast.Policy {
-			tmp.WriteString(ptype + ", ")
-			tmp.WriteString(util.ArrayToString(rule))
+			tmp.WriteString(a.policyLine(ptype, rule))
 			tmp.WriteString("\n")
 		}
 	}
@@ -92,10 +233,61 @@ func (a *Adapter) loadPolicyFile(model model.Model, handler func(string, model.M
 	}
 	defer f.Close()
 
-	scanner := bufio.NewScanner(f)
+	r, err := decompress(f)
+	if err != nil {
+		return err
+	}
+	return loadPolicyData(r, model, handler)
+}
+
+func (a *Adapter) loadPolicyReader(model model.Model, handler func(string, model.Model) error) error {
+	if a.reader != nil {
+		data, err := ioutil.ReadAll(a.reader)
+		if err != nil {
+			return err
+		}
+		a.data, a.reader = data, nil
+	}
+
+	r, err := decompress(bytes.NewReader(a.data))
+	if err != nil {
+		return err
+	}
+	return loadPolicyData(r, model, handler)
+}
+
+// gzipMagic are the first bytes of gzip-compressed data.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// decompress returns a reader of the decompressed data of r if it is gzip-compressed, or of r otherwise.
+func decompress(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(len(gzipMagic)); err != nil || !bytes.Equal(magic, gzipMagic) {
+		return br, nil
+	}
+	return gzip.NewReader(br)
+}
+
+// isGzipFile tells whether the file at path exists and is gzip-compressed.
+func isGzipFile(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	magic := make([]byte, len(gzipMagic))
+	if _, err = io.ReadFull(f, magic); err != nil {
+		return false
+	}
+	return bytes.Equal(magic, gzipMagic)
+}
+
+func loadPolicyData(r io.Reader, model model.Model, handler func(string, model.Model) error) error {
+	scanner := bufio.NewScanner(r)
 	for scanner.Scan() {
 		line := strings.TrimSpace(scanner.Text())
-		err = handler(line, model)
+		err := handler(line, model)
 		if err != nil {
 			return err
 		}
@@ -103,24 +295,155 @@ func (a *Adapter) loadPolicyFile(model model.Model, handler func(string, model.M
 	return scanner.Err()
 }
 
+// savePolicyFile writes text to a temporary file in the directory of the policy file and renames it over
+// the policy file, so that a crash while writing leaves the previous policy intact.
+// The text is gzip-compressed for NewAdapterGzip, a ".gz" file or a file already compressed.
 func (a *Adapter) savePolicyFile(text string) error {
-	f, err := os.Create(a.filePath)
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(a.filePath); err == nil {
+		mode = info.Mode().Perm()
+	}
+	compress := a.compress || strings.HasSuffix(a.filePath, ".gz") || isGzipFile(a.filePath)
+
+	dir, name := filepath.Split(a.filePath)
+	if dir == "" {
+		dir = "."
+	}
+	f, err := ioutil.TempFile(dir, "."+name+".tmp*")
 	if err != nil {
 		return err
 	}
-	w := bufio.NewWriter(f)
+	tmpPath := f.Name()
+	defer os.Remove(tmpPath)
 
-	_, err = w.WriteString(text)
+	if compress {
+		zw := gzip.NewWriter(f)
+		if _, err = zw.Write([]byte(text)); err == nil {
+			err = zw.Close()
+		}
+	} else {
+		_, err = f.WriteString(text)
+	}
 	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err = f.Chmod(mode); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
 		return err
 	}
 
-	err = w.Flush()
+	rename := a.rename
+	if rename == nil {
+		rename = os.Rename
+	}
+	return rename(tmpPath, a.filePath)
+}
+
+// policyFile is the content of the policy file read line by line, so that it can be rewritten as it was except
+// for the changed lines.
+type policyFile struct {
+	lines []string
+	// rules are the parsed tokens of the lines, blank lines and comments have no tokens.
+	rules [][]string
+	// newline is the line ending of the file, and final tells whether its last line ends with it.
+	newline string
+	final   bool
+}
+
+// text joins lines with the line ending of the file.
+func (p *policyFile) text(lines []string) string {
+	text := strings.Join(lines, p.newline)
+	if p.final && len(lines) != 0 {
+		text += p.newline
+	}
+	return text
+}
+
+// readPolicyLines reads the raw lines of the policy file along with their parsed tokens.
+func (a *Adapter) readPolicyLines() (*policyFile, error) {
+	if a.filePath == "" {
+		return nil, errors.New("invalid file path, file path cannot be empty")
+	}
+
+	f, err := os.Open(a.filePath)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer f.Close()
 
-	return f.Close()
+	r, err := decompress(f)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	file := &policyFile{newline: "\n", final: bytes.HasSuffix(data, []byte("\n"))}
+	if bytes.Contains(data, []byte("\r\n")) {
+		file.newline = "\r\n"
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		rule, err := a.parsePolicyLine(strings.TrimSpace(line))
+		if err != nil {
+			return nil, err
+		}
+		file.lines = append(file.lines, line)
+		file.rules = append(file.rules, rule)
+	}
+	return file, scanner.Err()
+}
+
+func (a *Adapter) parsePolicyLine(line string) ([]string, error) {
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil, nil
+	}
+
+	r := csv.NewReader(strings.NewReader(line))
+	r.Comma = a.separator()
+	r.Comment = '#'
+	r.TrimLeadingSpace = true
+	return r.Read()
+}
+
+// policyLine formats a rule as a line of the policy file, quoting the fields like a CSV writer, e.g. a field
+// containing the separator.
+func (a *Adapter) policyLine(ptype string, rule []string) string {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Comma = a.separator()
+	fields := make([]string, 0, len(rule)+1)
+	fields = append(fields, ptype)
+	for _, field := range rule {
+		buf.Reset()
+		_ = w.Write([]string{field})
+		w.Flush()
+		fields = append(fields, strings.TrimSuffix(buf.String(), "\n"))
+	}
+	return strings.Join(fields, string(a.separator())+" ")
+}
+
+func matchFilter(rule []string, fieldIndex int, fieldValues []string) bool {
+	for i, fieldValue := range fieldValues {
+		if fieldIndex+i >= len(rule) {
+			return false
+		}
+		if fieldValue != "" && rule[fieldIndex+i] != fieldValue {
+			return false
+		}
+	}
+	return true
 }
 
 // AddPolicy adds a policy rule to the storage.
@@ -15,20 +15,19 @@
 package fileadapter
 
 import (
-	"bufio"
 	"errors"
-	"os"
+	"regexp"
 	"strings"
 
 	"github.com/ApicaSystem/casbin/v2/model"
-	"github.com/ApicaSystem/casbin/v2/persist"
 )
 
 // FilteredAdapter is the filtered file adapter for Casbin. It can load policy
 // from file or save policy to file and supports loading of filtered policies.
+// The Adapter supports filtered policies as well, a FilteredAdapter only differs
+// in that the enforcer does not load the whole policy when it is created.
 type FilteredAdapter struct {
 	*Adapter
-	filtered bool
 }
 
 // Filter defines the filtering rules for a FilteredAdapter's policy. Empty values
@@ -41,88 +40,119 @@ type Filter struct {
 	G3 []string
 	G4 []string
 	G5 []string
+	// Patterns are matched against the fields of the "p" rules, e.g. ^user_\d+ at index 0 loads
+	// the "p" rules whose first field is a numbered user. A pattern is only applied when the value
+	// of P at the same index is empty, and nil patterns are ignored.
+	//
+	// Deprecated: use Matchers with MatchRegexp, Patterns are applied as "p" matchers.
+	Patterns []*regexp.Regexp
+	// Matchers are matched against the fields of the policy type they are keyed by, e.g. {"p": {nil,
+	// MatchPrefix("/api/")}} loads the "p" rules whose second field starts with "/api/". They apply
+	// in addition to the values and the patterns, and nil matchers are ignored.
+	Matchers map[string][]FieldMatcher
+}
+
+// FieldMatcher tells whether a field of a policy rule matches a filter. The field is read like the policy
+// file, unquoted and trimmed of spaces.
+type FieldMatcher func(value string) bool
+
+// MatchPrefix returns a FieldMatcher matching the fields starting with prefix.
+func MatchPrefix(prefix string) FieldMatcher {
+	return func(value string) bool {
+		return strings.HasPrefix(value, prefix)
+	}
+}
+
+// MatchRegexp returns a FieldMatcher matching the fields matched by re.
+func MatchRegexp(re *regexp.Regexp) FieldMatcher {
+	return re.MatchString
 }
 
 // NewFilteredAdapter is the constructor for FilteredAdapter.
 func NewFilteredAdapter(filePath string) *FilteredAdapter {
 	a := FilteredAdapter{}
-	a.filtered = true
 	a.Adapter = NewAdapter(filePath)
+	a.filtered = true
 	return &a
 }
 
-// LoadPolicy loads all policy rules from the storage.
-func (a *FilteredAdapter) LoadPolicy(model model.Model) error {
-	a.filtered = false
-	return a.Adapter.LoadPolicy(model)
-}
-
 // LoadFilteredPolicy loads only policy rules that match the filter.
-func (a *FilteredAdapter) LoadFilteredPolicy(model model.Model, filter interface{}) error {
+func (a *Adapter) LoadFilteredPolicy(model model.Model, filter interface{}) error {
 	if filter == nil {
 		return a.LoadPolicy(model)
 	}
-	if a.filePath == "" {
-		return errors.New("invalid file path, file path cannot be empty")
-	}
-
 	filterValue, ok := filter.(*Filter)
 	if !ok {
 		return errors.New("invalid filter type")
 	}
-	err := a.loadFilteredPolicyFile(model, filterValue, persist.LoadPolicyLine)
-	if err == nil {
-		a.filtered = true
-	}
-	return err
+	return a.loadFilteredPolicy(model, []*Filter{filterValue})
 }
 
-func (a *FilteredAdapter) loadFilteredPolicyFile(model model.Model, filter *Filter, handler func(string, model.Model) error) error {
-	f, err := os.Open(a.filePath)
-	if err != nil {
-		return err
+// LoadFilteredPolicies loads the policy rules matching any of the filters, reading the file only once.
+func (a *Adapter) LoadFilteredPolicies(model model.Model, filters []interface{}) error {
+	filterValues := make([]*Filter, 0, len(filters))
+	for _, filter := range filters {
+		if filter == nil {
+			return a.LoadPolicy(model)
+		}
+		filterValue, ok := filter.(*Filter)
+		if !ok {
+			return errors.New("invalid filter type")
+		}
+		filterValues = append(filterValues, filterValue)
 	}
-	defer f.Close()
-
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
+	return a.loadFilteredPolicy(model, filterValues)
+}
 
-		if filterLine(line, filter) {
-			continue
+func (a *Adapter) loadFilteredPolicy(m model.Model, filters []*Filter) error {
+	handler := func(line string, m model.Model) error {
+		if !a.matchAnyFilter(line, filters) {
+			return nil
 		}
+		return a.loadPolicyLine(line, m)
+	}
 
-		err = handler(line, model)
-		if err != nil {
-			return err
-		}
+	var err error
+	if a.fromReader {
+		err = a.loadPolicyReader(m, handler)
+	} else if a.filePath == "" {
+		err = errors.New("invalid file path, file path cannot be empty")
+	} else {
+		err = a.loadPolicyFile(m, handler)
+	}
+	if err == nil {
+		a.filtered = true
 	}
-	return scanner.Err()
+	return err
 }
 
 // IsFiltered returns true if the loaded policy has been filtered.
-func (a *FilteredAdapter) IsFiltered() bool {
+func (a *Adapter) IsFiltered() bool {
 	return a.filtered
 }
 
-// SavePolicy saves all policy rules to the storage.
-func (a *FilteredAdapter) SavePolicy(model model.Model) error {
-	if a.filtered {
-		return errors.New("cannot save a filtered policy")
+// matchAnyFilter tells whether the line matches any of the filters. A line which cannot be read is matched,
+// so that loading it reports the error.
+func (a *Adapter) matchAnyFilter(line string, filters []*Filter) bool {
+	rule, err := a.parsePolicyLine(line)
+	if err != nil || len(rule) == 0 {
+		return true
 	}
-	return a.Adapter.SavePolicy(model)
+	for _, filter := range filters {
+		if !filterRule(rule, filter) {
+			return true
+		}
+	}
+	return false
 }
 
-func filterLine(line string, filter *Filter) bool {
+func filterRule(rule []string, filter *Filter) bool {
 	if filter == nil {
 		return false
 	}
-	p := strings.Split(line, ",")
-	if len(p) == 0 {
-		return true
-	}
 	var filterSlice []string
-	switch strings.TrimSpace(p[0]) {
+	ptype := strings.TrimSpace(rule[0])
+	switch ptype {
 	case "p":
 		filterSlice = filter.P
 	case "g":
@@ -138,19 +168,52 @@ func filterLine(line string, filter *Filter) bool {
 	case "g5":
 		filterSlice = filter.G5
 	}
-	return filterWords(p, filterSlice)
+	return filterWords(rule, filterSlice, filter.fieldMatchers(ptype))
+}
+
+// fieldMatchers returns the matchers of the policy type, with the patterns added to the "p" matchers at the
+// indexes where P has no value.
+func (filter *Filter) fieldMatchers(ptype string) []FieldMatcher {
+	matchers := filter.Matchers[ptype]
+	if ptype != "p" || len(filter.Patterns) == 0 {
+		return matchers
+	}
+	matchers = append([]FieldMatcher(nil), matchers...)
+	for i, pattern := range filter.Patterns {
+		if pattern == nil || i < len(filter.P) && len(filter.P[i]) > 0 {
+			continue
+		}
+		for len(matchers) <= i {
+			matchers = append(matchers, nil)
+		}
+		if matcher := matchers[i]; matcher != nil {
+			pattern := pattern
+			matchers[i] = func(value string) bool {
+				return matcher(value) && pattern.MatchString(value)
+			}
+		} else {
+			matchers[i] = MatchRegexp(pattern)
+		}
+	}
+	return matchers
 }
 
-func filterWords(line []string, filter []string) bool {
+func filterWords(line []string, filter []string, matchers []FieldMatcher) bool {
 	if len(line) < len(filter)+1 {
 		return true
 	}
-	var skipLine bool
 	for i, v := range filter {
 		if len(v) > 0 && strings.TrimSpace(v) != strings.TrimSpace(line[i+1]) {
-			skipLine = true
-			break
+			return true
+		}
+	}
+	for i, matcher := range matchers {
+		if matcher == nil {
+			continue
+		}
+		if i+1 >= len(line) || !matcher(strings.TrimSpace(line[i+1])) {
+			return true
 		}
 	}
-	return skipLine
+	return false
 }
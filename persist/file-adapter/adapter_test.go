@@ -0,0 +1,548 @@
+// Copyright 2023 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fileadapter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/ApicaSystem/casbin/v2/model"
+	"github.com/ApicaSystem/casbin/v2/util"
+)
+
+const testModel = `
+[request_definition]
+r = sub, obj, act
+
+[policy_definition]
+p = sub, obj, act
+
+[role_definition]
+g = _, _
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = g(r.sub, p.sub) && r.obj == p.obj && r.act == p.act
+`
+
+const testPolicy = `p, alice, data1, read
+# bob's rules
+p, bob, data2, write
+p, data2_admin, data2, read
+p, data2_admin, data2, write
+g, alice, data2_admin`
+
+func newTestAdapter(t *testing.T) *Adapter {
+	t.Helper()
+	f, err := ioutil.TempFile("", "policy*.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err = f.WriteString(testPolicy); err != nil {
+		t.Fatal(err)
+	}
+	return NewAdapter(f.Name())
+}
+
+func testLoadedPolicy(t *testing.T, a *Adapter, sec string, ptype string, res [][]string) {
+	t.Helper()
+	m, err := model.NewModelFromString(testModel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = a.LoadPolicy(m); err != nil {
+		t.Fatal(err)
+	}
+
+	myRes, _ := m.GetPolicy(sec, ptype)
+	if !util.Array2DEquals(res, myRes) {
+		t.Errorf("%s policy: %v, supposed to be %v", ptype, myRes, res)
+	}
+}
+
+func TestUpdatePolicy(t *testing.T) {
+	a := newTestAdapter(t)
+	defer os.Remove(a.filePath)
+
+	if err := a.UpdatePolicy("p", "p", []string{"bob", "data2", "write"}, []string{"bob", "data3", "write"}); err != nil {
+		t.Fatal(err)
+	}
+	testLoadedPolicy(t, a, "p", "p", [][]string{
+		{"alice", "data1", "read"},
+		{"bob", "data3", "write"},
+		{"data2_admin", "data2", "read"},
+		{"data2_admin", "data2", "write"}})
+
+	if err := a.UpdatePolicy("g", "g", []string{"alice", "data2_admin"}, []string{"bob", "data2_admin"}); err != nil {
+		t.Fatal(err)
+	}
+	testLoadedPolicy(t, a, "g", "g", [][]string{{"bob", "data2_admin"}})
+
+	// Untouched lines, including comments, keep their position.
+	text, _ := ioutil.ReadFile(a.filePath)
+	expected := `p, alice, data1, read
+# bob's rules
+p, bob, data3, write
+p, data2_admin, data2, read
+p, data2_admin, data2, write
+g, bob, data2_admin`
+	if string(text) != expected {
+		t.Errorf("policy file:\n%s\nsupposed to be:\n%s", text, expected)
+	}
+
+	if err := a.UpdatePolicy("p", "p", []string{"eve", "data1", "read"}, []string{"eve", "data1", "write"}); err == nil {
+		t.Error("updating a non-existent rule should fail")
+	}
+}
+
+func TestUpdatePolicies(t *testing.T) {
+	a := newTestAdapter(t)
+	defer os.Remove(a.filePath)
+
+	err := a.UpdatePolicies("p", "p",
+		[][]string{{"alice", "data1", "read"}, {"data2_admin", "data2", "write"}},
+		[][]string{{"alice", "data1", "write"}, {"data2_admin", "data3", "write"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testLoadedPolicy(t, a, "p", "p", [][]string{
+		{"alice", "data1", "write"},
+		{"bob", "data2", "write"},
+		{"data2_admin", "data2", "read"},
+		{"data2_admin", "data3", "write"}})
+
+	// Nothing is written if one of the old rules is missing.
+	err = a.UpdatePolicies("p", "p",
+		[][]string{{"bob", "data2", "write"}, {"eve", "data1", "read"}},
+		[][]string{{"bob", "data2", "read"}, {"eve", "data1", "write"}})
+	if err == nil {
+		t.Error("updating a non-existent rule should fail")
+	}
+	testLoadedPolicy(t, a, "p", "p", [][]string{
+		{"alice", "data1", "write"},
+		{"bob", "data2", "write"},
+		{"data2_admin", "data2", "read"},
+		{"data2_admin", "data3", "write"}})
+
+	if err = a.UpdatePolicies("p", "p", [][]string{{"bob", "data2", "write"}}, nil); err == nil {
+		t.Error("rules of different length should fail")
+	}
+
+	// The rules of a policy type are only found in its section.
+	if err = a.UpdatePolicies("g", "p", [][]string{{"bob", "data2", "write"}}, [][]string{{"bob", "data2", "read"}}); err == nil {
+		t.Error("updating a rule of another section should fail")
+	}
+}
+
+func TestUpdatePoliciesLineEnding(t *testing.T) {
+	a := newTestAdapter(t)
+	defer os.Remove(a.filePath)
+	policy := strings.Replace(testPolicy, "\n", "\r\n", -1) + "\r\n"
+	if err := ioutil.WriteFile(a.filePath, []byte(policy), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a.UpdatePolicy("p", "p", []string{"bob", "data2", "write"}, []string{"bob", "data3", "write"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.UpdateFilteredPolicies("g", "g", [][]string{{"bob", "data2_admin"}}, 0, "alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The lines keep their ending and the file its final line break.
+	text, _ := ioutil.ReadFile(a.filePath)
+	expected := strings.Replace(`p, alice, data1, read
+# bob's rules
+p, bob, data3, write
+p, data2_admin, data2, read
+p, data2_admin, data2, write
+g, bob, data2_admin
+`, "\n", "\r\n", -1)
+	if string(text) != expected {
+		t.Errorf("policy file:\n%q\nsupposed to be:\n%q", text, expected)
+	}
+}
+
+func TestUpdateFilteredPolicies(t *testing.T) {
+	a := newTestAdapter(t)
+	defer os.Remove(a.filePath)
+
+	oldRules, err := a.UpdateFilteredPolicies("p", "p", [][]string{{"data2_admin", "data3", "read"}}, 0, "data2_admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !util.Array2DEquals([][]string{{"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}}, oldRules) {
+		t.Errorf("old rules: %v", oldRules)
+	}
+	testLoadedPolicy(t, a, "p", "p", [][]string{
+		{"alice", "data1", "read"},
+		{"bob", "data2", "write"},
+		{"data2_admin", "data3", "read"}})
+
+	oldRules, err = a.UpdateFilteredPolicies("p", "p", [][]string{{"eve", "data1", "read"}}, 0, "eve")
+	if err != nil || len(oldRules) != 0 {
+		t.Errorf("no rule should match: %v, %v", oldRules, err)
+	}
+
+	// The rules of a policy type are only found in its section.
+	oldRules, err = a.UpdateFilteredPolicies("g", "p", [][]string{{"eve", "data1", "read"}}, 0, "alice")
+	if err != nil || len(oldRules) != 0 {
+		t.Errorf("no rule of another section should match: %v, %v", oldRules, err)
+	}
+}
+
+func TestUpdateFilteredPoliciesAtomic(t *testing.T) {
+	a := newTestAdapter(t)
+	defer os.Remove(a.filePath)
+	if err := os.Chmod(a.filePath, 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate a crash after the new policy is written but before it replaces the policy file.
+	crash := errors.New("crash")
+	a.rename = func(oldPath, newPath string) error { return crash }
+	_, err := a.UpdateFilteredPolicies("p", "p", [][]string{{"data2_admin", "data3", "read"}}, 0, "data2_admin")
+	if err != crash {
+		t.Fatalf("UpdateFilteredPolicies should fail with the rename error, got %v", err)
+	}
+
+	text, _ := ioutil.ReadFile(a.filePath)
+	if string(text) != testPolicy {
+		t.Errorf("policy file should be left intact, got:\n%s", text)
+	}
+	dir, name := filepath.Split(a.filePath)
+	tmpFiles, _ := filepath.Glob(filepath.Join(dir, "."+name+".tmp*"))
+	if len(tmpFiles) != 0 {
+		t.Errorf("temporary files should be removed, got %v", tmpFiles)
+	}
+
+	a.rename = nil
+	if _, err = a.UpdateFilteredPolicies("p", "p", [][]string{{"data2_admin", "data3", "read"}}, 0, "data2_admin"); err != nil {
+		t.Fatal(err)
+	}
+	testLoadedPolicy(t, a, "p", "p", [][]string{
+		{"alice", "data1", "read"},
+		{"bob", "data2", "write"},
+		{"data2_admin", "data3", "read"}})
+	info, err := os.Stat(a.filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Errorf("policy file mode should be kept, got %v", info.Mode())
+	}
+}
+
+func TestAdapterFromReader(t *testing.T) {
+	a := NewAdapterFromReader(strings.NewReader(testPolicy))
+
+	// The policy can be loaded more than once although the reader is consumed by the first load.
+	for i := 0; i < 2; i++ {
+		testLoadedPolicy(t, a, "p", "p", [][]string{
+			{"alice", "data1", "read"},
+			{"bob", "data2", "write"},
+			{"data2_admin", "data2", "read"},
+			{"data2_admin", "data2", "write"}})
+		testLoadedPolicy(t, a, "g", "g", [][]string{{"alice", "data2_admin"}})
+	}
+
+	m, _ := model.NewModelFromString(testModel)
+	if err := a.SavePolicy(m); err == nil || !strings.Contains(err.Error(), "not supported") {
+		t.Errorf("SavePolicy should not be supported, got %v", err)
+	}
+	if err := a.UpdatePolicy("p", "p", []string{"alice", "data1", "read"}, []string{"alice", "data1", "write"}); err == nil || err.Error() != "not implemented" {
+		t.Errorf("UpdatePolicy should not be implemented, got %v", err)
+	}
+}
+
+func TestAdapterLoadFilteredPolicy(t *testing.T) {
+	a := newTestAdapter(t)
+	defer os.Remove(a.filePath)
+
+	m, _ := model.NewModelFromString(testModel)
+	if err := a.LoadFilteredPolicy(m, &Filter{P: []string{"", "data2"}, G: []string{"alice"}}); err != nil {
+		t.Fatal(err)
+	}
+	if !a.IsFiltered() {
+		t.Error("the adapter should be filtered")
+	}
+	myRes, _ := m.GetPolicy("p", "p")
+	if res := [][]string{{"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}}; !util.Array2DEquals(res, myRes) {
+		t.Errorf("p policy: %v, supposed to be %v", myRes, res)
+	}
+	if err := a.SavePolicy(m); err == nil {
+		t.Error("a filtered policy should not be saved")
+	}
+
+	r := NewAdapterFromReader(strings.NewReader(testPolicy))
+	m, _ = model.NewModelFromString(testModel)
+	if err := r.LoadFilteredPolicy(m, &Filter{P: []string{"alice"}}); err != nil {
+		t.Fatal(err)
+	}
+	myRes, _ = m.GetPolicy("p", "p")
+	if res := [][]string{{"alice", "data1", "read"}}; !util.Array2DEquals(res, myRes) {
+		t.Errorf("p policy: %v, supposed to be %v", myRes, res)
+	}
+
+	testLoadedPolicy(t, a, "p", "p", [][]string{
+		{"alice", "data1", "read"},
+		{"bob", "data2", "write"},
+		{"data2_admin", "data2", "read"},
+		{"data2_admin", "data2", "write"}})
+	if a.IsFiltered() {
+		t.Error("the adapter should not be filtered after loading the whole policy")
+	}
+}
+
+func TestFilterPatterns(t *testing.T) {
+	a := newTestAdapter(t)
+	defer os.Remove(a.filePath)
+
+	testFilteredPolicy := func(filter *Filter, p [][]string, g [][]string) {
+		t.Helper()
+		m, _ := model.NewModelFromString(testModel)
+		if err := a.LoadFilteredPolicy(m, filter); err != nil {
+			t.Fatal(err)
+		}
+		myP, _ := m.GetPolicy("p", "p")
+		if !util.Array2DEquals(p, myP) {
+			t.Errorf("p policy: %v, supposed to be %v", myP, p)
+		}
+		myG, _ := m.GetPolicy("g", "g")
+		if !util.Array2DEquals(g, myG) {
+			t.Errorf("g policy: %v, supposed to be %v", myG, g)
+		}
+	}
+
+	// the pattern only applies to the "p" rules.
+	testFilteredPolicy(&Filter{Patterns: []*regexp.Regexp{regexp.MustCompile(`^data\d+_admin$`)}},
+		[][]string{{"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}},
+		[][]string{{"alice", "data2_admin"}})
+	testFilteredPolicy(&Filter{Patterns: []*regexp.Regexp{nil, regexp.MustCompile(`^data\d+`)}},
+		[][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}},
+		[][]string{{"alice", "data2_admin"}})
+	// a value takes precedence over the pattern at the same index.
+	testFilteredPolicy(&Filter{P: []string{"bob"}, Patterns: []*regexp.Regexp{regexp.MustCompile(`^alice$`)}},
+		[][]string{{"bob", "data2", "write"}},
+		[][]string{{"alice", "data2_admin"}})
+	// a pattern beyond the fields of a rule does not match.
+	testFilteredPolicy(&Filter{Patterns: []*regexp.Regexp{nil, nil, nil, regexp.MustCompile(`^read$`)}},
+		[][]string{},
+		[][]string{{"alice", "data2_admin"}})
+}
+
+func TestFilterMatchers(t *testing.T) {
+	a := newTestAdapter(t)
+	defer os.Remove(a.filePath)
+
+	testFilteredPolicy := func(filter *Filter, p [][]string, g [][]string) {
+		t.Helper()
+		m, _ := model.NewModelFromString(testModel)
+		if err := a.LoadFilteredPolicy(m, filter); err != nil {
+			t.Fatal(err)
+		}
+		myP, _ := m.GetPolicy("p", "p")
+		if !util.Array2DEquals(p, myP) {
+			t.Errorf("p policy: %v, supposed to be %v", myP, p)
+		}
+		myG, _ := m.GetPolicy("g", "g")
+		if !util.Array2DEquals(g, myG) {
+			t.Errorf("g policy: %v, supposed to be %v", myG, g)
+		}
+	}
+
+	// a matcher only applies to the rules of its policy type.
+	testFilteredPolicy(&Filter{Matchers: map[string][]FieldMatcher{"p": {MatchRegexp(regexp.MustCompile(`^data\d+_admin$`))}}},
+		[][]string{{"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}},
+		[][]string{{"alice", "data2_admin"}})
+	testFilteredPolicy(&Filter{Matchers: map[string][]FieldMatcher{"p": {nil, MatchPrefix("data2")}, "g": {MatchPrefix("bob")}}},
+		[][]string{{"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}},
+		[][]string{})
+	// matchers apply in addition to the values.
+	testFilteredPolicy(&Filter{P: []string{"", "", "write"}, Matchers: map[string][]FieldMatcher{"p": {MatchPrefix("data2")}}},
+		[][]string{{"data2_admin", "data2", "write"}},
+		[][]string{{"alice", "data2_admin"}})
+	// a matcher beyond the fields of a rule does not match.
+	testFilteredPolicy(&Filter{Matchers: map[string][]FieldMatcher{"g": {nil, nil, MatchPrefix("")}}},
+		[][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}},
+		[][]string{})
+	// the patterns apply with the "p" matchers at the same index.
+	testFilteredPolicy(&Filter{Patterns: []*regexp.Regexp{regexp.MustCompile(`admin$`)}, Matchers: map[string][]FieldMatcher{"p": {MatchPrefix("data")}}},
+		[][]string{{"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}},
+		[][]string{{"alice", "data2_admin"}})
+
+	// the matchers and values see the fields unquoted.
+	r := NewAdapterFromReader(strings.NewReader("p, alice, \"data1, data2\", read\np, bob, data2, write\n"))
+	m, _ := model.NewModelFromString(testModel)
+	if err := r.LoadFilteredPolicy(m, &Filter{P: []string{"alice"}, Matchers: map[string][]FieldMatcher{"p": {nil, MatchPrefix("data1, ")}}}); err != nil {
+		t.Fatal(err)
+	}
+	myP, _ := m.GetPolicy("p", "p")
+	if res := [][]string{{"alice", "data1, data2", "read"}}; !util.Array2DEquals(res, myP) {
+		t.Errorf("p policy: %v, supposed to be %v", myP, res)
+	}
+}
+
+func TestAdapterWithSeparator(t *testing.T) {
+	f, err := ioutil.TempFile("", "policy*.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(strings.Replace(testPolicy, ",", ";", -1) + "\np;carol;\"data;3\";read")
+	_ = f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := NewAdapterWithOptions(f.Name(), WithSeparator(';'))
+	p := [][]string{
+		{"alice", "data1", "read"},
+		{"bob", "data2", "write"},
+		{"data2_admin", "data2", "read"},
+		{"data2_admin", "data2", "write"},
+		{"carol", "data;3", "read"}}
+	testLoadedPolicy(t, a, "p", "p", p)
+	testLoadedPolicy(t, a, "g", "g", [][]string{{"alice", "data2_admin"}})
+
+	// the separator is kept when the policy is saved or updated.
+	m, _ := model.NewModelFromString(testModel)
+	_ = m.AddPolicy("p", "p", []string{"alice", "data1", "read"})
+	_ = m.AddPolicy("g", "g", []string{"alice", "data2_admin"})
+	if err = a.SavePolicy(m); err != nil {
+		t.Fatal(err)
+	}
+	if err = a.UpdatePolicy("p", "p", []string{"alice", "data1", "read"}, []string{"alice", "data1", "write"}); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadFile(f.Name())
+	if string(data) != "p; alice; data1; write\ng; alice; data2_admin" {
+		t.Errorf("saved policy: %q", data)
+	}
+
+	// the filters split the lines with the separator as well.
+	m, _ = model.NewModelFromString(testModel)
+	if err = a.LoadFilteredPolicy(m, &Filter{P: []string{"alice"}}); err != nil {
+		t.Fatal(err)
+	}
+	myRes, _ := m.GetPolicy("p", "p")
+	if !util.Array2DEquals([][]string{{"alice", "data1", "write"}}, myRes) {
+		t.Errorf("filtered policy: %v", myRes)
+	}
+
+	// a comma separated policy is a single field with the separator.
+	m, _ = model.NewModelFromString(testModel)
+	if err = NewAdapterWithOptions("../../examples/rbac_policy.csv", WithSeparator(';')).LoadPolicy(m); err == nil {
+		t.Error("a comma separated policy should not be loaded with the ';' separator")
+	}
+
+	// a field containing the separator is quoted.
+	a = NewAdapterWithOptions(f.Name(), WithSeparator(';'))
+	m, _ = model.NewModelFromString(testModel)
+	_ = m.AddPolicy("p", "p", []string{"carol", "data;3", "read"})
+	if err = a.SavePolicy(m); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ = ioutil.ReadFile(f.Name()); string(data) != "p; carol; \"data;3\"; read" {
+		t.Errorf("saved policy: %q", data)
+	}
+	testLoadedPolicy(t, a, "p", "p", [][]string{{"carol", "data;3", "read"}})
+	if err = a.UpdatePolicy("p", "p", []string{"carol", "data;3", "read"}, []string{"carol", "data;3", "write"}); err != nil {
+		t.Fatal(err)
+	}
+	testLoadedPolicy(t, a, "p", "p", [][]string{{"carol", "data;3", "write"}})
+}
+
+func readGzipFile(t *testing.T, path string) string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("%s is not gzip-compressed: %v", path, err)
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestAdapterGzip(t *testing.T) {
+	p := [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}}
+	m, _ := model.NewModelFromString(testModel)
+	_ = m.AddPolicies("p", "p", p)
+	_ = m.AddPolicy("g", "g", []string{"alice", "data2_admin"})
+
+	for _, ext := range []string{".csv.gz", ".bin"} {
+		f, err := ioutil.TempFile("", "policy*"+ext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = f.Close()
+		defer os.Remove(f.Name())
+
+		// the ".gz" extension is enough for NewAdapter.
+		a := NewAdapter(f.Name())
+		if ext == ".bin" {
+			a = NewAdapterGzip(f.Name())
+		}
+		if err = a.SavePolicy(m); err != nil {
+			t.Fatal(err)
+		}
+		if text := readGzipFile(t, f.Name()); text != "p, alice, data1, read\np, bob, data2, write\ng, alice, data2_admin" {
+			t.Errorf("saved policy: %q", text)
+		}
+		testLoadedPolicy(t, a, "p", "p", p)
+		testLoadedPolicy(t, a, "g", "g", [][]string{{"alice", "data2_admin"}})
+
+		// a compressed file is detected whatever its extension, and stays compressed when updated.
+		a = NewAdapter(f.Name())
+		testLoadedPolicy(t, a, "p", "p", p)
+		if err = a.UpdatePolicy("p", "p", []string{"bob", "data2", "write"}, []string{"bob", "data3", "write"}); err != nil {
+			t.Fatal(err)
+		}
+		if text := readGzipFile(t, f.Name()); text != "p, alice, data1, read\np, bob, data3, write\ng, alice, data2_admin" {
+			t.Errorf("updated policy: %q", text)
+		}
+		m2, _ := model.NewModelFromString(testModel)
+		if err = a.LoadFilteredPolicy(m2, &Filter{P: []string{"bob"}}); err != nil {
+			t.Fatal(err)
+		}
+		if res, _ := m2.GetPolicy("p", "p"); !util.Array2DEquals([][]string{{"bob", "data3", "write"}}, res) {
+			t.Errorf("filtered policy: %v", res)
+		}
+	}
+
+	// a compressed reader is detected as well.
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, _ = zw.Write([]byte(testPolicy))
+	_ = zw.Close()
+	testLoadedPolicy(t, NewAdapterFromReader(&buf), "g", "g", [][]string{{"alice", "data2_admin"}})
+}
@@ -0,0 +1,123 @@
+// Copyright 2023 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package layeredadapter
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/ApicaSystem/casbin/v2/model"
+	"github.com/ApicaSystem/casbin/v2/persist"
+)
+
+// Adapter is the layered adapter for Casbin. It loads the policy of a base adapter
+// and merges the policy of an overlay adapter on top of it. Overlay rules take precedence:
+// a base rule differing from an overlay rule only by its effect is dropped, and overlay
+// rules are ordered before base rules, so they win with first-match effects like priority(p.eft).
+// The adapter is read-only, changes must be made to the underlying adapters.
+type Adapter struct {
+	base    persist.Adapter
+	overlay persist.Adapter
+}
+
+// NewAdapter is the constructor for Adapter.
+func NewAdapter(base persist.Adapter, overlay persist.Adapter) *Adapter {
+	return &Adapter{
+		base:    base,
+		overlay: overlay,
+	}
+}
+
+// LoadPolicy loads the base policy rules, then the overlay ones, from the storage.
+func (a *Adapter) LoadPolicy(m model.Model) error {
+	if err := a.base.LoadPolicy(m); err != nil {
+		return err
+	}
+
+	overlay := m.Copy()
+	overlay.ClearPolicy()
+	if err := a.overlay.LoadPolicy(overlay); err != nil {
+		return err
+	}
+
+	for ptype, ast := range overlay["p"] {
+		if len(ast.Policy) == 0 {
+			continue
+		}
+		eftIndex, err := m.GetFieldIndex(ptype, "eft")
+		if err != nil {
+			eftIndex = -1
+		}
+
+		overridden := make(map[string]bool, len(ast.Policy))
+		for _, rule := range ast.Policy {
+			overridden[ruleKey(rule, eftIndex)] = true
+		}
+		rules := append([][]string{}, ast.Policy...)
+		for _, rule := range m["p"][ptype].Policy {
+			if !overridden[ruleKey(rule, eftIndex)] {
+				rules = append(rules, rule)
+			}
+		}
+
+		m["p"][ptype].Policy = nil
+		m["p"][ptype].PolicyMap = map[string]int{}
+		for _, rule := range rules {
+			if err := m.AddPolicy("p", ptype, rule); err != nil {
+				return err
+			}
+		}
+	}
+
+	for ptype, ast := range overlay["g"] {
+		for _, rule := range ast.Policy {
+			if err := persist.LoadPolicyArray(append([]string{ptype}, rule...), m); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ruleKey identifies a rule regardless of its effect.
+func ruleKey(rule []string, eftIndex int) string {
+	if eftIndex < 0 || eftIndex >= len(rule) {
+		return strings.Join(rule, model.DefaultSep)
+	}
+	fields := make([]string, 0, len(rule)-1)
+	fields = append(fields, rule[:eftIndex]...)
+	fields = append(fields, rule[eftIndex+1:]...)
+	return strings.Join(fields, model.DefaultSep)
+}
+
+// SavePolicy saves all policy rules to the storage.
+func (a *Adapter) SavePolicy(model model.Model) error {
+	return errors.New("not implemented")
+}
+
+// AddPolicy adds a policy rule to the storage.
+func (a *Adapter) AddPolicy(sec string, ptype string, rule []string) error {
+	return errors.New("not implemented")
+}
+
+// RemovePolicy removes a policy rule from the storage.
+func (a *Adapter) RemovePolicy(sec string, ptype string, rule []string) error {
+	return errors.New("not implemented")
+}
+
+// RemoveFilteredPolicy removes policy rules that match the filter from the storage.
+func (a *Adapter) RemoveFilteredPolicy(sec string, ptype string, fieldIndex int, fieldValues ...string) error {
+	return errors.New("not implemented")
+}
@@ -0,0 +1,77 @@
+// Copyright 2023 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package layeredadapter
+
+import (
+	"testing"
+
+	"github.com/ApicaSystem/casbin/v2"
+	stringadapter "github.com/ApicaSystem/casbin/v2/persist/string-adapter"
+)
+
+func testEnforce(t *testing.T, e *casbin.Enforcer, sub string, obj string, act string, res bool) {
+	t.Helper()
+	if myRes, err := e.Enforce(sub, obj, act); err != nil {
+		t.Errorf("Enforce Error: %s", err)
+	} else if myRes != res {
+		t.Errorf("%s, %s, %s: %t, supposed to be %t", sub, obj, act, myRes, res)
+	}
+}
+
+func TestLayeredAdapter(t *testing.T) {
+	base := stringadapter.NewAdapter(`
+p, alice, data1, read, allow
+p, alice, data1, write, allow
+p, data_admin, data2, read, allow
+g, bob, data_admin
+`)
+	overlay := stringadapter.NewAdapter(`
+p, alice, data1, write, deny
+p, data_admin, data2, write, allow
+g, cathy, data_admin
+`)
+
+	for _, modelPath := range []string{
+		"../../examples/priority_model.conf",
+		"../../examples/rbac_with_deny_model.conf",
+	} {
+		e, err := casbin.NewEnforcer(modelPath, NewAdapter(base, overlay))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the overlay deny replaces the base allow on the same request.
+		testEnforce(t, e, "alice", "data1", "write", false)
+		testEnforce(t, e, "alice", "data1", "read", true)
+		testEnforce(t, e, "bob", "data2", "read", true)
+		testEnforce(t, e, "bob", "data2", "write", true)
+		testEnforce(t, e, "cathy", "data2", "read", true)
+
+		if ok, _ := e.HasPolicy("alice", "data1", "write", "allow"); ok {
+			t.Errorf("%s: the overridden base rule should not be loaded", modelPath)
+		}
+	}
+}
+
+func TestLayeredAdapterOrder(t *testing.T) {
+	base := stringadapter.NewAdapter("p, alice, data1, read, allow")
+	overlay := stringadapter.NewAdapter("p, alice, data2, read, allow")
+
+	e, _ := casbin.NewEnforcer("../../examples/priority_model.conf", NewAdapter(base, overlay))
+	policy, _ := e.GetPolicy()
+	if len(policy) != 2 || policy[0][1] != "data2" || policy[1][1] != "data1" {
+		t.Errorf("overlay rules should come first, got %v", policy)
+	}
+}
@@ -0,0 +1,288 @@
+// Copyright 2023 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memoryadapter
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/ApicaSystem/casbin/v2/model"
+	"github.com/ApicaSystem/casbin/v2/persist"
+	"github.com/ApicaSystem/casbin/v2/util"
+)
+
+// Adapter is the memory adapter for Casbin. It keeps the policy in memory, e.g. for tests exercising auto-save
+// without a disk or a database. It supports filtered policies and updates, and is safe for concurrent use.
+type Adapter struct {
+	mu sync.RWMutex
+	// policy holds the rules by section and policy type, in the order they were added.
+	policy map[string]map[string][][]string
+	// filtered is set once a filtered policy was loaded, the policy must not be saved then.
+	filtered bool
+}
+
+// Filter defines the filtering rules of a filtered policy by policy type, e.g. {"p": {"alice"}} loads the "p"
+// rules of alice and all the rules of the other policy types. Empty values are ignored, but all others must match.
+type Filter map[string][]string
+
+// NewAdapter is the constructor for Adapter, the storage initially holds the rules given with their policy type,
+// e.g. {"p", "alice", "data1", "read"}.
+func NewAdapter(rules ...[]string) *Adapter {
+	a := &Adapter{policy: make(map[string]map[string][][]string)}
+	for _, rule := range rules {
+		if len(rule) > 1 && len(rule[0]) > 0 {
+			a.add(rule[0][:1], rule[0], rule[1:])
+		}
+	}
+	return a
+}
+
+// LoadPolicy loads all policy rules from the storage.
+func (a *Adapter) LoadPolicy(model model.Model) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.filtered = false
+	return a.load(model, nil)
+}
+
+// LoadFilteredPolicy loads only policy rules that match the filter, a Filter or a *Filter.
+func (a *Adapter) LoadFilteredPolicy(model model.Model, filter interface{}) error {
+	var f Filter
+	switch filter := filter.(type) {
+	case nil:
+		return a.LoadPolicy(model)
+	case Filter:
+		f = filter
+	case *Filter:
+		if filter == nil {
+			return a.LoadPolicy(model)
+		}
+		f = *filter
+	default:
+		return errors.New("invalid filter type")
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := a.load(model, f); err != nil {
+		return err
+	}
+	a.filtered = true
+	return nil
+}
+
+// IsFiltered returns true if the loaded policy has been filtered.
+func (a *Adapter) IsFiltered() bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.filtered
+}
+
+func (a *Adapter) load(m model.Model, filter Filter) error {
+	for _, sec := range []string{"p", "g"} {
+		ptypes := make([]string, 0, len(a.policy[sec]))
+		for ptype := range a.policy[sec] {
+			ptypes = append(ptypes, ptype)
+		}
+		sort.Strings(ptypes)
+
+		for _, ptype := range ptypes {
+			for _, rule := range a.policy[sec][ptype] {
+				if !matchFilter(rule, 0, filter[ptype]) {
+					continue
+				}
+				if err := persist.LoadPolicyArray(append([]string{ptype}, rule...), m); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// SavePolicy replaces the rules of the storage with those of the model.
+func (a *Adapter) SavePolicy(model model.Model) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.filtered {
+		return errors.New("cannot save a filtered policy")
+	}
+
+	a.policy = make(map[string]map[string][][]string)
+	for _, sec := range []string{"p", "g"} {
+		for ptype, ast := range model[sec] {
+			for _, rule := range ast.Policy {
+				a.add(sec, ptype, rule)
+			}
+		}
+	}
+	return nil
+}
+
+// GetPolicy returns a copy of the rules of a policy type in the storage.
+func (a *Adapter) GetPolicy(sec string, ptype string) [][]string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	rules := make([][]string, 0, len(a.policy[sec][ptype]))
+	for _, rule := range a.policy[sec][ptype] {
+		rules = append(rules, append([]string(nil), rule...))
+	}
+	return rules
+}
+
+// AddPolicy adds a policy rule to the storage.
+func (a *Adapter) AddPolicy(sec string, ptype string, rule []string) error {
+	return a.AddPolicies(sec, ptype, [][]string{rule})
+}
+
+// AddPolicies adds policy rules to the storage. No rule is added if one of them already exists.
+func (a *Adapter) AddPolicies(sec string, ptype string, rules [][]string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, rule := range rules {
+		if a.index(sec, ptype, rule) != -1 {
+			return fmt.Errorf("policy rule already exists: %s, %s", ptype, util.ArrayToString(rule))
+		}
+	}
+	for _, rule := range rules {
+		a.add(sec, ptype, rule)
+	}
+	return nil
+}
+
+// RemovePolicy removes a policy rule from the storage.
+func (a *Adapter) RemovePolicy(sec string, ptype string, rule []string) error {
+	return a.RemovePolicies(sec, ptype, [][]string{rule})
+}
+
+// RemovePolicies removes policy rules from the storage. No rule is removed if one of them does not exist.
+func (a *Adapter) RemovePolicies(sec string, ptype string, rules [][]string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, rule := range rules {
+		if a.index(sec, ptype, rule) == -1 {
+			return fmt.Errorf("policy rule not found: %s, %s", ptype, util.ArrayToString(rule))
+		}
+	}
+	for _, rule := range rules {
+		if i := a.index(sec, ptype, rule); i != -1 {
+			a.policy[sec][ptype] = append(a.policy[sec][ptype][:i:i], a.policy[sec][ptype][i+1:]...)
+		}
+	}
+	return nil
+}
+
+// RemoveFilteredPolicy removes policy rules that match the filter from the storage.
+func (a *Adapter) RemoveFilteredPolicy(sec string, ptype string, fieldIndex int, fieldValues ...string) error {
+	_, err := a.UpdateFilteredPolicies(sec, ptype, nil, fieldIndex, fieldValues...)
+	return err
+}
+
+// UpdatePolicy updates a policy rule in the storage.
+func (a *Adapter) UpdatePolicy(sec string, ptype string, oldRule, newRule []string) error {
+	return a.UpdatePolicies(sec, ptype, [][]string{oldRule}, [][]string{newRule})
+}
+
+// UpdatePolicies updates policy rules in the storage, each old rule is replaced in place by its new rule.
+// No rule is updated if one of the old rules does not exist.
+func (a *Adapter) UpdatePolicies(sec string, ptype string, oldRules, newRules [][]string) error {
+	if len(oldRules) != len(newRules) {
+		return fmt.Errorf("the length of oldRules should be equal to the length of newRules, but got the length of oldRules is %d, the length of newRules is %d", len(oldRules), len(newRules))
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	indexes := make([]int, len(oldRules))
+	for i, oldRule := range oldRules {
+		if indexes[i] = a.index(sec, ptype, oldRule); indexes[i] == -1 {
+			return fmt.Errorf("policy rule not found: %s, %s", ptype, util.ArrayToString(oldRule))
+		}
+	}
+	for i, j := range indexes {
+		a.policy[sec][ptype][j] = append([]string(nil), newRules[i]...)
+	}
+	return nil
+}
+
+// UpdateFilteredPolicies deletes the policy rules that match the filter and adds newRules in place of the first one.
+// It returns the deleted rules.
+func (a *Adapter) UpdateFilteredPolicies(sec string, ptype string, newRules [][]string, fieldIndex int, fieldValues ...string) ([][]string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var oldRules [][]string
+	rules := a.policy[sec][ptype]
+	res := make([][]string, 0, len(rules)+len(newRules))
+	for _, rule := range rules {
+		if !matchFilter(rule, fieldIndex, fieldValues) {
+			res = append(res, rule)
+			continue
+		}
+		if oldRules == nil {
+			for _, newRule := range newRules {
+				res = append(res, append([]string(nil), newRule...))
+			}
+		}
+		oldRules = append(oldRules, rule)
+	}
+
+	if len(oldRules) != 0 {
+		a.policy[sec][ptype] = res
+	}
+	return oldRules, nil
+}
+
+// ReplaceAllPolicies replaces all rules of the ptype in the storage with rules.
+func (a *Adapter) ReplaceAllPolicies(sec string, ptype string, rules [][]string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.policy[sec] != nil {
+		delete(a.policy[sec], ptype)
+	}
+	for _, rule := range rules {
+		a.add(sec, ptype, rule)
+	}
+	return nil
+}
+
+func (a *Adapter) add(sec string, ptype string, rule []string) {
+	if a.policy[sec] == nil {
+		a.policy[sec] = make(map[string][][]string)
+	}
+	a.policy[sec][ptype] = append(a.policy[sec][ptype], append([]string(nil), rule...))
+}
+
+func (a *Adapter) index(sec string, ptype string, rule []string) int {
+	for i, r := range a.policy[sec][ptype] {
+		if util.ArrayEquals(r, rule) {
+			return i
+		}
+	}
+	return -1
+}
+
+func matchFilter(rule []string, fieldIndex int, fieldValues []string) bool {
+	for i, fieldValue := range fieldValues {
+		if fieldValue == "" {
+			continue
+		}
+		if fieldIndex+i >= len(rule) || rule[fieldIndex+i] != fieldValue {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,150 @@
+// Copyright 2023 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memoryadapter
+
+import (
+	"testing"
+
+	"github.com/ApicaSystem/casbin/v2"
+	"github.com/ApicaSystem/casbin/v2/util"
+)
+
+const rbacModel = "../../examples/rbac_model.conf"
+
+func newTestAdapter() *Adapter {
+	return NewAdapter(
+		[]string{"p", "alice", "data1", "read"},
+		[]string{"p", "bob", "data2", "write"},
+		[]string{"p", "data2_admin", "data2", "read"},
+		[]string{"p", "data2_admin", "data2", "write"},
+		[]string{"g", "alice", "data2_admin"},
+	)
+}
+
+func testEnforce(t *testing.T, e *casbin.Enforcer, sub string, obj string, act string, res bool) {
+	t.Helper()
+	if myRes, err := e.Enforce(sub, obj, act); err != nil {
+		t.Errorf("Enforce Error: %s", err)
+	} else if myRes != res {
+		t.Errorf("%s, %s, %s: %t, supposed to be %t", sub, obj, act, myRes, res)
+	}
+}
+
+func testStoredPolicy(t *testing.T, a *Adapter, sec string, ptype string, res [][]string) {
+	t.Helper()
+	if myRes := a.GetPolicy(sec, ptype); !util.Array2DEquals(res, myRes) {
+		t.Errorf("stored %s policy: %v, supposed to be %v", ptype, myRes, res)
+	}
+}
+
+func TestAutoSave(t *testing.T) {
+	a := newTestAdapter()
+	e, err := casbin.NewEnforcer(rbacModel, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testEnforce(t, e, "alice", "data2", "read", true)
+
+	if _, err = e.AddPolicy("carol", "data3", "read"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = e.RemovePolicy("bob", "data2", "write"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = e.UpdatePolicy([]string{"alice", "data1", "read"}, []string{"alice", "data1", "write"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = e.RemoveFilteredPolicy(0, "data2_admin", "", "write"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = e.AddGroupingPolicies([][]string{{"bob", "data2_admin"}, {"carol", "data2_admin"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = e.RemoveGroupingPolicy("alice", "data2_admin"); err != nil {
+		t.Fatal(err)
+	}
+	p := [][]string{{"alice", "data1", "write"}, {"data2_admin", "data2", "read"}, {"carol", "data3", "read"}}
+	g := [][]string{{"bob", "data2_admin"}, {"carol", "data2_admin"}}
+	testStoredPolicy(t, a, "p", "p", p)
+	testStoredPolicy(t, a, "g", "g", g)
+
+	// another enforcer sees the saved policy.
+	e2, err := casbin.NewEnforcer(rbacModel, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testEnforce(t, e2, "alice", "data1", "write", true)
+	testEnforce(t, e2, "alice", "data2", "read", false)
+	testEnforce(t, e2, "bob", "data2", "read", true)
+	testEnforce(t, e2, "bob", "data2", "write", false)
+
+	// changes failing in the storage are not applied.
+	if err = a.AddPolicy("p", "p", []string{"carol", "data3", "read"}); err == nil {
+		t.Error("adding an existing rule should fail")
+	}
+	if err = a.RemovePolicies("p", "p", [][]string{{"carol", "data3", "read"}, {"eve", "data1", "read"}}); err == nil {
+		t.Error("removing a missing rule should fail")
+	}
+	if err = a.UpdatePolicy("p", "p", []string{"eve", "data1", "read"}, []string{"eve", "data1", "write"}); err == nil {
+		t.Error("updating a missing rule should fail")
+	}
+	testStoredPolicy(t, a, "p", "p", p)
+
+	if err = e.SavePolicy(); err != nil {
+		t.Fatal(err)
+	}
+	testStoredPolicy(t, a, "p", "p", [][]string{{"alice", "data1", "write"}, {"data2_admin", "data2", "read"}, {"carol", "data3", "read"}})
+}
+
+func TestLoadFilteredPolicy(t *testing.T) {
+	a := newTestAdapter()
+	e, _ := casbin.NewEnforcer(rbacModel)
+	e.SetAdapter(a)
+	if err := e.LoadFilteredPolicy(Filter{"p": {"", "data2"}, "g": {"bob"}}); err != nil {
+		t.Fatal(err)
+	}
+	if !a.IsFiltered() {
+		t.Error("the adapter should be filtered")
+	}
+	p, _ := e.GetPolicy()
+	if res := [][]string{{"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}}; !util.Array2DEquals(res, p) {
+		t.Errorf("filtered policy: %v, supposed to be %v", p, res)
+	}
+	if g, _ := e.GetGroupingPolicy(); len(g) != 0 {
+		t.Errorf("filtered grouping policy: %v, supposed to be empty", g)
+	}
+	if err := e.SavePolicy(); err == nil {
+		t.Error("a filtered policy should not be saved")
+	}
+
+	if err := e.LoadFilteredPolicy(&Filter{"p": {"alice"}}); err != nil {
+		t.Fatal(err)
+	}
+	p, _ = e.GetPolicy()
+	if res := [][]string{{"alice", "data1", "read"}}; !util.Array2DEquals(res, p) {
+		t.Errorf("filtered policy: %v, supposed to be %v", p, res)
+	}
+	if err := e.LoadFilteredPolicy("alice"); err == nil {
+		t.Error("an invalid filter should fail")
+	}
+
+	if err := e.LoadPolicy(); err != nil {
+		t.Fatal(err)
+	}
+	if a.IsFiltered() {
+		t.Error("the adapter should not be filtered after loading the whole policy")
+	}
+	testEnforce(t, e, "alice", "data2", "read", true)
+}
@@ -17,6 +17,7 @@ package stringadapter
 import (
 	"bytes"
 	"errors"
+	"sort"
 	"strings"
 
 	"github.com/ApicaSystem/casbin/v2/model"
@@ -47,28 +48,32 @@ func (a *Adapter) LoadPolicy(model model.Model) error {
 		if str == "" {
 			continue
 		}
-		_ = persist.LoadPolicyLine(str, model)
+		if err := persist.LoadPolicyLine(str, model); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
 // SavePolicy saves all policy rules to the storage.
+// The rules are written one per line, sections and policy types in sorted order, so saving the same policy
+// always yields the same string.
 func (a *Adapter) SavePolicy(model model.Model) error {
 	var tmp bytes.Buffer
-	for ptype, ast := range model["p"] {
-		for _, rule := range ast.Policy {
-			tmp.WriteString(ptype + ", ")
-			tmp.WriteString(util.ArrayToString(rule))
-			tmp.WriteString("\n")
+	for _, sec := range []string{"p", "g"} {
+		ptypes := make([]string, 0, len(model[sec]))
+		for ptype := range model[sec] {
+			ptypes = append(ptypes, ptype)
 		}
-	}
+		sort.Strings(ptypes)
 
-	for ptype, ast := range model["g"] {
-		for _, rule := range ast.Policy {
-			tmp.WriteString(ptype + ", ")
-			tmp.WriteString(util.ArrayToString(rule))
-			tmp.WriteString("\n")
+		for _, ptype := range ptypes {
+			for _, rule := range model[sec][ptype].Policy {
+				tmp.WriteString(ptype + ", ")
+				tmp.WriteString(util.ArrayToString(rule))
+				tmp.WriteString("\n")
+			}
 		}
 	}
 	a.Line = strings.TrimRight(tmp.String(), "\n")
@@ -15,6 +15,7 @@
 package stringadapter
 
 import (
+	"reflect"
 	"testing"
 
 	"github.com/ApicaSystem/casbin/v2"
@@ -99,3 +100,58 @@ g, alice, data_group_admin
 		t.Error("unexpected enforce result")
 	}
 }
+
+func Test_StringMultiplePolicyTypes(t *testing.T) {
+	line := `
+p, user, /data, GET
+p, admin, /data, POST
+
+p2, user, view
+p2, admin, create
+
+g, admin, user
+g, alice, admin
+g2, alice, user
+`
+	a := NewAdapter(line)
+	e, err := casbin.NewEnforcer("../../examples/rbac_with_multiple_policy_model.conf", a)
+	if err != nil {
+		t.Fatalf("new enforcer failed: %v", err)
+	}
+
+	if res, _ := e.Enforce("alice", "/data", "POST"); !res {
+		t.Error("unexpected enforce result")
+	}
+	if res, _ := e.Enforce("bob", "/data", "GET"); res {
+		t.Error("unexpected enforce result")
+	}
+	if policy, _ := e.GetNamedPolicy("p2"); len(policy) != 2 {
+		t.Errorf("p2 rules = %v, supposed to have 2 rules", policy)
+	}
+	if roles, _ := e.GetNamedRoleManager("g2").GetRoles("alice"); len(roles) != 1 || roles[0] != "user" {
+		t.Errorf("g2 roles of alice = %v, supposed to be [user]", roles)
+	}
+
+	if err = e.SavePolicy(); err != nil {
+		t.Fatalf("save policy failed: %v", err)
+	}
+	expected := "p, user, /data, GET\np, admin, /data, POST\np2, user, view\np2, admin, create\n" +
+		"g, admin, user\ng, alice, admin\ng2, alice, user"
+	if a.Line != expected {
+		t.Errorf("saved policy = %q, supposed to be %q", a.Line, expected)
+	}
+
+	// The saved string loads back into the same policy.
+	e2, err := casbin.NewEnforcer("../../examples/rbac_with_multiple_policy_model.conf", NewAdapter(a.Line))
+	if err != nil {
+		t.Fatalf("new enforcer failed: %v", err)
+	}
+	p2, _ := e.GetNamedPolicy("p2")
+	reloaded, _ := e2.GetNamedPolicy("p2")
+	if !reflect.DeepEqual(reloaded, p2) {
+		t.Errorf("reloaded p2 rules = %v, supposed to be %v", reloaded, p2)
+	}
+	if res, _ := e2.Enforce("alice", "/data", "POST"); !res {
+		t.Error("unexpected enforce result")
+	}
+}
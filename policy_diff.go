@@ -0,0 +1,411 @@
+// Copyright 2023 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casbin
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ApicaSystem/casbin/v2/model"
+)
+
+// Policy is a snapshot of policy rules, keyed by section ("p" or "g") and policy type.
+type Policy map[string]map[string][][]string
+
+// PolicyRule is a rule of a policy type.
+type PolicyRule struct {
+	Sec   string
+	PType string
+	Rule  []string
+}
+
+// PolicyUpdate is a rule replaced by another rule of the same policy type.
+type PolicyUpdate struct {
+	Sec     string
+	PType   string
+	OldRule []string
+	NewRule []string
+}
+
+// PolicyDiff is the change set turning a policy into another one.
+type PolicyDiff struct {
+	Added   []PolicyRule
+	Removed []PolicyRule
+	Updated []PolicyUpdate
+}
+
+// IsEmpty returns true if the diff has no changes.
+func (d PolicyDiff) IsEmpty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Updated) == 0
+}
+
+// ExportPolicy returns a copy of all policy rules of the enforcer.
+func (e *Enforcer) ExportPolicy() Policy {
+	return exportPolicy(e.model)
+}
+
+// exportPolicy returns a copy of the "p" and "g" rules of m.
+func exportPolicy(m model.Model) Policy {
+	p := make(Policy)
+	for _, sec := range []string{"p", "g"} {
+		p[sec] = make(map[string][][]string)
+		for ptype, ast := range m[sec] {
+			rules := make([][]string, len(ast.Policy))
+			for i, rule := range ast.Policy {
+				rules[i] = deepCopyPolicy(rule)
+			}
+			p[sec][ptype] = rules
+		}
+	}
+	return p
+}
+
+// Diff returns the changes turning p into other, see Diff.
+func (p Policy) Diff(other Policy) PolicyDiff {
+	return Diff(p, other)
+}
+
+// Diff returns the changes turning policy a into policy b. A rule of a missing from b and a rule of b missing
+// from a are reported as an update if they have the same policy type and differ in a single field, e.g. the
+// action, otherwise as a removal and an addition. Sections and policy types are visited in sorted order, the
+// rules in the order of a and b.
+func Diff(a, b Policy) PolicyDiff {
+	var diff PolicyDiff
+	for _, sec := range sortedKeys(a, b) {
+		for _, ptype := range sortedPTypes(a[sec], b[sec]) {
+			removed := missingRules(a[sec][ptype], b[sec][ptype])
+			added := missingRules(b[sec][ptype], a[sec][ptype])
+
+			for _, oldRule := range removed {
+				i := indexOfUpdate(oldRule, added)
+				if i == -1 {
+					diff.Removed = append(diff.Removed, PolicyRule{Sec: sec, PType: ptype, Rule: oldRule})
+					continue
+				}
+				diff.Updated = append(diff.Updated, PolicyUpdate{Sec: sec, PType: ptype, OldRule: oldRule, NewRule: added[i]})
+				added = append(added[:i], added[i+1:]...)
+			}
+			for _, newRule := range added {
+				diff.Added = append(diff.Added, PolicyRule{Sec: sec, PType: ptype, Rule: newRule})
+			}
+		}
+	}
+	return diff
+}
+
+// ApplyDiff applies the changes of diff to the policy, removals first, then updates and additions, each as one
+// batch per policy type. The diff is checked before any change is made, so it fails without changes if a removed
+// or updated rule is missing, an added rule already exists, e.g. because the policy changed since the diff was
+// computed, or a rule is changed more than once. If the adapter fails, the batches applied before are undone.
+func (e *Enforcer) ApplyDiff(diff PolicyDiff) error {
+	removed := make(map[string]bool)
+	added := make(map[string]bool)
+	checkOnce := func(seen map[string]bool, sec string, ptype string, rule []string) error {
+		key := sec + ":" + ptype + ":" + strings.Join(rule, model.DefaultSep)
+		if seen[key] {
+			return fmt.Errorf("policy diff does not apply: rule %s, %s is changed more than once", ptype, strings.Join(rule, ", "))
+		}
+		seen[key] = true
+		return nil
+	}
+	for _, r := range diff.Removed {
+		if err := e.checkDiffRule(r.Sec, r.PType, r.Rule, true); err != nil {
+			return err
+		}
+		if err := checkOnce(removed, r.Sec, r.PType, r.Rule); err != nil {
+			return err
+		}
+	}
+	for _, u := range diff.Updated {
+		if err := e.checkDiffRule(u.Sec, u.PType, u.OldRule, true); err != nil {
+			return err
+		}
+		if err := checkOnce(removed, u.Sec, u.PType, u.OldRule); err != nil {
+			return err
+		}
+		if err := checkOnce(added, u.Sec, u.PType, u.NewRule); err != nil {
+			return err
+		}
+	}
+	for _, r := range diff.Added {
+		if err := e.checkDiffRule(r.Sec, r.PType, r.Rule, false); err != nil {
+			return err
+		}
+		if err := checkOnce(added, r.Sec, r.PType, r.Rule); err != nil {
+			return err
+		}
+	}
+
+	type batch struct {
+		sec, ptype         string
+		oldRules, newRules [][]string
+	}
+	group := func(batches []*batch, sec string, ptype string, oldRule []string, newRule []string) []*batch {
+		var b *batch
+		for _, other := range batches {
+			if other.sec == sec && other.ptype == ptype {
+				b = other
+			}
+		}
+		if b == nil {
+			b = &batch{sec: sec, ptype: ptype}
+			batches = append(batches, b)
+		}
+		if oldRule != nil {
+			b.oldRules = append(b.oldRules, oldRule)
+		}
+		if newRule != nil {
+			b.newRules = append(b.newRules, newRule)
+		}
+		return batches
+	}
+	var removals, updates, additions []*batch
+	for _, r := range diff.Removed {
+		removals = group(removals, r.Sec, r.PType, r.Rule, nil)
+	}
+	for _, u := range diff.Updated {
+		updates = group(updates, u.Sec, u.PType, u.OldRule, u.NewRule)
+	}
+	for _, r := range diff.Added {
+		additions = group(additions, r.Sec, r.PType, nil, r.Rule)
+	}
+
+	// undo holds the inverse of the batches applied so far, in the order they were applied. An inverse the
+	// adapter rejects is still applied to the in-memory policy.
+	var undo []func() error
+	fail := func(err error) error {
+		for i := len(undo) - 1; i >= 0; i-- {
+			if undo[i]() != nil {
+				autoSave := e.autoSave
+				e.autoSave = false
+				_ = undo[i]()
+				e.autoSave = autoSave
+			}
+		}
+		return err
+	}
+	for _, b := range removals {
+		b := b
+		if _, err := e.removePoliciesWithoutNotify(b.sec, b.ptype, b.oldRules); err != nil {
+			return fail(err)
+		}
+		undo = append(undo, func() error {
+			_, err := e.addPoliciesWithoutNotify(b.sec, b.ptype, b.oldRules, false)
+			return err
+		})
+	}
+	for _, b := range updates {
+		b := b
+		if _, err := e.updatePoliciesWithoutNotify(b.sec, b.ptype, b.oldRules, b.newRules); err != nil {
+			return fail(err)
+		}
+		undo = append(undo, func() error {
+			_, err := e.updatePoliciesWithoutNotify(b.sec, b.ptype, b.newRules, b.oldRules)
+			return err
+		})
+	}
+	for _, b := range additions {
+		b := b
+		if _, err := e.addPoliciesWithoutNotify(b.sec, b.ptype, b.newRules, false); err != nil {
+			return fail(err)
+		}
+		undo = append(undo, func() error {
+			_, err := e.removePoliciesWithoutNotify(b.sec, b.ptype, b.newRules)
+			return err
+		})
+	}
+
+	for _, b := range removals {
+		if err := e.notifyRemovePolicies(b.sec, b.ptype, b.oldRules); err != nil {
+			return err
+		}
+	}
+	for _, b := range updates {
+		if err := e.notifyUpdatePolicies(b.sec, b.ptype, b.oldRules, b.newRules); err != nil {
+			return err
+		}
+	}
+	for _, b := range additions {
+		if err := e.notifyAddPolicies(b.sec, b.ptype, b.newRules); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BatchUpdatePolicies replaces the old rule of every update by its new rule as a single change. All old rules are
+// checked to exist first, then the updates of each policy type are sent to the adapter with one UpdatePolicies call
+// and the role links are updated once per policy type. If the adapter fails, the updates of the policy types applied
+// before are undone, so the in-memory policy is left unchanged. The section of an update defaults to the first
+// letter of its policy type.
+func (e *Enforcer) BatchUpdatePolicies(updates []PolicyUpdate) error {
+	type batch struct {
+		sec, ptype         string
+		oldRules, newRules [][]string
+	}
+	var batches []*batch
+	batchOf := make(map[string]*batch)
+	seen := make(map[string]bool)
+	for _, u := range updates {
+		sec := u.Sec
+		if sec == "" && u.PType != "" {
+			sec = u.PType[:1]
+		}
+		if ok, err := e.model.HasPolicy(sec, u.PType, u.OldRule); err != nil {
+			return err
+		} else if !ok {
+			return fmt.Errorf("policy rule not found: %s, %s", u.PType, strings.Join(u.OldRule, ", "))
+		}
+		key := u.PType + ":" + strings.Join(u.OldRule, model.DefaultSep)
+		if seen[key] {
+			return fmt.Errorf("policy rule updated more than once: %s, %s", u.PType, strings.Join(u.OldRule, ", "))
+		}
+		seen[key] = true
+
+		b, ok := batchOf[sec+":"+u.PType]
+		if !ok {
+			b = &batch{sec: sec, ptype: u.PType}
+			batchOf[sec+":"+u.PType] = b
+			batches = append(batches, b)
+		}
+		b.oldRules = append(b.oldRules, u.OldRule)
+		b.newRules = append(b.newRules, u.NewRule)
+	}
+
+	for i, b := range batches {
+		if _, err := e.updatePoliciesWithoutNotify(b.sec, b.ptype, b.oldRules, b.newRules); err != nil {
+			for j := i - 1; j >= 0; j-- {
+				_, _ = e.updatePoliciesWithoutNotify(batches[j].sec, batches[j].ptype, batches[j].newRules, batches[j].oldRules)
+			}
+			return err
+		}
+	}
+
+	for _, b := range batches {
+		if err := e.notifyUpdatePolicies(b.sec, b.ptype, b.oldRules, b.newRules); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PoliciesAddedSince returns the rules of all "p" and "g" policy types that are missing from since, a policy
+// previously returned by ExportPolicy. Each rule is prefixed with its policy type like a line of a policy file,
+// e.g. ["p", "alice", "data1", "read"]. The policy types are visited in sorted order, the rules in their current
+// order.
+func (e *Enforcer) PoliciesAddedSince(since Policy) [][]string {
+	return policyDelta(e.ExportPolicy(), since)
+}
+
+// PoliciesRemovedSince returns the rules of since, a policy previously returned by ExportPolicy, that are missing
+// from the current policy, prefixed with their policy type like the rules of PoliciesAddedSince, in their order
+// in since.
+func (e *Enforcer) PoliciesRemovedSince(since Policy) [][]string {
+	return policyDelta(since, e.ExportPolicy())
+}
+
+// policyDelta returns the rules of a missing from b, prefixed with their policy type.
+func policyDelta(a, b Policy) [][]string {
+	var res [][]string
+	for _, sec := range sortedKeys(a, b) {
+		for _, ptype := range sortedPTypes(a[sec], nil) {
+			for _, rule := range missingRules(a[sec][ptype], b[sec][ptype]) {
+				res = append(res, append([]string{ptype}, rule...))
+			}
+		}
+	}
+	return res
+}
+
+func (e *Enforcer) checkDiffRule(sec string, ptype string, rule []string, exists bool) error {
+	ok, err := e.model.HasPolicy(sec, ptype, rule)
+	if err != nil {
+		return err
+	}
+	if ok != exists {
+		state := "is missing"
+		if ok {
+			state = "already exists"
+		}
+		return fmt.Errorf("policy diff does not apply: rule %s, %s %s", ptype, strings.Join(rule, ", "), state)
+	}
+	return nil
+}
+
+func sortedKeys(a, b Policy) []string {
+	secs := make(map[string]bool)
+	for sec := range a {
+		secs[sec] = true
+	}
+	for sec := range b {
+		secs[sec] = true
+	}
+	res := make([]string, 0, len(secs))
+	for sec := range secs {
+		res = append(res, sec)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// sortedPTypes returns the policy types of the sections a and b in sorted order.
+func sortedPTypes(a, b map[string][][]string) []string {
+	ptypes := make([]string, 0, len(a)+len(b))
+	for ptype := range a {
+		ptypes = append(ptypes, ptype)
+	}
+	for ptype := range b {
+		if _, ok := a[ptype]; !ok {
+			ptypes = append(ptypes, ptype)
+		}
+	}
+	sort.Strings(ptypes)
+	return ptypes
+}
+
+// missingRules returns the rules that are not in other.
+func missingRules(rules [][]string, other [][]string) [][]string {
+	set := make(map[string]bool, len(other))
+	for _, rule := range other {
+		set[strings.Join(rule, model.DefaultSep)] = true
+	}
+	var res [][]string
+	for _, rule := range rules {
+		if !set[strings.Join(rule, model.DefaultSep)] {
+			res = append(res, rule)
+		}
+	}
+	return res
+}
+
+// indexOfUpdate returns the index of the first rule differing from rule in a single field, or -1.
+func indexOfUpdate(rule []string, rules [][]string) int {
+	for i, other := range rules {
+		if len(other) != len(rule) {
+			continue
+		}
+		changed := 0
+		for j := range rule {
+			if rule[j] != other[j] {
+				changed++
+			}
+		}
+		if changed == 1 {
+			return i
+		}
+	}
+	return -1
+}
@@ -712,6 +712,15 @@ func (dm *DomainManager) BuildRelationship(name1 string, name2 string, domain ..
 	return nil
 }
 
+// NewHierarchicalDomainManager creates a DomainManager for nested domains like "org/team/sub",
+// where a role granted in a domain is also effective in all of its child domains.
+// It is equivalent to calling AddDomainMatchingFunc with util.DomainMatch on a new DomainManager.
+func NewHierarchicalDomainManager(maxHierarchyLevel int) *DomainManager {
+	dm := NewDomainManager(maxHierarchyLevel)
+	dm.AddDomainMatchingFunc("domainMatch", util.DomainMatch)
+	return dm
+}
+
 type RoleManager struct {
 	*DomainManager
 }
@@ -939,6 +948,37 @@ func (cdm *ConditionalDomainManager) getConditionalRoleManager(domain string, st
 	return rm
 }
 
+// AddDomainMatchingFunc support use domain pattern in g.
+func (cdm *ConditionalDomainManager) AddDomainMatchingFunc(name string, fn rbac.MatchingFunc) {
+	cdm.domainMatchingFunc = fn
+	cdm.rmMap.Range(func(key, value interface{}) bool {
+		value.(*ConditionalRoleManager).AddDomainMatchingFunc(name, fn)
+		return true
+	})
+
+	// Unlike DomainManager, the role managers are not rebuilt from scratch, so the link condition functions
+	// already registered on them are kept. The links of the pattern domains are copied into the matching ones.
+	cdm.rmMap.Range(func(key, value interface{}) bool {
+		domain := key.(string)
+		cdm.rangeAffectedRoleManagers(domain, func(rm *ConditionalRoleManager) {
+			rm.copyFrom(value.(*ConditionalRoleManager))
+		})
+		return true
+	})
+}
+
+func (cdm *ConditionalDomainManager) rangeAffectedRoleManagers(domain string, fn func(rm *ConditionalRoleManager)) {
+	if cdm.domainMatchingFunc != nil {
+		cdm.rmMap.Range(func(key, value interface{}) bool {
+			domain2 := key.(string)
+			if domain != domain2 && cdm.Match(domain2, domain) {
+				fn(value.(*ConditionalRoleManager))
+			}
+			return true
+		})
+	}
+}
+
 // HasLink determines whether role: name1 inherits role: name2.
 func (cdm *ConditionalDomainManager) HasLink(name1 string, name2 string, domains ...string) (bool, error) {
 	domain, err := cdm.getDomain(domains...)
@@ -959,7 +999,7 @@ func (cdm *ConditionalDomainManager) AddLink(name1 string, name2 string, domains
 	conditionalRoleManager := cdm.getConditionalRoleManager(domain, true) // create role manager if it does not exist
 	_ = conditionalRoleManager.AddLink(name1, name2, domain)
 
-	cdm.rangeAffectedRoleManagers(domain, func(rm *RoleManagerImpl) {
+	cdm.rangeAffectedRoleManagers(domain, func(rm *ConditionalRoleManager) {
 		_ = rm.AddLink(name1, name2, domain)
 	})
 	return nil
@@ -975,12 +1015,32 @@ func (cdm *ConditionalDomainManager) DeleteLink(name1 string, name2 string, doma
 	conditionalRoleManager := cdm.getConditionalRoleManager(domain, true) // create role manager if it does not exist
 	_ = conditionalRoleManager.DeleteLink(name1, name2, domain)
 
-	cdm.rangeAffectedRoleManagers(domain, func(rm *RoleManagerImpl) {
+	cdm.rangeAffectedRoleManagers(domain, func(rm *ConditionalRoleManager) {
 		_ = rm.DeleteLink(name1, name2, domain)
 	})
 	return nil
 }
 
+// GetRoles gets the roles that a subject inherits, including the roles granted in the domains matching the given one.
+func (cdm *ConditionalDomainManager) GetRoles(name string, domains ...string) ([]string, error) {
+	domain, err := cdm.getDomain(domains...)
+	if err != nil {
+		return nil, err
+	}
+	rm := cdm.getConditionalRoleManager(domain, false)
+	return rm.GetRoles(name, domains...)
+}
+
+// GetUsers gets the users of a role, including the users granted in the domains matching the given one.
+func (cdm *ConditionalDomainManager) GetUsers(name string, domains ...string) ([]string, error) {
+	domain, err := cdm.getDomain(domains...)
+	if err != nil {
+		return nil, err
+	}
+	rm := cdm.getConditionalRoleManager(domain, false)
+	return rm.GetUsers(name, domains...)
+}
+
 // AddLinkConditionFunc is based on userName, roleName, add LinkConditionFunc.
 func (cdm *ConditionalDomainManager) AddLinkConditionFunc(userName, roleName string, fn rbac.LinkConditionFunc) {
 	cdm.rmMap.Range(func(key, value interface{}) bool {
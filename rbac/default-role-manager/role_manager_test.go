@@ -15,7 +15,9 @@
 package defaultrolemanager
 
 import (
+	"errors"
 	"fmt"
+	"sync"
 	"testing"
 
 	"github.com/ApicaSystem/casbin/v2/rbac"
@@ -262,6 +264,33 @@ func TestClear(t *testing.T) {
 	testRole(t, rm, "u4", "g3", false)
 }
 
+func TestHierarchicalDomainRole(t *testing.T) {
+	rm := NewHierarchicalDomainManager(10)
+	_ = rm.AddLink("u1", "admin", "org")
+	_ = rm.AddLink("u2", "admin", "org/team")
+	_ = rm.AddLink("u3", "viewer", "org/*")
+
+	testDomainRole(t, rm, "u1", "admin", "org", true)
+	testDomainRole(t, rm, "u1", "admin", "org/team", true)
+	testDomainRole(t, rm, "u1", "admin", "org/team/sub", true)
+	testDomainRole(t, rm, "u1", "admin", "other", false)
+
+	testDomainRole(t, rm, "u2", "admin", "org", false)
+	testDomainRole(t, rm, "u2", "admin", "org/team", true)
+	testDomainRole(t, rm, "u2", "admin", "org/team/sub", true)
+	testDomainRole(t, rm, "u2", "admin", "org/team2", false)
+
+	testDomainRole(t, rm, "u3", "viewer", "org", false)
+	testDomainRole(t, rm, "u3", "viewer", "org/team", true)
+
+	// links added to a parent after a child domain exists are inherited as well
+	_ = rm.AddLink("u4", "admin", "org")
+	testDomainRole(t, rm, "u4", "admin", "org/team", true)
+
+	_ = rm.DeleteLink("u1", "admin", "org")
+	testDomainRole(t, rm, "u1", "admin", "org/team", false)
+}
+
 func TestDomainPatternRole(t *testing.T) {
 	rm := NewRoleManager(10)
 	rm.AddDomainMatchingFunc("keyMatch2", util.KeyMatch2)
@@ -338,6 +367,23 @@ func TestDomainMatchingFuncWithDifferentDomain(t *testing.T) {
 	testDomainRole(t, rm, "alice", "admin", "domain2", false)
 }
 
+func TestConditionalDomainPatternRole(t *testing.T) {
+	rm := NewConditionalDomainManager(10)
+	_ = rm.AddLink("alice", "editor", "domain1")
+	rm.AddDomainMatchingFunc("keyMatch4", util.KeyMatch4)
+	_ = rm.AddLink("alice", "admin", "*")
+	_ = rm.AddLink("bob", "admin", "/tenant/{id}")
+
+	testDomainRole(t, rm, "alice", "admin", "domain1", true)
+	testDomainRole(t, rm, "alice", "editor", "domain1", true)
+	testDomainRole(t, rm, "bob", "admin", "/tenant/1", true)
+	testDomainRole(t, rm, "bob", "admin", "domain1", false)
+
+	testPrintRolesWithDomain(t, rm, "alice", "domain1", []string{"admin", "editor"})
+	testPrintRolesWithDomain(t, rm, "alice", "domain2", []string{"admin"})
+	testPrintRolesWithDomain(t, rm, "bob", "/tenant/1", []string{"admin"})
+}
+
 func TestTemporaryRoles(t *testing.T) {
 	rm := NewRoleManager(10)
 	rm.AddMatchingFunc("regexMatch", util.RegexMatch)
@@ -386,3 +432,54 @@ func TestMaxHierarchyLevel(t *testing.T) {
 	testRole(t, rm, "level1", "level2", true)
 	testRole(t, rm, "level1", "level3", true)
 }
+
+func TestSyncedRoleManager(t *testing.T) {
+	rm := NewSyncedRoleManager(NewRoleManager(10))
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			_ = rm.AddLink(fmt.Sprintf("u%d", i), "g1", "domain1")
+			if i%25 == 0 {
+				_ = rm.Clear()
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			_, _ = rm.HasLink(fmt.Sprintf("u%d", i), "g1", "domain1")
+		}
+	}()
+	wg.Wait()
+
+	testDomainRole(t, rm, "u99", "g1", "domain1", true)
+	testDomainRole(t, rm, "u0", "g1", "domain1", false)
+	testDomainRole(t, rm, "u99", "g1", "domain2", false)
+}
+
+func TestSyncedRoleManagerRebuild(t *testing.T) {
+	rm := NewSyncedRoleManager(NewRoleManager(10))
+	rm.AddDomainMatchingFunc("keyMatch", util.KeyMatch)
+	_ = rm.AddLink("u1", "g1", "*")
+
+	err := rm.Rebuild(func(fresh rbac.RoleManager) error {
+		return fresh.AddLink("u2", "g1", "*")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testDomainRole(t, rm, "u1", "g1", "domain1", false)
+	testDomainRole(t, rm, "u2", "g1", "domain1", true)
+
+	err = rm.Rebuild(func(fresh rbac.RoleManager) error {
+		return errors.New("build failed")
+	})
+	if err == nil {
+		t.Error("rebuild should return the error of build")
+	}
+	testDomainRole(t, rm, "u2", "g1", "domain1", true)
+}
@@ -0,0 +1,186 @@
+// Copyright 2023 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package defaultrolemanager
+
+import (
+	"sync"
+
+	"github.com/ApicaSystem/casbin/v2/log"
+	"github.com/ApicaSystem/casbin/v2/rbac"
+)
+
+// SyncedRoleManager guards a RoleManager with a sync.RWMutex, so links can be added and deleted
+// while other goroutines check them, e.g. AddGroupingPolicy running concurrently with Enforce.
+type SyncedRoleManager struct {
+	rm rbac.RoleManager
+	m  sync.RWMutex
+}
+
+// NewSyncedRoleManager wraps rm into a SyncedRoleManager.
+func NewSyncedRoleManager(rm rbac.RoleManager) *SyncedRoleManager {
+	return &SyncedRoleManager{rm: rm}
+}
+
+// RoleManager returns the wrapped role manager.
+func (srm *SyncedRoleManager) RoleManager() rbac.RoleManager {
+	srm.m.RLock()
+	defer srm.m.RUnlock()
+	return srm.rm
+}
+
+// Rebuild rebuilds the links of the role manager from scratch with build, e.g. from the grouping policy. The
+// default role managers are rebuilt aside and swapped in once build succeeded, so concurrent readers keep seeing
+// the previous links instead of a partially built graph. Other role managers are cleared and rebuilt under the
+// write lock.
+func (srm *SyncedRoleManager) Rebuild(build func(rm rbac.RoleManager) error) error {
+	srm.m.RLock()
+	fresh := emptyCopy(srm.rm)
+	srm.m.RUnlock()
+
+	if fresh == nil {
+		srm.m.Lock()
+		defer srm.m.Unlock()
+		if err := srm.rm.Clear(); err != nil {
+			return err
+		}
+		return build(srm.rm)
+	}
+
+	if err := build(fresh); err != nil {
+		return err
+	}
+	srm.m.Lock()
+	srm.rm = fresh
+	srm.m.Unlock()
+	return nil
+}
+
+// emptyCopy returns a role manager without links but with the settings and matching functions of rm,
+// or nil if rm is not one of the default role managers.
+func emptyCopy(rm rbac.RoleManager) rbac.RoleManager {
+	switch rm := rm.(type) {
+	case *RoleManagerImpl:
+		c := NewRoleManagerImpl(rm.maxHierarchyLevel)
+		c.matchingFunc, c.domainMatchingFunc, c.logger = rm.matchingFunc, rm.domainMatchingFunc, rm.logger
+		return c
+	case *RoleManager:
+		c := NewRoleManager(rm.maxHierarchyLevel)
+		c.matchingFunc, c.domainMatchingFunc, c.logger = rm.matchingFunc, rm.domainMatchingFunc, rm.logger
+		return c
+	case *DomainManager:
+		c := NewDomainManager(rm.maxHierarchyLevel)
+		c.matchingFunc, c.domainMatchingFunc, c.logger = rm.matchingFunc, rm.domainMatchingFunc, rm.logger
+		return c
+	}
+	return nil
+}
+
+// Clear clears all stored data and resets the role manager to the initial state.
+func (srm *SyncedRoleManager) Clear() error {
+	srm.m.Lock()
+	defer srm.m.Unlock()
+	return srm.rm.Clear()
+}
+
+// AddLink adds the inheritance link between role: name1 and role: name2.
+func (srm *SyncedRoleManager) AddLink(name1 string, name2 string, domain ...string) error {
+	srm.m.Lock()
+	defer srm.m.Unlock()
+	return srm.rm.AddLink(name1, name2, domain...)
+}
+
+// BuildRelationship is no longer required.
+func (srm *SyncedRoleManager) BuildRelationship(name1 string, name2 string, domain ...string) error {
+	srm.m.Lock()
+	defer srm.m.Unlock()
+	return srm.rm.BuildRelationship(name1, name2, domain...)
+}
+
+// DeleteLink deletes the inheritance link between role: name1 and role: name2.
+func (srm *SyncedRoleManager) DeleteLink(name1 string, name2 string, domain ...string) error {
+	srm.m.Lock()
+	defer srm.m.Unlock()
+	return srm.rm.DeleteLink(name1, name2, domain...)
+}
+
+// HasLink determines whether role: name1 inherits role: name2.
+func (srm *SyncedRoleManager) HasLink(name1 string, name2 string, domain ...string) (bool, error) {
+	srm.m.RLock()
+	defer srm.m.RUnlock()
+	return srm.rm.HasLink(name1, name2, domain...)
+}
+
+// GetRoles gets the roles that a user inherits.
+func (srm *SyncedRoleManager) GetRoles(name string, domain ...string) ([]string, error) {
+	srm.m.RLock()
+	defer srm.m.RUnlock()
+	return srm.rm.GetRoles(name, domain...)
+}
+
+// GetUsers gets the users that inherits a role.
+func (srm *SyncedRoleManager) GetUsers(name string, domain ...string) ([]string, error) {
+	srm.m.RLock()
+	defer srm.m.RUnlock()
+	return srm.rm.GetUsers(name, domain...)
+}
+
+// GetDomains gets domains that a user has.
+func (srm *SyncedRoleManager) GetDomains(name string) ([]string, error) {
+	srm.m.RLock()
+	defer srm.m.RUnlock()
+	return srm.rm.GetDomains(name)
+}
+
+// GetAllDomains gets all domains.
+func (srm *SyncedRoleManager) GetAllDomains() ([]string, error) {
+	srm.m.RLock()
+	defer srm.m.RUnlock()
+	return srm.rm.GetAllDomains()
+}
+
+// PrintRoles prints all the roles to log.
+func (srm *SyncedRoleManager) PrintRoles() error {
+	srm.m.RLock()
+	defer srm.m.RUnlock()
+	return srm.rm.PrintRoles()
+}
+
+// SetLogger sets role manager's logger.
+func (srm *SyncedRoleManager) SetLogger(logger log.Logger) {
+	srm.m.Lock()
+	defer srm.m.Unlock()
+	srm.rm.SetLogger(logger)
+}
+
+// Match matches the domain with the pattern.
+func (srm *SyncedRoleManager) Match(str string, pattern string) bool {
+	srm.m.RLock()
+	defer srm.m.RUnlock()
+	return srm.rm.Match(str, pattern)
+}
+
+// AddMatchingFunc adds the matching function.
+func (srm *SyncedRoleManager) AddMatchingFunc(name string, fn rbac.MatchingFunc) {
+	srm.m.Lock()
+	defer srm.m.Unlock()
+	srm.rm.AddMatchingFunc(name, fn)
+}
+
+// AddDomainMatchingFunc adds the domain matching function.
+func (srm *SyncedRoleManager) AddDomainMatchingFunc(name string, fn rbac.MatchingFunc) {
+	srm.m.Lock()
+	defer srm.m.Unlock()
+	srm.rm.AddDomainMatchingFunc(name, fn)
+}
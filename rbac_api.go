@@ -16,10 +16,13 @@ package casbin
 
 import (
 	"fmt"
+	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/ApicaSystem/casbin/v2/constant"
 	"github.com/ApicaSystem/casbin/v2/errors"
+	"github.com/ApicaSystem/casbin/v2/rbac"
 	"github.com/ApicaSystem/casbin/v2/util"
 )
 
@@ -102,6 +105,33 @@ func (e *Enforcer) DeleteRolesForUser(user string, domain ...string) (bool, erro
 	return e.RemoveFilteredGroupingPolicy(0, args...)
 }
 
+// BulkDeleteRolesForUsers deletes all roles of the given users, e.g. when deprovisioning users in bulk.
+// The grouping rules of all users are removed with a single RemovePolicies call of the adapter, and the role
+// links are updated once, instead of once per user with DeleteRolesForUser.
+func (e *Enforcer) BulkDeleteRolesForUsers(users []string) error {
+	if _, err := e.model.GetAssertion("g", "g"); err != nil {
+		return err
+	}
+
+	userSet := make(map[string]struct{}, len(users))
+	for _, user := range users {
+		userSet[user] = struct{}{}
+	}
+
+	var rules [][]string
+	for _, rule := range e.model["g"]["g"].Policy {
+		if _, ok := userSet[rule[0]]; ok {
+			rules = append(rules, rule)
+		}
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+
+	_, err := e.RemoveGroupingPolicies(rules)
+	return err
+}
+
 // DeleteUser deletes a user.
 // Returns false if the user does not exist (aka not affected).
 func (e *Enforcer) DeleteUser(user string) (bool, error) {
@@ -184,6 +214,12 @@ func (e *Enforcer) GetPermissionsForUser(user string, domain ...string) ([][]str
 	return e.GetNamedPermissionsForUser("p", user, domain...)
 }
 
+// GetPoliciesForRole gets the "p" rules whose subject is the role, optionally inside a domain.
+// The members of the role and the roles it inherits are not expanded, see GetImplicitPermissionsForUser.
+func (e *Enforcer) GetPoliciesForRole(role string, domain ...string) ([][]string, error) {
+	return e.GetNamedPermissionsForUser("p", role, domain...)
+}
+
 // GetNamedPermissionsForUser gets permissions for a user or role by named policy.
 func (e *Enforcer) GetNamedPermissionsForUser(ptype string, user string, domain ...string) ([][]string, error) {
 	permission := make([][]string, 0)
@@ -283,6 +319,135 @@ func (e *Enforcer) GetNamedImplicitRolesForUser(ptype string, name string, domai
 	return res, nil
 }
 
+// ExplainRoleInheritance returns every chain of grouping policy rules through which a user has a role, each
+// path starting with the user and ending with the role. Paths do not visit a user or role twice and are sorted.
+// For example:
+// g, alice, role:admin
+// g, alice, role:editor
+// g, role:admin, role:user
+// g, role:editor, role:user
+//
+// ExplainRoleInheritance("alice", "role:user") will get:
+// [["alice", "role:admin", "role:user"], ["alice", "role:editor", "role:user"]].
+func (e *Enforcer) ExplainRoleInheritance(user string, role string, domain ...string) ([][]string, error) {
+	rm := e.GetRoleManager()
+	if rm == nil {
+		return nil, fmt.Errorf("role manager is not initialized")
+	}
+	return roleChains(rm, user, role, domain...)
+}
+
+// roleChains returns the paths from user to role in the role manager, see ExplainRoleInheritance.
+func roleChains(rm rbac.RoleManager, user string, role string, domain ...string) ([][]string, error) {
+	res := [][]string{}
+	path := []string{user}
+	onPath := map[string]bool{user: true}
+	var walk func(name string) error
+	walk = func(name string) error {
+		if name == role {
+			res = append(res, append([]string(nil), path...))
+			return nil
+		}
+		roles, err := rm.GetRoles(name, domain...)
+		if err != nil {
+			return err
+		}
+		sort.Strings(roles)
+		for _, r := range roles {
+			if onPath[r] {
+				continue
+			}
+			onPath[r] = true
+			path = append(path, r)
+			if err = walk(r); err != nil {
+				return err
+			}
+			path = path[:len(path)-1]
+			onPath[r] = false
+		}
+		return nil
+	}
+
+	if err := walk(user); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// FindUnusedRoles returns the roles, i.e. the targets of grouping policy rules, that no user has or that grant no
+// permission, directly or through the roles they inherit. Users are the names that are not roles themselves.
+// With a domain, only the roles, the users and the permissions inside the domain are considered, which is required
+// for a model with domains. The roles are sorted.
+// For example:
+// p, role:admin, data1, read
+// g, alice, role:admin
+// g, bob, role:auditor
+//
+// FindUnusedRoles() will get: ["role:auditor"], as it grants no permission.
+func (e *Enforcer) FindUnusedRoles(domain ...string) ([]string, error) {
+	if len(domain) > 1 {
+		return nil, errors.ErrDomainParameter
+	}
+	rm := e.GetRoleManager()
+	if rm == nil {
+		return nil, fmt.Errorf("role manager is not initialized")
+	}
+	g, err := e.model.GetAssertion("g", "g")
+	if err != nil {
+		return nil, err
+	}
+
+	roles := make(map[string]bool)
+	for _, rule := range g.Policy {
+		if len(domain) == 1 && (len(rule) < 3 || rule[2] != domain[0]) {
+			continue
+		}
+		roles[rule[1]] = true
+	}
+
+	res := []string{}
+	for role := range roles {
+		permissions, err := e.GetImplicitPermissionsForUser(role, domain...)
+		if err != nil {
+			return nil, err
+		}
+		hasUser := false
+		if len(permissions) > 0 {
+			if hasUser, err = hasImplicitUser(rm, role, roles, domain...); err != nil {
+				return nil, err
+			}
+		}
+		if !hasUser {
+			res = append(res, role)
+		}
+	}
+	sort.Strings(res)
+	return res, nil
+}
+
+// hasImplicitUser determines whether a name that is not one of the roles has the role, directly or through roles.
+func hasImplicitUser(rm rbac.RoleManager, role string, roles map[string]bool, domain ...string) (bool, error) {
+	visited := map[string]bool{role: true}
+	q := []string{role}
+	for len(q) > 0 {
+		members, err := rm.GetUsers(q[0], domain...)
+		if err != nil && err != errors.ErrNameNotFound {
+			return false, err
+		}
+		q = q[1:]
+		for _, member := range members {
+			if !roles[member] {
+				return true, nil
+			}
+			if !visited[member] {
+				visited[member] = true
+				q = append(q, member)
+			}
+		}
+	}
+	return false, nil
+}
+
 // GetImplicitUsersForRole gets implicit users for a role.
 func (e *Enforcer) GetImplicitUsersForRole(name string, domain ...string) ([]string, error) {
 	res := []string{}
@@ -453,6 +618,67 @@ func (e *Enforcer) GetNamedImplicitPermissionsForUser(ptype string, gtype string
 	return permission, nil
 }
 
+// GetImplicitPermissionsForUserWithResourceRoles gets implicit permissions for a user, expanding both the roles of
+// the user ("g") and the resource roles of the objects ("g2"), within a domain if one is given.
+// Every permission reachable through the roles of the user is returned, followed by a copy for each resource
+// inheriting its object, directly or transitively.
+// For example:
+// p, admin, domain1, data_group, write
+// g, alice, admin, domain1
+// g2, data1, data_group, domain1
+//
+// GetImplicitPermissionsForUserWithResourceRoles("alice", "domain1") will get:
+// [["admin", "domain1", "data_group", "write"], ["admin", "domain1", "data1", "write"]].
+func (e *Enforcer) GetImplicitPermissionsForUserWithResourceRoles(user string, domain ...string) ([][]string, error) {
+	permissions, err := e.GetNamedImplicitPermissionsForUser("p", "g", user, domain...)
+	if err != nil {
+		return nil, err
+	}
+	rm := e.GetNamedRoleManager("g2")
+	if rm == nil {
+		return nil, fmt.Errorf("role manager %s is not initialized", "g2")
+	}
+	objIndex, err := e.GetFieldIndex("p", constant.ObjectIndex)
+	if err != nil {
+		return nil, err
+	}
+	// Resource roles are only scoped to the domain if their definition has one.
+	var resourceDomain []string
+	if len(e.model["g"]["g2"].Tokens) > 2 {
+		resourceDomain = domain
+	}
+
+	res := make([][]string, 0, len(permissions))
+	seen := make(map[string]struct{}, len(permissions))
+	for _, permission := range permissions {
+		objects := []string{permission[objIndex]}
+		visited := map[string]struct{}{permission[objIndex]: {}}
+		for i := 0; i < len(objects); i++ {
+			resources, err := rm.GetUsers(objects[i], resourceDomain...)
+			if err != nil {
+				return nil, err
+			}
+			for _, resource := range resources {
+				if _, ok := visited[resource]; !ok {
+					visited[resource] = struct{}{}
+					objects = append(objects, resource)
+				}
+			}
+		}
+
+		for _, object := range objects {
+			rule := deepCopyPolicy(permission)
+			rule[objIndex] = object
+			key := strings.Join(rule, ",")
+			if _, ok := seen[key]; !ok {
+				seen[key] = struct{}{}
+				res = append(res, rule)
+			}
+		}
+	}
+	return res, nil
+}
+
 // GetImplicitUsersForPermission gets implicit users for a permission.
 // For example:
 // p, admin, data1, read
@@ -461,18 +687,28 @@ func (e *Enforcer) GetNamedImplicitPermissionsForUser(ptype string, gtype string
 //
 // GetImplicitUsersForPermission("data1", "read") will get: ["alice", "bob"].
 // Note: only users will be returned, roles (2nd arg in "g") will be excluded.
+// The candidates are the subjects of the policy and the members of the user roles, each is checked with Enforce,
+// so permissions inherited through resource roles are found as well. The user roles are the role definitions the
+// matcher calls with the request subject, e.g. g2 for g2(r.sub, p.sub), see subjectRoleTypes. The names grouped
+// by the other role definitions are resources, they are neither candidates nor excluded as roles.
 func (e *Enforcer) GetImplicitUsersForPermission(permission ...string) ([]string, error) {
 	pSubjects, err := e.GetAllSubjects()
 	if err != nil {
 		return nil, err
 	}
-	gInherit, err := e.model.GetValuesForFieldInPolicyAllTypes("g", 1)
-	if err != nil {
-		return nil, err
-	}
-	gSubjects, err := e.model.GetValuesForFieldInPolicyAllTypes("g", 0)
-	if err != nil {
-		return nil, err
+
+	var gInherit, gSubjects []string
+	for _, ptype := range e.subjectRoleTypes() {
+		inherit, err := e.model.GetValuesForFieldInPolicy("g", ptype, 1)
+		if err != nil {
+			return nil, err
+		}
+		subjects, err := e.model.GetValuesForFieldInPolicy("g", ptype, 0)
+		if err != nil {
+			return nil, err
+		}
+		gInherit = append(gInherit, inherit...)
+		gSubjects = append(gSubjects, subjects...)
 	}
 
 	subjects := append(pSubjects, gSubjects...)
@@ -496,6 +732,29 @@ func (e *Enforcer) GetImplicitUsersForPermission(permission ...string) ([]string
 	return res, nil
 }
 
+// subjectRoleTypes returns the role definitions the matcher calls with the request subject as the user, e.g. "g"
+// for g(r.sub, p.sub), leaving out the resource roles like g2 in g2(r.obj, p.obj).
+func (e *Enforcer) subjectRoleTypes() []string {
+	m, ok := e.model["m"]["m"]
+	if !ok {
+		return nil
+	}
+	r, ok := e.model["r"]["r"]
+	if !ok || len(r.Tokens) == 0 {
+		return nil
+	}
+
+	var ptypes []string
+	for ptype := range e.model["g"] {
+		call := regexp.MustCompile(`\b` + regexp.QuoteMeta(ptype) + `\(\s*` + regexp.QuoteMeta(r.Tokens[0]) + `\s*,`)
+		if call.MatchString(m.Value) {
+			ptypes = append(ptypes, ptype)
+		}
+	}
+	sort.Strings(ptypes)
+	return ptypes
+}
+
 // GetDomainsForUser gets all domains.
 func (e *Enforcer) GetDomainsForUser(user string) ([]string, error) {
 	var domains []string
@@ -567,21 +826,39 @@ func deepCopyPolicy(src []string) []string {
 // This error is returned because some data adapters' ORM return full table data by default
 // when they receive an empty condition, which tends to behave contrary to expectations.(e.g. GORM)
 // If you are using an adapter that does not behave like this, you can choose to ignore this error.
+//
+// 2. The obj and act fields are looked up by name, so the policy definition may order or extend them freely.
+// Without an obj or act field, the second or third field is used, e.g. sub_rule in p = sub, sub_rule, act.
+// Models without a role definition, like ABAC rule models, are supported as well, only the rules of the user apply then.
 func (e *Enforcer) GetAllowedObjectConditions(user string, action string, prefix string) ([]string, error) {
-	permissions, err := e.GetImplicitPermissionsForUser(user)
+	var permissions [][]string
+	var err error
+	if _, ok := e.model["g"]["g"]; ok {
+		permissions, err = e.GetImplicitPermissionsForUser(user)
+	} else {
+		permissions, err = e.GetPermissionsForUser(user)
+	}
 	if err != nil {
 		return nil, err
 	}
+	objIndex, err := e.GetFieldIndex("p", constant.ObjectIndex)
+	if err != nil {
+		objIndex = 1
+	}
+	actIndex, err := e.GetFieldIndex("p", constant.ActionIndex)
+	if err != nil {
+		actIndex = 2
+	}
 
 	var objectConditions []string
 	for _, policy := range permissions {
-		// policy {sub, obj, act}
-		if policy[2] == action {
-			if !strings.HasPrefix(policy[1], prefix) {
-				return nil, errors.ErrObjCondition
-			}
-			objectConditions = append(objectConditions, strings.TrimPrefix(policy[1], prefix))
+		if len(policy) <= objIndex || len(policy) <= actIndex || policy[actIndex] != action {
+			continue
+		}
+		if !strings.HasPrefix(policy[objIndex], prefix) {
+			return nil, errors.ErrObjCondition
 		}
+		objectConditions = append(objectConditions, strings.TrimPrefix(policy[objIndex], prefix))
 	}
 
 	if len(objectConditions) == 0 {
@@ -591,6 +868,49 @@ func (e *Enforcer) GetAllowedObjectConditions(user string, action string, prefix
 	return objectConditions, nil
 }
 
+// GetObjectsForUser gets the distinct objects a user has at least one permission for, directly or through the roles
+// the user inherits, in the order they first appear in the policy. If a domain is given, only the permissions
+// inside the domain are considered. Rules whose effect is deny do not grant a permission.
+// For example:
+// p, admin, data1, read
+// p, alice, data2, read
+// g, alice, admin
+//
+// GetObjectsForUser("alice") will get: ["data1", "data2"].
+func (e *Enforcer) GetObjectsForUser(user string, domain ...string) ([]string, error) {
+	var permissions [][]string
+	var err error
+	if _, ok := e.model["g"]["g"]; ok {
+		permissions, err = e.GetImplicitPermissionsForUser(user, domain...)
+	} else {
+		permissions, err = e.GetPermissionsForUser(user, domain...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	objIndex, err := e.GetFieldIndex("p", constant.ObjectIndex)
+	if err != nil {
+		objIndex = 1
+	}
+	eftIndex, err := e.GetFieldIndex("p", "eft")
+	if err != nil {
+		eftIndex = -1
+	}
+
+	objects := make([]string, 0)
+	seen := make(map[string]struct{})
+	for _, policy := range permissions {
+		if len(policy) <= objIndex || (eftIndex != -1 && len(policy) > eftIndex && policy[eftIndex] == "deny") {
+			continue
+		}
+		if _, ok := seen[policy[objIndex]]; !ok {
+			seen[policy[objIndex]] = struct{}{}
+			objects = append(objects, policy[objIndex])
+		}
+	}
+	return objects, nil
+}
+
 // removeDuplicatePermissions Convert permissions to string as a hash to deduplicate.
 func removeDuplicatePermissions(permissions [][]string) [][]string {
 	permissionsSet := make(map[string]bool)
@@ -714,3 +1034,95 @@ func (e *Enforcer) GetImplicitUsersForResourceByDomain(resource string, domain s
 	res := removeDuplicatePermissions(permissions)
 	return res, nil
 }
+
+// SuggestRolesForPermissions returns a minimal set of existing roles whose union covers all the given permissions,
+// e.g. [][]string{{"data1", "read"}, {"data2", "write"}}. A role covers a permission if enforcing the permission
+// with the role as subject is allowed, so inherited roles and matcher patterns are taken into account. The probes
+// are not decisions, so they skip the middlewares, the observer and the logger.
+// Returns an error if a permission is not covered by any role.
+// Finding a minimal cover takes exponential time in the worst case, it is meant for role design tooling.
+func (e *Enforcer) SuggestRolesForPermissions(permissions [][]string) ([]string, error) {
+	if len(permissions) == 0 {
+		return []string{}, nil
+	}
+	roles, err := e.GetAllRoles()
+	if err != nil {
+		return nil, err
+	}
+	util.ArrayRemoveDuplicates(&roles)
+	sort.Strings(roles)
+	decide, err := e.quietDecider()
+	if err != nil {
+		return nil, err
+	}
+
+	// covers[i][j] tells whether role i covers permission j.
+	covers := make([][]bool, len(roles))
+	for i := range roles {
+		covers[i] = make([]bool, len(permissions))
+	}
+	for j, permission := range permissions {
+		covered := false
+		for i, role := range roles {
+			allowed, err := decide(util.JoinSliceAny(role, permission...)...)
+			if err != nil {
+				return nil, err
+			}
+			covers[i][j] = allowed
+			covered = covered || allowed
+		}
+		if !covered {
+			return nil, fmt.Errorf("no role grants the permission %v", permission)
+		}
+	}
+
+	// Search covers of growing size, branching on the roles covering the first uncovered permission.
+	counts := make([]int, len(permissions))
+	var chosen []int
+	var search func(limit int) bool
+	search = func(limit int) bool {
+		uncovered := -1
+		for j, count := range counts {
+			if count == 0 {
+				uncovered = j
+				break
+			}
+		}
+		if uncovered == -1 {
+			return true
+		}
+		if len(chosen) == limit {
+			return false
+		}
+		for i := range roles {
+			if !covers[i][uncovered] {
+				continue
+			}
+			chosen = append(chosen, i)
+			for j := range permissions {
+				if covers[i][j] {
+					counts[j]++
+				}
+			}
+			if search(limit) {
+				return true
+			}
+			for j := range permissions {
+				if covers[i][j] {
+					counts[j]--
+				}
+			}
+			chosen = chosen[:len(chosen)-1]
+		}
+		return false
+	}
+	for limit := 1; !search(limit); limit++ {
+	}
+
+	res := make([]string, 0, len(chosen))
+	for _, i := range chosen {
+		res = append(res, roles[i])
+	}
+	sort.Strings(res)
+	return res, nil
+}
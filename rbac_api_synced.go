@@ -67,6 +67,13 @@ func (e *SyncedEnforcer) DeleteRolesForUser(user string, domain ...string) (bool
 	return e.Enforcer.DeleteRolesForUser(user, domain...)
 }
 
+// BulkDeleteRolesForUsers deletes all roles of the given users with a single adapter call.
+func (e *SyncedEnforcer) BulkDeleteRolesForUsers(users []string) error {
+	e.m.Lock()
+	defer e.m.Unlock()
+	return e.Enforcer.BulkDeleteRolesForUsers(users)
+}
+
 // DeleteUser deletes a user.
 // Returns false if the user does not exist (aka not affected).
 func (e *SyncedEnforcer) DeleteUser(user string) (bool, error) {
@@ -130,6 +137,13 @@ func (e *SyncedEnforcer) GetPermissionsForUser(user string, domain ...string) ([
 	return e.Enforcer.GetPermissionsForUser(user, domain...)
 }
 
+// GetPoliciesForRole gets the "p" rules whose subject is the role, optionally inside a domain.
+func (e *SyncedEnforcer) GetPoliciesForRole(role string, domain ...string) ([][]string, error) {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.GetPoliciesForRole(role, domain...)
+}
+
 // GetNamedPermissionsForUser gets permissions for a user or role by named policy.
 func (e *SyncedEnforcer) GetNamedPermissionsForUser(ptype string, user string, domain ...string) ([][]string, error) {
 	e.m.RLock()
@@ -173,6 +187,13 @@ func (e *SyncedEnforcer) GetImplicitPermissionsForUser(user string, domain ...st
 	return e.Enforcer.GetImplicitPermissionsForUser(user, domain...)
 }
 
+// GetObjectsForUser gets the distinct objects a user has at least one permission for, directly or through roles.
+func (e *SyncedEnforcer) GetObjectsForUser(user string, domain ...string) ([]string, error) {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.GetObjectsForUser(user, domain...)
+}
+
 // GetNamedImplicitPermissionsForUser gets implicit permissions for a user or role by named policy.
 // Compared to GetNamedPermissionsForUser(), this function retrieves permissions for inherited roles.
 // For example:
@@ -188,6 +209,14 @@ func (e *SyncedEnforcer) GetNamedImplicitPermissionsForUser(ptype string, gtype
 	return e.Enforcer.GetNamedImplicitPermissionsForUser(ptype, gtype, user, domain...)
 }
 
+// GetImplicitPermissionsForUserWithResourceRoles gets implicit permissions for a user, expanding both the roles of
+// the user ("g") and the resource roles of the objects ("g2"), within a domain if one is given.
+func (e *SyncedEnforcer) GetImplicitPermissionsForUserWithResourceRoles(user string, domain ...string) ([][]string, error) {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.GetImplicitPermissionsForUserWithResourceRoles(user, domain...)
+}
+
 // GetImplicitUsersForPermission gets implicit users for a permission.
 // For example:
 // p, admin, data1, read
@@ -201,3 +230,31 @@ func (e *SyncedEnforcer) GetImplicitUsersForPermission(permission ...string) ([]
 	defer e.m.RUnlock()
 	return e.Enforcer.GetImplicitUsersForPermission(permission...)
 }
+
+// SuggestRolesForPermissions returns a minimal set of existing roles whose union covers all the given permissions.
+func (e *SyncedEnforcer) SuggestRolesForPermissions(permissions [][]string) ([]string, error) {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.SuggestRolesForPermissions(permissions)
+}
+
+// GetRoleGraph builds the role inheritance graph of the "g" grouping policy, optionally restricted to a domain.
+func (e *SyncedEnforcer) GetRoleGraph(domain ...string) (*RoleGraph, error) {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.GetRoleGraph(domain...)
+}
+
+// ExplainRoleInheritance returns every chain of grouping policy rules through which a user has a role.
+func (e *SyncedEnforcer) ExplainRoleInheritance(user string, role string, domain ...string) ([][]string, error) {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.ExplainRoleInheritance(user, role, domain...)
+}
+
+// FindUnusedRoles returns the roles that no user has or that grant no permission.
+func (e *SyncedEnforcer) FindUnusedRoles(domain ...string) ([]string, error) {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.FindUnusedRoles(domain...)
+}
@@ -16,11 +16,16 @@ package casbin
 
 import (
 	"log"
+	"reflect"
 	"sort"
+	"strings"
 	"testing"
 
 	"github.com/ApicaSystem/casbin/v2/constant"
 	"github.com/ApicaSystem/casbin/v2/errors"
+	"github.com/ApicaSystem/casbin/v2/model"
+	fileadapter "github.com/ApicaSystem/casbin/v2/persist/file-adapter"
+	stringadapter "github.com/ApicaSystem/casbin/v2/persist/string-adapter"
 	"github.com/ApicaSystem/casbin/v2/util"
 )
 
@@ -229,6 +234,78 @@ func testGetNamedPermissionsForUser(t *testing.T, e *Enforcer, ptype string, nam
 	}
 }
 
+func TestGetPoliciesForRole(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
+
+	testPolicies := func(role string, res [][]string, domain ...string) {
+		t.Helper()
+		myRes, err := e.GetPoliciesForRole(role, domain...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !util.Array2DEquals(res, myRes) {
+			t.Errorf("Policies for %s: %v, supposed to be %v", role, myRes, res)
+		}
+	}
+
+	testPolicies("data2_admin", [][]string{{"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}})
+	// the membership of alice in data2_admin is not expanded.
+	testPolicies("alice", [][]string{{"alice", "data1", "read"}})
+	testPolicies("data1_admin", [][]string{})
+
+	e, _ = NewEnforcer("examples/rbac_with_domains_model.conf", "examples/rbac_with_domains_policy.csv")
+	testPolicies("admin", [][]string{{"admin", "domain2", "data2", "read"}, {"admin", "domain2", "data2", "write"}}, "domain2")
+	testPolicies("alice", [][]string{}, "domain1")
+}
+
+// mockRemoveAdapter records the RemovePolicies calls instead of writing the policy file.
+type mockRemoveAdapter struct {
+	mockSaveAdapter
+	removed [][][]string
+}
+
+func (a *mockRemoveAdapter) RemovePolicies(sec string, ptype string, rules [][]string) error {
+	a.removed = append(a.removed, rules)
+	return nil
+}
+
+func TestBulkDeleteRolesForUsers(t *testing.T) {
+	policy := `
+p, admin, data1, read
+g, alice, admin
+g, alice, data2_admin
+g, bob, admin
+g, carol, admin
+`
+	a := &mockRemoveAdapter{mockSaveAdapter: mockSaveAdapter{Adapter: fileadapter.NewAdapterFromReader(strings.NewReader(policy))}}
+	e, _ := NewEnforcer("examples/rbac_model.conf", a)
+
+	if err := e.BulkDeleteRolesForUsers([]string{"alice", "bob", "dave"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(a.removed) != 1 {
+		t.Fatalf("RemovePolicies called %d times, supposed to be once", len(a.removed))
+	}
+	removed := [][]string{{"alice", "admin"}, {"alice", "data2_admin"}, {"bob", "admin"}}
+	if !util.Array2DEquals(removed, a.removed[0]) {
+		t.Errorf("adapter removed %v, supposed to be %v", a.removed[0], removed)
+	}
+
+	testGetRoles(t, e, []string{}, "alice")
+	testGetRoles(t, e, []string{}, "bob")
+	testGetRoles(t, e, []string{"admin"}, "carol")
+	testEnforce(t, e, "alice", "data1", "read", false)
+	testEnforce(t, e, "carol", "data1", "read", true)
+
+	// users without roles do not reach the adapter.
+	if err := e.BulkDeleteRolesForUsers([]string{"alice", "dave"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(a.removed) != 1 {
+		t.Errorf("RemovePolicies called %d times, supposed to be once", len(a.removed))
+	}
+}
+
 func TestPermissionAPI(t *testing.T) {
 	e, _ := NewEnforcer("examples/basic_without_resources_model.conf", "examples/basic_without_resources_policy.csv")
 
@@ -354,6 +431,42 @@ func testGetNamedImplicitPermissions(t *testing.T, e *Enforcer, ptype string, gt
 	}
 }
 
+func testGetObjectsForUser(t *testing.T, e *Enforcer, res []string, user string, domain ...string) {
+	t.Helper()
+	myRes, err := e.GetObjectsForUser(user, domain...)
+	if err != nil {
+		t.Error(err)
+	}
+	t.Log("Objects for ", user, domain, ": ", myRes)
+
+	if !util.ArrayEquals(res, myRes) {
+		t.Error("Objects for ", user, domain, ": ", myRes, ", supposed to be ", res)
+	}
+}
+
+func TestGetObjectsForUser(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
+	testGetObjectsForUser(t, e, []string{"data1", "data2"}, "alice")
+	testGetObjectsForUser(t, e, []string{"data2"}, "bob")
+	testGetObjectsForUser(t, e, []string{}, "eve")
+
+	e, _ = NewEnforcer("examples/rbac_with_domains_model.conf", "examples/rbac_with_domains_policy.csv")
+	testGetObjectsForUser(t, e, []string{"data1"}, "alice", "domain1")
+	testGetObjectsForUser(t, e, []string{}, "alice", "domain2")
+	testGetObjectsForUser(t, e, []string{"data2"}, "bob", "domain2")
+
+	// deny rules do not grant a permission.
+	e, _ = NewEnforcer("examples/rbac_with_deny_model.conf", "examples/rbac_with_deny_policy.csv")
+	e.EnableAutoSave(false)
+	_, _ = e.AddPolicy("carol", "data3", "read", "deny")
+	testGetObjectsForUser(t, e, []string{"data1", "data2"}, "alice")
+	testGetObjectsForUser(t, e, []string{}, "carol")
+
+	// without a role definition, only the rules of the user apply.
+	e, _ = NewEnforcer("examples/basic_model.conf", "examples/basic_policy.csv")
+	testGetObjectsForUser(t, e, []string{"data1"}, "alice")
+}
+
 func TestImplicitPermissionAPI(t *testing.T) {
 	e, _ := NewEnforcer("examples/rbac_model.conf", "examples/rbac_with_hierarchy_policy.csv")
 
@@ -419,6 +532,49 @@ func TestImplicitUserAPI(t *testing.T) {
 	testGetImplicitUsers(t, e, []string{"alice", "bob"}, "data1", "read")
 }
 
+func TestImplicitUserAPIWithResourceRoles(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_with_resource_roles_model.conf", "examples/rbac_with_resource_roles_policy.csv")
+
+	testGetImplicitUsers(t, e, []string{"alice"}, "data1", "read")
+	// alice inherits the write permission on data_group, which data1 and data2 belong to.
+	testGetImplicitUsers(t, e, []string{"alice"}, "data1", "write")
+	testGetImplicitUsers(t, e, []string{"alice", "bob"}, "data2", "write")
+	testGetImplicitUsers(t, e, []string{}, "data2", "read")
+
+	// a user sharing the name of a resource role is still a user.
+	_, _ = e.AddPolicy("data_group", "data1", "read")
+	testGetImplicitUsers(t, e, []string{"alice", "data_group"}, "data1", "read")
+}
+
+func TestImplicitUserAPIWithSubjectRolesInG2(t *testing.T) {
+	m, _ := model.NewModelFromString(`
+[request_definition]
+r = sub, obj, act
+
+[policy_definition]
+p = sub, obj, act
+
+[role_definition]
+g = _, _
+g2 = _, _
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = g2(r.sub, p.sub) && g(r.obj, p.obj) && r.act == p.act
+`)
+	e, _ := NewEnforcer(m)
+	_, _ = e.AddPolicy("admin", "data_group", "read")
+	_, _ = e.AddPolicy("bob", "data_group", "read")
+	_, _ = e.AddNamedGroupingPolicy("g2", "alice", "admin")
+	_, _ = e.AddGroupingPolicy("data1", "data_group")
+
+	// g2 groups the users and g the resources, so alice is found and admin is excluded as a role.
+	testGetImplicitUsers(t, e, []string{"alice", "bob"}, "data1", "read")
+	testGetImplicitUsers(t, e, []string{}, "data1", "write")
+}
+
 func testGetImplicitResourcesForUser(t *testing.T, e *Enforcer, res [][]string, user string, domain ...string) {
 	t.Helper()
 	myRes, _ := e.GetImplicitResourcesForUser(user, domain...)
@@ -467,6 +623,50 @@ func TestGetImplicitResourcesForUser(t *testing.T) {
 	}, "cathy")
 }
 
+func TestGetImplicitPermissionsForUserWithResourceRoles(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_with_domains_and_resource_roles_model.conf", "examples/rbac_with_domains_and_resource_roles_policy.csv")
+
+	res := [][]string{
+		{"alice", "domain1", "data5", "read"},
+		{"admin", "domain1", "data_group", "write"},
+		{"admin", "domain1", "data1", "write"},
+		{"admin", "domain1", "data2", "write"},
+		{"admin", "domain1", "data_subgroup", "write"},
+		{"admin", "domain1", "data3", "write"},
+		{"reader", "domain1", "data_group", "read"},
+		{"reader", "domain1", "data1", "read"},
+		{"reader", "domain1", "data2", "read"},
+		{"reader", "domain1", "data_subgroup", "read"},
+		{"reader", "domain1", "data3", "read"},
+	}
+	myRes, err := e.GetImplicitPermissionsForUserWithResourceRoles("alice", "domain1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every reachable permission is granted by the enforcer.
+	for _, rule := range myRes {
+		testDomainEnforce(t, e, "alice", rule[1], rule[2], rule[3], true)
+	}
+	testDomainEnforce(t, e, "alice", "domain1", "data4", "write", false)
+	if !util.Set2DEquals(res, myRes) {
+		t.Errorf("implicit permissions for alice in domain1: %v, supposed to be %v", myRes, res)
+	}
+
+	myRes, err = e.GetImplicitPermissionsForUserWithResourceRoles("bob", "domain2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res = [][]string{{"admin", "domain2", "data_group", "write"}, {"admin", "domain2", "data4", "write"}}
+	if !util.Set2DEquals(res, myRes) {
+		t.Errorf("implicit permissions for bob in domain2: %v, supposed to be %v", myRes, res)
+	}
+
+	e, _ = NewEnforcer("examples/rbac_with_domains_model.conf", "examples/rbac_with_domains_policy.csv")
+	if _, err = e.GetImplicitPermissionsForUserWithResourceRoles("alice", "domain1"); err == nil {
+		t.Error("resource roles should be required")
+	}
+}
+
 func TestImplicitUsersForRole(t *testing.T) {
 	e, _ := NewEnforcer("examples/rbac_with_pattern_model.conf", "examples/rbac_with_pattern_policy.csv")
 
@@ -512,6 +712,44 @@ func TestExplicitPriorityModify(t *testing.T) {
 	testEnforce(t, e, "bob", "data2", "write", false)
 }
 
+func TestNormalizePriorityOrder(t *testing.T) {
+	shuffled := stringadapter.NewAdapter(`
+p, 1, bob, data2, read, deny
+p, 10, data2_allow_group, data2, write, allow
+p, 1, alice, data1, read, allow
+p, 10, data1_deny_group, data1, write, deny
+p, 10, data2_allow_group, data2, read, allow
+p, 1, alice, data1, write, allow
+p, 10, data1_deny_group, data1, read, deny
+g, bob, data2_allow_group
+g, alice, data1_deny_group`)
+	e, _ := NewEnforcer("examples/priority_model_explicit.conf", "examples/priority_policy_explicit.csv")
+	e2, _ := NewEnforcer("examples/priority_model_explicit.conf", shuffled)
+	for _, sub := range []string{"alice", "bob"} {
+		for _, obj := range []string{"data1", "data2"} {
+			for _, act := range []string{"read", "write"} {
+				res, _ := e.Enforce(sub, obj, act)
+				testEnforce(t, e2, sub, obj, act, res)
+			}
+		}
+	}
+
+	// updating the priority of a rule keeps its position until the order is normalized.
+	e.EnableAutoSave(false)
+	_, _ = e.UpdatePolicy([]string{"1", "alice", "data1", "read", "allow"}, []string{"20", "alice", "data1", "read", "allow"})
+	testEnforce(t, e, "alice", "data1", "read", true)
+	if err := e.NormalizePriorityOrder(); err != nil {
+		t.Fatalf("NormalizePriorityOrder: %v", err)
+	}
+	testEnforce(t, e, "alice", "data1", "read", false)
+	testEnforce(t, e, "alice", "data1", "write", true)
+
+	policy, _ := e.GetPolicy()
+	if policy[len(policy)-1][0] != "20" {
+		t.Errorf("the rule with the lowest priority should be last, got %v", policy)
+	}
+}
+
 func TestCustomizedFieldIndex(t *testing.T) {
 	e, _ := NewEnforcer("examples/priority_model_explicit_customized.conf",
 		"examples/priority_policy_explicit_customized.csv")
@@ -604,6 +842,40 @@ func TestGetAllowedObjectConditions(t *testing.T) {
 	}
 }
 
+func TestGetAllowedObjectConditionsABAC(t *testing.T) {
+	m, _ := model.NewModelFromString(`
+[request_definition]
+r = sub, obj, act
+
+[policy_definition]
+p = sub, act, obj
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = r.sub == p.sub && r.act == p.act && eval(p.obj)
+`)
+	e, _ := NewEnforcer(m)
+	_, _ = e.AddPolicies([][]string{
+		{"alice", "read", "r.obj.Owner == 'alice'"},
+		{"alice", "read", "r.obj.Name == 'data3'"},
+		{"bob", "read", "r.obj.Owner == 'bob'"},
+		{"bob", "write", "r.sub == 'bob'"},
+	})
+
+	testGetAllowedObjectConditions(t, e, "alice", "read", "r.obj.", []string{"Owner == 'alice'", "Name == 'data3'"}, nil)
+	testGetAllowedObjectConditions(t, e, "bob", "read", "r.obj.", []string{"Owner == 'bob'"}, nil)
+	testGetAllowedObjectConditions(t, e, "alice", "write", "r.obj.", nil, errors.ErrEmptyCondition)
+	// the condition on the subject cannot be pushed down to the objects.
+	testGetAllowedObjectConditions(t, e, "bob", "write", "r.obj.", nil, errors.ErrObjCondition)
+
+	// the conditions select the objects the enforcer allows.
+	testEnforce(t, e, "alice", newTestResource("data1", "alice"), "read", true)
+	testEnforce(t, e, "alice", newTestResource("data2", "bob"), "read", false)
+	testEnforce(t, e, "alice", newTestResource("data3", "bob"), "read", true)
+}
+
 func testGetImplicitUsersForResource(t *testing.T, e *Enforcer, res [][]string, resource string, domain ...string) {
 	t.Helper()
 	myRes, err := e.GetImplicitUsersForResource(resource)
@@ -657,3 +929,181 @@ func TestGetImplicitUsersForResourceByDomain(t *testing.T) {
 	testGetImplicitUsersForResourceByDomain(t, e, [][]string{{"bob", "domain2", "data2", "read"},
 		{"bob", "domain2", "data2", "write"}}, "data2", "domain2")
 }
+
+func TestSuggestRolesForPermissions(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_model.conf", "examples/rbac_with_hierarchy_policy.csv")
+
+	testSuggestRoles := func(permissions [][]string, res []string) {
+		t.Helper()
+		myRes, err := e.SuggestRolesForPermissions(permissions)
+		if err != nil {
+			t.Error(err)
+		}
+		if !util.ArrayEquals(myRes, res) {
+			t.Errorf("Suggested roles for %v: %v, supposed to be %v", permissions, myRes, res)
+		}
+	}
+
+	testSuggestRoles([][]string{{"data1", "write"}}, []string{"admin"})
+	// admin inherits both data1_admin and data2_admin, so it covers the permissions alone.
+	testSuggestRoles([][]string{{"data1", "write"}, {"data2", "read"}}, []string{"admin"})
+
+	_, _ = e.RemoveGroupingPolicy("alice", "admin")
+	testSuggestRoles([][]string{{"data1", "read"}}, []string{"data1_admin"})
+	testSuggestRoles([][]string{{"data1", "write"}, {"data2", "read"}}, []string{"data1_admin", "data2_admin"})
+	testSuggestRoles([][]string{}, []string{})
+
+	if _, err := e.SuggestRolesForPermissions([][]string{{"data1", "read"}, {"data3", "read"}}); err == nil {
+		t.Error("SuggestRolesForPermissions should fail for a permission no role grants")
+	}
+
+	// The probes are not decisions, so the hooks must not see them.
+	obs := &countingObserver{}
+	e.SetEnforceObserver(obs)
+	calls := 0
+	e.Use(func(next EnforceFunc) EnforceFunc {
+		return func(rvals ...interface{}) (bool, error) {
+			calls++
+			return next(rvals...)
+		}
+	})
+	testSuggestRoles([][]string{{"data1", "read"}}, []string{"data1_admin"})
+	if obs.n != 0 || calls != 0 {
+		t.Errorf("probes reached the hooks: %d observations, %d middleware calls", obs.n, calls)
+	}
+}
+
+func TestGetRoleGraph(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_model.conf", "examples/rbac_with_hierarchy_policy.csv")
+	e.EnableAutoSave(false)
+	// A cycle must not make the walk loop forever.
+	_, _ = e.AddGroupingPolicy("data2_admin", "alice")
+
+	graph, err := e.GetRoleGraph()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !util.ArrayEquals(graph.Nodes, []string{"alice", "admin", "data1_admin", "data2_admin"}) {
+		t.Errorf("nodes: %v", graph.Nodes)
+	}
+	if len(graph.Edges) != 4 || graph.Edges[0] != (RoleEdge{From: "alice", To: "admin"}) {
+		t.Errorf("edges: %v", graph.Edges)
+	}
+	if res := graph.Ancestors("admin"); !util.ArrayEquals(res, []string{"data1_admin", "data2_admin", "alice"}) {
+		t.Errorf("ancestors of admin: %v", res)
+	}
+	if res := graph.Descendants("data1_admin"); !util.ArrayEquals(res, []string{"admin", "alice", "data2_admin"}) {
+		t.Errorf("descendants of data1_admin: %v", res)
+	}
+	if res := graph.Ancestors("bob"); len(res) != 0 {
+		t.Errorf("ancestors of bob: %v", res)
+	}
+	if _, err = e.GetRoleGraph("domain1"); err == nil {
+		t.Error("a domain should be rejected without a domain in the role definition")
+	}
+
+	e, _ = NewEnforcer("examples/rbac_with_domains_model.conf", "examples/rbac_with_hierarchy_with_domains_policy.csv")
+	e.EnableAutoSave(false)
+	_, _ = e.AddRoleForUserInDomain("bob", "role:reader", "domain2")
+
+	graph, err = e.GetRoleGraph("domain1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(graph.Edges) != 3 {
+		t.Errorf("edges in domain1: %v", graph.Edges)
+	}
+	if res := graph.Ancestors("alice"); !util.SetEquals(res, []string{"role:global_admin", "role:reader", "role:writer"}) {
+		t.Errorf("ancestors of alice in domain1: %v", res)
+	}
+	if res := graph.Descendants("role:reader"); !util.ArrayEquals(res, []string{"role:global_admin", "alice"}) {
+		t.Errorf("descendants of role:reader in domain1: %v", res)
+	}
+
+	graph, _ = e.GetRoleGraph()
+	if res := graph.Descendants("role:reader"); !util.SetEquals(res, []string{"role:global_admin", "alice", "bob"}) {
+		t.Errorf("descendants of role:reader in all domains: %v", res)
+	}
+}
+
+func TestExplainRoleInheritance(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_model.conf", "examples/rbac_with_hierarchy_policy.csv")
+	e.EnableAutoSave(false)
+	_, _ = e.AddGroupingPolicies([][]string{
+		{"alice", "data1_admin"},
+		{"data1_admin", "admin"},
+	})
+
+	testExplain := func(user string, role string, res [][]string, domain ...string) {
+		t.Helper()
+		myRes, err := e.ExplainRoleInheritance(user, role, domain...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(myRes, res) {
+			t.Errorf("paths from %s to %s: %v, supposed to be %v", user, role, myRes, res)
+		}
+	}
+
+	testExplain("alice", "data2_admin", [][]string{
+		{"alice", "admin", "data2_admin"},
+		{"alice", "data1_admin", "admin", "data2_admin"},
+	})
+	testExplain("alice", "data1_admin", [][]string{
+		{"alice", "admin", "data1_admin"},
+		{"alice", "data1_admin"},
+	})
+	testExplain("alice", "alice", [][]string{{"alice"}})
+	testExplain("bob", "admin", [][]string{})
+
+	e, _ = NewEnforcer("examples/rbac_with_domains_model.conf", "examples/rbac_with_hierarchy_with_domains_policy.csv")
+	testExplain("alice", "role:reader", [][]string{{"alice", "role:global_admin", "role:reader"}}, "domain1")
+	testExplain("alice", "role:reader", [][]string{}, "domain2")
+}
+
+func TestFindUnusedRoles(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_model.conf")
+	_, _ = e.AddPolicies([][]string{
+		{"role:admin", "data1", "read"},
+		{"role:reader", "data2", "read"},
+		{"role:orphan", "data3", "read"},
+	})
+	_, _ = e.AddGroupingPolicies([][]string{
+		{"alice", "role:admin"},
+		{"role:admin", "role:reader"},
+		{"bob", "role:auditor"},
+		// role:orphan and role:nested only have each other as members.
+		{"role:nested", "role:orphan"},
+		{"role:orphan", "role:nested"},
+	})
+
+	testUnused := func(res []string, domain ...string) {
+		t.Helper()
+		myRes, err := e.FindUnusedRoles(domain...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(myRes, res) {
+			t.Errorf("unused roles: %v, supposed to be %v", myRes, res)
+		}
+	}
+
+	// role:auditor grants nothing, nobody has role:orphan and role:nested.
+	testUnused([]string{"role:auditor", "role:nested", "role:orphan"})
+
+	_, _ = e.AddRoleForUser("carol", "role:nested")
+	_, _ = e.AddPolicy("role:auditor", "logs", "read")
+	testUnused([]string{})
+
+	_, _ = e.DeleteRoleForUser("carol", "role:nested")
+	testUnused([]string{"role:nested", "role:orphan"})
+
+	e, _ = NewEnforcer("examples/rbac_with_domains_model.conf", "examples/rbac_with_domains_policy.csv")
+	e.EnableAutoSave(false)
+	_, _ = e.AddRoleForUserInDomain("carol", "auditor", "domain1")
+	testUnused([]string{"auditor"}, "domain1")
+	testUnused([]string{}, "domain2")
+	if _, err := e.FindUnusedRoles("domain1", "domain2"); err == nil {
+		t.Error("more than one domain should be rejected")
+	}
+}
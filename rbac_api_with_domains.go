@@ -16,25 +16,99 @@ package casbin
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/ApicaSystem/casbin/v2/constant"
+	"github.com/ApicaSystem/casbin/v2/model"
+	"github.com/ApicaSystem/casbin/v2/util"
 )
 
 // GetUsersForRoleInDomain gets the users that has a role inside a domain. Add by Gordon.
+// Matching functions registered with AddNamedMatchingFunc and AddNamedDomainMatchingFunc are honored,
+// so users granted a role pattern or a domain pattern matching the role and the domain are included.
+// With EnableDomainGlob, a domain containing glob metacharacters gets the users of the role in all matching domains.
 func (e *Enforcer) GetUsersForRoleInDomain(name string, domain string) []string {
 	if e.GetRoleManager() == nil {
 		return nil
 	}
-	res, _ := e.GetRoleManager().GetUsers(name, domain)
-	return res
+	return e.collectInDomains(domain, func(d string) ([]string, error) {
+		return e.GetRoleManager().GetUsers(name, d)
+	})
+}
+
+// GetUsersForRoleInDomains gets the users that have a role directly inside any of the domains, in the order their
+// grouping rules are found. The grouping policy is scanned once, whatever the number of domains, and matching
+// functions are not applied.
+func (e *Enforcer) GetUsersForRoleInDomains(role string, domains []string) ([]string, error) {
+	g, err := e.model.GetAssertion("g", "g")
+	if err != nil {
+		return nil, err
+	}
+	if len(g.Tokens) < 3 {
+		return nil, fmt.Errorf("the role definition %s has no domain", g.Key)
+	}
+
+	domainSet := make(map[string]struct{}, len(domains))
+	for _, domain := range domains {
+		domainSet[domain] = struct{}{}
+	}
+	users := make([]string, 0)
+	seen := make(map[string]struct{})
+	for _, rule := range g.Policy {
+		if len(rule) < 3 || rule[1] != role {
+			continue
+		}
+		if _, ok := domainSet[rule[2]]; !ok {
+			continue
+		}
+		if _, ok := seen[rule[0]]; !ok {
+			seen[rule[0]] = struct{}{}
+			users = append(users, rule[0])
+		}
+	}
+	return users, nil
 }
 
 // GetRolesForUserInDomain gets the roles that a user has inside a domain.
+// With EnableDomainGlob, a domain containing glob metacharacters gets the roles of the user in all matching domains.
 func (e *Enforcer) GetRolesForUserInDomain(name string, domain string) []string {
 	if e.GetRoleManager() == nil {
 		return nil
 	}
-	res, _ := e.GetRoleManager().GetRoles(name, domain)
+	return e.collectInDomains(domain, func(d string) ([]string, error) {
+		return e.GetRoleManager().GetRoles(name, d)
+	})
+}
+
+// collectInDomains calls get for the domain, or for every domain of the role manager matching it when it is a glob,
+// and returns the distinct names in the order they are first found.
+func (e *Enforcer) collectInDomains(domain string, get func(domain string) ([]string, error)) []string {
+	if !e.domainGlob || !isDomainGlob(domain) {
+		res, _ := get(domain)
+		return res
+	}
+
+	domains, err := e.GetRoleManager().GetAllDomains()
+	if err != nil {
+		return nil
+	}
+	sort.Strings(domains)
+
+	var res []string
+	seen := make(map[string]struct{})
+	for _, d := range domains {
+		if ok, _ := util.GlobMatch(d, domain); !ok {
+			continue
+		}
+		names, _ := get(d)
+		for _, name := range names {
+			if _, ok := seen[name]; !ok {
+				seen[name] = struct{}{}
+				res = append(res, name)
+			}
+		}
+	}
 	return res
 }
 
@@ -44,6 +118,157 @@ func (e *Enforcer) GetPermissionsForUserInDomain(user string, domain string) [][
 	return res
 }
 
+// PermissionWithEffect is a permission rule along with its effect, see GetPermissionsForUserInDomainWithEffect.
+type PermissionWithEffect struct {
+	Rule []string
+	// Effect is the value of the "eft" field of the rule, "allow" if the policy definition has none.
+	Effect string
+}
+
+// GetPermissionsForUserInDomainWithEffect gets the permissions of a user or role inside a domain, directly or through
+// roles, like GetPermissionsForUserInDomain, along with their effect, so that deny rules can be told from grants.
+// An empty domain gets the permissions of all domains: those of the role manager and of the policy rules for a
+// model with domains, or all permissions for a model without domains.
+func (e *Enforcer) GetPermissionsForUserInDomainWithEffect(user string, domain string) ([]PermissionWithEffect, error) {
+	var permissions [][]string
+	var err error
+	if domainIndex, indexErr := e.GetFieldIndex("p", constant.DomainIndex); domain == "" && indexErr == nil {
+		permissions, err = e.getPermissionsInAllDomains(user, domainIndex)
+	} else if domain != "" {
+		permissions, err = e.GetImplicitPermissionsForUser(user, domain)
+	} else {
+		permissions, err = e.GetImplicitPermissionsForUser(user)
+	}
+	if err != nil {
+		return nil, err
+	}
+	eftIndex, err := e.GetFieldIndex("p", "eft")
+	if err != nil {
+		eftIndex = -1
+	}
+
+	res := make([]PermissionWithEffect, 0, len(permissions))
+	for _, rule := range permissions {
+		effect := "allow"
+		if eftIndex != -1 && eftIndex < len(rule) {
+			effect = rule[eftIndex]
+		}
+		res = append(res, PermissionWithEffect{Rule: append([]string(nil), rule...), Effect: effect})
+	}
+	return res, nil
+}
+
+// getPermissionsInAllDomains gets the implicit permissions of a user in every domain of the role manager and of
+// the policy rules, in sorted domain order and without duplicates.
+func (e *Enforcer) getPermissionsInAllDomains(user string, domainIndex int) ([][]string, error) {
+	domainSet := make(map[string]struct{})
+	if rm := e.GetRoleManager(); rm != nil {
+		if domains, err := rm.GetAllDomains(); err == nil {
+			for _, d := range domains {
+				domainSet[d] = struct{}{}
+			}
+		}
+	}
+	for _, rule := range e.model["p"]["p"].Policy {
+		if domainIndex < len(rule) {
+			domainSet[rule[domainIndex]] = struct{}{}
+		}
+	}
+	domains := make([]string, 0, len(domainSet))
+	for d := range domainSet {
+		domains = append(domains, d)
+	}
+	sort.Strings(domains)
+
+	var res [][]string
+	seen := make(map[string]struct{})
+	for _, d := range domains {
+		permissions, err := e.GetImplicitPermissionsForUser(user, d)
+		if err != nil {
+			return nil, err
+		}
+		for _, rule := range permissions {
+			key := strings.Join(rule, model.DefaultSep)
+			if _, ok := seen[key]; !ok {
+				seen[key] = struct{}{}
+				res = append(res, rule)
+			}
+		}
+	}
+	return res, nil
+}
+
+// GetPermissionsForRoleInDomain gets the permission rules granted directly to a role inside a domain, i.e. the rules
+// whose subject is the role and whose domain is the domain. Roles inherited by the role are not followed,
+// see GetImplicitPermissionsForUserInDomain.
+func (e *Enforcer) GetPermissionsForRoleInDomain(role string, domain string) ([][]string, error) {
+	if _, err := e.GetFieldIndex("p", constant.DomainIndex); err != nil {
+		return nil, err
+	}
+	return e.GetNamedPermissionsForUser("p", role, domain)
+}
+
+// GetImplicitPermissionsForUserInDomain gets the permissions reachable for a user inside a domain, directly or through
+// roles. Only the roles the user has inside the domain are followed, and only rules of that domain (or of domains
+// matching it with a domain matching function) are returned, so roles held in other domains do not bleed through.
+func (e *Enforcer) GetImplicitPermissionsForUserInDomain(user string, domain string) ([][]string, error) {
+	if _, err := e.GetFieldIndex("p", constant.DomainIndex); err != nil {
+		return nil, err
+	}
+	return e.GetNamedImplicitPermissionsForUser("p", "g", user, domain)
+}
+
+// HasPermissionForUserInDomains determines whether a user has a permission inside any of the given domains.
+// It stops at the first domain in which the permission is found and returns that domain as well.
+func (e *Enforcer) HasPermissionForUserInDomains(user string, domains []string, permission ...string) (bool, string, error) {
+	domainIndex, err := e.GetFieldIndex("p", constant.DomainIndex)
+	if err != nil {
+		return false, "", err
+	}
+	subIndex, err := e.GetFieldIndex("p", constant.SubjectIndex)
+	if err != nil {
+		subIndex = 0
+	}
+	if domainIndex >= len(permission)+2 || subIndex >= len(permission)+2 {
+		return false, "", nil
+	}
+
+	for _, domain := range domains {
+		rule := make([]string, 0, len(permission)+2)
+		rest := permission
+		for i := 0; i < len(permission)+2; i++ {
+			switch i {
+			case subIndex:
+				rule = append(rule, user)
+			case domainIndex:
+				rule = append(rule, domain)
+			default:
+				rule = append(rule, rest[0])
+				rest = rest[1:]
+			}
+		}
+
+		ok, err := e.model.HasPolicy("p", "p", rule)
+		if err != nil {
+			return false, "", err
+		}
+		if ok {
+			return true, domain, nil
+		}
+	}
+
+	return false, "", nil
+}
+
+// GetAllPermissionsInDomain gets all permission rules scoped to a domain, regardless of the user or role they grant.
+func (e *Enforcer) GetAllPermissionsInDomain(domain string) ([][]string, error) {
+	index, err := e.GetFieldIndex("p", constant.DomainIndex)
+	if err != nil {
+		return nil, err
+	}
+	return e.GetFilteredPolicy(index, domain)
+}
+
 // AddRoleForUserInDomain adds a role for a user inside a domain.
 // Returns false if the user already has the role (aka not affected).
 func (e *Enforcer) AddRoleForUserInDomain(user string, role string, domain string) (bool, error) {
@@ -75,6 +300,21 @@ func (e *Enforcer) DeleteRolesForUserInDomain(user string, domain string) (bool,
 	return e.RemoveGroupingPolicies(rules)
 }
 
+// RemoveRolesForUserInAllDomains deletes all roles for a user in every domain the user has roles in.
+// The roles are removed with a single filtered removal, so the adapter and the role links are only updated once.
+func (e *Enforcer) RemoveRolesForUserInAllDomains(user string) error {
+	domains, err := e.GetDomainsForUser(user)
+	if err != nil {
+		return err
+	}
+	if len(domains) == 0 {
+		return nil
+	}
+
+	_, err = e.RemoveFilteredGroupingPolicy(0, user)
+	return err
+}
+
 // GetAllUsersByDomain would get all users associated with the domain.
 func (e *Enforcer) GetAllUsersByDomain(domain string) ([]string, error) {
 	m := make(map[string]struct{})
@@ -108,7 +348,10 @@ func (e *Enforcer) GetAllUsersByDomain(domain string) ([]string, error) {
 	return users, nil
 }
 
-// DeleteAllUsersByDomain would delete all users associated with the domain.
+// DeleteAllUsersByDomain would delete all users associated with the domain. The "g" rules of the domain are
+// removed first, then its "p" rules, each with a single call to the adapter, and the watcher is notified once both
+// are removed. If removing the "p" rules fails, the "g" rules are restored in memory only, so the enforcer is left
+// as it was.
 func (e *Enforcer) DeleteAllUsersByDomain(domain string) (bool, error) {
 	g, err := e.model.GetAssertion("g", "g")
 	if err != nil {
@@ -133,13 +376,34 @@ func (e *Enforcer) DeleteAllUsersByDomain(domain string) (bool, error) {
 		return res
 	}
 
-	users := getUser(2, g.Policy, domain)
-	if _, err = e.RemoveGroupingPolicies(users); err != nil {
-		return false, err
+	groupingRules := getUser(2, g.Policy, domain)
+	rules := getUser(index, p.Policy, domain)
+	if len(groupingRules) != 0 {
+		if _, err = e.removePoliciesWithoutNotify("g", "g", groupingRules); err != nil {
+			return false, err
+		}
 	}
-	users = getUser(index, p.Policy, domain)
-	if _, err = e.RemovePolicies(users); err != nil {
-		return false, err
+	if len(rules) != 0 {
+		if _, err = e.removePoliciesWithoutNotify("p", "p", rules); err != nil {
+			if len(groupingRules) != 0 {
+				autoSave := e.autoSave
+				e.autoSave = false
+				_, _ = e.addPoliciesWithoutNotify("g", "g", groupingRules, false)
+				e.autoSave = autoSave
+			}
+			return false, err
+		}
+	}
+
+	if len(groupingRules) != 0 {
+		if err = e.notifyRemovePolicies("g", "g", groupingRules); err != nil {
+			return false, err
+		}
+	}
+	if len(rules) != 0 {
+		if err = e.notifyRemovePolicies("p", "p", rules); err != nil {
+			return false, err
+		}
 	}
 	return true, nil
 }
@@ -159,6 +423,12 @@ func (e *Enforcer) DeleteDomains(domains ...string) (bool, error) {
 	return true, nil
 }
 
+// DeleteDomain deletes all the role inheritance rules and permission rules of a domain, see DeleteAllUsersByDomain.
+func (e *Enforcer) DeleteDomain(domain string) error {
+	_, err := e.DeleteAllUsersByDomain(domain)
+	return err
+}
+
 // GetAllDomains would get all domains.
 func (e *Enforcer) GetAllDomains() ([]string, error) {
 	if e.GetRoleManager() == nil {
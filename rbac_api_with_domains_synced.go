@@ -21,6 +21,13 @@ func (e *SyncedEnforcer) GetUsersForRoleInDomain(name string, domain string) []s
 	return e.Enforcer.GetUsersForRoleInDomain(name, domain)
 }
 
+// GetUsersForRoleInDomains gets the users that have a role directly inside any of the domains.
+func (e *SyncedEnforcer) GetUsersForRoleInDomains(role string, domains []string) ([]string, error) {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.GetUsersForRoleInDomains(role, domains)
+}
+
 // GetRolesForUserInDomain gets the roles that a user has inside a domain.
 func (e *SyncedEnforcer) GetRolesForUserInDomain(name string, domain string) []string {
 	e.m.RLock()
@@ -35,6 +42,41 @@ func (e *SyncedEnforcer) GetPermissionsForUserInDomain(user string, domain strin
 	return e.Enforcer.GetPermissionsForUserInDomain(user, domain)
 }
 
+// GetPermissionsForUserInDomainWithEffect gets the permissions of a user or role inside a domain along with their effect.
+func (e *SyncedEnforcer) GetPermissionsForUserInDomainWithEffect(user string, domain string) ([]PermissionWithEffect, error) {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.GetPermissionsForUserInDomainWithEffect(user, domain)
+}
+
+// GetPermissionsForRoleInDomain gets the permission rules granted directly to a role inside a domain.
+func (e *SyncedEnforcer) GetPermissionsForRoleInDomain(role string, domain string) ([][]string, error) {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.GetPermissionsForRoleInDomain(role, domain)
+}
+
+// GetImplicitPermissionsForUserInDomain gets the permissions reachable for a user inside a domain, directly or through roles.
+func (e *SyncedEnforcer) GetImplicitPermissionsForUserInDomain(user string, domain string) ([][]string, error) {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.GetImplicitPermissionsForUserInDomain(user, domain)
+}
+
+// HasPermissionForUserInDomains determines whether a user has a permission inside any of the given domains.
+func (e *SyncedEnforcer) HasPermissionForUserInDomains(user string, domains []string, permission ...string) (bool, string, error) {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.HasPermissionForUserInDomains(user, domains, permission...)
+}
+
+// GetAllPermissionsInDomain gets all permission rules scoped to a domain, regardless of the user or role they grant.
+func (e *SyncedEnforcer) GetAllPermissionsInDomain(domain string) ([][]string, error) {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.GetAllPermissionsInDomain(domain)
+}
+
 // AddRoleForUserInDomain adds a role for a user inside a domain.
 // Returns false if the user already has the role (aka not affected).
 func (e *SyncedEnforcer) AddRoleForUserInDomain(user string, role string, domain string) (bool, error) {
@@ -58,3 +100,17 @@ func (e *SyncedEnforcer) DeleteRolesForUserInDomain(user string, domain string)
 	defer e.m.Unlock()
 	return e.Enforcer.DeleteRolesForUserInDomain(user, domain)
 }
+
+// RemoveRolesForUserInAllDomains deletes all roles for a user in every domain the user has roles in.
+func (e *SyncedEnforcer) RemoveRolesForUserInAllDomains(user string) error {
+	e.m.Lock()
+	defer e.m.Unlock()
+	return e.Enforcer.RemoveRolesForUserInAllDomains(user)
+}
+
+// DeleteDomain deletes all the role inheritance rules and permission rules of a domain.
+func (e *SyncedEnforcer) DeleteDomain(domain string) error {
+	e.m.Lock()
+	defer e.m.Unlock()
+	return e.Enforcer.DeleteDomain(domain)
+}
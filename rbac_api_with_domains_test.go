@@ -15,9 +15,14 @@
 package casbin
 
 import (
+	"errors"
+	"reflect"
 	"sort"
 	"testing"
 
+	"github.com/ApicaSystem/casbin/v2/model"
+	fileadapter "github.com/ApicaSystem/casbin/v2/persist/file-adapter"
+	"github.com/ApicaSystem/casbin/v2/rbac"
 	"github.com/ApicaSystem/casbin/v2/util"
 )
 
@@ -52,6 +57,98 @@ func TestGetImplicitRolesForDomainUser(t *testing.T) {
 	testGetImplicitRolesInDomain(t, e, "alice", "domain1", []string{"role:global_admin", "role:reader", "role:writer"})
 }
 
+func TestGetRolesForUserInDomainWithPattern(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_with_domain_pattern_model.conf", "examples/rbac_with_domain_pattern_policy.csv")
+	e.AddNamedDomainMatchingFunc("g", "KeyMatch4", util.KeyMatch4)
+
+	testGetRolesInDomain(t, e, "alice", "domain1", []string{"admin"})
+	testGetRolesInDomain(t, e, "alice", "domain2", []string{"admin"})
+	testGetRolesInDomain(t, e, "bob", "domain1", []string{})
+	testGetRolesInDomain(t, e, "bob", "domain2", []string{"admin"})
+
+	_, _ = e.AddRoleForUserInDomain("alice", "editor", "domain1")
+	_, _ = e.AddRoleForUserInDomain("carol", "reader", "/tenant/{id}")
+	_, _ = e.AddRoleForUserInDomain("carol", "writer", "/tenant/1")
+
+	testGetRolesInDomain(t, e, "alice", "domain1", []string{"admin", "editor"})
+	testGetRolesInDomain(t, e, "carol", "/tenant/1", []string{"reader", "writer"})
+	testGetRolesInDomain(t, e, "carol", "/tenant/2", []string{"reader"})
+	testGetRolesInDomain(t, e, "carol", "domain1", []string{})
+	testGetUsersInDomain(t, e, "reader", "/tenant/2", []string{"carol"})
+}
+
+func TestGetUsersForRoleInDomainWithPattern(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_with_domains_model.conf", "examples/rbac_with_domains_policy.csv")
+	e.EnableAutoSave(false)
+
+	testGetUsersInDomain(t, e, "admin", "domain1", []string{"alice"})
+	testGetUsersInDomain(t, e, "admin", "domain2", []string{"bob"})
+
+	_, _ = e.AddRoleForUserInDomain("carol", "admin*", "domain*")
+	_, _ = e.AddRoleForUserInDomain("dave", "admin", "*")
+
+	// Without matching functions the patterns are plain names.
+	testGetUsersInDomain(t, e, "admin", "domain1", []string{"alice"})
+	testGetUsersInDomain(t, e, "admin*", "domain*", []string{"carol"})
+
+	e.AddNamedMatchingFunc("g", "keyMatch", util.KeyMatch)
+	e.AddNamedDomainMatchingFunc("g", "keyMatch", util.KeyMatch)
+
+	testGetUsersInDomain(t, e, "admin", "domain1", []string{"alice", "carol", "dave"})
+	testGetUsersInDomain(t, e, "admin", "domain2", []string{"bob", "carol", "dave"})
+	testGetUsersInDomain(t, e, "admin2", "domain1", []string{"carol"})
+	testGetUsersInDomain(t, e, "admin", "other", []string{"dave"})
+	testGetUsersInDomain(t, e, "reader", "domain1", []string{})
+}
+
+func TestGetRolesForUserInConditionalDomainWithPattern(t *testing.T) {
+	m, _ := model.NewModelFromString(`
+[request_definition]
+r = sub, dom, obj, act
+
+[policy_definition]
+p = sub, dom, obj, act
+
+[role_definition]
+g = _, _, _, (_, _)
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = g(r.sub, p.sub, r.dom) && keyMatch4(r.dom, p.dom) && r.obj == p.obj && r.act == p.act
+`)
+	e, _ := NewEnforcer(m)
+	_, _ = e.AddPolicy("reader", "/tenant/{id}", "data1", "read")
+	_, _ = e.AddGroupingPolicies([][]string{
+		{"alice", "reader", "/tenant/{id}", "_", "_"},
+		{"alice", "writer", "/tenant/1", "_", "_"},
+	})
+	if !e.AddNamedDomainMatchingFunc("g", "KeyMatch4", util.KeyMatch4) {
+		t.Fatal("the domain matching function was not added to the conditional role manager")
+	}
+
+	// The domain APIs only see the plain role managers, so the conditional one is queried directly.
+	crm := e.condRmMap["g"]
+	testRoles := func(get func(name string, domains ...string) ([]string, error), name, domain string, res []string) {
+		t.Helper()
+		myRes, err := get(name, domain)
+		if err != nil {
+			t.Error(err)
+		}
+		if !util.SetEquals(myRes, res) {
+			t.Errorf("%s under %s: %v, supposed to be %v", name, domain, myRes, res)
+		}
+	}
+	testRoles(crm.GetRoles, "alice", "/tenant/1", []string{"reader", "writer"})
+	testRoles(crm.GetRoles, "alice", "/tenant/2", []string{"reader"})
+	testRoles(crm.GetRoles, "alice", "domain1", []string{})
+	testRoles(crm.GetUsers, "reader", "/tenant/2", []string{"alice"})
+
+	testDomainEnforce(t, e, "alice", "/tenant/2", "data1", "read", true)
+	testDomainEnforce(t, e, "alice", "domain1", "data1", "read", false)
+}
+
 // TestUserAPIWithDomains: Add by Gordon.
 func TestUserAPIWithDomains(t *testing.T) {
 	e, _ := NewEnforcer("examples/rbac_with_domains_model.conf", "examples/rbac_with_domains_policy.csv")
@@ -84,6 +181,38 @@ func TestUserAPIWithDomains(t *testing.T) {
 	testGetUsersInDomain(t, e, "non_exist", "domain2", []string{})
 }
 
+func testGetUsersInDomains(t *testing.T, e *Enforcer, role string, domains []string, res []string) {
+	t.Helper()
+	myRes, err := e.GetUsersForRoleInDomains(role, domains)
+	if err != nil {
+		t.Error(err)
+	}
+	t.Log("Users for ", role, " under ", domains, ": ", myRes)
+
+	if !util.ArrayEquals(res, myRes) {
+		t.Error("Users for ", role, " under ", domains, ": ", myRes, ", supposed to be ", res)
+	}
+}
+
+func TestGetUsersForRoleInDomains(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_with_domains_model.conf", "examples/rbac_with_domains_policy.csv")
+	e.EnableAutoSave(false)
+	_, _ = e.AddRoleForUserInDomain("carol", "admin", "domain2")
+	_, _ = e.AddRoleForUserInDomain("bob", "admin", "domain1")
+
+	testGetUsersInDomains(t, e, "admin", []string{"domain1"}, []string{"alice", "bob"})
+	testGetUsersInDomains(t, e, "admin", []string{"domain1", "domain2"}, []string{"alice", "bob", "carol"})
+	testGetUsersInDomains(t, e, "admin", []string{"domain2", "domain3"}, []string{"bob", "carol"})
+	testGetUsersInDomains(t, e, "admin", []string{"domain3"}, []string{})
+	testGetUsersInDomains(t, e, "admin", nil, []string{})
+	testGetUsersInDomains(t, e, "non_exist", []string{"domain1", "domain2"}, []string{})
+
+	e, _ = NewEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
+	if _, err := e.GetUsersForRoleInDomains("data2_admin", []string{"domain1"}); err == nil {
+		t.Error("GetUsersForRoleInDomains should fail without domains in the role definition")
+	}
+}
+
 func TestRoleAPIWithDomains(t *testing.T) {
 	e, _ := NewEnforcer("examples/rbac_with_domains_model.conf", "examples/rbac_with_domains_policy.csv")
 
@@ -190,6 +319,199 @@ func TestPermissionAPIInDomain(t *testing.T) {
 	testGetPermissionsInDomain(t, e, "non_exist", "domain2", [][]string{})
 }
 
+func TestGetAllPermissionsInDomain(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_with_domains_model.conf", "examples/rbac_with_domains_policy.csv")
+
+	permissions, err := e.GetAllPermissionsInDomain("domain1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !util.Array2DEquals([][]string{{"admin", "domain1", "data1", "read"}, {"admin", "domain1", "data1", "write"}}, permissions) {
+		t.Error("Permissions in domain1: ", permissions)
+	}
+
+	permissions, _ = e.GetAllPermissionsInDomain("domain3")
+	if len(permissions) != 0 {
+		t.Error("Permissions in domain3: ", permissions)
+	}
+}
+
+func TestGDomainFunction(t *testing.T) {
+	m, _ := model.NewModelFromString(`
+[request_definition]
+r = sub, role
+
+[policy_definition]
+p = sub, dom, obj, act
+
+[role_definition]
+g = _, _, _
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = gDomain(r.sub, r.role) == "domain1"
+`)
+	e, _ := NewEnforcer(m, fileadapter.NewAdapter("examples/rbac_with_domains_policy.csv"))
+
+	testGDomain := func(sub string, role string, res string) {
+		t.Helper()
+		myRes, err := util.GenerateGDomainFunction(e.GetRoleManager())(sub, role)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if myRes != res {
+			t.Errorf("gDomain(%s, %s) = %v, supposed to be %s", sub, role, myRes, res)
+		}
+	}
+
+	testGDomain("alice", "admin", "domain1")
+	testGDomain("bob", "admin", "domain2")
+	testGDomain("alice", "user", "")
+
+	if ok, err := e.Enforce("alice", "admin"); !ok || err != nil {
+		t.Errorf("alice is admin in domain1: %t, %v", ok, err)
+	}
+	if ok, _ := e.Enforce("bob", "admin"); ok {
+		t.Error("bob is admin in domain2 only")
+	}
+
+	// the domains are listed once per generated function, and again once the role links changed.
+	rm := &countingDomainsRoleManager{RoleManager: e.GetRoleManager()}
+	gDomain := util.GenerateGDomainFunction(rm)
+	for _, sub := range []string{"alice", "bob", "carol"} {
+		if _, err := gDomain(sub, "admin"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if rm.calls != 1 {
+		t.Errorf("GetAllDomains called %d times, supposed to be once", rm.calls)
+	}
+	if _, err := e.AddGroupingPolicy("carol", "admin", "domain1"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := e.Enforce("carol", "admin"); !ok || err != nil {
+		t.Errorf("carol is admin in domain1: %t, %v", ok, err)
+	}
+}
+
+// countingDomainsRoleManager counts the GetAllDomains calls.
+type countingDomainsRoleManager struct {
+	rbac.RoleManager
+	calls int
+}
+
+func (rm *countingDomainsRoleManager) GetAllDomains() ([]string, error) {
+	rm.calls++
+	return rm.RoleManager.GetAllDomains()
+}
+
+func TestDomainGlob(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_with_domains_model.conf", "examples/rbac_with_domains_policy.csv")
+
+	// Without the option, the domain is matched literally.
+	policy, _ := e.GetFilteredPolicy(1, "domain*")
+	if len(policy) != 0 {
+		t.Errorf("GetFilteredPolicy(1, domain*) = %v, supposed to be empty", policy)
+	}
+
+	e.EnableDomainGlob(true)
+	policy, err := e.GetFilteredPolicy(1, "domain*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testPolicy, _ := e.GetPolicy()
+	if !util.Array2DEquals(testPolicy, policy) {
+		t.Errorf("GetFilteredPolicy(1, domain*) = %v, supposed to be %v", policy, testPolicy)
+	}
+
+	policy, _ = e.GetFilteredPolicy(1, "domain*", "data2")
+	if !util.Array2DEquals([][]string{{"admin", "domain2", "data2", "read"}, {"admin", "domain2", "data2", "write"}}, policy) {
+		t.Errorf("GetFilteredPolicy(1, domain*, data2) = %v", policy)
+	}
+
+	policy, _ = e.GetFilteredPolicy(0, "admin", "domain[2-9]")
+	if !util.Array2DEquals([][]string{{"admin", "domain2", "data2", "read"}, {"admin", "domain2", "data2", "write"}}, policy) {
+		t.Errorf("GetFilteredPolicy(0, admin, domain[2-9]) = %v", policy)
+	}
+
+	policy, _ = e.GetFilteredGroupingPolicy(1, "admin", "domain*")
+	if !util.Array2DEquals([][]string{{"alice", "admin", "domain1"}, {"bob", "admin", "domain2"}}, policy) {
+		t.Errorf("GetFilteredGroupingPolicy(1, admin, domain*) = %v", policy)
+	}
+
+	// A literal domain is still matched exactly.
+	policy, _ = e.GetFilteredGroupingPolicy(2, "domain1")
+	if !util.Array2DEquals([][]string{{"alice", "admin", "domain1"}}, policy) {
+		t.Errorf("GetFilteredGroupingPolicy(2, domain1) = %v", policy)
+	}
+
+	if users := e.GetUsersForRoleInDomain("admin", "domain*"); !util.ArrayEquals([]string{"alice", "bob"}, users) {
+		t.Errorf("GetUsersForRoleInDomain(admin, domain*) = %v, supposed to be [alice bob]", users)
+	}
+	if roles := e.GetRolesForUserInDomain("bob", "domain*"); !util.ArrayEquals([]string{"admin"}, roles) {
+		t.Errorf("GetRolesForUserInDomain(bob, domain*) = %v, supposed to be [admin]", roles)
+	}
+	if roles := e.GetRolesForUserInDomain("bob", "domain1"); len(roles) != 0 {
+		t.Errorf("GetRolesForUserInDomain(bob, domain1) = %v, supposed to be empty", roles)
+	}
+}
+
+func TestGetPermissionsForRoleInDomain(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_with_domains_model.conf", "examples/rbac_with_hierarchy_with_domains_policy.csv")
+
+	testPermissions := func(role string, domain string, res [][]string) {
+		t.Helper()
+		myRes, err := e.GetPermissionsForRoleInDomain(role, domain)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !util.Array2DEquals(res, myRes) {
+			t.Errorf("Permissions for %s in %s: %v, supposed to be %v", role, domain, myRes, res)
+		}
+	}
+
+	testPermissions("role:reader", "domain1", [][]string{{"role:reader", "domain1", "data1", "read"}})
+	testPermissions("role:writer", "domain1", [][]string{{"role:writer", "domain1", "data1", "write"}})
+	// permissions of inherited roles are not included.
+	testPermissions("role:global_admin", "domain1", [][]string{})
+	testPermissions("role:reader", "domain2", [][]string{})
+
+	e, _ = NewEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
+	if _, err := e.GetPermissionsForRoleInDomain("data2_admin", "domain1"); err == nil {
+		t.Error("a model without domains should be rejected")
+	}
+}
+
+func TestGetImplicitPermissionsForUserInDomain(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_with_domains_model.conf", "examples/rbac_with_hierarchy_with_domains_policy.csv")
+
+	testGetImplicitPermissionsInDomain := func(name string, domain string, res [][]string) {
+		t.Helper()
+		myRes, err := e.GetImplicitPermissionsForUserInDomain(name, domain)
+		if err != nil {
+			t.Errorf("GetImplicitPermissionsForUserInDomain returned an error: %v", err)
+		}
+		if !util.Set2DEquals(res, myRes) {
+			t.Error("Implicit permissions for", name, "under", domain, ":", myRes, ", supposed to be ", res)
+		}
+	}
+
+	testGetImplicitPermissionsInDomain("alice", "domain1", [][]string{{"alice", "domain1", "data2", "read"}, {"role:reader", "domain1", "data1", "read"}, {"role:writer", "domain1", "data1", "write"}})
+	testGetImplicitPermissionsInDomain("alice", "domain2", [][]string{{"alice", "domain2", "data2", "read"}})
+
+	// a role granted in domain2 does not carry the permissions it has in domain1.
+	_, _ = e.AddRoleForUserInDomain("bob", "role:writer", "domain2")
+	testGetImplicitPermissionsInDomain("bob", "domain2", [][]string{})
+	testGetImplicitPermissionsInDomain("bob", "domain1", [][]string{})
+
+	e, _ = NewEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
+	if _, err := e.GetImplicitPermissionsForUserInDomain("alice", "domain1"); err == nil {
+		t.Error("GetImplicitPermissionsForUserInDomain should fail for a model without domains")
+	}
+}
+
 func testGetDomainsForUser(t *testing.T, e *Enforcer, res []string, user string) {
 	t.Helper()
 	myRes, _ := e.GetDomainsForUser(user)
@@ -202,6 +524,30 @@ func testGetDomainsForUser(t *testing.T, e *Enforcer, res []string, user string)
 	}
 }
 
+func testHasPermissionInDomains(t *testing.T, e *Enforcer, name string, domains []string, permission []string, res bool, resDomain string) {
+	t.Helper()
+	myRes, myDomain, err := e.HasPermissionForUserInDomains(name, domains, permission...)
+	if err != nil {
+		t.Errorf("HasPermissionForUserInDomains returned an error: %v", err)
+	}
+	t.Log(name, " has permission ", permission, " in ", domains, ": ", myRes, " (", myDomain, ")")
+
+	if myRes != res || myDomain != resDomain {
+		t.Error(name, " has permission ", permission, " in ", domains, ": ", myRes, " (", myDomain, "), supposed to be ", res, " (", resDomain, ")")
+	}
+}
+
+func TestHasPermissionForUserInDomains(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_with_domains_model.conf", "examples/rbac_with_domains_policy.csv")
+
+	testHasPermissionInDomains(t, e, "admin", []string{"domain1", "domain2"}, []string{"data1", "read"}, true, "domain1")
+	testHasPermissionInDomains(t, e, "admin", []string{"domain2", "domain1"}, []string{"data2", "write"}, true, "domain2")
+	testHasPermissionInDomains(t, e, "admin", []string{"domain2"}, []string{"data1", "read"}, false, "")
+	testHasPermissionInDomains(t, e, "admin", []string{}, []string{"data1", "read"}, false, "")
+	testHasPermissionInDomains(t, e, "alice", []string{"domain1", "domain2"}, []string{"data1", "read"}, false, "")
+	testHasPermissionInDomains(t, e, "admin", []string{"domain1"}, []string{"data1"}, false, "")
+}
+
 func TestGetDomainsForUser(t *testing.T) {
 	e, _ := NewEnforcer("examples/rbac_with_domains_model.conf", "examples/rbac_with_domains_policy2.csv")
 
@@ -210,6 +556,29 @@ func TestGetDomainsForUser(t *testing.T) {
 	testGetDomainsForUser(t, e, []string{"domain3"}, "user")
 }
 
+func TestRemoveRolesForUserInAllDomains(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_with_domains_model.conf", "examples/rbac_with_domains_policy2.csv")
+
+	if err := e.RemoveRolesForUserInAllDomains("bob"); err != nil {
+		t.Fatal(err)
+	}
+	testGetDomainsForUser(t, e, []string{}, "bob")
+	testGetRolesInDomain(t, e, "bob", "domain2", []string{})
+	testGetRolesInDomain(t, e, "bob", "domain3", []string{})
+	testDomainEnforce(t, e, "bob", "domain2", "data2", "read", false)
+	testDomainEnforce(t, e, "bob", "domain3", "data2", "read", false)
+
+	// Other users keep their roles.
+	testGetDomainsForUser(t, e, []string{"domain1", "domain2"}, "alice")
+	testDomainEnforce(t, e, "alice", "domain2", "data2", "read", true)
+
+	// A user without roles is a no-op.
+	if err := e.RemoveRolesForUserInAllDomains("bob"); err != nil {
+		t.Fatal(err)
+	}
+	testGetGroupingPolicy(t, e, [][]string{{"alice", "admin", "domain1"}, {"alice", "admin", "domain2"}})
+}
+
 func testGetAllUsersByDomain(t *testing.T, e *Enforcer, domain string, expected []string) {
 	users, _ := e.GetAllUsersByDomain(domain)
 	if !util.SetEquals(users, expected) {
@@ -260,6 +629,130 @@ func TestDeleteAllUsersByDomain(t *testing.T) {
 	})
 }
 
+func TestGetPermissionsForUserInDomainWithEffect(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_with_deny_model.conf", "examples/rbac_with_deny_policy.csv")
+	permissions, err := e.GetPermissionsForUserInDomainWithEffect("alice", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []PermissionWithEffect{
+		{Rule: []string{"alice", "data1", "read", "allow"}, Effect: "allow"},
+		{Rule: []string{"data2_admin", "data2", "read", "allow"}, Effect: "allow"},
+		{Rule: []string{"data2_admin", "data2", "write", "allow"}, Effect: "allow"},
+		{Rule: []string{"alice", "data2", "write", "deny"}, Effect: "deny"},
+	}
+	if !reflect.DeepEqual(permissions, expected) {
+		t.Errorf("permissions of alice: %v, supposed to be %v", permissions, expected)
+	}
+
+	// without an eft field, the rules allow.
+	e, _ = NewEnforcer("examples/rbac_with_domains_model.conf", "examples/rbac_with_domains_policy.csv")
+	permissions, err = e.GetPermissionsForUserInDomainWithEffect("alice", "domain1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []PermissionWithEffect{
+		{Rule: []string{"admin", "domain1", "data1", "read"}, Effect: "allow"},
+		{Rule: []string{"admin", "domain1", "data1", "write"}, Effect: "allow"},
+	}
+	if !reflect.DeepEqual(permissions, expected) {
+		t.Errorf("permissions of alice in domain1: %v, supposed to be %v", permissions, expected)
+	}
+	if permissions, _ = e.GetPermissionsForUserInDomainWithEffect("alice", "domain2"); len(permissions) != 0 {
+		t.Errorf("permissions of alice in domain2: %v, supposed to be none", permissions)
+	}
+
+	// an empty domain gets the permissions of all domains.
+	_, _ = e.AddPolicy("alice", "domain3", "data3", "read")
+	permissions, err = e.GetPermissionsForUserInDomainWithEffect("alice", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []PermissionWithEffect{
+		{Rule: []string{"admin", "domain1", "data1", "read"}, Effect: "allow"},
+		{Rule: []string{"admin", "domain1", "data1", "write"}, Effect: "allow"},
+		{Rule: []string{"alice", "domain3", "data3", "read"}, Effect: "allow"},
+	}
+	if !reflect.DeepEqual(permissions, expected) {
+		t.Errorf("permissions of alice in all domains: %v, supposed to be %v", permissions, expected)
+	}
+
+	// the rules are copies.
+	permissions[0].Rule[0] = "changed"
+	if ok, _ := e.HasPolicy("admin", "domain1", "data1", "read"); !ok {
+		t.Error("changing a returned rule should not change the policy")
+	}
+}
+
+// mockFailingRemoveAdapter fails RemovePolicies calls for failPType.
+type mockFailingRemoveAdapter struct {
+	mockRemoveAdapter
+	failPType string
+	added     [][]string
+}
+
+func (a *mockFailingRemoveAdapter) AddPolicies(sec string, ptype string, rules [][]string) error {
+	a.added = append(a.added, rules...)
+	return nil
+}
+
+func (a *mockFailingRemoveAdapter) RemovePolicies(sec string, ptype string, rules [][]string) error {
+	if ptype == a.failPType {
+		return errors.New("remove failed")
+	}
+	return a.mockRemoveAdapter.RemovePolicies(sec, ptype, rules)
+}
+
+func TestDeleteDomain(t *testing.T) {
+	a := &mockRemoveAdapter{mockSaveAdapter: mockSaveAdapter{Adapter: fileadapter.NewAdapter("examples/rbac_with_domains_policy.csv")}}
+	e, _ := NewEnforcer("examples/rbac_with_domains_model.conf", a)
+
+	if err := e.DeleteDomain("domain1"); err != nil {
+		t.Fatal(err)
+	}
+	removed := [][][]string{
+		{{"alice", "admin", "domain1"}},
+		{{"admin", "domain1", "data1", "read"}, {"admin", "domain1", "data1", "write"}},
+	}
+	if !reflect.DeepEqual(a.removed, removed) {
+		t.Errorf("adapter removed %v, supposed to be %v", a.removed, removed)
+	}
+	testGetPolicy(t, e, [][]string{{"admin", "domain2", "data2", "read"}, {"admin", "domain2", "data2", "write"}})
+	testGetGroupingPolicy(t, e, [][]string{{"bob", "admin", "domain2"}})
+	testGetRolesInDomain(t, e, "alice", "domain1", []string{})
+	testDomainEnforce(t, e, "alice", "domain1", "data1", "read", false)
+	testDomainEnforce(t, e, "bob", "domain2", "data2", "read", true)
+
+	// an unknown domain is a no-op.
+	if err := e.DeleteDomain("domain3"); err != nil {
+		t.Fatal(err)
+	}
+	if len(a.removed) != 2 {
+		t.Errorf("RemovePolicies called %d times, supposed to be twice", len(a.removed))
+	}
+
+	// if the permission rules cannot be removed, the domain is kept as it was.
+	f := &mockFailingRemoveAdapter{failPType: "p"}
+	f.Adapter = fileadapter.NewAdapter("examples/rbac_with_domains_policy.csv")
+	e, _ = NewEnforcer("examples/rbac_with_domains_model.conf", f)
+	w := &SampleWatcher{}
+	_ = e.SetWatcher(w)
+	updates := 0
+	w.callback = func(string) { updates++ }
+	if err := e.DeleteDomain("domain1"); err == nil {
+		t.Error("DeleteDomain should fail when the adapter fails")
+	}
+	// the rules are restored without adapter writes or watcher notifications.
+	if len(f.added) != 0 || updates != 0 {
+		t.Errorf("the rollback added %v to the adapter and notified the watcher %d times", f.added, updates)
+	}
+	if rules, _ := e.GetGroupingPolicy(); !util.SortedArray2DEquals(rules, [][]string{{"alice", "admin", "domain1"}, {"bob", "admin", "domain2"}}) {
+		t.Errorf("grouping policy after a failed DeleteDomain: %v", rules)
+	}
+	testGetRolesInDomain(t, e, "alice", "domain1", []string{"admin"})
+	testDomainEnforce(t, e, "alice", "domain1", "data1", "read", true)
+}
+
 // testGetAllDomains tests GetAllDomains().
 func testGetAllDomains(t *testing.T, e *Enforcer, res []string) {
 	t.Helper()
@@ -0,0 +1,111 @@
+// Copyright 2023 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casbin
+
+import (
+	"errors"
+	"strings"
+)
+
+// RoleEdge is a role inheritance link of a RoleGraph: From inherits the role To.
+// Condition holds the parameters of the link condition function of a conditional role definition, if any.
+type RoleEdge struct {
+	From      string
+	To        string
+	Condition string
+}
+
+// RoleGraph is the role inheritance graph built from the grouping policy by GetRoleGraph.
+// Nodes are the users and roles in the order they first appear.
+type RoleGraph struct {
+	Nodes []string
+	Edges []RoleEdge
+
+	roles map[string][]string
+	users map[string][]string
+}
+
+// GetRoleGraph builds the role inheritance graph of the "g" grouping policy. If a domain is given, only the links
+// of that domain are included, otherwise the links of all domains are merged into a single graph.
+func (e *Enforcer) GetRoleGraph(domain ...string) (*RoleGraph, error) {
+	ast, err := e.model.GetAssertion("g", "g")
+	if err != nil {
+		return nil, err
+	}
+	if len(domain) > 1 {
+		return nil, errors.New("error: domain should be 1 parameter")
+	}
+	if len(domain) == 1 && len(ast.Tokens) < 3 {
+		return nil, errors.New("error: the role definition has no domain")
+	}
+
+	graph := &RoleGraph{
+		roles: make(map[string][]string),
+		users: make(map[string][]string),
+	}
+	seen := make(map[string]bool)
+	addNode := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			graph.Nodes = append(graph.Nodes, name)
+		}
+	}
+
+	for _, rule := range ast.Policy {
+		if len(rule) < len(ast.Tokens) || len(domain) == 1 && rule[2] != domain[0] {
+			continue
+		}
+		addNode(rule[0])
+		addNode(rule[1])
+		graph.Edges = append(graph.Edges, RoleEdge{
+			From:      rule[0],
+			To:        rule[1],
+			Condition: strings.Join(rule[len(ast.Tokens):], ", "),
+		})
+		graph.roles[rule[0]] = append(graph.roles[rule[0]], rule[1])
+		graph.users[rule[1]] = append(graph.users[rule[1]], rule[0])
+	}
+
+	return graph, nil
+}
+
+// Ancestors returns the roles the given user or role inherits, directly or transitively, nearest first.
+func (graph *RoleGraph) Ancestors(role string) []string {
+	return walkRoleGraph(graph.roles, role)
+}
+
+// Descendants returns the users and roles inheriting the given role, directly or transitively, nearest first.
+func (graph *RoleGraph) Descendants(role string) []string {
+	return walkRoleGraph(graph.users, role)
+}
+
+// walkRoleGraph returns the nodes reachable from start in breadth-first order, visiting each node once so cycles terminate.
+func walkRoleGraph(links map[string][]string, start string) []string {
+	res := []string{}
+	visited := map[string]bool{start: true}
+	queue := []string{start}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		for _, next := range links[name] {
+			if !visited[next] {
+				visited[next] = true
+				res = append(res, next)
+				queue = append(queue, next)
+			}
+		}
+	}
+	return res
+}
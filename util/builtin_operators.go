@@ -15,10 +15,15 @@
 package util
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"net"
 	"regexp"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -42,18 +47,31 @@ var (
 )
 
 func mustCompileOrGet(key string) *regexp.Regexp {
+	re, err := compileOrGet(key)
+	if err != nil {
+		panic(err)
+	}
+	return re
+}
+
+// compileOrGet returns the compiled regular expression of key, compiling and caching it on first use.
+func compileOrGet(key string) (*regexp.Regexp, error) {
 	reCacheMu.RLock()
 	re, ok := reCache[key]
 	reCacheMu.RUnlock()
 
 	if !ok {
-		re = regexp.MustCompile(key)
+		var err error
+		re, err = regexp.Compile(key)
+		if err != nil {
+			return nil, err
+		}
 		reCacheMu.Lock()
 		reCache[key] = re
 		reCacheMu.Unlock()
 	}
 
-	return re
+	return re, nil
 }
 
 // validate the variadic parameter size and type as string.
@@ -137,11 +155,16 @@ func KeyGetFunc(args ...interface{}) (interface{}, error) {
 // KeyMatch2 determines whether key1 matches the pattern of key2 (similar to RESTful path), key2 can contain a *.
 // For example, "/foo/bar" matches "/foo/*", "/resource1" matches "/:resource".
 func KeyMatch2(key1 string, key2 string) bool {
+	return RegexMatch(key1, keyMatch2Pattern(key2))
+}
+
+// keyMatch2Pattern translates a KeyMatch2 pattern into a regular expression.
+func keyMatch2Pattern(key2 string) string {
 	key2 = strings.Replace(key2, "/*", "/.*", -1)
 
 	key2 = keyMatch2Re.ReplaceAllString(key2, "$1[^/]+$2")
 
-	return RegexMatch(key1, "^"+key2+"$")
+	return "^" + key2 + "$"
 }
 
 // KeyMatch2Func is the wrapper for KeyMatch2.
@@ -156,6 +179,24 @@ func KeyMatch2Func(args ...interface{}) (interface{}, error) {
 	return KeyMatch2(name1, name2), nil
 }
 
+// KeyMatchI is the case-insensitive variant of KeyMatch2.
+// For example, "/Foo/Bar" matches "/foo/*" and "/Resource1" matches "/:resource".
+func KeyMatchI(key1 string, key2 string) bool {
+	return RegexMatch(key1, "(?i)"+keyMatch2Pattern(key2))
+}
+
+// KeyMatchIFunc is the wrapper for KeyMatchI.
+func KeyMatchIFunc(args ...interface{}) (interface{}, error) {
+	if err := validateVariadicArgs(2, args...); err != nil {
+		return false, fmt.Errorf("%s: %w", "keyMatchI", err)
+	}
+
+	name1 := args[0].(string)
+	name2 := args[1].(string)
+
+	return KeyMatchI(name1, name2), nil
+}
+
 // KeyGet2 returns value matched pattern
 // For example, "/resource1" matches "/:resource"
 // if the pathVar == "resource", then "resource1" will be returned.
@@ -330,13 +371,84 @@ func KeyMatch5Func(args ...interface{}) (interface{}, error) {
 	return KeyMatch5(name1, name2), nil
 }
 
+// keyNPattern converts the pattern of KeyMatchN into a regular expression, along with the names of its parameters.
+func keyNPattern(key2 string, sep string) (string, []string) {
+	var names []string
+	segments := []string{key2}
+	if sep != "" {
+		segments = strings.Split(key2, sep)
+	}
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") && len(segment) > 1 {
+			names = append(names, segment[1:])
+			if sep == "" {
+				segments[i] = "(.+)"
+			} else {
+				segments[i] = "([^" + regexp.QuoteMeta(sep) + "]+)"
+			}
+			continue
+		}
+		segments[i] = strings.Replace(regexp.QuoteMeta(segment), `\*`, ".*", -1)
+	}
+	return "^" + strings.Join(segments, regexp.QuoteMeta(sep)) + "$", names
+}
+
+// KeyMatchN determines whether key1 matches the pattern of key2 like KeyMatch2, using sep instead of "/"
+// as the separator. key2 can contain a *, matching anything, and :name segments, matching a single segment.
+// For example, with sep ".", "org.team.bucket" matches "org.*" and "org.:team.bucket".
+func KeyMatchN(key1 string, key2 string, sep string) bool {
+	pattern, _ := keyNPattern(key2, sep)
+	return mustCompileOrGet(pattern).MatchString(key1)
+}
+
+// KeyMatchNFunc is the wrapper for KeyMatchN.
+func KeyMatchNFunc(args ...interface{}) (interface{}, error) {
+	if err := validateVariadicArgs(3, args...); err != nil {
+		return false, fmt.Errorf("%s: %w", "keyMatchN", err)
+	}
+
+	name1 := args[0].(string)
+	name2 := args[1].(string)
+	sep := args[2].(string)
+
+	return KeyMatchN(name1, name2, sep), nil
+}
+
+// KeyGetN returns the value of the pathVar parameter of key2 matched by key1, using sep as the separator.
+// For example, with sep ".", "org.team1.bucket" matches "org.:team.bucket"
+// if the pathVar == "team", then "team1" will be returned.
+func KeyGetN(key1, key2 string, sep string, pathVar string) string {
+	pattern, names := keyNPattern(key2, sep)
+	values := mustCompileOrGet(pattern).FindStringSubmatch(key1)
+	if len(values) == 0 {
+		return ""
+	}
+	for i, name := range names {
+		if pathVar == name {
+			return values[i+1]
+		}
+	}
+	return ""
+}
+
+// KeyGetNFunc is the wrapper for KeyGetN.
+func KeyGetNFunc(args ...interface{}) (interface{}, error) {
+	if err := validateVariadicArgs(4, args...); err != nil {
+		return false, fmt.Errorf("%s: %w", "keyGetN", err)
+	}
+
+	name1 := args[0].(string)
+	name2 := args[1].(string)
+	sep := args[2].(string)
+	key := args[3].(string)
+
+	return KeyGetN(name1, name2, sep, key), nil
+}
+
 // RegexMatch determines whether key1 matches the pattern of key2 in regular expression.
+// Compiled patterns are cached. It panics if key2 is not a valid regular expression.
 func RegexMatch(key1 string, key2 string) bool {
-	res, err := regexp.MatchString(key2, key1)
-	if err != nil {
-		panic(err)
-	}
-	return res
+	return mustCompileOrGet(key2).MatchString(key1)
 }
 
 // RegexMatchFunc is the wrapper for RegexMatch.
@@ -348,28 +460,46 @@ func RegexMatchFunc(args ...interface{}) (interface{}, error) {
 	name1 := args[0].(string)
 	name2 := args[1].(string)
 
-	return RegexMatch(name1, name2), nil
+	re, err := compileOrGet(name2)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", "regexMatch", err)
+	}
+	return re.MatchString(name1), nil
 }
 
-// IPMatch determines whether IP address ip1 matches the pattern of IP address ip2, ip2 can be an IP address or a CIDR pattern.
-// For example, "192.168.2.123" matches "192.168.2.0/24".
+// IPMatch determines whether IP address ip1 matches the pattern of IP address ip2, ip2 can be an IP address, a CIDR pattern
+// or an IPv4 pattern with * wildcard octets.
+// For example, "192.168.2.123" matches "192.168.2.0/24" and "192.168.*.*".
+// It panics if ip1 or ip2 is malformed, IPMatchFunc returns an error instead.
 func IPMatch(ip1 string, ip2 string) bool {
+	res, err := ipMatch(ip1, ip2)
+	if err != nil {
+		panic(err)
+	}
+	return res
+}
+
+func ipMatch(ip1 string, ip2 string) (bool, error) {
 	objIP1 := net.ParseIP(ip1)
 	if objIP1 == nil {
-		panic("invalid argument: ip1 in IPMatch() function is not an IP address.")
+		return false, errors.New("invalid argument: ip1 in IPMatch() function is not an IP address")
+	}
+
+	if strings.Contains(ip2, "*") {
+		return IPWildcardMatch(ip1, ip2)
 	}
 
 	_, cidr, err := net.ParseCIDR(ip2)
 	if err != nil {
 		objIP2 := net.ParseIP(ip2)
 		if objIP2 == nil {
-			panic("invalid argument: ip2 in IPMatch() function is neither an IP address nor a CIDR.")
+			return false, errors.New("invalid argument: ip2 in IPMatch() function is neither an IP address nor a CIDR")
 		}
 
-		return objIP1.Equal(objIP2)
+		return objIP1.Equal(objIP2), nil
 	}
 
-	return cidr.Contains(objIP1)
+	return cidr.Contains(objIP1), nil
 }
 
 // IPMatchFunc is the wrapper for IPMatch.
@@ -381,7 +511,244 @@ func IPMatchFunc(args ...interface{}) (interface{}, error) {
 	ip1 := args[0].(string)
 	ip2 := args[1].(string)
 
-	return IPMatch(ip1, ip2), nil
+	res, err := ipMatch(ip1, ip2)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", "ipMatch", err)
+	}
+	return res, nil
+}
+
+// IPRangeMatch determines whether IP address ip matches rangeStr, rangeStr can be an IP address, a CIDR pattern
+// or an inclusive range of the form "start-end".
+// For example, "10.0.0.23" matches "10.0.0.1-10.0.0.50" and "2001:db8::5" matches "2001:db8::1-2001:db8::ff".
+// It panics if ip or rangeStr is malformed, IPRangeMatchFunc returns an error instead.
+func IPRangeMatch(ip string, rangeStr string) bool {
+	res, err := ipRangeMatch(ip, rangeStr)
+	if err != nil {
+		panic(err)
+	}
+	return res
+}
+
+var errInvalidIPRange = errors.New("invalid argument: rangeStr in IPRangeMatch() function is neither an IP address, a CIDR nor an IP range")
+
+func ipRangeMatch(ip string, rangeStr string) (bool, error) {
+	objIP := net.ParseIP(ip)
+	if objIP == nil {
+		return false, errors.New("invalid argument: ip in IPRangeMatch() function is not an IP address")
+	}
+
+	i := strings.Index(rangeStr, "-")
+	if i == -1 {
+		_, cidr, err := net.ParseCIDR(rangeStr)
+		if err == nil {
+			return cidr.Contains(objIP), nil
+		}
+
+		objRangeIP := net.ParseIP(rangeStr)
+		if objRangeIP == nil {
+			return false, errInvalidIPRange
+		}
+
+		return objIP.Equal(objRangeIP), nil
+	}
+
+	start := net.ParseIP(strings.TrimSpace(rangeStr[:i]))
+	end := net.ParseIP(strings.TrimSpace(rangeStr[i+1:]))
+	if start == nil || end == nil || (start.To4() == nil) != (end.To4() == nil) {
+		return false, errInvalidIPRange
+	}
+
+	if (objIP.To4() == nil) != (start.To4() == nil) {
+		return false, nil
+	}
+
+	return bytes.Compare(objIP.To16(), start.To16()) >= 0 && bytes.Compare(objIP.To16(), end.To16()) <= 0, nil
+}
+
+// IPRangeMatchFunc is the wrapper for IPRangeMatch.
+func IPRangeMatchFunc(args ...interface{}) (interface{}, error) {
+	if err := validateVariadicArgs(2, args...); err != nil {
+		return false, fmt.Errorf("%s: %w", "ipRangeMatch", err)
+	}
+
+	ip := args[0].(string)
+	rangeStr := args[1].(string)
+
+	res, err := ipRangeMatch(ip, rangeStr)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", "ipRangeMatch", err)
+	}
+	return res, nil
+}
+
+// IPWildcardMatch determines whether IP address ip1 matches the pattern of IP address ip2, ip2 can be an IP address,
+// a CIDR pattern or an IPv4 pattern whose octets may be a * wildcard.
+// For example, "192.168.2.5" matches "192.168.*.*".
+func IPWildcardMatch(ip1 string, ip2 string) (bool, error) {
+	objIP1 := net.ParseIP(ip1)
+	if objIP1 == nil {
+		return false, errors.New("invalid argument: ip1 in IPWildcardMatch() function is not an IP address")
+	}
+
+	if !strings.Contains(ip2, "*") {
+		_, cidr, err := net.ParseCIDR(ip2)
+		if err == nil {
+			return cidr.Contains(objIP1), nil
+		}
+
+		objIP2 := net.ParseIP(ip2)
+		if objIP2 == nil {
+			return false, errors.New("invalid argument: ip2 in IPWildcardMatch() function is neither an IP address nor a CIDR")
+		}
+
+		return objIP1.Equal(objIP2), nil
+	}
+
+	octets := strings.Split(ip2, ".")
+	if len(octets) != net.IPv4len {
+		return false, fmt.Errorf("invalid argument: ip2 in IPWildcardMatch() function is not a valid wildcard pattern: %s", ip2)
+	}
+
+	wildcards := make([]bool, net.IPv4len)
+	for i, octet := range octets {
+		if octet == "*" {
+			wildcards[i] = true
+			octets[i] = "0"
+		}
+	}
+
+	objIP2 := net.ParseIP(strings.Join(octets, ".")).To4()
+	if objIP2 == nil {
+		return false, fmt.Errorf("invalid argument: ip2 in IPWildcardMatch() function is not a valid wildcard pattern: %s", ip2)
+	}
+
+	objIP1 = objIP1.To4()
+	if objIP1 == nil {
+		return false, nil
+	}
+
+	for i := range objIP2 {
+		if !wildcards[i] && objIP1[i] != objIP2[i] {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// IPWildcardMatchFunc is the wrapper for IPWildcardMatch.
+func IPWildcardMatchFunc(args ...interface{}) (interface{}, error) {
+	if err := validateVariadicArgs(2, args...); err != nil {
+		return false, fmt.Errorf("%s: %w", "ipWildcardMatch", err)
+	}
+
+	ip1 := args[0].(string)
+	ip2 := args[1].(string)
+
+	return IPWildcardMatch(ip1, ip2)
+}
+
+// IPMatchAny determines whether IP address ip falls into any of the given CIDRs, a plain IP address is accepted
+// as a single-address CIDR. All CIDRs are validated, so a malformed entry is reported even if an earlier one matched.
+// For example, "192.168.2.123" matches any of "10.0.0.0/8", "192.168.0.0/16".
+func IPMatchAny(ip string, cidrs ...string) (bool, error) {
+	objIP := net.ParseIP(ip)
+	if objIP == nil {
+		return false, errors.New("invalid argument: ip in IPMatchAny() function is not an IP address")
+	}
+
+	matched := false
+	for _, c := range cidrs {
+		_, cidr, err := net.ParseCIDR(c)
+		if err == nil {
+			matched = matched || cidr.Contains(objIP)
+			continue
+		}
+
+		objIP2 := net.ParseIP(c)
+		if objIP2 == nil {
+			return false, fmt.Errorf("invalid argument: %s in IPMatchAny() function is neither an IP address nor a CIDR", c)
+		}
+		matched = matched || objIP.Equal(objIP2)
+	}
+
+	return matched, nil
+}
+
+// IPMatchAnyFunc is the wrapper for IPMatchAny.
+func IPMatchAnyFunc(args ...interface{}) (interface{}, error) {
+	if len(args) < 2 {
+		return false, fmt.Errorf("%s: expected at least 2 arguments, but got %d", "ipMatchAny", len(args))
+	}
+	if err := validateVariadicArgs(len(args), args...); err != nil {
+		return false, fmt.Errorf("%s: %w", "ipMatchAny", err)
+	}
+
+	ip := args[0].(string)
+	cidrs := make([]string, 0, len(args)-1)
+	for _, arg := range args[1:] {
+		cidrs = append(cidrs, arg.(string))
+	}
+
+	return IPMatchAny(ip, cidrs...)
+}
+
+// IPMatchExcept determines whether IP address ip falls into the CIDR include but into none of the CIDRs excludes,
+// plain IP addresses are accepted as single-address CIDRs. All CIDRs are validated up front, so a malformed entry
+// is reported whatever the IP address.
+// For example, "10.2.0.1" matches "10.0.0.0/8" except "10.1.2.0/24", while "10.1.2.3" does not.
+func IPMatchExcept(ip string, include string, excludes ...string) (bool, error) {
+	objIP := net.ParseIP(ip)
+	if objIP == nil {
+		return false, errors.New("invalid argument: ip in IPMatchExcept() function is not an IP address")
+	}
+
+	nets := make([]*net.IPNet, 0, len(excludes)+1)
+	for _, c := range append([]string{include}, excludes...) {
+		_, cidr, err := net.ParseCIDR(c)
+		if err != nil {
+			objIP2 := net.ParseIP(c)
+			if objIP2 == nil {
+				return false, fmt.Errorf("invalid argument: %s in IPMatchExcept() function is neither an IP address nor a CIDR", c)
+			}
+			bits := 8 * len(objIP2)
+			if objIP2.To4() != nil {
+				objIP2, bits = objIP2.To4(), 32
+			}
+			cidr = &net.IPNet{IP: objIP2, Mask: net.CIDRMask(bits, bits)}
+		}
+		nets = append(nets, cidr)
+	}
+
+	if !nets[0].Contains(objIP) {
+		return false, nil
+	}
+	for _, cidr := range nets[1:] {
+		if cidr.Contains(objIP) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// IPMatchExceptFunc is the wrapper for IPMatchExcept.
+func IPMatchExceptFunc(args ...interface{}) (interface{}, error) {
+	if len(args) < 2 {
+		return false, fmt.Errorf("%s: expected at least 2 arguments, but got %d", "ipMatchExcept", len(args))
+	}
+	if err := validateVariadicArgs(len(args), args...); err != nil {
+		return false, fmt.Errorf("%s: %w", "ipMatchExcept", err)
+	}
+
+	ip := args[0].(string)
+	include := args[1].(string)
+	excludes := make([]string, 0, len(args)-2)
+	for _, arg := range args[2:] {
+		excludes = append(excludes, arg.(string))
+	}
+
+	return IPMatchExcept(ip, include, excludes...)
 }
 
 // GlobMatch determines whether key1 matches the pattern of key2 using glob pattern.
@@ -401,6 +768,111 @@ func GlobMatchFunc(args ...interface{}) (interface{}, error) {
 	return GlobMatch(name1, name2)
 }
 
+// DomainMatch determines whether domain1 lies within the hierarchical domain pattern domain2, with levels separated by "/".
+// A domain matches itself and all of its descendants, so "org/team" and "org/team/sub" match "org".
+// A trailing "/*" only matches descendants: "org/team" matches "org/*" but "org" does not.
+func DomainMatch(domain1 string, domain2 string) bool {
+	if strings.HasSuffix(domain2, "/*") {
+		return strings.HasPrefix(domain1, domain2[:len(domain2)-1])
+	}
+	return domain1 == domain2 || strings.HasPrefix(domain1, domain2+"/")
+}
+
+// DomainMatchFunc is the wrapper for DomainMatch.
+func DomainMatchFunc(args ...interface{}) (interface{}, error) {
+	if err := validateVariadicArgs(2, args...); err != nil {
+		return false, fmt.Errorf("%s: %w", "domainMatch", err)
+	}
+
+	name1 := args[0].(string)
+	name2 := args[1].(string)
+
+	return DomainMatch(name1, name2), nil
+}
+
+// OriginMatch determines whether the origin of a request, e.g. the Origin header "https://app.example.com",
+// matches the allowed origin pattern. The schemes must be the same, the hosts are compared case-insensitively
+// and the ports must be the same, where the default port of http and https may be omitted.
+// A host pattern "*.example.com" matches all subdomains of example.com but not example.com itself,
+// a host pattern "*" matches any host.
+func OriginMatch(origin string, pattern string) bool {
+	scheme1, host1, port1, ok := splitOrigin(origin)
+	if !ok {
+		return false
+	}
+	scheme2, host2, port2, ok := splitOrigin(pattern)
+	if !ok || scheme1 != scheme2 || port1 != port2 {
+		return false
+	}
+
+	switch {
+	case host2 == "*":
+		return host1 != ""
+	case strings.HasPrefix(host2, "*."):
+		return strings.HasSuffix(host1, host2[1:]) && len(host1) > len(host2)-1
+	default:
+		return host1 == host2
+	}
+}
+
+// splitOrigin splits an origin into its lower-cased scheme and host and its port, "" for the default port.
+func splitOrigin(origin string) (scheme, host, port string, ok bool) {
+	i := strings.Index(origin, "://")
+	if i <= 0 {
+		return "", "", "", false
+	}
+	scheme = strings.ToLower(origin[:i])
+	host = strings.ToLower(strings.TrimSuffix(origin[i+3:], "/"))
+	if host == "" || strings.ContainsAny(host, "/?#@") {
+		return "", "", "", false
+	}
+
+	// the port follows the last colon, unless it is part of a bracketed IPv6 address.
+	if j := strings.LastIndex(host, ":"); j != -1 && j > strings.LastIndex(host, "]") {
+		host, port = host[:j], host[j+1:]
+	}
+	if (scheme == "http" && port == "80") || (scheme == "https" && port == "443") {
+		port = ""
+	}
+	return scheme, host, port, true
+}
+
+// OriginMatchFunc is the wrapper for OriginMatch.
+func OriginMatchFunc(args ...interface{}) (interface{}, error) {
+	if err := validateVariadicArgs(2, args...); err != nil {
+		return false, fmt.Errorf("%s: %w", "originMatch", err)
+	}
+
+	name1 := args[0].(string)
+	name2 := args[1].(string)
+
+	return OriginMatch(name1, name2), nil
+}
+
+// Sha256Hex returns the hex-encoded SHA-256 hash of s.
+func Sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// Sha256Eq determines whether the SHA-256 hash of key1 equals the hex-encoded hash key2, e.g. a stored token hash.
+// The comparison is case-insensitive and takes constant time.
+func Sha256Eq(key1 string, key2 string) bool {
+	return subtle.ConstantTimeCompare([]byte(Sha256Hex(key1)), []byte(strings.ToLower(key2))) == 1
+}
+
+// Sha256EqFunc is the wrapper for Sha256Eq.
+func Sha256EqFunc(args ...interface{}) (interface{}, error) {
+	if err := validateVariadicArgs(2, args...); err != nil {
+		return false, fmt.Errorf("%s: %w", "sha256Eq", err)
+	}
+
+	name1 := args[0].(string)
+	name2 := args[1].(string)
+
+	return Sha256Eq(name1, name2), nil
+}
+
 // GenerateGFunction is the factory method of the g(_, _[, _]) function.
 func GenerateGFunction(rm rbac.RoleManager) govaluate.ExpressionFunction {
 	memorized := sync.Map{}
@@ -444,6 +916,53 @@ func GenerateGFunction(rm rbac.RoleManager) govaluate.ExpressionFunction {
 	}
 }
 
+// GenerateGDomainFunction is the factory method of the gDomain(name1, name2) function, returning the first domain,
+// in lexical order, in which name1 inherits name2, or "" if it does not inherit it in any domain.
+// It helps to find out which domain granted a role, e.g. when domains are matched by patterns.
+// Like the function of GenerateGFunction, it caches the domains of the role manager on its first call, so a new
+// function has to be generated once the role links changed.
+func GenerateGDomainFunction(rm rbac.RoleManager) govaluate.ExpressionFunction {
+	var (
+		mu      sync.Mutex
+		domains []string
+		listed  bool
+	)
+	sortedDomains := func() ([]string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if !listed {
+			all, err := rm.GetAllDomains()
+			if err != nil {
+				return nil, err
+			}
+			sort.Strings(all)
+			domains, listed = all, true
+		}
+		return domains, nil
+	}
+
+	return func(args ...interface{}) (interface{}, error) {
+		if err := validateVariadicArgs(2, args...); err != nil {
+			return "", fmt.Errorf("%s: %w", "gDomain", err)
+		}
+
+		name1, name2 := args[0].(string), args[1].(string)
+		if rm == nil {
+			return "", nil
+		}
+		domains, err := sortedDomains()
+		if err != nil {
+			return "", err
+		}
+		for _, domain := range domains {
+			if ok, _ := rm.HasLink(name1, name2, domain); ok {
+				return domain, nil
+			}
+		}
+		return "", nil
+	}
+}
+
 // GenerateConditionalGFunction is the factory method of the g(_, _[, _]) function with conditions.
 func GenerateConditionalGFunction(crm rbac.ConditionalRoleManager) govaluate.ExpressionFunction {
 	return func(args ...interface{}) (interface{}, error) {
@@ -496,3 +1015,157 @@ func TimeMatch(startTime, endTime string) (bool, error) {
 
 	return true, nil
 }
+
+// Clock provides the current time to the time based operators.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// DurationMatchFunc is the wrapper for DurationMatch.
+func DurationMatchFunc(args ...interface{}) (interface{}, error) {
+	return NewDurationMatchFunc(systemClock{})(args...)
+}
+
+// NewDurationMatchFunc returns the wrapper for DurationMatchWithClock reading the current time from clock.
+func NewDurationMatchFunc(clock Clock) govaluate.ExpressionFunction {
+	return func(args ...interface{}) (interface{}, error) {
+		if err := validateVariadicArgs(1, args...); err != nil {
+			return false, fmt.Errorf("%s: %w", "durationMatch", err)
+		}
+		return DurationMatchWithClock(args[0].(string), clock)
+	}
+}
+
+// DurationMatch determines whether the current time is inside the recurring window described by schedule.
+// The schedule is made of the days, the time of day range and an optional time zone (UTC by default),
+// for example "Mon-Fri 09:00-17:00 America/New_York" or "Sat,Sun 22:00-06:00".
+// Days can be "*" to match every day, a window whose end is before its start spans midnight.
+func DurationMatch(schedule string) (bool, error) {
+	return DurationMatchWithClock(schedule, systemClock{})
+}
+
+// DurationMatchWithClock is the same as DurationMatch, but reads the current time from the given clock.
+func DurationMatchWithClock(schedule string, clock Clock) (bool, error) {
+	fields := strings.Fields(schedule)
+	if len(fields) < 2 || len(fields) > 3 {
+		return false, fmt.Errorf("invalid schedule: %s", schedule)
+	}
+
+	days, err := parseWeekdays(fields[0])
+	if err != nil {
+		return false, err
+	}
+
+	bounds := strings.Split(fields[1], "-")
+	if len(bounds) != 2 {
+		return false, fmt.Errorf("invalid time range: %s", fields[1])
+	}
+	start, err := parseTimeOfDay(bounds[0])
+	if err != nil {
+		return false, err
+	}
+	end, err := parseTimeOfDay(bounds[1])
+	if err != nil {
+		return false, err
+	}
+
+	loc := time.UTC
+	if len(fields) == 3 {
+		if loc, err = time.LoadLocation(fields[2]); err != nil {
+			return false, err
+		}
+	}
+
+	now := clock.Now().In(loc)
+	current := time.Duration(now.Hour())*time.Hour + time.Duration(now.Minute())*time.Minute + time.Duration(now.Second())*time.Second
+
+	if start <= end {
+		return days[now.Weekday()] && current >= start && current < end, nil
+	}
+
+	// The window spans midnight, so the early part of the day belongs to the window started on the previous day.
+	if current >= start {
+		return days[now.Weekday()], nil
+	}
+	if current < end {
+		return days[(now.Weekday()+6)%7], nil
+	}
+	return false, nil
+}
+
+// ScheduleMatchLinkFunc is the link condition function of scheduleMatch, the link is valid while the current time is
+// inside the schedule given as the parameter of the grouping rule, e.g. "g, alice, admin, Mon-Fri 09:00-17:00".
+func ScheduleMatchLinkFunc(args ...string) (bool, error) {
+	return NewScheduleMatchLinkFunc(systemClock{})(args...)
+}
+
+// NewScheduleMatchLinkFunc returns the link condition function of scheduleMatch reading the current time from clock.
+func NewScheduleMatchLinkFunc(clock Clock) rbac.LinkConditionFunc {
+	return func(args ...string) (bool, error) {
+		if err := validateVariadicStringArgs(1, args...); err != nil {
+			return false, fmt.Errorf("%s: %w", "scheduleMatch", err)
+		}
+		return DurationMatchWithClock(args[0], clock)
+	}
+}
+
+func parseWeekdays(s string) (map[time.Weekday]bool, error) {
+	days := map[time.Weekday]bool{}
+	if s == "*" {
+		for _, d := range weekdays {
+			days[d] = true
+		}
+		return days, nil
+	}
+
+	for _, part := range strings.Split(s, ",") {
+		bounds := strings.Split(part, "-")
+		if len(bounds) > 2 {
+			return nil, fmt.Errorf("invalid weekday range: %s", part)
+		}
+
+		first, ok := weekdays[strings.ToLower(bounds[0])]
+		if !ok {
+			return nil, fmt.Errorf("invalid weekday: %s", bounds[0])
+		}
+		last := first
+		if len(bounds) == 2 {
+			if last, ok = weekdays[strings.ToLower(bounds[1])]; !ok {
+				return nil, fmt.Errorf("invalid weekday: %s", bounds[1])
+			}
+		}
+
+		for d := first; ; d = (d + 1) % 7 {
+			days[d] = true
+			if d == last {
+				break
+			}
+		}
+	}
+
+	return days, nil
+}
+
+func parseTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day: %s", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
@@ -15,7 +15,9 @@
 package util
 
 import (
+	"strings"
 	"testing"
+	"time"
 )
 
 func testKeyMatch(t *testing.T, key1 string, key2 string, res bool) {
@@ -72,6 +74,16 @@ func testKeyMatch2(t *testing.T, key1 string, key2 string, res bool) {
 	}
 }
 
+func testKeyMatchI(t *testing.T, key1 string, key2 string, res bool) {
+	t.Helper()
+	myRes := KeyMatchI(key1, key2)
+	t.Logf("%s < %s: %t", key1, key2, myRes)
+
+	if myRes != res {
+		t.Errorf("%s < %s: %t, supposed to be %t", key1, key2, !res, res)
+	}
+}
+
 func testGlobMatch(t *testing.T, key1 string, key2 string, res bool) {
 	t.Helper()
 	myRes, err := GlobMatch(key1, key2)
@@ -116,6 +128,27 @@ func TestKeyMatch2(t *testing.T) {
 	testKeyMatch2(t, "/alice/all", "/:/all", false)
 }
 
+func TestKeyMatchI(t *testing.T) {
+	testKeyMatchI(t, "/Foo/Bar", "/foo/*", true)
+	testKeyMatchI(t, "/foo/bar", "/FOO/*", true)
+	testKeyMatchI(t, "/FOO", "/foo", true)
+	testKeyMatchI(t, "/Foo/Bar", "/foo", false)
+	testKeyMatchI(t, "/foobar", "/foo/*", false)
+	testKeyMatchI(t, "/Resource1", "/:resource", true)
+	testKeyMatchI(t, "/MyId/Using/MyResId", "/:id/using/:resId", true)
+	testKeyMatchI(t, "/MyId/Using", "/:id/using/:resId", false)
+
+	// KeyMatch2 stays case-sensitive.
+	testKeyMatch2(t, "/Foo/Bar", "/foo/*", false)
+
+	if res, err := KeyMatchIFunc("/Foo/Bar", "/foo/*"); res != true || err != nil {
+		t.Errorf("KeyMatchIFunc: %v %v, supposed to be true", res, err)
+	}
+	if _, err := KeyMatchIFunc("/Foo/Bar"); err == nil {
+		t.Error("KeyMatchIFunc with a single argument should fail")
+	}
+}
+
 func testKeyGet2(t *testing.T, key1 string, key2 string, pathVar string, res string) {
 	t.Helper()
 	myRes := KeyGet2(key1, key2, pathVar)
@@ -312,6 +345,8 @@ func TestIPMatch(t *testing.T) {
 	testIPMatch(t, "192.168.2.123", "192.168.2.123/32", true)
 	testIPMatch(t, "10.0.0.11", "10.0.0.0/8", true)
 	testIPMatch(t, "11.0.0.123", "10.0.0.0/8", false)
+	testIPMatch(t, "192.168.2.5", "192.168.*.*", true)
+	testIPMatch(t, "192.169.2.5", "192.168.*.*", false)
 }
 
 func testRegexMatchFunc(t *testing.T, res bool, err string, args ...interface{}) {
@@ -417,6 +452,7 @@ func TestRegexMatchFunc(t *testing.T) {
 	testRegexMatchFunc(t, false, "regexMatch: expected 2 arguments, but got 3", "/topic/create/123", "/topic/create", "/topic/update")
 	testRegexMatchFunc(t, false, "regexMatch: argument must be a string", "/topic/create", false)
 	testRegexMatchFunc(t, true, "", "/topic/create/123", "/topic/create")
+	testRegexMatchFunc(t, false, "regexMatch: error parsing regexp: missing closing ]: `[0-9+`", "/topic/edit/123", "/topic/edit/[0-9+")
 }
 
 func TestKeyMatchFunc(t *testing.T) {
@@ -527,6 +563,213 @@ func TestIPMatchFunc(t *testing.T) {
 	testIPMatchFunc(t, false, "ipMatch: expected 2 arguments, but got 1", "192.168.2.123")
 	testIPMatchFunc(t, false, "ipMatch: argument must be a string", "192.168.2.123", 128)
 	testIPMatchFunc(t, true, "", "192.168.2.123", "192.168.2.0/24")
+	testIPMatchFunc(t, false, "ipMatch: invalid argument: ip2 in IPWildcardMatch() function is not a valid wildcard pattern: 192.168.*", "192.168.2.123", "192.168.*")
+	testIPMatchFunc(t, false, "ipMatch: invalid argument: ip2 in IPMatch() function is neither an IP address nor a CIDR", "192.168.2.123", "192.168.2")
+	testIPMatchFunc(t, false, "ipMatch: invalid argument: ip1 in IPMatch() function is not an IP address", "alice", "192.168.2.0/24")
+}
+
+func testIPRangeMatch(t *testing.T, ip string, rangeStr string, res bool) {
+	t.Helper()
+	myRes := IPRangeMatch(ip, rangeStr)
+	t.Logf("%s < %s: %t", ip, rangeStr, myRes)
+
+	if myRes != res {
+		t.Errorf("%s < %s: %t, supposed to be %t", ip, rangeStr, !res, res)
+	}
+}
+
+func TestIPRangeMatch(t *testing.T) {
+	testIPRangeMatch(t, "10.0.0.1", "10.0.0.1-10.0.0.50", true)
+	testIPRangeMatch(t, "10.0.0.23", "10.0.0.1-10.0.0.50", true)
+	testIPRangeMatch(t, "10.0.0.50", "10.0.0.1-10.0.0.50", true)
+	testIPRangeMatch(t, "10.0.0.51", "10.0.0.1-10.0.0.50", false)
+	testIPRangeMatch(t, "10.0.0.0", "10.0.0.1-10.0.0.50", false)
+	testIPRangeMatch(t, "10.0.1.23", "10.0.0.1-10.0.0.50", false)
+	testIPRangeMatch(t, "10.0.3.4", "10.0.0.200-10.0.5.10", true)
+	testIPRangeMatch(t, "10.0.0.23", "10.0.0.1 - 10.0.0.50", true)
+	testIPRangeMatch(t, "192.168.2.123", "192.168.2.0/24", true)
+	testIPRangeMatch(t, "192.168.3.123", "192.168.2.0/24", false)
+	testIPRangeMatch(t, "192.168.2.123", "192.168.2.123", true)
+	testIPRangeMatch(t, "192.168.2.124", "192.168.2.123", false)
+
+	testIPRangeMatch(t, "2001:db8::5", "2001:db8::1-2001:db8::ff", true)
+	testIPRangeMatch(t, "2001:db8::1:0", "2001:db8::1-2001:db8::ff", false)
+	testIPRangeMatch(t, "2001:db8::1", "2001:db8::/64", true)
+	testIPRangeMatch(t, "2001:db9::1", "2001:db8::/64", false)
+	testIPRangeMatch(t, "2001:db8::1", "2001:db8::1", true)
+
+	testIPRangeMatch(t, "10.0.0.23", "2001:db8::1-2001:db8::ff", false)
+	testIPRangeMatch(t, "2001:db8::5", "10.0.0.1-10.0.0.50", false)
+}
+
+func testIPRangeMatchFunc(t *testing.T, res bool, err string, args ...interface{}) {
+	t.Helper()
+	myRes, myErr := IPRangeMatchFunc(args...)
+	myErrStr := ""
+
+	if myErr != nil {
+		myErrStr = myErr.Error()
+	}
+
+	if myRes != res || err != myErrStr {
+		t.Errorf("%v returns %v %v, supposed to be %v %v", args, myRes, myErr, res, err)
+	}
+}
+
+func TestIPRangeMatchFunc(t *testing.T) {
+	testIPRangeMatchFunc(t, false, "ipRangeMatch: expected 2 arguments, but got 1", "10.0.0.23")
+	testIPRangeMatchFunc(t, false, "ipRangeMatch: argument must be a string", "10.0.0.23", 128)
+	testIPRangeMatchFunc(t, true, "", "10.0.0.23", "10.0.0.1-10.0.0.50")
+	testIPRangeMatchFunc(t, false, "", "10.0.0.51", "10.0.0.1-10.0.0.50")
+	testIPRangeMatchFunc(t, false, "ipRangeMatch: invalid argument: rangeStr in IPRangeMatch() function is neither an IP address, a CIDR nor an IP range", "10.0.0.23", "10.0.0.1-10.0.0")
+	testIPRangeMatchFunc(t, false, "ipRangeMatch: invalid argument: rangeStr in IPRangeMatch() function is neither an IP address, a CIDR nor an IP range", "10.0.0.23", "2001:db8::1-10.0.0.50")
+	testIPRangeMatchFunc(t, false, "ipRangeMatch: invalid argument: ip in IPRangeMatch() function is not an IP address", "alice", "10.0.0.1-10.0.0.50")
+}
+
+func testIPWildcardMatch(t *testing.T, ip1 string, ip2 string, res bool, hasErr bool) {
+	t.Helper()
+	myRes, err := IPWildcardMatch(ip1, ip2)
+	t.Logf("%s < %s: %t", ip1, ip2, myRes)
+
+	if (err != nil) != hasErr {
+		t.Errorf("%s < %s: unexpected error state: %v", ip1, ip2, err)
+	}
+	if myRes != res {
+		t.Errorf("%s < %s: %t, supposed to be %t", ip1, ip2, !res, res)
+	}
+}
+
+func TestIPWildcardMatch(t *testing.T) {
+	testIPWildcardMatch(t, "192.168.2.5", "192.168.*.*", true, false)
+	testIPWildcardMatch(t, "192.168.2.5", "192.168.2.*", true, false)
+	testIPWildcardMatch(t, "192.168.2.5", "*.*.*.5", true, false)
+	testIPWildcardMatch(t, "192.168.2.5", "*.*.*.*", true, false)
+	testIPWildcardMatch(t, "192.169.2.5", "192.168.*.*", false, false)
+	testIPWildcardMatch(t, "192.168.2.5", "192.168.3.*", false, false)
+	testIPWildcardMatch(t, "10.0.2.5", "192.168.*.*", false, false)
+	testIPWildcardMatch(t, "2001:db8::1", "192.168.*.*", false, false)
+	testIPWildcardMatch(t, "192.168.2.5", "192.168.2.0/24", true, false)
+	testIPWildcardMatch(t, "192.168.2.5", "192.168.2.5", true, false)
+
+	testIPWildcardMatch(t, "192.168.2.5", "192.168.*", false, true)
+	testIPWildcardMatch(t, "192.168.2.5", "192.168.2*.*", false, true)
+	testIPWildcardMatch(t, "192.168.2.5", "192.168.256.*", false, true)
+	testIPWildcardMatch(t, "192.168.2.5", "192.168.*.*.*", false, true)
+	testIPWildcardMatch(t, "192.168.2.5", "foo", false, true)
+	testIPWildcardMatch(t, "foo", "192.168.*.*", false, true)
+}
+
+func testIPMatchAny(t *testing.T, ip string, cidrs []string, res bool, hasErr bool) {
+	t.Helper()
+	myRes, err := IPMatchAny(ip, cidrs...)
+	t.Logf("%s < %v: %t", ip, cidrs, myRes)
+
+	if (err != nil) != hasErr {
+		t.Errorf("%s < %v: unexpected error state: %v", ip, cidrs, err)
+	}
+	if myRes != res {
+		t.Errorf("%s < %v: %t, supposed to be %t", ip, cidrs, !res, res)
+	}
+}
+
+func TestIPMatchAny(t *testing.T) {
+	private := []string{"10.0.0.0/8", "192.168.0.0/16"}
+	testIPMatchAny(t, "10.1.2.3", private, true, false)
+	testIPMatchAny(t, "192.168.2.123", private, true, false)
+	testIPMatchAny(t, "172.16.0.1", private, false, false)
+	testIPMatchAny(t, "172.16.0.1", []string{"10.0.0.0/8", "172.16.0.1"}, true, false)
+	testIPMatchAny(t, "10.1.2.3", nil, false, false)
+
+	v6 := []string{"2001:db8::/32", "fd00::/8"}
+	testIPMatchAny(t, "2001:db8::1", v6, true, false)
+	testIPMatchAny(t, "fd12:3456::1", v6, true, false)
+	testIPMatchAny(t, "2001:db9::1", v6, false, false)
+	testIPMatchAny(t, "10.1.2.3", v6, false, false)
+
+	testIPMatchAny(t, "10.1.2.3", []string{"10.0.0.0/8", "10.0.0.0/33"}, false, true)
+	testIPMatchAny(t, "10.1.2.3", []string{"foo"}, false, true)
+	testIPMatchAny(t, "foo", private, false, true)
+}
+
+func testIPMatchAnyFunc(t *testing.T, res bool, err string, args ...interface{}) {
+	t.Helper()
+	myRes, myErr := IPMatchAnyFunc(args...)
+	myErrStr := ""
+
+	if myErr != nil {
+		myErrStr = myErr.Error()
+	}
+
+	if myRes != res || err != myErrStr {
+		t.Errorf("%v returns %v %v, supposed to be %v %v", args, myRes, myErr, res, err)
+	}
+}
+
+func TestIPMatchAnyFunc(t *testing.T) {
+	testIPMatchAnyFunc(t, false, "ipMatchAny: expected at least 2 arguments, but got 1", "10.0.0.23")
+	testIPMatchAnyFunc(t, false, "ipMatchAny: argument must be a string", "10.0.0.23", "10.0.0.0/8", 128)
+	testIPMatchAnyFunc(t, true, "", "192.168.2.123", "10.0.0.0/8", "192.168.0.0/16")
+	testIPMatchAnyFunc(t, false, "", "172.16.0.1", "10.0.0.0/8", "192.168.0.0/16")
+}
+
+func testIPMatchExcept(t *testing.T, ip string, include string, excludes []string, res bool, hasErr bool) {
+	t.Helper()
+	myRes, err := IPMatchExcept(ip, include, excludes...)
+	t.Logf("%s < %s except %v: %t, %v", ip, include, excludes, myRes, err)
+
+	if myRes != res || (err != nil) != hasErr {
+		t.Errorf("%s < %s except %v: %t, %v, supposed to be %t, error %t", ip, include, excludes, myRes, err, res, hasErr)
+	}
+}
+
+func TestIPMatchExcept(t *testing.T) {
+	excludes := []string{"10.1.2.0/24", "10.200.0.0/16"}
+	testIPMatchExcept(t, "10.2.0.1", "10.0.0.0/8", excludes, true, false)
+	testIPMatchExcept(t, "10.1.2.3", "10.0.0.0/8", excludes, false, false)
+	testIPMatchExcept(t, "10.1.3.3", "10.0.0.0/8", excludes, true, false)
+	testIPMatchExcept(t, "10.200.7.7", "10.0.0.0/8", excludes, false, false)
+	testIPMatchExcept(t, "11.1.2.3", "10.0.0.0/8", excludes, false, false)
+	testIPMatchExcept(t, "10.1.2.3", "10.0.0.0/8", nil, true, false)
+
+	// overlapping excludes, and an exclude covering the whole include.
+	testIPMatchExcept(t, "10.1.2.3", "10.1.0.0/16", []string{"10.1.0.0/20", "10.1.2.0/24"}, false, false)
+	testIPMatchExcept(t, "10.1.16.1", "10.1.0.0/16", []string{"10.1.0.0/20", "10.1.2.0/24"}, true, false)
+	testIPMatchExcept(t, "10.1.2.3", "10.1.2.0/24", []string{"10.0.0.0/8"}, false, false)
+
+	// plain IP addresses.
+	testIPMatchExcept(t, "10.1.2.3", "10.0.0.0/8", []string{"10.1.2.3"}, false, false)
+	testIPMatchExcept(t, "10.1.2.4", "10.0.0.0/8", []string{"10.1.2.3"}, true, false)
+	testIPMatchExcept(t, "10.1.2.3", "10.1.2.3", nil, true, false)
+
+	testIPMatchExcept(t, "2001:db8:1::1", "2001:db8::/32", []string{"2001:db8:1::/48"}, false, false)
+	testIPMatchExcept(t, "2001:db8:2::1", "2001:db8::/32", []string{"2001:db8:1::/48"}, true, false)
+	testIPMatchExcept(t, "2001:db8:2::1", "2001:db8::/32", []string{"2001:db8:2::1"}, false, false)
+	testIPMatchExcept(t, "10.1.2.3", "2001:db8::/32", nil, false, false)
+
+	testIPMatchExcept(t, "11.1.2.3", "10.0.0.0/8", []string{"10.1.2.0/33"}, false, true)
+	testIPMatchExcept(t, "10.1.2.3", "foo", nil, false, true)
+	testIPMatchExcept(t, "foo", "10.0.0.0/8", nil, false, true)
+}
+
+func testIPMatchExceptFunc(t *testing.T, res bool, err string, args ...interface{}) {
+	t.Helper()
+	myRes, myErr := IPMatchExceptFunc(args...)
+	myErrStr := ""
+
+	if myErr != nil {
+		myErrStr = myErr.Error()
+	}
+
+	if myRes != res || err != myErrStr {
+		t.Errorf("%v returns %v %v, supposed to be %v %v", args, myRes, myErr, res, err)
+	}
+}
+
+func TestIPMatchExceptFunc(t *testing.T) {
+	testIPMatchExceptFunc(t, false, "ipMatchExcept: expected at least 2 arguments, but got 1", "10.0.0.23")
+	testIPMatchExceptFunc(t, false, "ipMatchExcept: argument must be a string", "10.0.0.23", "10.0.0.0/8", 128)
+	testIPMatchExceptFunc(t, true, "", "10.0.0.23", "10.0.0.0/8", "10.1.2.0/24")
+	testIPMatchExceptFunc(t, false, "", "10.1.2.23", "10.0.0.0/8", "10.1.2.0/24")
 }
 
 func TestGlobMatch(t *testing.T) {
@@ -662,3 +905,255 @@ func TestTestMatch(t *testing.T) {
 	testTimeMatch(t, "0000-01-01 00:00:00", "_", true)
 	testTimeMatch(t, "9999-12-30 00:00:00", "_", false)
 }
+
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time {
+	return time.Time(c)
+}
+
+func testDurationMatch(t *testing.T, schedule string, now string, res bool) {
+	t.Helper()
+	tm, err := time.Parse(time.RFC3339, now)
+	if err != nil {
+		panic(err)
+	}
+	myRes, err := DurationMatchWithClock(schedule, fixedClock(tm))
+	if err != nil {
+		t.Errorf("%s at %s: unexpected error: %v", schedule, now, err)
+	}
+	t.Logf("%s at %s: %t", schedule, now, myRes)
+
+	if myRes != res {
+		t.Errorf("%s at %s: %t, supposed to be %t", schedule, now, !res, res)
+	}
+}
+
+func TestDurationMatch(t *testing.T) {
+	// 2023-06-14 is a Wednesday.
+	testDurationMatch(t, "Mon-Fri 09:00-17:00", "2023-06-14T09:00:00Z", true)
+	testDurationMatch(t, "Mon-Fri 09:00-17:00", "2023-06-14T16:59:59Z", true)
+	testDurationMatch(t, "Mon-Fri 09:00-17:00", "2023-06-14T17:00:00Z", false)
+	testDurationMatch(t, "Mon-Fri 09:00-17:00", "2023-06-14T08:59:59Z", false)
+	testDurationMatch(t, "Mon-Fri 09:00-17:00", "2023-06-17T10:00:00Z", false)
+	testDurationMatch(t, "Sat,Sun 09:00-17:00", "2023-06-17T10:00:00Z", true)
+	testDurationMatch(t, "Fri-Mon 09:00-17:00", "2023-06-18T10:00:00Z", true)
+	testDurationMatch(t, "Fri-Mon 09:00-17:00", "2023-06-14T10:00:00Z", false)
+	testDurationMatch(t, "* 09:00-17:00", "2023-06-18T10:00:00Z", true)
+
+	testDurationMatch(t, "Mon-Fri 09:00-17:00 America/New_York", "2023-06-14T14:00:00Z", true)
+	testDurationMatch(t, "Mon-Fri 09:00-17:00 America/New_York", "2023-06-14T22:00:00Z", false)
+	testDurationMatch(t, "Mon-Fri 09:00-17:00 America/New_York", "2023-06-15T02:00:00+09:00", true)
+
+	testDurationMatch(t, "Fri 22:00-06:00", "2023-06-16T23:00:00Z", true)
+	testDurationMatch(t, "Fri 22:00-06:00", "2023-06-17T05:00:00Z", true)
+	testDurationMatch(t, "Fri 22:00-06:00", "2023-06-17T07:00:00Z", false)
+	testDurationMatch(t, "Fri 22:00-06:00", "2023-06-16T05:00:00Z", false)
+}
+
+func TestDurationMatchError(t *testing.T) {
+	clock := fixedClock(time.Now())
+	for _, schedule := range []string{
+		"",
+		"Mon-Fri",
+		"Mon-Fri 09:00",
+		"Mon-Fri 9-17",
+		"Mon-Fry 09:00-17:00",
+		"Mon-Wed-Fri 09:00-17:00",
+		"Mon-Fri 09:00-17:00 Nowhere/City",
+		"Mon-Fri 09:00-17:00 UTC extra",
+	} {
+		if _, err := DurationMatchWithClock(schedule, clock); err == nil {
+			t.Errorf("%q: an error is expected", schedule)
+		}
+	}
+}
+
+func TestDurationMatchFunc(t *testing.T) {
+	if _, err := DurationMatchFunc(); err == nil || err.Error() != "durationMatch: expected 1 arguments, but got 0" {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := DurationMatchFunc(1); err == nil || err.Error() != "durationMatch: argument must be a string" {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if res, err := DurationMatchFunc("* 00:00-23:59"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	} else if _, ok := res.(bool); !ok {
+		t.Errorf("durationMatch should return a bool, got %v", res)
+	}
+}
+
+func TestScheduleMatchFunc(t *testing.T) {
+	// 2023-06-17 is a Saturday, 2023-06-14 a Wednesday.
+	weekend, _ := time.Parse(time.RFC3339, "2023-06-17T10:00:00Z")
+	weekday, _ := time.Parse(time.RFC3339, "2023-06-14T10:00:00Z")
+
+	if res, err := NewDurationMatchFunc(fixedClock(weekend))("Mon-Fri 09:00-17:00"); err != nil || res != false {
+		t.Errorf("durationMatch on a weekend: %v, %v", res, err)
+	}
+	if res, err := NewDurationMatchFunc(fixedClock(weekday))("Mon-Fri 09:00-17:00"); err != nil || res != true {
+		t.Errorf("durationMatch on a weekday: %v, %v", res, err)
+	}
+	if ok, err := NewScheduleMatchLinkFunc(fixedClock(weekend))("Mon-Fri 09:00-17:00"); err != nil || ok {
+		t.Errorf("scheduleMatch link on a weekend: %v, %v", ok, err)
+	}
+	if ok, err := NewScheduleMatchLinkFunc(fixedClock(weekday))("Mon-Fri 09:00-17:00"); err != nil || !ok {
+		t.Errorf("scheduleMatch link on a weekday: %v, %v", ok, err)
+	}
+
+	if _, err := NewDurationMatchFunc(fixedClock(weekday))("Mon-Fri 9-17"); err == nil {
+		t.Error("an invalid schedule should fail")
+	}
+	if _, err := ScheduleMatchLinkFunc(); err == nil || err.Error() != "scheduleMatch: expected 1 arguments, but got 0" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func testDomainMatch(t *testing.T, domain1 string, domain2 string, res bool) {
+	t.Helper()
+	myRes := DomainMatch(domain1, domain2)
+	t.Logf("%s < %s: %t", domain1, domain2, myRes)
+
+	if myRes != res {
+		t.Errorf("%s < %s: %t, supposed to be %t", domain1, domain2, !res, res)
+	}
+}
+
+func TestDomainMatch(t *testing.T) {
+	testDomainMatch(t, "org", "org", true)
+	testDomainMatch(t, "org/team", "org", true)
+	testDomainMatch(t, "org/team/sub", "org", true)
+	testDomainMatch(t, "org", "org/team", false)
+	testDomainMatch(t, "organization", "org", false)
+	testDomainMatch(t, "org/team", "org/*", true)
+	testDomainMatch(t, "org/team/sub", "org/*", true)
+	testDomainMatch(t, "org", "org/*", false)
+	testDomainMatch(t, "org/team2", "org/team", false)
+	testDomainMatch(t, "other/team", "org/*", false)
+}
+
+func testOriginMatch(t *testing.T, origin string, pattern string, res bool) {
+	t.Helper()
+	myRes := OriginMatch(origin, pattern)
+	t.Logf("%s < %s: %t", origin, pattern, myRes)
+
+	if myRes != res {
+		t.Errorf("%s < %s: %t, supposed to be %t", origin, pattern, !res, res)
+	}
+}
+
+func TestOriginMatch(t *testing.T) {
+	// exact origins.
+	testOriginMatch(t, "https://example.com", "https://example.com", true)
+	testOriginMatch(t, "https://Example.COM", "https://example.com", true)
+	testOriginMatch(t, "https://example.com:443", "https://example.com", true)
+	testOriginMatch(t, "https://example.com:8443", "https://example.com", false)
+	testOriginMatch(t, "http://localhost:3000", "http://localhost:3000", true)
+	testOriginMatch(t, "https://example.org", "https://example.com", false)
+
+	// wildcard subdomains.
+	testOriginMatch(t, "https://app.example.com", "https://*.example.com", true)
+	testOriginMatch(t, "https://a.b.example.com", "https://*.example.com", true)
+	testOriginMatch(t, "https://example.com", "https://*.example.com", false)
+	testOriginMatch(t, "https://evilexample.com", "https://*.example.com", false)
+	testOriginMatch(t, "https://app.example.com.evil.com", "https://*.example.com", false)
+	testOriginMatch(t, "https://anything.io", "https://*", true)
+
+	// scheme mismatches.
+	testOriginMatch(t, "http://app.example.com", "https://*.example.com", false)
+	testOriginMatch(t, "https://example.com", "http://example.com", false)
+	testOriginMatch(t, "wss://example.com", "https://example.com", false)
+
+	// malformed origins.
+	testOriginMatch(t, "example.com", "https://example.com", false)
+	testOriginMatch(t, "https://example.com/path", "https://example.com", false)
+	testOriginMatch(t, "https://", "https://*", false)
+}
+
+func TestSha256Eq(t *testing.T) {
+	hash := "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	if res := Sha256Hex("hello"); res != hash {
+		t.Errorf("Sha256Hex(hello) = %s, supposed to be %s", res, hash)
+	}
+
+	if !Sha256Eq("hello", hash) {
+		t.Error("hello should match its hash")
+	}
+	if !Sha256Eq("hello", strings.ToUpper(hash)) {
+		t.Error("hello should match its upper-case hash")
+	}
+	if Sha256Eq("hello2", hash) {
+		t.Error("hello2 should not match the hash of hello")
+	}
+	if Sha256Eq("hello", "hello") {
+		t.Error("hello should not match itself as a hash")
+	}
+
+	res, err := Sha256EqFunc("hello", hash)
+	if err != nil || res != true {
+		t.Errorf("Sha256EqFunc(hello) = %v, %v, supposed to be true", res, err)
+	}
+	if _, err = Sha256EqFunc("hello"); err == nil {
+		t.Error("Sha256EqFunc should fail with a single argument")
+	}
+}
+
+func testKeyMatchN(t *testing.T, key1 string, key2 string, sep string, res bool) {
+	t.Helper()
+	myRes := KeyMatchN(key1, key2, sep)
+	t.Logf("%s < %s (%s): %t", key1, key2, sep, myRes)
+
+	if myRes != res {
+		t.Errorf("%s < %s (%s): %t, supposed to be %t", key1, key2, sep, !res, res)
+	}
+}
+
+func TestKeyMatchN(t *testing.T) {
+	testKeyMatchN(t, "/foo/bar", "/foo/*", "/", true)
+	testKeyMatchN(t, "/foo/bar", "/:resource/bar", "/", true)
+	testKeyMatchN(t, "/foo/baz/bar", "/:resource/bar", "/", false)
+
+	testKeyMatchN(t, "org.team.bucket", "org.*", ".", true)
+	testKeyMatchN(t, "org.team.bucket", "org.team.bucket", ".", true)
+	testKeyMatchN(t, "org", "org.*", ".", false)
+	testKeyMatchN(t, "orgXteam", "org.team", ".", false)
+	testKeyMatchN(t, "org.team.bucket", "org.:team.bucket", ".", true)
+	testKeyMatchN(t, "org.team.sub.bucket", "org.:team.bucket", ".", false)
+	// parameters must span a whole segment.
+	testKeyMatchN(t, "org/team.bucket", "org/:team.bucket", ".", false)
+	testKeyMatchN(t, "logs/2023.gz", "logs/*.gz", ".", true)
+	testKeyMatchN(t, "logs/2023.gz", "logs/*.tar", ".", false)
+
+	testKeyMatchN(t, "foo::bar", "foo::*", "::", true)
+	testKeyMatchN(t, "foo::bar::baz", "foo:::id::baz", "::", true)
+}
+
+func testKeyGetN(t *testing.T, key1 string, key2 string, sep string, pathVar string, res string) {
+	t.Helper()
+	myRes := KeyGetN(key1, key2, sep, pathVar)
+	t.Logf(`%s < %s (%s): %s = "%s"`, key1, key2, sep, pathVar, myRes)
+
+	if myRes != res {
+		t.Errorf(`%s < %s (%s): %s = "%s" supposed to be "%s"`, key1, key2, sep, pathVar, myRes, res)
+	}
+}
+
+func TestKeyGetN(t *testing.T) {
+	testKeyGetN(t, "org.team1.bucket", "org.:team.bucket", ".", "team", "team1")
+	testKeyGetN(t, "org.team1.bucket", "org.:team.:bucket", ".", "bucket", "bucket")
+	testKeyGetN(t, "org.team1.bucket", "org.:team.bucket", ".", "id", "")
+	testKeyGetN(t, "org.team1.sub.bucket", "org.:team.bucket", ".", "team", "")
+	testKeyGetN(t, "/proxy/myid/res", "/proxy/:id/*", "/", "id", "myid")
+}
+
+func TestKeyMatchNFunc(t *testing.T) {
+	if _, err := KeyMatchNFunc("org.team", "org.*"); err == nil || err.Error() != "keyMatchN: expected 3 arguments, but got 2" {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if res, err := KeyMatchNFunc("org.team", "org.*", "."); err != nil || res != true {
+		t.Errorf("keyMatchN returns %v %v, supposed to be true", res, err)
+	}
+	if res, err := KeyGetNFunc("org.team", "org.:team", ".", "team"); err != nil || res != "team" {
+		t.Errorf("keyGetN returns %v %v, supposed to be team", res, err)
+	}
+}
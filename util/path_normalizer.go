@@ -0,0 +1,50 @@
+// Copyright 2023 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import "strings"
+
+// PathNormOptions selects how NewPathNormalizerFunc normalizes a path.
+type PathNormOptions struct {
+	// StripTrailingSlash removes the trailing slashes, so "/users/" becomes "/users". The root "/" is kept.
+	StripTrailingSlash bool
+	// LowercasePath converts the path to lower case.
+	LowercasePath bool
+	// StripQueryString removes the query string and the fragment, so "/users?id=1" becomes "/users".
+	StripQueryString bool
+}
+
+// NewPathNormalizerFunc returns a function normalizing a path with the given options, e.g. to be set on the
+// enforcer with SetObjectNormalizer so that "/users/" and "/users" are matched the same way.
+func NewPathNormalizerFunc(options PathNormOptions) func(string) string {
+	return func(path string) string {
+		if options.StripQueryString {
+			if i := strings.IndexAny(path, "?#"); i != -1 {
+				path = path[:i]
+			}
+		}
+		if options.StripTrailingSlash {
+			if trimmed := strings.TrimRight(path, "/"); trimmed != "" || path == "" {
+				path = trimmed
+			} else {
+				path = "/"
+			}
+		}
+		if options.LowercasePath {
+			path = strings.ToLower(path)
+		}
+		return path
+	}
+}
@@ -0,0 +1,245 @@
+// Copyright 2023 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// TrieMatcher matches keys against a set of KeyMatch2 patterns like "/api/users/:id" or "/static/*" at once.
+// The patterns are split into "/" separated segments and stored in a trie, so matching a key walks the trie
+// once instead of running a regular expression per pattern. A segment is either literal, a ":name" parameter
+// matching one non-empty segment, or "*" matching the rest of the key up to the next segment of the pattern.
+// Patterns with other regular expression syntax are kept aside and compared with KeyMatch2.
+// A TrieMatcher is safe for concurrent use.
+type TrieMatcher struct {
+	root     *trieNode
+	patterns map[string]struct{}
+	// regexPatterns are the patterns which cannot be stored in the trie.
+	regexPatterns []string
+
+	// last memorizes the patterns matching the last key, since an enforce call compares the same
+	// request key with the pattern of every rule.
+	mu      sync.Mutex
+	lastKey string
+	last    map[string]struct{}
+}
+
+type trieNode struct {
+	literals map[string]*trieNode
+	params   map[string]*trieNode
+	wildcard *trieNode
+	// pattern is the pattern ending at the node, if any.
+	pattern string
+	end     bool
+}
+
+// TrieMatch is a pattern matching a key, with the values of its parameters. The value matched by "*" is
+// stored under "*".
+type TrieMatch struct {
+	Pattern string
+	Params  map[string]string
+}
+
+func newTrieNode() *trieNode {
+	return &trieNode{literals: map[string]*trieNode{}, params: map[string]*trieNode{}}
+}
+
+// NewTrieMatcher creates a TrieMatcher from the given patterns, typically the objects of the policy.
+func NewTrieMatcher(patterns ...string) *TrieMatcher {
+	tm := &TrieMatcher{root: newTrieNode(), patterns: map[string]struct{}{}}
+	for _, pattern := range patterns {
+		tm.Add(pattern)
+	}
+	return tm
+}
+
+// Add adds a pattern to the matcher.
+func (tm *TrieMatcher) Add(pattern string) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	if _, ok := tm.patterns[pattern]; ok {
+		return
+	}
+	tm.patterns[pattern] = struct{}{}
+	tm.last = nil
+
+	segments := strings.Split(pattern, "/")
+	for _, segment := range segments {
+		if !isTrieSegment(segment) {
+			tm.regexPatterns = append(tm.regexPatterns, pattern)
+			return
+		}
+	}
+
+	n := tm.root
+	for _, segment := range segments {
+		var children map[string]*trieNode
+		switch {
+		case segment == "*":
+			if n.wildcard == nil {
+				n.wildcard = newTrieNode()
+			}
+			n = n.wildcard
+			continue
+		case strings.HasPrefix(segment, ":"):
+			children = n.params
+		default:
+			children = n.literals
+		}
+		child, ok := children[segment]
+		if !ok {
+			child = newTrieNode()
+			children[segment] = child
+		}
+		n = child
+	}
+	n.pattern = pattern
+	n.end = true
+}
+
+// Has reports whether the pattern was added to the matcher.
+func (tm *TrieMatcher) Has(pattern string) bool {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	_, ok := tm.patterns[pattern]
+	return ok
+}
+
+// Match reports whether the key matches any pattern, and returns the parameters of the most specific one:
+// literal segments are preferred over parameters, and parameters over "*".
+func (tm *TrieMatcher) Match(key string) (bool, map[string]string) {
+	matches := tm.Matches(key)
+	if len(matches) == 0 {
+		return false, nil
+	}
+	return true, matches[0].Params
+}
+
+// Matches returns all patterns matching the key, the most specific first.
+func (tm *TrieMatcher) Matches(key string) []TrieMatch {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	return tm.matches(key)
+}
+
+func (tm *TrieMatcher) matches(key string) []TrieMatch {
+	var res []TrieMatch
+	tm.root.collect(strings.Split(key, "/"), map[string]string{}, &res)
+	for _, pattern := range tm.regexPatterns {
+		if KeyMatch2(key, pattern) {
+			res = append(res, TrieMatch{Pattern: pattern, Params: map[string]string{}})
+		}
+	}
+	return res
+}
+
+// MatchPattern reports whether the key matches the pattern. Patterns not added to the matcher are compared
+// with KeyMatch2.
+func (tm *TrieMatcher) MatchPattern(key string, pattern string) bool {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	if _, ok := tm.patterns[pattern]; !ok {
+		return KeyMatch2(key, pattern)
+	}
+
+	if tm.last == nil || tm.lastKey != key {
+		matches := tm.matches(key)
+		tm.last = make(map[string]struct{}, len(matches))
+		for _, match := range matches {
+			tm.last[match.Pattern] = struct{}{}
+		}
+		tm.lastKey = key
+	}
+	_, ok := tm.last[pattern]
+	return ok
+}
+
+// TrieKeyMatchFunc returns the matcher function trieKeyMatch(key, pattern) comparing with MatchPattern.
+func (tm *TrieMatcher) TrieKeyMatchFunc() func(args ...interface{}) (interface{}, error) {
+	return func(args ...interface{}) (interface{}, error) {
+		if err := validateVariadicArgs(2, args...); err != nil {
+			return false, fmt.Errorf("%s: %w", "trieKeyMatch", err)
+		}
+
+		return tm.MatchPattern(args[0].(string), args[1].(string)), nil
+	}
+}
+
+// isTrieSegment reports whether a pattern segment is literal, a ":name" parameter or "*", i.e. whether it has
+// no other meaning as a regular expression in KeyMatch2.
+func isTrieSegment(segment string) bool {
+	if segment == "*" {
+		return true
+	}
+	if strings.HasPrefix(segment, ":") {
+		return len(segment) > 1
+	}
+	return !strings.ContainsAny(segment, `:.*+?()[]{}|^$\`)
+}
+
+func (n *trieNode) collect(segments []string, params map[string]string, res *[]TrieMatch) {
+	if len(segments) == 0 {
+		if n.end {
+			matched := make(map[string]string, len(params))
+			for k, v := range params {
+				matched[k] = v
+			}
+			*res = append(*res, TrieMatch{Pattern: n.pattern, Params: matched})
+		}
+		return
+	}
+
+	segment := segments[0]
+	if child, ok := n.literals[segment]; ok {
+		child.collect(segments[1:], params, res)
+	}
+
+	if segment != "" {
+		names := make([]string, 0, len(n.params))
+		for name := range n.params {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			child := n.params[name]
+			old, had := params[name[1:]]
+			params[name[1:]] = segment
+			child.collect(segments[1:], params, res)
+			if had {
+				params[name[1:]] = old
+			} else {
+				delete(params, name[1:])
+			}
+		}
+	}
+
+	if n.wildcard != nil {
+		// "*" consumes at least one segment, like "/.*" requires the slash in KeyMatch2.
+		old, had := params["*"]
+		for i := 1; i <= len(segments); i++ {
+			params["*"] = strings.Join(segments[:i], "/")
+			n.wildcard.collect(segments[i:], params, res)
+		}
+		if had {
+			params["*"] = old
+		} else {
+			delete(params, "*")
+		}
+	}
+}
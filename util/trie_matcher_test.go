@@ -0,0 +1,77 @@
+// Copyright 2023 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTrieMatcherKeyMatch2(t *testing.T) {
+	patterns := []string{
+		"/foo", "/foo*", "/foo/*", "/:resource", "/:id/using/:resId", "/proxy/:id/*",
+		"/:id", "/:id/all", "/:/all", "/api/*/items", "/file.json",
+	}
+	keys := []string{
+		"/", "/foo", "/foo/", "/foo/bar", "/foobar", "/resource1", "/myid", "/myid/using/myresid",
+		"/proxy/myid", "/proxy/myid/", "/proxy/myid/res/res2", "/proxy/", "/alice", "/alice/all",
+		"/api/items", "/api/v1/items", "/api/v1/v2/items", "/api//items", "/file.json", "/fileXjson",
+	}
+
+	tm := NewTrieMatcher(patterns...)
+	for _, key := range keys {
+		for _, pattern := range patterns {
+			if res, expected := tm.MatchPattern(key, pattern), KeyMatch2(key, pattern); res != expected {
+				t.Errorf("%s < %s: %t, supposed to be %t like KeyMatch2", key, pattern, res, expected)
+			}
+		}
+	}
+
+	// Patterns missing from the matcher are compared with KeyMatch2.
+	if !tm.MatchPattern("/bar/1", "/bar/:id") {
+		t.Error("/bar/1 < /bar/:id: false, supposed to be true")
+	}
+	if !tm.Has("/foo/*") || tm.Has("/bar/:id") {
+		t.Error("Has is supposed to report the added patterns only")
+	}
+}
+
+func TestTrieMatcherMatch(t *testing.T) {
+	tm := NewTrieMatcher("/users/:id", "/users/me", "/users/:id/posts/:post", "/static/*")
+
+	testMatch := func(key string, ok bool, params map[string]string) {
+		t.Helper()
+		myOk, myParams := tm.Match(key)
+		if myOk != ok || !reflect.DeepEqual(myParams, params) {
+			t.Errorf("Match(%s) = %t, %v, supposed to be %t, %v", key, myOk, myParams, ok, params)
+		}
+	}
+
+	// the literal segment is preferred over the parameter.
+	testMatch("/users/me", true, map[string]string{})
+	testMatch("/users/42", true, map[string]string{"id": "42"})
+	testMatch("/users/42/posts/7", true, map[string]string{"id": "42", "post": "7"})
+	testMatch("/static/css/site.css", true, map[string]string{"*": "css/site.css"})
+	testMatch("/users", false, nil)
+	testMatch("/users/42/posts", false, nil)
+
+	var patterns []string
+	for _, match := range tm.Matches("/users/me") {
+		patterns = append(patterns, match.Pattern)
+	}
+	if !reflect.DeepEqual(patterns, []string{"/users/me", "/users/:id"}) {
+		t.Errorf("Matches(/users/me) = %v, supposed to be [/users/me /users/:id]", patterns)
+	}
+}
@@ -26,6 +26,10 @@ var evalReg = regexp.MustCompile(`\beval\((?P<rule>[^)]*)\)`)
 
 var escapeAssertionRegex = regexp.MustCompile(`\b((r|p)[0-9]*)\.`)
 
+var indexedAccessRegex = regexp.MustCompile(`\b[rp][0-9]*_\w+(\.\w+|\[[0-9]+\])*\[[0-9]+\](\.\w+|\[[0-9]+\])*`)
+
+var indexedAccessEscaper = strings.NewReplacer("[", `\[`, "]", `\]`)
+
 func JsonToMap(jsonStr string) (map[string]interface{}, error) {
 	result := make(map[string]interface{})
 	err := json.Unmarshal([]byte(jsonStr), &result)
@@ -36,10 +40,15 @@ func JsonToMap(jsonStr string) (map[string]interface{}, error) {
 }
 
 // EscapeAssertion escapes the dots in the assertion, because the expression evaluation doesn't support such variable names.
+// Attribute paths with an index, e.g. r.obj.Tags[0], are additionally wrapped into an escaped parameter name,
+// [r_obj.Tags\[0\]], because the expression evaluation doesn't support indexing either.
 func EscapeAssertion(s string) string {
 	s = escapeAssertionRegex.ReplaceAllStringFunc(s, func(m string) string {
 		return strings.Replace(m, ".", "_", 1)
 	})
+	s = indexedAccessRegex.ReplaceAllStringFunc(s, func(m string) string {
+		return "[" + indexedAccessEscaper.Replace(m) + "]"
+	})
 	return s
 }
 
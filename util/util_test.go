@@ -47,6 +47,8 @@ func TestEscapeAssertion(t *testing.T) {
 	testEscapeAssertion(t, "g(r.sub, p.sub) == p.attr", "g(r_sub, p_sub) == p_attr")
 	testEscapeAssertion(t, "g(r.sub,p.sub) == p.attr", "g(r_sub,p_sub) == p_attr")
 	testEscapeAssertion(t, "(r.attp.value || p.attr)p.u", "(r_attp.value || p_attr)p_u")
+	testEscapeAssertion(t, "r.obj.Meta.Tags[0] == p.attr", `[r_obj.Meta.Tags\[0\]] == p_attr`)
+	testEscapeAssertion(t, "r2.obj.Rows[1][2].Name == r.sub", `[r2_obj.Rows\[1\]\[2\].Name] == r_sub`)
 }
 
 func testRemoveComments(t *testing.T, s string, res string) {
@@ -223,3 +225,27 @@ func TestLRUCache(t *testing.T) {
 	testCacheGet(t, cache, "two", nil, false)
 	testCacheEqual(t, cache, []int{1, 3, 4})
 }
+
+func TestNewPathNormalizerFunc(t *testing.T) {
+	tests := []struct {
+		options PathNormOptions
+		path    string
+		want    string
+	}{
+		{PathNormOptions{}, "/Users/?id=1", "/Users/?id=1"},
+		{PathNormOptions{StripTrailingSlash: true}, "/users/", "/users"},
+		{PathNormOptions{StripTrailingSlash: true}, "/users//", "/users"},
+		{PathNormOptions{StripTrailingSlash: true}, "/", "/"},
+		{PathNormOptions{StripTrailingSlash: true}, "", ""},
+		{PathNormOptions{LowercasePath: true}, "/Users/Alice", "/users/alice"},
+		{PathNormOptions{StripQueryString: true}, "/users?id=1", "/users"},
+		{PathNormOptions{StripQueryString: true}, "/users#top", "/users"},
+		{PathNormOptions{StripTrailingSlash: true, StripQueryString: true}, "/users/?id=1", "/users"},
+		{PathNormOptions{StripTrailingSlash: true, LowercasePath: true, StripQueryString: true}, "/Users/?ID=1", "/users"},
+	}
+	for _, tt := range tests {
+		if got := NewPathNormalizerFunc(tt.options)(tt.path); got != tt.want {
+			t.Errorf("NewPathNormalizerFunc(%+v)(%q) = %q, supposed to be %q", tt.options, tt.path, got, tt.want)
+		}
+	}
+}
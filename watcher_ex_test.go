@@ -15,6 +15,8 @@
 package casbin
 
 import (
+	"fmt"
+	"reflect"
 	"testing"
 
 	"github.com/ApicaSystem/casbin/v2/model"
@@ -68,3 +70,82 @@ func TestSetWatcherEx(t *testing.T) {
 	_, _ = e.AddPolicies([][]string{{"admin", "data1", "read"}, {"admin", "data2", "read"}})    // calls watcherEx.UpdateForAddPolicies()
 	_, _ = e.RemovePolicies([][]string{{"admin", "data1", "read"}, {"admin", "data2", "read"}}) // calls watcherEx.UpdateForRemovePolicies()
 }
+
+// recordingWatcherEx records the WatcherEx callbacks it receives.
+type recordingWatcherEx struct {
+	SampleWatcher
+	calls []string
+}
+
+func (w *recordingWatcherEx) Update() error {
+	w.calls = append(w.calls, "Update")
+	return nil
+}
+
+func (w *recordingWatcherEx) UpdateForAddPolicy(sec, ptype string, params ...string) error {
+	w.calls = append(w.calls, fmt.Sprintf("AddPolicy %s %s %v", sec, ptype, params))
+	return nil
+}
+
+func (w *recordingWatcherEx) UpdateForRemovePolicy(sec, ptype string, params ...string) error {
+	w.calls = append(w.calls, fmt.Sprintf("RemovePolicy %s %s %v", sec, ptype, params))
+	return nil
+}
+
+func (w *recordingWatcherEx) UpdateForRemoveFilteredPolicy(sec, ptype string, fieldIndex int, fieldValues ...string) error {
+	w.calls = append(w.calls, fmt.Sprintf("RemoveFilteredPolicy %s %s %d %v", sec, ptype, fieldIndex, fieldValues))
+	return nil
+}
+
+func (w *recordingWatcherEx) UpdateForSavePolicy(model model.Model) error {
+	w.calls = append(w.calls, "SavePolicy")
+	return nil
+}
+
+func (w *recordingWatcherEx) UpdateForAddPolicies(sec string, ptype string, rules ...[]string) error {
+	w.calls = append(w.calls, fmt.Sprintf("AddPolicies %s %s %v", sec, ptype, rules))
+	return nil
+}
+
+func (w *recordingWatcherEx) UpdateForRemovePolicies(sec string, ptype string, rules ...[]string) error {
+	w.calls = append(w.calls, fmt.Sprintf("RemovePolicies %s %s %v", sec, ptype, rules))
+	return nil
+}
+
+func TestWatcherExCallbacks(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
+	e.EnableAutoSave(false)
+
+	w := &recordingWatcherEx{}
+	if err := e.SetWatcherEx(w); err != nil {
+		t.Fatal(err)
+	}
+
+	_, _ = e.AddPolicy("admin", "data1", "read")
+	_, _ = e.RemovePolicy("admin", "data1", "read")
+	_, _ = e.AddGroupingPolicy("bob", "admin")
+	_, _ = e.RemoveFilteredGroupingPolicy(0, "bob")
+	_, _ = e.AddPolicies([][]string{{"admin", "data1", "read"}, {"admin", "data2", "read"}})
+	_, _ = e.RemovePolicies([][]string{{"admin", "data1", "read"}})
+	// unchanged policies do not notify.
+	_, _ = e.AddPolicy("alice", "data1", "read")
+	_, _ = e.RemovePolicy("carol", "data1", "read")
+
+	expected := []string{
+		"AddPolicy p p [admin data1 read]",
+		"RemovePolicy p p [admin data1 read]",
+		"AddPolicy g g [bob admin]",
+		"RemoveFilteredPolicy g g 0 [bob]",
+		"AddPolicies p p [[admin data1 read] [admin data2 read]]",
+		"RemovePolicies p p [[admin data1 read]]",
+	}
+	if !reflect.DeepEqual(w.calls, expected) {
+		t.Errorf("watcher calls: %v, supposed to be %v", w.calls, expected)
+	}
+
+	e.EnableAutoNotifyWatcher(false)
+	_, _ = e.AddPolicy("admin", "data3", "read")
+	if len(w.calls) != len(expected) {
+		t.Errorf("watcher notified with auto-notify disabled: %v", w.calls[len(expected):])
+	}
+}